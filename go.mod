@@ -8,6 +8,10 @@ require gopkg.in/yaml.v3 v3.0.1
 
 require wmcplib v0.0.0
 
+require mai/src/mcps/lib v0.0.0
+
 replace mcplib => ./src/mcps/lib
 
 replace wmcplib => ./src/wmcp/lib
+
+replace mai/src/mcps/lib => ./src/mcps/lib
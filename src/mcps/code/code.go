@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -25,19 +26,40 @@ type CodeService struct {
 	langCache map[string]string
 	// Cache for build system identification
 	buildSystemCache map[string]string
+	// Policy deciding which commands are run
+	policy *mcplib.CommandPolicy
+	// Index of the Go packages used by the symbol tools
+	goIndex *goIndex
 }
 
 // NewCodeService creates a new CodeService instance
-func NewCodeService() *CodeService {
+func NewCodeService(policy *mcplib.CommandPolicy) *CodeService {
 	return &CodeService{
 		fileModTimes:     make(map[string]time.Time),
 		langCache:        make(map[string]string),
 		buildSystemCache: make(map[string]string),
+		policy:           policy,
+		goIndex:          newGoIndex(),
 	}
 }
 
 // GetTools returns all available code tools
 func (s *CodeService) GetTools() []mcplib.Tool {
+	applyPatch := mcplib.MustTypedTool("apply_patch", "Applies a patch to a file by replacing specific lines.", s.handleApplyPatch)
+	applyPatch.UsageExamples = "Example: {\"file_path\": \"/path/to/file.go\", \"start_line\": 10, \"end_line\": 15, \"new_content\": \"// New code here\"} - Replaces lines 10-15 with new content"
+	applyDiff := mcplib.MustTypedTool("apply_diff", "Applies a unified diff to one or more files, locating each hunk by its context so it still applies when lines have shifted. Supports file creation, deletion and renames. Nothing is written unless every hunk applies; rejected hunks are reported with candidate locations.", s.handleApplyDiff)
+	findDefinition := mcplib.MustTypedTool("find_definition", "Finds where a Go symbol is declared, with its kind, signature and doc comment. The symbol is given by name or by the line of one of its uses.", s.handleFindDefinition)
+	findDefinition.UsageExamples = "Example: {\"path\": \"/path/to/project/server.go\", \"symbol\": \"Server.Start\"} - Shows the declaration of the Start method of Server"
+	findReferences := mcplib.MustTypedTool("find_references", "Lists the uses of a Go symbol in the whole module, with the function containing each of them.", s.handleFindReferences)
+	findReferences.UsageExamples = "Example: {\"path\": \"/path/to/project/server.go\", \"line\": 42, \"symbol\": \"handle\"} - Lists the references to the handle identifier used on line 42"
+	callGraph := mcplib.MustTypedTool("call_graph", "Lists the callers and the callees of a Go function or method, following calls up to the given depth.", s.handleCallGraph)
+	callGraph.UsageExamples = "Example: {\"path\": \"/path/to/project\", \"symbol\": \"main\", \"direction\": \"callees\", \"depth\": 2} - Shows the functions called by main and the ones they call"
+	packageSummary := mcplib.MustTypedTool("package_summary", "Summarizes a Go package: documentation, files, imports and the declared symbols with their signatures.", s.handlePackageSummary)
+	packageSummary.UsageExamples = "Example: {\"path\": \"/path/to/project/internal/store\"} - Lists the exported API of the store package"
+	runTests := mcplib.MustTypedTool("run_tests", "Runs the tests of a project with go test, pytest, cargo test or jest, detected from its build system, and returns the result of each test with the output of the failed ones.", s.handleRunTests)
+	runTests.UsageExamples = "Example: {\"path\": \"/path/to/project\", \"filter\": \"TestParse\"} - Runs the tests whose name matches TestParse"
+	applyDiff.UsageExamples = "Example: {\"diff\": \"--- a/main.go\\n+++ b/main.go\\n@@ -10,3 +10,3 @@\\n func main() {\\n-\\tfmt.Println(\\\"hi\\\")\\n+\\tfmt.Println(\\\"hello\\\")\\n }\\n\", \"directory\": \"/path/to/repo\", \"dry_run\": true} - Checks that the hunk applies without modifying main.go"
+
 	return []mcplib.Tool{
 		// Search tool for finding text in files
 		{
@@ -419,7 +441,7 @@ func (s *CodeService) GetTools() []mcplib.Tool {
 				"required": []string{"path"},
 			},
 			UsageExamples: "Example: {\"path\": \"/path/to/project\"} - Compiles the project",
-			Handler:       s.handleCompile,
+			Handler:       withDiagnostics(s.handleCompile),
 		},
 
 		// 4. Run
@@ -445,7 +467,7 @@ func (s *CodeService) GetTools() []mcplib.Tool {
 				"required": []string{"path"},
 			},
 			UsageExamples: "Example: {\"path\": \"/path/to/project\", \"compile_first\": true} - Compiles and runs the project",
-			Handler:       s.handleRun,
+			Handler:       withDiagnostics(s.handleRun),
 		},
 
 		// 5. list_functions
@@ -515,34 +537,8 @@ func (s *CodeService) GetTools() []mcplib.Tool {
 		},
 
 		// 8. apply_patch
-		{
-			Name:        "apply_patch",
-			Description: "Applies a patch to a file by replacing specific lines.",
-			InputSchema: map[string]any{
-				"type": "object",
-				"properties": map[string]any{
-					"file_path": map[string]any{
-						"type":        "string",
-						"description": "Path to the file to patch.",
-					},
-					"start_line": map[string]any{
-						"type":        "integer",
-						"description": "The line number to start replacing from (1-based).",
-					},
-					"end_line": map[string]any{
-						"type":        "integer",
-						"description": "The line number to end replacing at (1-based, inclusive).",
-					},
-					"new_content": map[string]any{
-						"type":        "string",
-						"description": "The new content to replace the specified lines with.",
-					},
-				},
-				"required": []string{"file_path", "start_line", "end_line", "new_content"},
-			},
-			UsageExamples: "Example: {\"file_path\": \"/path/to/file.go\", \"start_line\": 10, \"end_line\": 15, \"new_content\": \"// New code here\"} - Replaces lines 10-15 with new content",
-			Handler:       s.handleApplyPatch,
-		},
+		applyPatch,
+		applyDiff,
 
 		// 9. query_structure
 		{
@@ -570,6 +566,14 @@ func (s *CodeService) GetTools() []mcplib.Tool {
 			Handler:       s.handleQueryStructure,
 		},
 
+		runTests,
+
+		// Go symbol index
+		findDefinition,
+		findReferences,
+		callGraph,
+		packageSummary,
+
 		// 10. Make
 		{
 			Name:        "Make",
@@ -589,7 +593,7 @@ func (s *CodeService) GetTools() []mcplib.Tool {
 				"required": []string{"directory"},
 			},
 			UsageExamples: "Example: {\"directory\": \"/path/to/project\", \"target\": \"test\"} - Runs 'make test' in the project directory",
-			Handler:       s.handleMakeCmd,
+			Handler:       withDiagnostics(s.handleMakeCmd),
 		},
 
 		// 3. SystemInformation - list_files
@@ -650,6 +654,9 @@ func (s *CodeService) handleExecuteCommand(args map[string]any) (any, error) {
 	if !ok || command == "" {
 		return nil, fmt.Errorf("command is required")
 	}
+	if refusal := s.policy.Check(command, ""); refusal != nil {
+		return refusal.ToolResult(), nil
+	}
 
 	// Default timeout is 60 seconds if not specified
 	timeout := 60
@@ -1801,6 +1808,11 @@ func (s *CodeService) listFunctionsInFile(filePath string) ([]map[string]any, er
 		return nil, fmt.Errorf("failed to identify language: %v", err)
 	}
 
+	// Go files are parsed, not matched with regexes
+	if lang == "Go" {
+		return s.goFunctions(filePath)
+	}
+
 	// Read file content
 	content, err := os.ReadFile(filePath)
 	if err != nil {
@@ -1988,8 +2000,7 @@ func (s *CodeService) findFunctionInDirectory(dirPath, functionName string, recu
 	var filePath string
 
 	for _, function := range functions {
-		name, _ := function["name"].(string)
-		if name == functionName {
+		if functionMatches(function, functionName) {
 			targetFunction = function
 			filePath = filepath.Join(dirPath, function["file_path"].(string))
 			break
@@ -2013,6 +2024,17 @@ func (s *CodeService) findFunctionInDirectory(dirPath, functionName string, recu
 	return targetFunction, nil
 }
 
+// functionMatches tells if a function is the one named name, which may
+// be qualified by the receiver type like Type.Method
+func functionMatches(function map[string]any, name string) bool {
+	fname, _ := function["name"].(string)
+	if fname == name {
+		return true
+	}
+	receiver, _ := function["receiver"].(string)
+	return receiver != "" && receiverBase(receiver)+"."+fname == name
+}
+
 // findFunctionInFile locates a function in a single file
 func (s *CodeService) findFunctionInFile(filePath, functionName string) (map[string]any, error) {
 	// List all functions in the file
@@ -2025,8 +2047,7 @@ func (s *CodeService) findFunctionInFile(filePath, functionName string) (map[str
 	var targetFunction map[string]any
 
 	for _, function := range functions {
-		name, _ := function["name"].(string)
-		if name == functionName {
+		if functionMatches(function, functionName) {
 			targetFunction = function
 			break
 		}
@@ -2064,6 +2085,11 @@ func (s *CodeService) extractFunctionBody(filePath string, functionInfo map[stri
 		return "", fmt.Errorf("invalid line number")
 	}
 
+	// Parsed functions know where they end
+	if endLine, ok := functionInfo["end_line"].(int); ok && endLine >= lineNum && endLine <= len(lines) {
+		return strings.Join(lines[lineNum-1:endLine], "\n"), nil
+	}
+
 	// Determine the language to know how to extract the function body
 	language, _ := functionInfo["language"].(string)
 
@@ -2354,14 +2380,21 @@ func (s *CodeService) queryStructuresInFile(filePath, structureName string) ([]m
 		return nil, fmt.Errorf("failed to identify language: %v", err)
 	}
 
-	// Read file content
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %v", err)
-	}
+	var structures []map[string]any
+	if lang == "Go" {
+		// Go files are parsed, not matched with regexes
+		structures, err = s.goStructures(filePath)
+	} else {
+		// Read file content
+		var content []byte
+		content, err = os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %v", err)
+		}
 
-	// Extract structures based on language
-	structures, err := s.extractStructures(string(content), lang, filePath)
+		// Extract structures based on language
+		structures, err = s.extractStructures(string(content), lang, filePath)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -2564,75 +2597,76 @@ func (s *CodeService) handleFileChangeCheck(args map[string]any) (any, error) {
 	return response, nil
 }
 
-// handleApplyPatch handles the apply_patch request
-func (s *CodeService) handleApplyPatch(args map[string]any) (any, error) {
-	filePath, ok := args["file_path"].(string)
-	if !ok || filePath == "" {
-		return nil, fmt.Errorf("file_path is required")
-	}
-
-	startLine, ok := args["start_line"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("start_line is required and must be a number")
-	}
+// applyPatchArgs are the arguments of apply_patch
+type applyPatchArgs struct {
+	FilePath   string `json:"file_path" description:"Path to the file to patch."`
+	StartLine  int    `json:"start_line" min:"1" description:"The line number to start replacing from (1-based)."`
+	EndLine    int    `json:"end_line" min:"1" description:"The line number to end replacing at (1-based, inclusive)."`
+	NewContent string `json:"new_content" description:"The new content to replace the specified lines with."`
+}
 
-	endLine, ok := args["end_line"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("end_line is required and must be a number")
-	}
+// applyPatchResult describes the patched file
+type applyPatchResult struct {
+	Success       bool   `json:"success"`
+	FilePath      string `json:"file_path"`
+	LinesReplaced int    `json:"lines_replaced"`
+	NewLinesCount int    `json:"new_lines_count"`
+	BackupFile    string `json:"backup_file"`
+}
 
-	newContent, ok := args["new_content"].(string)
-	if !ok {
-		return nil, fmt.Errorf("new_content is required")
+// handleApplyPatch handles the apply_patch request
+func (s *CodeService) handleApplyPatch(ctx context.Context, args applyPatchArgs) (applyPatchResult, error) {
+	filePath := args.FilePath
+	if filePath == "" {
+		return applyPatchResult{}, fmt.Errorf("file_path is required")
 	}
-
-	// Convert to int
-	startLineInt := int(startLine)
-	endLineInt := int(endLine)
+	startLine := args.StartLine
+	endLine := args.EndLine
+	newContent := args.NewContent
 
 	// Validate line numbers
-	if startLineInt <= 0 || endLineInt < startLineInt {
-		return nil, fmt.Errorf("invalid line numbers: start_line must be positive and end_line must be >= start_line")
+	if endLine < startLine {
+		return applyPatchResult{}, fmt.Errorf("invalid line numbers: end_line must be >= start_line")
 	}
 
 	// Check if the file exists
 	_, err := os.Stat(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to access file: %v", err)
+		return applyPatchResult{}, fmt.Errorf("failed to access file: %v", err)
 	}
 
 	// Read the file
 	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %v", err)
+		return applyPatchResult{}, fmt.Errorf("failed to read file: %v", err)
 	}
 
 	// Split into lines
 	lines := strings.Split(string(content), "\n")
 
 	// Check if line numbers are valid
-	if startLineInt > len(lines) {
-		return nil, fmt.Errorf("start_line %d exceeds file length of %d lines", startLineInt, len(lines))
+	if startLine > len(lines) {
+		return applyPatchResult{}, fmt.Errorf("start_line %d exceeds file length of %d lines", startLine, len(lines))
 	}
 
 	// Cap end_line to file length if it exceeds
-	if endLineInt > len(lines) {
-		endLineInt = len(lines)
+	if endLine > len(lines) {
+		endLine = len(lines)
 	}
 
 	// Create a backup of the file before modifying
 	backupFilePath := filePath + ".bak"
 	err = os.WriteFile(backupFilePath, content, 0644)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create backup file: %v", err)
+		return applyPatchResult{}, fmt.Errorf("failed to create backup file: %v", err)
 	}
 
 	// Apply the patch - replace the specified lines with the new content
 	newLines := strings.Split(newContent, "\n")
 
 	// Convert from 1-based to 0-based indexing
-	startIdx := startLineInt - 1
-	endIdx := endLineInt - 1
+	startIdx := startLine - 1
+	endIdx := endLine - 1
 
 	// Construct the new file content
 	resultLines := append(lines[:startIdx], newLines...)
@@ -2646,7 +2680,7 @@ func (s *CodeService) handleApplyPatch(args map[string]any) (any, error) {
 	// Write the result back to the file
 	err = os.WriteFile(filePath, []byte(resultContent), 0644)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write patched file: %v", err)
+		return applyPatchResult{}, fmt.Errorf("failed to write patched file: %v", err)
 	}
 
 	// Update the mod time in our cache
@@ -2654,12 +2688,12 @@ func (s *CodeService) handleApplyPatch(args map[string]any) (any, error) {
 		s.fileModTimes[filePath] = fileInfo.ModTime()
 	}
 
-	return map[string]any{
-		"success":         true,
-		"file_path":       filePath,
-		"lines_replaced":  endLineInt - startLineInt + 1,
-		"new_lines_count": len(newLines),
-		"backup_file":     backupFilePath,
+	return applyPatchResult{
+		Success:       true,
+		FilePath:      filePath,
+		LinesReplaced: endLine - startLine + 1,
+		NewLinesCount: len(newLines),
+		BackupFile:    backupFilePath,
 	}, nil
 }
 
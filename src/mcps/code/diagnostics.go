@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mcplib"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxDiagnostics bounds the diagnostics parsed from an output
+const maxDiagnostics = 200
+
+// diagnostic is an error or warning reported by a compiler, linter or
+// interpreter
+type diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity" description:"error, warning or note"`
+	Message  string `json:"message"`
+	Code     string `json:"code,omitempty" description:"Error code like E0308 or TS2322"`
+	Tool     string `json:"tool" description:"go, gcc, rustc, tsc or python"`
+}
+
+var (
+	// src/a.ts(12,5): error TS2322: message
+	tscDiagRe = regexp.MustCompile(`^(.+?)\((\d+),(\d+)\): (error|warning) (TS\d+): (.*)$`)
+	// src/a.ts:12:5 - error TS2322: message
+	tscPrettyDiagRe = regexp.MustCompile(`^(.+?):(\d+):(\d+) - (error|warning) (TS\d+): (.*)$`)
+	// main.c:3:5: error: message
+	gccDiagRe = regexp.MustCompile(`^(.+?):(\d+):(?:(\d+):)? (fatal error|error|warning|note): (.*)$`)
+	// ./main.go:3:5: message, go vet may prefix it with "vet: "
+	goDiagRe = regexp.MustCompile(`^(?:vet: )?(\S+\.go):(\d+)(?::(\d+))?: (.*)$`)
+	// error[E0425]: message, followed by --> src/main.rs:2:13
+	rustDiagRe    = regexp.MustCompile(`^(error|warning)(?:\[(\w+)\])?: (.*)$`)
+	rustSpanRe    = regexp.MustCompile(`^\s*--> (.+?):(\d+):(\d+)$`)
+	pythonFrameRe = regexp.MustCompile(`^\s*File "(.+?)", line (\d+)`)
+	// test_x.py:12: AssertionError, as printed by pytest
+	pythonDiagRe = regexp.MustCompile(`^(\S+\.py):(\d+): (.*)$`)
+)
+
+// rustMessage is a diagnostic of rustc --error-format=json, also found in
+// the compiler-message lines of cargo --message-format=json
+type rustMessage struct {
+	Message string `json:"message"`
+	Level   string `json:"level"`
+	Code    *struct {
+		Code string `json:"code"`
+	} `json:"code"`
+	Spans []struct {
+		FileName    string `json:"file_name"`
+		LineStart   int    `json:"line_start"`
+		ColumnStart int    `json:"column_start"`
+		IsPrimary   bool   `json:"is_primary"`
+	} `json:"spans"`
+}
+
+// parseDiagnostics extracts the errors and warnings from the output of
+// go build and go vet, gcc and clang, rustc and cargo (human or JSON), tsc
+// and Python tracebacks
+func parseDiagnostics(output string) []diagnostic {
+	diags := []diagnostic{}
+	seen := make(map[string]bool)
+	add := func(d diagnostic) {
+		d.Message = strings.TrimSpace(d.Message)
+		key := fmt.Sprintf("%s:%d:%d:%s", d.File, d.Line, d.Column, d.Message)
+		if d.File == "" || seen[key] || len(diags) >= maxDiagnostics {
+			return
+		}
+		seen[key] = true
+		diags = append(diags, d)
+	}
+	atoi := func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "{") {
+			if d, ok := parseRustJSON(line); ok {
+				add(d)
+			}
+			continue
+		}
+		if m := tscDiagRe.FindStringSubmatch(line); m != nil {
+			add(diagnostic{File: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Severity: m[4], Code: m[5], Message: m[6], Tool: "tsc"})
+			continue
+		}
+		if m := tscPrettyDiagRe.FindStringSubmatch(line); m != nil {
+			add(diagnostic{File: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Severity: m[4], Code: m[5], Message: m[6], Tool: "tsc"})
+			continue
+		}
+		if m := gccDiagRe.FindStringSubmatch(line); m != nil && !strings.HasPrefix(line, " ") {
+			severity := m[4]
+			if severity == "fatal error" {
+				severity = "error"
+			}
+			add(diagnostic{File: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Severity: severity, Message: m[5], Tool: "gcc"})
+			continue
+		}
+		if m := goDiagRe.FindStringSubmatch(line); m != nil {
+			add(diagnostic{File: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Severity: "error", Message: m[4], Tool: "go"})
+			continue
+		}
+		if m := rustDiagRe.FindStringSubmatch(line); m != nil {
+			// The location follows the message, after the notes of
+			// multi-line messages
+			for j := i + 1; j < len(lines) && j <= i+5; j++ {
+				if span := rustSpanRe.FindStringSubmatch(lines[j]); span != nil {
+					add(diagnostic{File: span[1], Line: atoi(span[2]), Column: atoi(span[3]), Severity: m[1], Code: m[2], Message: m[3], Tool: "rustc"})
+					i = j
+					break
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "Traceback (most recent call last):") || pythonFrameRe.MatchString(line) {
+			if d, end, ok := parsePythonTraceback(lines, i); ok {
+				add(d)
+				i = end
+			}
+			continue
+		}
+		if m := pythonDiagRe.FindStringSubmatch(line); m != nil {
+			add(diagnostic{File: m[1], Line: atoi(m[2]), Severity: "error", Message: m[3], Tool: "python"})
+		}
+	}
+	return diags
+}
+
+// parseRustJSON reads a JSON line of rustc or cargo
+func parseRustJSON(line string) (diagnostic, bool) {
+	// The message is a string for rustc and an object for cargo
+	var cargo struct {
+		Reason  string          `json:"reason"`
+		Message json.RawMessage `json:"message"`
+	}
+	var m rustMessage
+	if json.Unmarshal([]byte(line), &cargo) == nil && cargo.Reason == "compiler-message" {
+		if json.Unmarshal(cargo.Message, &m) != nil {
+			return diagnostic{}, false
+		}
+	} else if json.Unmarshal([]byte(line), &m) != nil || m.Level == "" {
+		return diagnostic{}, false
+	}
+	d := diagnostic{Severity: m.Level, Message: m.Message, Tool: "rustc"}
+	if strings.HasPrefix(d.Severity, "error") {
+		// Also "error: internal compiler error"
+		d.Severity = "error"
+	}
+	if m.Code != nil {
+		d.Code = m.Code.Code
+	}
+	for _, span := range m.Spans {
+		if span.IsPrimary || d.File == "" {
+			d.File, d.Line, d.Column = span.FileName, span.LineStart, span.ColumnStart
+		}
+	}
+	return d, d.File != ""
+}
+
+// parsePythonTraceback reads the traceback starting at lines[i] and returns
+// the exception located at its innermost frame, with the index of the
+// exception line
+func parsePythonTraceback(lines []string, i int) (diagnostic, int, bool) {
+	var d diagnostic
+	for j := i; j < len(lines); j++ {
+		line := lines[j]
+		if m := pythonFrameRe.FindStringSubmatch(line); m != nil {
+			d.File = m[1]
+			d.Line, _ = strconv.Atoi(m[2])
+			continue
+		}
+		if j == i || line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			// Header, source lines and carets
+			continue
+		}
+		if d.File == "" {
+			return d, j, false
+		}
+		d.Severity, d.Message, d.Tool = "error", line, "python"
+		return d, j, true
+	}
+	return d, len(lines) - 1, false
+}
+
+// buildResult returns the result of a build or of a run with the
+// diagnostics found in its output, as structured content
+func buildResult(result map[string]any) mcplib.ToolCallResult {
+	output, _ := result["output"].(string)
+	diags := parseDiagnostics(output)
+	result["diagnostics"] = diags
+	errors, warnings := 0, 0
+	for _, d := range diags {
+		switch d.Severity {
+		case "error":
+			errors++
+		case "warning":
+			warnings++
+		}
+	}
+	result["error_count"] = errors
+	result["warning_count"] = warnings
+
+	text := fmt.Sprintf("%v", result)
+	if b, err := json.MarshalIndent(result, "", "  "); err == nil {
+		text = string(b)
+	}
+	return mcplib.ToolCallResult{
+		Content:           []any{map[string]any{"type": "text", "text": text}},
+		StructuredContent: result,
+	}
+}
+
+// withDiagnostics wraps the handler of a build or run tool so its result
+// carries the diagnostics of its output
+func withDiagnostics(handler mcplib.ToolHandler) mcplib.ToolHandler {
+	return func(args map[string]any) (any, error) {
+		result, err := handler(args)
+		if m, ok := result.(map[string]any); ok && err == nil {
+			return buildResult(m), nil
+		}
+		return result, err
+	}
+}
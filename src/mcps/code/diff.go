@@ -0,0 +1,676 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// applyDiffArgs holds the arguments of the apply_diff tool
+type applyDiffArgs struct {
+	Diff             string `json:"diff" description:"Unified diff to apply, as produced by diff -u or git diff. It may patch several files."`
+	Directory        string `json:"directory,omitempty" description:"Directory the paths in the diff are relative to. If not provided, uses the current working directory."`
+	Strip            *int   `json:"strip,omitempty" min:"0" description:"Number of leading path components to remove, like patch -p. Detected from the a/ and b/ prefixes if not provided."`
+	Fuzz             int    `json:"fuzz" min:"0" max:"3" default:"2" description:"Maximum number of context lines that may be ignored at the start and at the end of a hunk."`
+	IgnoreWhitespace bool   `json:"ignore_whitespace,omitempty" description:"Match lines ignoring differences in whitespace."`
+	DryRun           bool   `json:"dry_run,omitempty" description:"Only report which hunks would apply, without modifying any file."`
+}
+
+// applyDiffResult describes the outcome of applying a diff
+type applyDiffResult struct {
+	Success bool             `json:"success"`
+	DryRun  bool             `json:"dry_run"`
+	Applied int              `json:"hunks_applied"`
+	Failed  int              `json:"hunks_rejected"`
+	Files   []diffFileResult `json:"files"`
+	Message string           `json:"message,omitempty"`
+}
+
+// diffFileResult describes the outcome for one file of the diff
+type diffFileResult struct {
+	Path    string           `json:"path"`
+	OldPath string           `json:"old_path,omitempty"`
+	Action  string           `json:"action" description:"modify, create, delete or rename"`
+	Error   string           `json:"error,omitempty"`
+	Hunks   []diffHunkResult `json:"hunks"`
+}
+
+// diffHunkResult tells where a hunk applied, or why it was rejected
+type diffHunkResult struct {
+	Index      int                 `json:"index"`
+	Header     string              `json:"header"`
+	Applied    bool                `json:"applied"`
+	Line       int                 `json:"line,omitempty" description:"First line of the original file matched by the hunk"`
+	Offset     int                 `json:"offset,omitempty" description:"Lines between the matched position and the one in the hunk header"`
+	Fuzz       int                 `json:"fuzz,omitempty" description:"Context lines ignored to find a match"`
+	Whitespace bool                `json:"whitespace_ignored,omitempty"`
+	Reason     string              `json:"reason,omitempty"`
+	Candidates []diffHunkCandidate `json:"candidates,omitempty"`
+}
+
+// diffHunkCandidate is a location resembling the context of a rejected hunk
+type diffHunkCandidate struct {
+	Line       int     `json:"line"`
+	Similarity float64 `json:"similarity"`
+	Preview    string  `json:"preview"`
+}
+
+// diffFile is a file section of a unified diff
+type diffFile struct {
+	oldPath string // Empty for created files
+	newPath string // Empty for deleted files
+	binary  bool
+	hunks   []diffHunk
+}
+
+// diffHunk is a @@ section of a diff
+type diffHunk struct {
+	header   string
+	oldStart int // 1-based, 0 if unknown
+	lines    []diffLine
+	newNoEOL bool // The new text has no newline at the end
+}
+
+// diffLine is a line of a hunk, its kind is ' ', '-' or '+'
+type diffLine struct {
+	kind byte
+	text string
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// parseUnifiedDiff splits a unified diff into files and hunks. Line counts
+// of hunk headers are not trusted, hunks end at the first line that is not
+// part of one.
+func parseUnifiedDiff(diff string) ([]diffFile, error) {
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+	var files []diffFile
+	var cur *diffFile
+	startFile := func() {
+		files = append(files, diffFile{})
+		cur = &files[len(files)-1]
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			startFile()
+			if a, b, ok := splitGitPaths(strings.TrimPrefix(line, "diff --git ")); ok {
+				cur.oldPath, cur.newPath = a, b
+			}
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if cur == nil || len(cur.hunks) > 0 || cur.binary {
+				startFile()
+			}
+			cur.oldPath = diffHeaderPath(line[4:])
+			cur.newPath = diffHeaderPath(lines[i+1][4:])
+			i++
+		case cur == nil:
+			// Text before the first file
+		case strings.HasPrefix(line, "new file mode"):
+			cur.oldPath = ""
+		case strings.HasPrefix(line, "deleted file mode"):
+			cur.newPath = ""
+		case strings.HasPrefix(line, "rename from "):
+			cur.oldPath = withGitPrefix(cur.oldPath, "a/", strings.TrimPrefix(line, "rename from "))
+		case strings.HasPrefix(line, "rename to "):
+			cur.newPath = withGitPrefix(cur.newPath, "b/", strings.TrimPrefix(line, "rename to "))
+		case strings.HasPrefix(line, "GIT binary patch"), strings.HasPrefix(line, "Binary files "):
+			cur.binary = true
+		case strings.HasPrefix(line, "@@"):
+			hunk := diffHunk{header: line}
+			if m := hunkHeaderRe.FindStringSubmatch(line); m != nil {
+				hunk.oldStart, _ = strconv.Atoi(m[1])
+			}
+			i = parseHunkLines(lines, i+1, &hunk) - 1
+			if len(hunk.lines) == 0 {
+				return nil, fmt.Errorf("empty hunk %q", line)
+			}
+			cur.hunks = append(cur.hunks, hunk)
+		}
+	}
+	var result []diffFile
+	for _, f := range files {
+		if f.oldPath == "" && f.newPath == "" {
+			continue
+		}
+		result = append(result, f)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no file headers found in the diff")
+	}
+	return result, nil
+}
+
+// parseHunkLines reads the lines of a hunk starting at lines[i] and returns
+// the index of the first line after it
+func parseHunkLines(lines []string, i int, hunk *diffHunk) int {
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			// Blank context lines often lose their leading space, keep
+			// them unless they end the hunk
+			j := i
+			for j < len(lines) && lines[j] == "" {
+				j++
+			}
+			if j == len(lines) || !isHunkLine(lines, j) {
+				return j
+			}
+			hunk.lines = append(hunk.lines, diffLine{kind: ' '})
+			continue
+		}
+		if !isHunkLine(lines, i) {
+			return i
+		}
+		if line[0] == '\\' {
+			if n := len(hunk.lines); n > 0 && hunk.lines[n-1].kind != '-' {
+				hunk.newNoEOL = true
+			}
+			continue
+		}
+		hunk.lines = append(hunk.lines, diffLine{kind: line[0], text: line[1:]})
+	}
+	return i
+}
+
+// isHunkLine tells if lines[i] continues a hunk rather than starting a
+// new file or hunk
+func isHunkLine(lines []string, i int) bool {
+	line := lines[i]
+	switch line[0] {
+	case ' ', '+', '\\':
+		return true
+	case '-':
+		return !(strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "))
+	}
+	return false
+}
+
+// diffHeaderPath returns the path of a ---/+++ header, empty for /dev/null
+func diffHeaderPath(s string) string {
+	if tab := strings.IndexByte(s, '\t'); tab != -1 {
+		s = s[:tab]
+	}
+	s = strings.TrimSpace(s)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	if s == "/dev/null" {
+		return ""
+	}
+	return s
+}
+
+// splitGitPaths splits the "a/x b/x" part of a diff --git line
+func splitGitPaths(s string) (string, string, bool) {
+	if idx := strings.Index(s, " b/"); idx != -1 {
+		return s[:idx], s[idx+1:], true
+	}
+	parts := strings.Fields(s)
+	if len(parts) == 2 {
+		return parts[0], parts[1], true
+	}
+	return "", "", false
+}
+
+// withGitPrefix returns the path of a rename line, which has no prefix,
+// with the prefix of the diff --git line so that it is stripped alike
+func withGitPrefix(gitPath, prefix, path string) string {
+	if strings.HasPrefix(gitPath, prefix) {
+		return prefix + path
+	}
+	return path
+}
+
+// stripPath removes n leading components from a diff path
+func stripPath(p string, n int) string {
+	for ; n > 0; n-- {
+		idx := strings.IndexByte(p, '/')
+		if idx == -1 {
+			break
+		}
+		p = p[idx+1:]
+	}
+	return p
+}
+
+// detectStrip returns 1 when the paths use the a/ and b/ prefixes of git
+func detectStrip(files []diffFile) int {
+	for _, f := range files {
+		if (f.oldPath != "" && !strings.HasPrefix(f.oldPath, "a/")) || (f.newPath != "" && !strings.HasPrefix(f.newPath, "b/")) {
+			return 0
+		}
+	}
+	return 1
+}
+
+// fileText is the content of a file split into lines
+type fileText struct {
+	lines    []string
+	finalEOL bool
+	perm     os.FileMode
+}
+
+func splitFileText(content string) fileText {
+	t := fileText{finalEOL: true}
+	if content == "" {
+		return t
+	}
+	t.finalEOL = strings.HasSuffix(content, "\n")
+	t.lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	return t
+}
+
+func (t fileText) String() string {
+	if len(t.lines) == 0 {
+		return ""
+	}
+	s := strings.Join(t.lines, "\n")
+	if t.finalEOL {
+		s += "\n"
+	}
+	return s
+}
+
+// hunkMatch is the place where a hunk applies in the original lines
+type hunkMatch struct {
+	start, end int // Range of the original lines replaced
+	lead, tail int // Context lines ignored at each side
+	whitespace bool
+}
+
+// oldLines returns the lines of the hunk expected in the original file,
+// without the first lead and last tail ones
+func (h diffHunk) oldLines(lead, tail int) []string {
+	var old []string
+	for _, l := range h.lines[lead : len(h.lines)-tail] {
+		if l.kind != '+' {
+			old = append(old, l.text)
+		}
+	}
+	return old
+}
+
+// reversed returns the hunk undoing h
+func (h diffHunk) reversed() diffHunk {
+	r := h
+	r.lines = make([]diffLine, len(h.lines))
+	for i, l := range h.lines {
+		switch l.kind {
+		case '-':
+			l.kind = '+'
+		case '+':
+			l.kind = '-'
+		}
+		r.lines[i] = l
+	}
+	return r
+}
+
+// contextLines counts the context lines at the start and at the end
+func (h diffHunk) contextLines() (int, int) {
+	lead, tail := 0, 0
+	for lead < len(h.lines) && h.lines[lead].kind == ' ' {
+		lead++
+	}
+	if lead == len(h.lines) {
+		return lead, 0
+	}
+	for tail < len(h.lines) && h.lines[len(h.lines)-1-tail].kind == ' ' {
+		tail++
+	}
+	return lead, tail
+}
+
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func linesEqual(a []string, b []string, ignoreSpace bool) bool {
+	for i := range b {
+		if a[i] != b[i] && (!ignoreSpace || normalizeSpace(a[i]) != normalizeSpace(b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// findHunk searches the lines of the hunk in the file at or after from,
+// nearest to the expected position first, trying larger fuzz only when
+// smaller fails
+func findHunk(lines []string, h diffHunk, expected, from, fuzz int, ignoreSpace bool) (hunkMatch, bool) {
+	leadCtx, tailCtx := h.contextLines()
+	for f := 0; f <= fuzz; f++ {
+		lead, tail := f, f
+		if lead > leadCtx {
+			lead = leadCtx
+		}
+		if tail > tailCtx {
+			tail = tailCtx
+		}
+		if f > 0 && lead < f && tail < f {
+			// Nothing more to ignore
+			break
+		}
+		old := h.oldLines(lead, tail)
+		if len(old) == 0 {
+			if len(h.oldLines(0, 0)) > 0 {
+				// Never ignore the whole context
+				break
+			}
+			pos := expected + lead
+			if pos < from {
+				pos = from
+			}
+			if pos > len(lines) {
+				pos = len(lines)
+			}
+			return hunkMatch{start: pos, end: pos, lead: lead, tail: tail}, true
+		}
+		for _, ws := range []bool{false, true} {
+			if ws && !ignoreSpace {
+				continue
+			}
+			best := -1
+			for pos := from; pos+len(old) <= len(lines); pos++ {
+				if best != -1 && abs(pos-expected-lead) >= abs(best-expected-lead) {
+					break
+				}
+				if linesEqual(lines[pos:pos+len(old)], old, ws) {
+					best = pos
+				}
+			}
+			if best != -1 {
+				return hunkMatch{start: best, end: best + len(old), lead: lead, tail: tail, whitespace: ws}, true
+			}
+		}
+	}
+	return hunkMatch{}, false
+}
+
+// hunkCandidates returns the locations whose lines best resemble the
+// original lines of a rejected hunk
+func hunkCandidates(lines []string, h diffHunk, expected int) []diffHunkCandidate {
+	old := h.oldLines(0, 0)
+	if len(old) == 0 || len(lines) == 0 {
+		return nil
+	}
+	normOld := make([]string, len(old))
+	for i, l := range old {
+		normOld[i] = normalizeSpace(l)
+	}
+	normLines := make([]string, len(lines))
+	for i, l := range lines {
+		normLines[i] = normalizeSpace(l)
+	}
+	type scored struct {
+		pos     int
+		matches int
+	}
+	var all []scored
+	for pos := 0; pos < len(lines); pos++ {
+		matches := 0
+		for i := range normOld {
+			if pos+i < len(lines) && normLines[pos+i] == normOld[i] && normOld[i] != "" {
+				matches++
+			}
+		}
+		if matches > 0 {
+			all = append(all, scored{pos, matches})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].matches != all[j].matches {
+			return all[i].matches > all[j].matches
+		}
+		return abs(all[i].pos-expected) < abs(all[j].pos-expected)
+	})
+	var candidates []diffHunkCandidate
+	for _, c := range all {
+		if len(candidates) == 3 {
+			break
+		}
+		end := c.pos + 3
+		if end > len(lines) {
+			end = len(lines)
+		}
+		candidates = append(candidates, diffHunkCandidate{
+			Line:       c.pos + 1,
+			Similarity: math.Round(float64(c.matches)/float64(len(old))*100) / 100,
+			Preview:    strings.Join(lines[c.pos:end], "\n"),
+		})
+	}
+	return candidates
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// applyHunks applies the hunks of a file to its text, reporting the result
+// of each hunk. The text is only valid when every hunk applied.
+func applyHunks(text fileText, hunks []diffHunk, fuzz int, ignoreSpace bool) (fileText, []diffHunkResult, bool) {
+	results := make([]diffHunkResult, len(hunks))
+	matches := make([]hunkMatch, len(hunks))
+	ok := true
+	from, delta := 0, 0
+	for i, h := range hunks {
+		res := diffHunkResult{Index: i + 1, Header: h.header}
+		expected := from
+		if h.oldStart > 0 {
+			expected = h.oldStart - 1 + delta
+			if oldLen := len(h.oldLines(0, 0)); oldLen == 0 {
+				// -N,0 inserts after line N
+				expected = h.oldStart + delta
+			}
+		}
+		m, found := findHunk(text.lines, h, expected, from, fuzz, ignoreSpace)
+		if !found {
+			res.Reason = "context not found"
+			if h.oldStart > 0 && expected > len(text.lines) {
+				res.Reason = fmt.Sprintf("context not found, the file only has %d lines", len(text.lines))
+			}
+			if _, applied := findHunk(text.lines, h.reversed(), expected, 0, fuzz, ignoreSpace); applied {
+				res.Reason = "the changes of the hunk seem to be already applied"
+			}
+			res.Candidates = hunkCandidates(text.lines, h, expected)
+			results[i] = res
+			ok = false
+			continue
+		}
+		res.Applied = true
+		res.Line = m.start + 1
+		res.Fuzz = m.lead
+		if m.tail > res.Fuzz {
+			res.Fuzz = m.tail
+		}
+		res.Whitespace = m.whitespace
+		if h.oldStart > 0 {
+			res.Offset = m.start - (expected + m.lead)
+			delta += res.Offset
+		}
+		results[i] = res
+		matches[i] = m
+		from = m.end
+	}
+	if !ok {
+		return text, results, false
+	}
+
+	var out []string
+	pos := 0
+	finalEOL := text.finalEOL
+	for i, h := range hunks {
+		m := matches[i]
+		out = append(out, text.lines[pos:m.start]...)
+		orig := m.start
+		for _, l := range h.lines[m.lead : len(h.lines)-m.tail] {
+			switch l.kind {
+			case ' ':
+				// Keep the line of the file, it may differ in whitespace
+				out = append(out, text.lines[orig])
+				orig++
+			case '-':
+				orig++
+			case '+':
+				out = append(out, l.text)
+			}
+		}
+		pos = m.end
+		if m.end == len(text.lines) && m.tail == 0 {
+			finalEOL = !h.newNoEOL
+		}
+	}
+	out = append(out, text.lines[pos:]...)
+	return fileText{lines: out, finalEOL: finalEOL, perm: text.perm}, results, true
+}
+
+// pendingWrite is a change to the filesystem prepared by apply_diff
+type pendingWrite struct {
+	path    string
+	content string
+	perm    os.FileMode
+	remove  string // File removed after writing, for deletions and renames
+}
+
+// handleApplyDiff handles the apply_diff request
+func (s *CodeService) handleApplyDiff(ctx context.Context, args applyDiffArgs) (applyDiffResult, error) {
+	if strings.TrimSpace(args.Diff) == "" {
+		return applyDiffResult{}, fmt.Errorf("diff is required")
+	}
+	files, err := parseUnifiedDiff(args.Diff)
+	if err != nil {
+		return applyDiffResult{}, fmt.Errorf("failed to parse diff: %v", err)
+	}
+	dir := args.Directory
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return applyDiffResult{}, fmt.Errorf("failed to get current directory: %v", err)
+		}
+	}
+	strip := detectStrip(files)
+	if args.Strip != nil {
+		strip = *args.Strip
+	}
+	resolve := func(p string) string {
+		if p == "" {
+			return ""
+		}
+		if filepath.IsAbs(p) {
+			return filepath.Clean(p)
+		}
+		return filepath.Join(dir, stripPath(p, strip))
+	}
+
+	result := applyDiffResult{DryRun: args.DryRun, Files: []diffFileResult{}}
+	var writes []pendingWrite
+	for _, f := range files {
+		oldPath, newPath := resolve(f.oldPath), resolve(f.newPath)
+		fr := diffFileResult{Path: newPath, Hunks: []diffHunkResult{}}
+		switch {
+		case oldPath == "":
+			fr.Action = "create"
+		case newPath == "":
+			fr.Action, fr.Path = "delete", oldPath
+		case oldPath != newPath:
+			fr.Action, fr.OldPath = "rename", oldPath
+		default:
+			fr.Action = "modify"
+		}
+
+		text := fileText{finalEOL: true, perm: 0644}
+		if f.binary {
+			fr.Error = "binary patches are not supported"
+		} else if fr.Action == "create" {
+			if _, err := os.Stat(newPath); err == nil {
+				fr.Error = "file already exists"
+			}
+		} else if content, err := os.ReadFile(oldPath); err != nil {
+			fr.Error = fmt.Sprintf("failed to read file: %v", err)
+		} else {
+			text = splitFileText(string(content))
+			if info, err := os.Stat(oldPath); err == nil {
+				text.perm = info.Mode().Perm()
+			}
+			if fr.Action == "rename" {
+				if _, err := os.Stat(newPath); err == nil {
+					fr.Error = "rename target already exists"
+				}
+			}
+		}
+		if fr.Error != "" {
+			result.Failed += len(f.hunks)
+			result.Files = append(result.Files, fr)
+			continue
+		}
+
+		newText, hunks, ok := applyHunks(text, f.hunks, args.Fuzz, args.IgnoreWhitespace)
+		fr.Hunks = hunks
+		for _, h := range hunks {
+			if h.Applied {
+				result.Applied++
+			} else {
+				result.Failed++
+			}
+		}
+		if ok && fr.Action == "delete" && len(newText.lines) > 0 {
+			fr.Error = fmt.Sprintf("the file still has %d lines after removing the content of the diff", len(newText.lines))
+			result.Failed++
+		}
+		result.Files = append(result.Files, fr)
+		if !ok || fr.Error != "" {
+			continue
+		}
+		switch fr.Action {
+		case "delete":
+			writes = append(writes, pendingWrite{remove: oldPath})
+		case "rename":
+			writes = append(writes, pendingWrite{path: newPath, content: newText.String(), perm: text.perm, remove: oldPath})
+		default:
+			writes = append(writes, pendingWrite{path: newPath, content: newText.String(), perm: text.perm})
+		}
+	}
+
+	result.Success = result.Failed == 0
+	if !result.Success {
+		result.Message = fmt.Sprintf("%d hunks rejected, no files were modified", result.Failed)
+		return result, nil
+	}
+	if args.DryRun {
+		result.Message = fmt.Sprintf("all %d hunks would apply", result.Applied)
+		return result, nil
+	}
+
+	// Every hunk applies, write the files
+	for _, w := range writes {
+		if w.path != "" {
+			if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+				return result, fmt.Errorf("failed to create directory for %s: %v", w.path, err)
+			}
+			if err := os.WriteFile(w.path, []byte(w.content), w.perm); err != nil {
+				return result, fmt.Errorf("failed to write %s: %v", w.path, err)
+			}
+			if fileInfo, err := os.Stat(w.path); err == nil {
+				s.fileModTimes[w.path] = fileInfo.ModTime()
+			}
+		}
+		if w.remove != "" {
+			if err := os.Remove(w.remove); err != nil {
+				return result, fmt.Errorf("failed to remove %s: %v", w.remove, err)
+			}
+			delete(s.fileModTimes, w.remove)
+		}
+	}
+	result.Message = fmt.Sprintf("applied %d hunks to %d files", result.Applied, len(writes))
+	return result, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestApplyDiffRenameAndModify applies a git patch renaming a file and
+// modifying another one. The paths of the pure rename only come from the
+// rename lines, which carry no a/ and b/ prefixes.
+func TestApplyDiffRenameAndModify(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"pkg/old.go":  "package pkg\n\nfunc Old() {}\n",
+		"pkg/main.go": "package pkg\n\nvar x = 1\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	diff := `diff --git a/pkg/old.go b/pkg/new.go
+similarity index 100%
+rename from pkg/old.go
+rename to pkg/new.go
+diff --git a/pkg/main.go b/pkg/main.go
+index 3333333..4444444 100644
+--- a/pkg/main.go
++++ b/pkg/main.go
+@@ -1,3 +1,3 @@
+ package pkg
+ 
+-var x = 1
++var x = 2
+`
+	files, err := parseUnifiedDiff(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strip := detectStrip(files); strip != 1 {
+		t.Fatalf("detectStrip = %d, want 1", strip)
+	}
+
+	s := NewCodeService(nil)
+	result, err := s.handleApplyDiff(context.Background(), applyDiffArgs{Diff: diff, Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success {
+		t.Fatalf("diff rejected: %+v", result)
+	}
+	for name, want := range map[string]string{
+		"pkg/new.go":  "package pkg\n\nfunc Old() {}\n",
+		"pkg/main.go": "package pkg\n\nvar x = 2\n",
+	} {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Errorf("%s = %q, want %q", name, content, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pkg/old.go")); !os.IsNotExist(err) {
+		t.Errorf("pkg/old.go was not removed")
+	}
+}
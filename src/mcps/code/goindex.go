@@ -0,0 +1,1133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxIndexedPackages bounds the packages loaded to search a module
+const maxIndexedPackages = 500
+
+// goIndex caches parsed and type-checked Go packages by directory. A
+// package is reloaded when one of its files, its directory or one of the
+// module packages it imports changes. Packages of the module import each
+// other from the cache, so their objects can be compared across packages.
+type goIndex struct {
+	mu   sync.Mutex
+	fset *token.FileSet
+	// std imports the packages of the standard library from source
+	std  types.ImporterFrom
+	pkgs map[string]*goPackage
+	// dirs caches the directories of the imports found with go list
+	dirs map[string]string
+}
+
+// goPackage is an indexed Go package, test files are not included
+type goPackage struct {
+	dir        string
+	name       string
+	importPath string
+	modRoot    string
+	modPath    string
+	dirTime    time.Time
+	mtimes     map[string]time.Time
+	files      []*ast.File
+	types      *types.Package
+	info       *types.Info
+	deps       []*goPackage
+	errors     []string
+}
+
+// goSymbol is a top-level declaration of a Go file
+type goSymbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind" description:"func, method, struct, interface, type, alias, var or const"`
+	Receiver  string `json:"receiver,omitempty"`
+	Signature string `json:"signature"`
+	Doc       string `json:"doc,omitempty"`
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	EndLine   int    `json:"end_line"`
+	Exported  bool   `json:"exported"`
+}
+
+func newGoIndex() *goIndex {
+	fset := token.NewFileSet()
+	return &goIndex{
+		fset: fset,
+		std:  importer.ForCompiler(fset, "source", nil).(types.ImporterFrom),
+		pkgs: make(map[string]*goPackage),
+		dirs: make(map[string]string),
+	}
+}
+
+// load returns the package in dir, type-checking it if needed
+func (x *goIndex) load(dir string) (*goPackage, error) {
+	return x.loadPackage(dir, make(map[string]bool))
+}
+
+func (x *goIndex) loadPackage(dir string, loading map[string]bool) (*goPackage, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if pkg, ok := x.pkgs[dir]; ok && x.fresh(pkg, make(map[*goPackage]bool)) {
+		return pkg, nil
+	}
+	if loading[dir] {
+		return nil, fmt.Errorf("import cycle through %s", dir)
+	}
+	loading[dir] = true
+	defer delete(loading, dir)
+
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &goPackage{
+		dir:     dir,
+		name:    bp.Name,
+		dirTime: dirInfo.ModTime(),
+		mtimes:  make(map[string]time.Time),
+	}
+	pkg.modRoot, pkg.modPath = findGoModule(dir)
+	pkg.importPath = bp.ImportPath
+	if pkg.modPath != "" {
+		rel, _ := filepath.Rel(pkg.modRoot, dir)
+		pkg.importPath = strings.TrimSuffix(pkg.modPath+"/"+filepath.ToSlash(rel), "/.")
+	}
+	for _, name := range append(append([]string{}, bp.GoFiles...), bp.CgoFiles...) {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(x.fset, path, nil, parser.ParseComments)
+		if f == nil {
+			return nil, err
+		}
+		if err != nil {
+			// Keep the partial syntax tree
+			pkg.errors = append(pkg.errors, err.Error())
+		}
+		pkg.mtimes[path] = info.ModTime()
+		pkg.files = append(pkg.files, f)
+	}
+
+	conf := types.Config{
+		Importer:    &goIndexImporter{index: x, pkg: pkg, loading: loading},
+		FakeImportC: true,
+		Error: func(err error) {
+			if len(pkg.errors) < 20 {
+				pkg.errors = append(pkg.errors, err.Error())
+			}
+		},
+	}
+	pkg.info = &types.Info{
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+	}
+	// Errors are collected above, the partial information is still useful
+	pkg.types, _ = conf.Check(pkg.importPath, x.fset, pkg.files, pkg.info)
+	x.pkgs[dir] = pkg
+	return pkg, nil
+}
+
+// fresh tells if the files of the package and of its module dependencies
+// did not change since it was loaded
+func (x *goIndex) fresh(pkg *goPackage, seen map[*goPackage]bool) bool {
+	if seen[pkg] {
+		return true
+	}
+	seen[pkg] = true
+	if x.pkgs[pkg.dir] != pkg {
+		return false
+	}
+	if info, err := os.Stat(pkg.dir); err != nil || !info.ModTime().Equal(pkg.dirTime) {
+		return false
+	}
+	for path, mtime := range pkg.mtimes {
+		if info, err := os.Stat(path); err != nil || !info.ModTime().Equal(mtime) {
+			return false
+		}
+	}
+	for _, dep := range pkg.deps {
+		if !x.fresh(dep, seen) {
+			return false
+		}
+	}
+	return true
+}
+
+// goIndexImporter imports the packages outside of the standard library
+// from the index
+type goIndexImporter struct {
+	index   *goIndex
+	pkg     *goPackage
+	loading map[string]bool
+}
+
+func (imp *goIndexImporter) Import(path string) (*types.Package, error) {
+	return imp.ImportFrom(path, imp.pkg.dir, 0)
+}
+
+func (imp *goIndexImporter) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if isStdPackage(path) {
+		return imp.index.std.ImportFrom(path, dir, mode)
+	}
+	depDir, err := imp.index.packageDir(imp.pkg, path)
+	if err != nil {
+		return nil, err
+	}
+	dep, err := imp.index.loadPackage(depDir, imp.loading)
+	if err != nil {
+		return nil, err
+	}
+	imp.pkg.deps = append(imp.pkg.deps, dep)
+	return dep.types, nil
+}
+
+// isStdPackage tells if an import path belongs to the standard library
+func isStdPackage(path string) bool {
+	if path == "unsafe" || path == "C" {
+		return true
+	}
+	info, err := os.Stat(filepath.Join(build.Default.GOROOT, "src", filepath.FromSlash(path)))
+	return err == nil && info.IsDir()
+}
+
+// packageDir returns the directory of a package imported by pkg. Packages
+// of other modules are located with go list, which knows about replace
+// directives and the module cache.
+func (x *goIndex) packageDir(pkg *goPackage, path string) (string, error) {
+	if pkg.modPath != "" && (path == pkg.modPath || strings.HasPrefix(path, pkg.modPath+"/")) {
+		return filepath.Join(pkg.modRoot, filepath.FromSlash(strings.TrimPrefix(path, pkg.modPath))), nil
+	}
+	key := pkg.modRoot + "\x00" + path
+	if dir, ok := x.dirs[key]; ok {
+		return dir, nil
+	}
+	cmd := exec.Command("go", "list", "-e", "-f", "{{.Dir}}", "--", path)
+	cmd.Dir = pkg.dir
+	out, err := cmd.Output()
+	dir := strings.TrimSpace(string(out))
+	if err != nil || dir == "" {
+		return "", fmt.Errorf("cannot find package %s", path)
+	}
+	x.dirs[key] = dir
+	return dir, nil
+}
+
+// findGoModule returns the directory and the path of the module
+// containing dir, empty if there is none
+func findGoModule(dir string) (string, string) {
+	for d := dir; ; d = filepath.Dir(d) {
+		if data, err := os.ReadFile(filepath.Join(d, "go.mod")); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) >= 2 && fields[0] == "module" {
+					return d, strings.Trim(fields[1], "\"")
+				}
+			}
+			return d, ""
+		}
+		if filepath.Dir(d) == d {
+			return "", ""
+		}
+	}
+}
+
+// packagesUnder loads the packages in root and its subdirectories, skipping
+// nested modules, vendor and testdata directories
+func (x *goIndex) packagesUnder(root string) []*goPackage {
+	var pkgs []*goPackage
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		name := info.Name()
+		if path != root {
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata" || name == "node_modules" {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		if len(pkgs) >= maxIndexedPackages {
+			return filepath.SkipDir
+		}
+		if pkg, err := x.load(path); err == nil {
+			pkgs = append(pkgs, pkg)
+		}
+		return nil
+	})
+	return pkgs
+}
+
+// searchRoot returns the directory searched for references to the symbols
+// of the package in dir: its module, or the directory itself
+func searchRoot(dir string) string {
+	if root, _ := findGoModule(dir); root != "" {
+		return root
+	}
+	return dir
+}
+
+// fileSyntax returns the syntax tree of a Go file, from the index when its
+// package is loaded, parsing it otherwise
+func (x *goIndex) fileSyntax(path string) (*token.FileSet, *ast.File, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pkg, ok := x.pkgs[filepath.Dir(path)]; ok && x.fresh(pkg, make(map[*goPackage]bool)) {
+		for _, f := range pkg.files {
+			if x.fset.File(f.Pos()).Name() == path {
+				return x.fset, f, nil
+			}
+		}
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if f == nil {
+		return nil, nil, err
+	}
+	return fset, f, nil
+}
+
+// fileSymbols lists the top-level declarations of a file
+func fileSymbols(fset *token.FileSet, f *ast.File) []goSymbol {
+	var symbols []goSymbol
+	filename := fset.File(f.Pos()).Name()
+	add := func(sym goSymbol, node ast.Node, doc *ast.CommentGroup) {
+		sym.File = filename
+		sym.Line = fset.Position(node.Pos()).Line
+		sym.EndLine = fset.Position(node.End()).Line
+		sym.Doc = strings.TrimSpace(doc.Text())
+		sym.Exported = ast.IsExported(sym.Name)
+		symbols = append(symbols, sym)
+	}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			sym := goSymbol{Name: d.Name.Name, Kind: "func"}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				sym.Kind = "method"
+				sym.Receiver = nodeString(fset, d.Recv.List[0].Type)
+			}
+			sym.Signature = nodeString(fset, &ast.FuncDecl{Recv: d.Recv, Name: d.Name, Type: d.Type})
+			add(sym, d, d.Doc)
+			if sym.Receiver != "" && !ast.IsExported(receiverBase(sym.Receiver)) {
+				symbols[len(symbols)-1].Exported = false
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				// Ungrouped declarations start at the keyword
+				var node ast.Node = spec
+				doc := d.Doc
+				if d.Lparen.IsValid() {
+					doc = nil
+				} else {
+					node = d
+				}
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					if sp.Doc != nil {
+						doc = sp.Doc
+					}
+					kind := "type"
+					switch sp.Type.(type) {
+					case *ast.StructType:
+						kind = "struct"
+					case *ast.InterfaceType:
+						kind = "interface"
+					}
+					if sp.Assign.IsValid() {
+						kind = "alias"
+					}
+					sig := nodeString(fset, &ast.TypeSpec{Name: sp.Name, TypeParams: sp.TypeParams, Assign: sp.Assign, Type: sp.Type})
+					add(goSymbol{Name: sp.Name.Name, Kind: kind, Signature: "type " + sig}, node, doc)
+				case *ast.ValueSpec:
+					if sp.Doc != nil {
+						doc = sp.Doc
+					}
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for i, name := range sp.Names {
+						if name.Name == "_" {
+							continue
+						}
+						sig := kind + " " + name.Name
+						if sp.Type != nil {
+							sig += " " + nodeString(fset, sp.Type)
+						}
+						if kind == "const" && i < len(sp.Values) {
+							if value := nodeString(fset, sp.Values[i]); len(value) <= 80 {
+								sig += " = " + value
+							}
+						}
+						add(goSymbol{Name: name.Name, Kind: kind, Signature: sig}, node, doc)
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// nodeString prints a syntax node as Go source
+func nodeString(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	conf := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := conf.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// receiverBase returns the type name of a receiver like *List[T]
+func receiverBase(recv string) string {
+	recv = strings.TrimPrefix(recv, "*")
+	if idx := strings.IndexByte(recv, '['); idx != -1 {
+		recv = recv[:idx]
+	}
+	return recv
+}
+
+// objectOrigin returns the generic object of an instantiated one
+func objectOrigin(obj types.Object) types.Object {
+	switch o := obj.(type) {
+	case *types.Func:
+		return o.Origin()
+	case *types.Var:
+		return o.Origin()
+	}
+	return obj
+}
+
+// objectKind describes the kind of a types object
+func objectKind(obj types.Object) string {
+	switch o := obj.(type) {
+	case *types.Func:
+		if sig, ok := o.Type().(*types.Signature); ok && sig.Recv() != nil {
+			return "method"
+		}
+		return "func"
+	case *types.Var:
+		if o.IsField() {
+			return "field"
+		}
+		return "var"
+	case *types.Const:
+		return "const"
+	case *types.TypeName:
+		if o.IsAlias() {
+			return "alias"
+		}
+		switch o.Type().Underlying().(type) {
+		case *types.Struct:
+			return "struct"
+		case *types.Interface:
+			return "interface"
+		}
+		return "type"
+	case *types.PkgName:
+		return "package"
+	case *types.Label:
+		return "label"
+	}
+	return "object"
+}
+
+// objectName returns a readable qualified name like pkg.Type.Method
+func objectName(obj types.Object) string {
+	name := obj.Name()
+	if fn, ok := obj.(*types.Func); ok {
+		if sig, ok := fn.Type().(*types.Signature); ok && sig.Recv() != nil {
+			recv := sig.Recv().Type()
+			if ptr, ok := recv.(*types.Pointer); ok {
+				recv = ptr.Elem()
+			}
+			if named, ok := recv.(*types.Named); ok {
+				name = named.Obj().Name() + "." + name
+			}
+		}
+	}
+	if obj.Pkg() != nil && (obj.Parent() == obj.Pkg().Scope() || strings.Contains(name, ".")) {
+		name = obj.Pkg().Name() + "." + name
+	}
+	return name
+}
+
+// resolveSymbol finds the objects named by a symbol like Name, Type.Method,
+// Type.Field, pkg.Name or pkg.Type.Method in the given packages
+func resolveSymbol(pkgs []*goPackage, symbol string) []types.Object {
+	parts := strings.Split(symbol, ".")
+	var objs []types.Object
+	for _, pkg := range pkgs {
+		if pkg.types == nil {
+			continue
+		}
+		scopes := []*types.Package{pkg.types}
+		names := parts
+		if len(names) > 1 && pkg.types.Scope().Lookup(names[0]) == nil {
+			// The symbol is qualified by the package or by an import
+			scopes = nil
+			if names[0] == pkg.name {
+				scopes = append(scopes, pkg.types)
+			}
+			for _, imp := range pkg.types.Imports() {
+				if imp.Name() == names[0] {
+					scopes = append(scopes, imp)
+				}
+			}
+			names = names[1:]
+		}
+		for _, scope := range scopes {
+			if obj := lookupMember(scope, names); obj != nil {
+				objs = append(objs, obj)
+			}
+		}
+	}
+	return uniqueObjects(objs)
+}
+
+// lookupMember finds Name or Type.Member in a package
+func lookupMember(pkg *types.Package, names []string) types.Object {
+	obj := pkg.Scope().Lookup(names[0])
+	if obj == nil || len(names) == 1 {
+		return obj
+	}
+	if _, ok := obj.(*types.TypeName); !ok || len(names) > 2 {
+		return nil
+	}
+	member, _, _ := types.LookupFieldOrMethod(obj.Type(), true, pkg, names[1])
+	return member
+}
+
+// uniqueObjects removes the duplicates from a list of objects
+func uniqueObjects(objs []types.Object) []types.Object {
+	seen := make(map[types.Object]bool)
+	var unique []types.Object
+	for _, obj := range objs {
+		if !seen[obj] {
+			seen[obj] = true
+			unique = append(unique, obj)
+		}
+	}
+	return unique
+}
+
+// identAt returns the identifier of the file at line, at column when it is
+// not zero, or named name, or the first one of the line
+func identAt(fset *token.FileSet, f *ast.File, line, column int, name string) *ast.Ident {
+	var found *ast.Ident
+	ast.Inspect(f, func(n ast.Node) bool {
+		if found != nil {
+			return false
+		}
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		pos := fset.Position(id.Pos())
+		if pos.Line != line {
+			return true
+		}
+		switch {
+		case column > 0:
+			if column >= pos.Column && column < pos.Column+len(id.Name) {
+				found = id
+			}
+		case name != "":
+			if id.Name == name {
+				found = id
+			}
+		default:
+			found = id
+		}
+		return true
+	})
+	return found
+}
+
+// goSymbolArgs selects a Go symbol by name or by position
+type goSymbolArgs struct {
+	Path   string `json:"path" description:"Go file or package directory where the symbol is defined or used."`
+	Symbol string `json:"symbol,omitempty" description:"Symbol name: Name, Type.Method, Type.Field, pkg.Name or pkg.Type.Method."`
+	Line   int    `json:"line,omitempty" min:"0" description:"Line of a use of the symbol in the file given as path. With symbol, the identifier with that name on the line is used."`
+	Column int    `json:"column,omitempty" min:"0" description:"Column of the identifier on line (1-based)."`
+}
+
+// resolve returns the objects selected by the arguments, with the
+// directory to search for their uses
+func (x *goIndex) resolve(args goSymbolArgs) ([]types.Object, string, error) {
+	if args.Path == "" {
+		return nil, "", fmt.Errorf("path is required")
+	}
+	info, err := os.Stat(args.Path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to access path: %v", err)
+	}
+	path, _ := filepath.Abs(args.Path)
+	dir := path
+	if !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	pkg, err := x.load(dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load package: %v", err)
+	}
+	root := searchRoot(dir)
+
+	if args.Line > 0 {
+		if info.IsDir() {
+			return nil, "", fmt.Errorf("line requires path to be a file")
+		}
+		name := args.Symbol
+		if idx := strings.LastIndexByte(name, '.'); idx != -1 {
+			name = name[idx+1:]
+		}
+		for _, f := range pkg.files {
+			if x.fset.File(f.Pos()).Name() != path {
+				continue
+			}
+			id := identAt(x.fset, f, args.Line, args.Column, name)
+			if id == nil {
+				return nil, "", fmt.Errorf("no identifier found at %s:%d", path, args.Line)
+			}
+			obj := pkg.info.Uses[id]
+			if obj == nil {
+				obj = pkg.info.Defs[id]
+			}
+			if obj == nil {
+				return nil, "", fmt.Errorf("no object found for %s at %s:%d", id.Name, path, args.Line)
+			}
+			return []types.Object{objectOrigin(obj)}, root, nil
+		}
+		return nil, "", fmt.Errorf("%s is not part of package %s, it may be a test file or excluded by build constraints", path, pkg.name)
+	}
+
+	if args.Symbol == "" {
+		return nil, "", fmt.Errorf("symbol or line is required")
+	}
+	objs := resolveSymbol([]*goPackage{pkg}, args.Symbol)
+	if len(objs) == 0 {
+		objs = resolveSymbol(x.packagesUnder(root), args.Symbol)
+	}
+	if len(objs) == 0 {
+		return nil, "", fmt.Errorf("symbol '%s' not found", args.Symbol)
+	}
+	return objs, root, nil
+}
+
+// goLocation is a position in a Go file
+type goLocation struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Function string `json:"function,omitempty" description:"Function containing the location"`
+	Context  string `json:"context,omitempty" description:"Source line at the location"`
+}
+
+// location describes a position, reading its line from the file
+func (x *goIndex) location(pos token.Pos, lines map[string][]string) goLocation {
+	p := x.fset.Position(pos)
+	loc := goLocation{File: p.Filename, Line: p.Line, Column: p.Column}
+	src, ok := lines[p.Filename]
+	if !ok {
+		if data, err := os.ReadFile(p.Filename); err == nil {
+			src = strings.Split(string(data), "\n")
+		}
+		lines[p.Filename] = src
+	}
+	if p.Line > 0 && p.Line <= len(src) {
+		loc.Context = strings.TrimSpace(src[p.Line-1])
+	}
+	return loc
+}
+
+// enclosingFunc returns the name of the function declaration containing pos
+func enclosingFunc(f *ast.File, pos token.Pos, info *types.Info) string {
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Pos() <= pos && pos < fd.End() {
+			if obj := info.Defs[fd.Name]; obj != nil {
+				return objectName(obj)
+			}
+			return fd.Name.Name
+		}
+	}
+	return ""
+}
+
+// goDefinition describes where a symbol is declared
+type goDefinition struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Package   string `json:"package,omitempty"`
+	Signature string `json:"signature"`
+	Doc       string `json:"doc,omitempty"`
+	goLocation
+	EndLine int `json:"end_line,omitempty"`
+}
+
+type goDefinitionResult struct {
+	Definitions []goDefinition `json:"definitions"`
+}
+
+// handleFindDefinition handles the find_definition request
+func (s *CodeService) handleFindDefinition(ctx context.Context, args goSymbolArgs) (goDefinitionResult, error) {
+	x := s.goIndex
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	objs, _, err := x.resolve(args)
+	if err != nil {
+		return goDefinitionResult{}, err
+	}
+	result := goDefinitionResult{Definitions: []goDefinition{}}
+	lines := make(map[string][]string)
+	for _, obj := range objs {
+		def := goDefinition{Name: objectName(obj), Kind: objectKind(obj)}
+		if obj.Pkg() != nil {
+			def.Package = obj.Pkg().Path()
+			def.Signature = types.ObjectString(obj, types.RelativeTo(obj.Pkg()))
+		} else {
+			def.Signature = types.ObjectString(obj, nil)
+		}
+		if obj.Pos().IsValid() {
+			def.goLocation = x.location(obj.Pos(), lines)
+			// Declarations of indexed files have their doc and extent
+			if _, f, err := x.fileSyntax(def.File); err == nil && f != nil {
+				for _, sym := range fileSymbols(x.fset, f) {
+					if sym.Name == obj.Name() && def.Line >= sym.Line && def.Line <= sym.EndLine {
+						def.Doc, def.EndLine = sym.Doc, sym.EndLine
+						if sym.Kind == "method" || sym.Kind == "func" {
+							def.Signature = sym.Signature
+						}
+						break
+					}
+				}
+			}
+		}
+		result.Definitions = append(result.Definitions, def)
+	}
+	return result, nil
+}
+
+type goReferencesResult struct {
+	Symbols     []string     `json:"symbols"`
+	Definitions []goLocation `json:"definitions"`
+	References  []goLocation `json:"references"`
+	Count       int          `json:"count"`
+	Packages    int          `json:"packages_searched"`
+}
+
+// handleFindReferences handles the find_references request
+func (s *CodeService) handleFindReferences(ctx context.Context, args goSymbolArgs) (goReferencesResult, error) {
+	x := s.goIndex
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	objs, root, err := x.resolve(args)
+	if err != nil {
+		return goReferencesResult{}, err
+	}
+	targets := make(map[types.Object]bool)
+	result := goReferencesResult{Definitions: []goLocation{}, References: []goLocation{}}
+	lines := make(map[string][]string)
+	for _, obj := range objs {
+		targets[obj] = true
+		result.Symbols = append(result.Symbols, objectName(obj))
+		if obj.Pos().IsValid() {
+			result.Definitions = append(result.Definitions, x.location(obj.Pos(), lines))
+		}
+	}
+	pkgs := x.packagesUnder(root)
+	result.Packages = len(pkgs)
+	for _, pkg := range pkgs {
+		for _, f := range pkg.files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				id, ok := n.(*ast.Ident)
+				if !ok {
+					return true
+				}
+				if obj := pkg.info.Uses[id]; obj != nil && targets[objectOrigin(obj)] {
+					loc := x.location(id.Pos(), lines)
+					loc.Function = enclosingFunc(f, id.Pos(), pkg.info)
+					result.References = append(result.References, loc)
+				}
+				return true
+			})
+		}
+	}
+	sort.Slice(result.References, func(i, j int) bool {
+		a, b := result.References[i], result.References[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	result.Count = len(result.References)
+	return result, nil
+}
+
+// goCall is a call from a function declaration of the index
+type goCall struct {
+	caller  *types.Func
+	callee  *types.Func
+	pos     token.Pos
+	dynamic bool
+}
+
+// calls lists the calls made by the function declarations of the packages
+func calls(pkgs []*goPackage) []goCall {
+	var result []goCall
+	for _, pkg := range pkgs {
+		for _, f := range pkg.files {
+			for _, decl := range f.Decls {
+				fd, ok := decl.(*ast.FuncDecl)
+				if !ok || fd.Body == nil {
+					continue
+				}
+				caller, ok := pkg.info.Defs[fd.Name].(*types.Func)
+				if !ok {
+					continue
+				}
+				ast.Inspect(fd.Body, func(n ast.Node) bool {
+					call, ok := n.(*ast.CallExpr)
+					if !ok {
+						return true
+					}
+					fun := call.Fun
+					for {
+						paren, ok := fun.(*ast.ParenExpr)
+						if !ok {
+							break
+						}
+						fun = paren.X
+					}
+					switch e := fun.(type) {
+					case *ast.IndexExpr:
+						fun = e.X
+					case *ast.IndexListExpr:
+						fun = e.X
+					}
+					var id *ast.Ident
+					switch e := fun.(type) {
+					case *ast.Ident:
+						id = e
+					case *ast.SelectorExpr:
+						id = e.Sel
+					}
+					if id == nil {
+						return true
+					}
+					callee, ok := pkg.info.Uses[id].(*types.Func)
+					if !ok {
+						return true
+					}
+					callee = objectOrigin(callee).(*types.Func)
+					dynamic := false
+					if sig, ok := callee.Type().(*types.Signature); ok && sig.Recv() != nil {
+						dynamic = types.IsInterface(sig.Recv().Type())
+					}
+					result = append(result, goCall{caller: caller, callee: callee, pos: call.Pos(), dynamic: dynamic})
+					return true
+				})
+			}
+		}
+	}
+	return result
+}
+
+type goCallGraphArgs struct {
+	goSymbolArgs
+	Direction string `json:"direction" enum:"callers,callees,both" default:"both" description:"Which calls to list."`
+	Depth     int    `json:"depth" min:"1" max:"5" default:"1" description:"Levels of calls to follow."`
+}
+
+// goCallEdge is a call in the call graph
+type goCallEdge struct {
+	Caller  string `json:"caller"`
+	Callee  string `json:"callee"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Depth   int    `json:"depth"`
+	Dynamic bool   `json:"dynamic,omitempty" description:"Call of an interface method"`
+}
+
+type goCallGraphResult struct {
+	Functions []string     `json:"functions"`
+	Callers   []goCallEdge `json:"callers"`
+	Callees   []goCallEdge `json:"callees"`
+}
+
+// maxCallEdges bounds the calls returned by call_graph
+const maxCallEdges = 500
+
+// handleCallGraph handles the call_graph request
+func (s *CodeService) handleCallGraph(ctx context.Context, args goCallGraphArgs) (goCallGraphResult, error) {
+	x := s.goIndex
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	objs, root, err := x.resolve(args.goSymbolArgs)
+	if err != nil {
+		return goCallGraphResult{}, err
+	}
+	var funcs []*types.Func
+	result := goCallGraphResult{Callers: []goCallEdge{}, Callees: []goCallEdge{}}
+	for _, obj := range objs {
+		if fn, ok := obj.(*types.Func); ok {
+			funcs = append(funcs, fn)
+			result.Functions = append(result.Functions, objectName(fn))
+		}
+	}
+	if len(funcs) == 0 {
+		return goCallGraphResult{}, fmt.Errorf("'%s' is not a function or method", objectName(objs[0]))
+	}
+	all := calls(x.packagesUnder(root))
+	edge := func(c goCall, depth int) goCallEdge {
+		p := x.fset.Position(c.pos)
+		return goCallEdge{Caller: objectName(c.caller), Callee: objectName(c.callee), File: p.Filename, Line: p.Line, Depth: depth, Dynamic: c.dynamic}
+	}
+	// Follow the calls breadth first from the functions
+	walk := func(forward bool) []goCallEdge {
+		edges := []goCallEdge{}
+		seen := make(map[*types.Func]bool)
+		level := make(map[*types.Func]bool)
+		for _, fn := range funcs {
+			level[fn] = true
+			seen[fn] = true
+		}
+		for depth := 1; depth <= args.Depth && len(level) > 0; depth++ {
+			next := make(map[*types.Func]bool)
+			for _, c := range all {
+				from, to := c.caller, c.callee
+				if !forward {
+					from, to = c.callee, c.caller
+				}
+				if !level[from] || len(edges) >= maxCallEdges {
+					continue
+				}
+				edges = append(edges, edge(c, depth))
+				if !seen[to] {
+					seen[to] = true
+					next[to] = true
+				}
+			}
+			level = next
+		}
+		return edges
+	}
+	if args.Direction != "callees" {
+		result.Callers = walk(false)
+	}
+	if args.Direction != "callers" {
+		result.Callees = walk(true)
+	}
+	return result, nil
+}
+
+type goPackageArgs struct {
+	Path              string `json:"path" description:"Package directory, or a Go file of the package."`
+	IncludeUnexported bool   `json:"include_unexported,omitempty" description:"Also list the unexported symbols."`
+}
+
+type goPackageSummary struct {
+	Name       string     `json:"name"`
+	ImportPath string     `json:"import_path"`
+	Dir        string     `json:"dir"`
+	Doc        string     `json:"doc,omitempty"`
+	Files      []string   `json:"files"`
+	Imports    []string   `json:"imports"`
+	Symbols    []goSymbol `json:"symbols"`
+	Errors     []string   `json:"errors,omitempty" description:"Parse and type errors of the package"`
+}
+
+// handlePackageSummary handles the package_summary request
+func (s *CodeService) handlePackageSummary(ctx context.Context, args goPackageArgs) (goPackageSummary, error) {
+	x := s.goIndex
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if args.Path == "" {
+		return goPackageSummary{}, fmt.Errorf("path is required")
+	}
+	info, err := os.Stat(args.Path)
+	if err != nil {
+		return goPackageSummary{}, fmt.Errorf("failed to access path: %v", err)
+	}
+	dir := args.Path
+	if !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	pkg, err := x.load(dir)
+	if err != nil {
+		return goPackageSummary{}, fmt.Errorf("failed to load package: %v", err)
+	}
+	summary := goPackageSummary{
+		Name:       pkg.name,
+		ImportPath: pkg.importPath,
+		Dir:        pkg.dir,
+		Files:      []string{},
+		Imports:    []string{},
+		Symbols:    []goSymbol{},
+		Errors:     pkg.errors,
+	}
+	imports := make(map[string]bool)
+	for _, f := range pkg.files {
+		summary.Files = append(summary.Files, filepath.Base(x.fset.File(f.Pos()).Name()))
+		if summary.Doc == "" && f.Doc != nil {
+			summary.Doc = strings.TrimSpace(f.Doc.Text())
+		}
+		for _, imp := range f.Imports {
+			imports[strings.Trim(imp.Path.Value, "\"`")] = true
+		}
+		for _, sym := range fileSymbols(x.fset, f) {
+			if sym.Exported || args.IncludeUnexported {
+				sym.File = filepath.Base(sym.File)
+				summary.Symbols = append(summary.Symbols, sym)
+			}
+		}
+	}
+	for imp := range imports {
+		summary.Imports = append(summary.Imports, imp)
+	}
+	sort.Strings(summary.Imports)
+	return summary, nil
+}
+
+// goFunctions lists the functions of a Go file for list_functions
+func (s *CodeService) goFunctions(filePath string) ([]map[string]any, error) {
+	s.goIndex.mu.Lock()
+	defer s.goIndex.mu.Unlock()
+	fset, f, err := s.goIndex.fileSyntax(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file: %v", err)
+	}
+	functions := []map[string]any{}
+	for _, sym := range fileSymbols(fset, f) {
+		if sym.Kind != "func" && sym.Kind != "method" {
+			continue
+		}
+		function := map[string]any{
+			"name":       sym.Name,
+			"kind":       sym.Kind,
+			"signature":  sym.Signature,
+			"parameters": goParameters(sym.Signature),
+			"line":       sym.Line,
+			"end_line":   sym.EndLine,
+			"language":   "Go",
+		}
+		if sym.Receiver != "" {
+			function["receiver"] = sym.Receiver
+		}
+		if sym.Doc != "" {
+			function["doc"] = sym.Doc
+		}
+		functions = append(functions, function)
+	}
+	return functions, nil
+}
+
+// goParameters returns the parameter list of a function signature
+func goParameters(signature string) string {
+	if strings.HasPrefix(signature, "func (") {
+		// Skip the receiver
+		if idx := strings.Index(signature, ") "); idx != -1 {
+			signature = signature[idx+2:]
+		}
+	}
+	start := strings.IndexByte(signature, '(')
+	if start == -1 {
+		return ""
+	}
+	depth := 0
+	for i := start; i < len(signature); i++ {
+		switch signature[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return signature[start+1 : i]
+			}
+		}
+	}
+	return ""
+}
+
+// goStructures lists the types of a Go file for query_structure
+func (s *CodeService) goStructures(filePath string) ([]map[string]any, error) {
+	s.goIndex.mu.Lock()
+	defer s.goIndex.mu.Unlock()
+	fset, f, err := s.goIndex.fileSyntax(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file: %v", err)
+	}
+	// Methods may be declared in other files of the package
+	methods := make(map[string][]string)
+	siblings, _ := filepath.Glob(filepath.Join(filepath.Dir(filePath), "*.go"))
+	for _, sibling := range siblings {
+		if strings.HasSuffix(sibling, "_test.go") {
+			continue
+		}
+		sfset, sf, err := s.goIndex.fileSyntax(sibling)
+		if err != nil || sf.Name.Name != f.Name.Name {
+			continue
+		}
+		for _, sym := range fileSymbols(sfset, sf) {
+			if sym.Kind == "method" {
+				base := receiverBase(sym.Receiver)
+				methods[base] = append(methods[base], sym.Name)
+			}
+		}
+	}
+	structures := []map[string]any{}
+	for _, sym := range fileSymbols(fset, f) {
+		switch sym.Kind {
+		case "struct", "interface", "type", "alias":
+		default:
+			continue
+		}
+		structure := map[string]any{
+			"name":       sym.Name,
+			"type":       sym.Kind,
+			"definition": sym.Signature,
+			"line":       sym.Line,
+			"end_line":   sym.EndLine,
+			"language":   "Go",
+		}
+		if sym.Doc != "" {
+			structure["doc"] = sym.Doc
+		}
+		if m := methods[sym.Name]; len(m) > 0 {
+			structure["methods"] = m
+		}
+		structures = append(structures, structure)
+	}
+	return structures, nil
+}
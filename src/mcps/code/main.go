@@ -8,10 +8,15 @@ import (
 )
 
 func main() {
-	listen := flag.String("l", "", "listen host:port, http://host:port/path, or sse://host:port/path (optional) serve MCP over TCP, HTTP, or SSE")
+	listen := flag.String("l", "", "listen host:port, http://host:port/path, sse://host:port/path, ws://host:port/path, or unix:///path (optional) serve MCP over TCP, HTTP, SSE, WebSocket, or a Unix socket")
+	policyFile := flag.String("policy", "", "(optional) JSON command policy file (or set MCPLIB_COMMAND_POLICY)")
 	flag.Parse()
 
-	codeService := NewCodeService()
+	policy, err := mcplib.LoadCommandPolicy(*policyFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	codeService := NewCodeService(policy)
 
 	// Get all tools from the service
 	tools := codeService.GetTools()
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxTestOutput bounds the output kept for each failed test
+	maxTestOutput = 4096
+	// maxTestResults bounds the tests listed in a result
+	maxTestResults = 1000
+)
+
+// runTestsArgs holds the arguments of the run_tests tool
+type runTestsArgs struct {
+	Path      string `json:"path" description:"Project directory, or a test file."`
+	Framework string `json:"framework,omitempty" enum:"go,pytest,cargo,jest" description:"Test framework. Detected from the build system of the project if not provided."`
+	Filter    string `json:"filter,omitempty" description:"Only run the tests matching this pattern: go test -run, pytest -k, the cargo test filter or jest -t."`
+	Target    string `json:"target,omitempty" description:"What to test: Go package pattern (default ./...), pytest or jest test path, or cargo package name."`
+	Timeout   int    `json:"timeout" min:"1" max:"3600" default:"300" description:"Timeout in seconds."`
+}
+
+// runTestsResult describes the outcome of a test run
+type runTestsResult struct {
+	Framework   string       `json:"framework"`
+	Command     string       `json:"command"`
+	Directory   string       `json:"directory"`
+	Success     bool         `json:"success"`
+	Passed      int          `json:"passed"`
+	Failed      int          `json:"failed"`
+	Skipped     int          `json:"skipped"`
+	Tests       []testResult `json:"tests"`
+	Diagnostics []diagnostic `json:"diagnostics" description:"Errors located in the output, like build errors or failed assertions"`
+	Output      string       `json:"output,omitempty" description:"End of the raw output, when it explains a failure better than the tests"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// testResult is the outcome of a single test
+type testResult struct {
+	Name     string  `json:"name"`
+	Package  string  `json:"package,omitempty"`
+	Status   string  `json:"status" description:"pass, fail or skip"`
+	Duration float64 `json:"duration,omitempty" description:"Seconds"`
+	Output   string  `json:"output,omitempty" description:"Output of the failed test"`
+}
+
+// detectTestFramework picks the test framework of a project from its build
+// system, or from its files when the build system wraps another tool
+func (s *CodeService) detectTestFramework(dir string) string {
+	buildSystem, _, _ := s.detectBuildSystem(dir)
+	switch buildSystem {
+	case "Go Modules", "Go":
+		return "go"
+	case "Cargo":
+		return "cargo"
+	case "npm", "Yarn", "JavaScript", "TypeScript":
+		return "jest"
+	case "pip", "Poetry", "Python":
+		return "pytest"
+	}
+	exists := func(pattern string) bool {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		return len(matches) > 0
+	}
+	switch {
+	case exists("go.mod"):
+		return "go"
+	case exists("Cargo.toml"):
+		return "cargo"
+	case exists("package.json"):
+		return "jest"
+	case exists("pyproject.toml"), exists("setup.py"), exists("pytest.ini"), exists("conftest.py"), exists("requirements.txt"):
+		return "pytest"
+	case exists("*.go"):
+		return "go"
+	case exists("*.py"), exists("tests/*.py"):
+		return "pytest"
+	}
+	return ""
+}
+
+// handleRunTests handles the run_tests request
+func (s *CodeService) handleRunTests(ctx context.Context, args runTestsArgs) (runTestsResult, error) {
+	if args.Path == "" {
+		return runTestsResult{}, fmt.Errorf("path is required")
+	}
+	info, err := os.Stat(args.Path)
+	if err != nil {
+		return runTestsResult{}, fmt.Errorf("failed to access path: %v", err)
+	}
+	dir, target := args.Path, args.Target
+	if !info.IsDir() {
+		dir = filepath.Dir(args.Path)
+		if target == "" {
+			target = filepath.Base(args.Path)
+		}
+	}
+	framework := args.Framework
+	if framework == "" {
+		if framework = s.detectTestFramework(dir); framework == "" {
+			return runTestsResult{}, fmt.Errorf("could not detect the test framework of %s, set framework", dir)
+		}
+	}
+
+	// Reports are written to a temporary file by pytest and jest
+	report := filepath.Join(os.TempDir(), fmt.Sprintf("mcp-code-tests-%d-%d", os.Getpid(), time.Now().UnixNano()))
+	defer os.Remove(report)
+
+	var argv []string
+	switch framework {
+	case "go":
+		if !info.IsDir() && args.Target == "" {
+			// Test files are run with their package
+			target = "."
+		} else if target == "" {
+			target = "./..."
+		}
+		argv = []string{"go", "test", "-json"}
+		if args.Filter != "" {
+			argv = append(argv, "-run", args.Filter)
+		}
+		argv = append(argv, target)
+	case "pytest":
+		argv = []string{"pytest"}
+		if _, err := exec.LookPath("pytest"); err != nil {
+			argv = []string{"python3", "-m", "pytest"}
+		}
+		argv = append(argv, "-q", "--tb=short", "--junitxml="+report)
+		if args.Filter != "" {
+			argv = append(argv, "-k", args.Filter)
+		}
+		if target != "" {
+			argv = append(argv, target)
+		}
+	case "cargo":
+		argv = []string{"cargo", "test", "--color", "never"}
+		// A file is not a package, cargo tests the crate containing it
+		if args.Target != "" {
+			argv = append(argv, "--package", args.Target)
+		}
+		if args.Filter != "" {
+			argv = append(argv, args.Filter)
+		}
+	case "jest":
+		argv = []string{"npx", "--no-install", "jest", "--ci", "--json", "--outputFile=" + report}
+		if args.Filter != "" {
+			argv = append(argv, "-t", args.Filter)
+		}
+		if target != "" {
+			argv = append(argv, target)
+		}
+	default:
+		return runTestsResult{}, fmt.Errorf("unsupported test framework: %s", framework)
+	}
+
+	command := quoteArgs(argv)
+	if refusal := s.policy.Check(command, dir); refusal != nil {
+		return runTestsResult{}, refusal
+	}
+
+	timeout := args.Timeout
+	if timeout <= 0 {
+		timeout = 300
+	}
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(runCtx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	result := runTestsResult{
+		Framework: framework,
+		Command:   command,
+		Directory: dir,
+	}
+	// Output that is not a test report is searched for build errors
+	other := stderr.String()
+	switch framework {
+	case "go":
+		var rest string
+		result.Tests, rest = parseGoTestJSON(stdout.String())
+		other = rest + other
+	case "pytest":
+		result.Tests, err = parseJUnitReport(report)
+		other = stdout.String() + other
+	case "cargo":
+		result.Tests = parseCargoTest(stdout.String())
+		other = stdout.String() + other
+	case "jest":
+		result.Tests, err = parseJestReport(report)
+		other = stdout.String() + other
+	}
+	if result.Tests == nil {
+		result.Tests = []testResult{}
+	}
+	result.Diagnostics = parseDiagnostics(other)
+
+	failedTests := 0
+	for _, t := range result.Tests {
+		switch t.Status {
+		case "pass":
+			result.Passed++
+		case "fail":
+			result.Failed++
+			if t.Output != "" {
+				failedTests++
+			}
+		case "skip":
+			result.Skipped++
+		}
+	}
+	if len(result.Tests) > maxTestResults {
+		result.Tests = result.Tests[:maxTestResults]
+	}
+	result.Success = runErr == nil && result.Failed == 0
+
+	switch {
+	case runCtx.Err() == context.DeadlineExceeded:
+		result.Error = fmt.Sprintf("tests timed out after %d seconds", timeout)
+	case runErr != nil:
+		result.Error = runErr.Error()
+	case err != nil:
+		result.Error = fmt.Sprintf("failed to read the test report: %v", err)
+	}
+	if (!result.Success && failedTests == 0) || len(result.Tests) == 0 {
+		result.Output = lastBytes(stdout.String()+stderr.String(), maxTestOutput)
+	}
+	return result, nil
+}
+
+// quoteArgs joins a command line, quoting the arguments for a POSIX shell
+// when they need it
+func quoteArgs(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_./=:@%+,-") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// lastBytes returns the end of s, at most n bytes starting at a line
+func lastBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[len(s)-n:]
+	if idx := strings.IndexByte(s, '\n'); idx != -1 {
+		s = s[idx+1:]
+	}
+	return s
+}
+
+// parseGoTestJSON reads the events of go test -json, returning the tests
+// and the output that does not belong to a test
+func parseGoTestJSON(output string) ([]testResult, string) {
+	type event struct {
+		Action      string
+		Package     string
+		ImportPath  string
+		Test        string
+		Elapsed     float64
+		Output      string
+		FailedBuild string
+	}
+	var tests []testResult
+	index := make(map[string]int)
+	outputs := make(map[string]*strings.Builder)
+	var packages []string
+	failedPackages := make(map[string]bool)
+	failedTests := make(map[string]bool)
+	// Build errors are reported by import path since Go 1.24
+	buildOutputs := make(map[string]*strings.Builder)
+	failedBuilds := make(map[string]string)
+	var rest strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		var ev event
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &ev) != nil {
+			rest.WriteString(line + "\n")
+			continue
+		}
+		if ev.Action == "build-output" && ev.ImportPath != "" {
+			if buildOutputs[ev.ImportPath] == nil {
+				buildOutputs[ev.ImportPath] = &strings.Builder{}
+			}
+			buildOutputs[ev.ImportPath].WriteString(ev.Output)
+			continue
+		}
+		key := ev.Package + "\x00" + ev.Test
+		if outputs[key] == nil {
+			outputs[key] = &strings.Builder{}
+			if ev.Test == "" {
+				packages = append(packages, ev.Package)
+			}
+		}
+		switch ev.Action {
+		case "output", "build-output":
+			if !strings.HasPrefix(ev.Output, "=== ") {
+				outputs[key].WriteString(ev.Output)
+			}
+		case "pass", "fail", "skip":
+			if ev.Test == "" {
+				if ev.Action == "fail" {
+					failedPackages[ev.Package] = true
+					failedBuilds[ev.Package] = ev.FailedBuild
+				}
+				continue
+			}
+			t := testResult{Name: ev.Test, Package: ev.Package, Status: ev.Action, Duration: ev.Elapsed}
+			if ev.Action == "fail" {
+				t.Output = lastBytes(outputs[key].String(), maxTestOutput)
+				failedTests[ev.Package] = true
+			}
+			if i, ok := index[key]; ok {
+				tests[i] = t
+			} else {
+				index[key] = len(tests)
+				tests = append(tests, t)
+			}
+		}
+	}
+	// Packages failing without a failed test did not build or crashed
+	for _, pkg := range packages {
+		if !failedPackages[pkg] || failedTests[pkg] {
+			continue
+		}
+		out := outputs[pkg+"\x00"].String()
+		if build := buildOutputs[failedBuilds[pkg]]; build != nil {
+			out = build.String() + out
+		}
+		rest.WriteString(out)
+		tests = append(tests, testResult{Name: pkg, Package: pkg, Status: "fail", Output: lastBytes(out, maxTestOutput)})
+	}
+	return tests, rest.String()
+}
+
+// junitSuite is a testsuites or testsuite element of a JUnit report
+type junitSuite struct {
+	Suites []junitSuite `xml:"testsuite"`
+	Cases  []junitCase  `xml:"testcase"`
+}
+
+type junitCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Error     *junitMessage `xml:"error"`
+	Skipped   *junitMessage `xml:"skipped"`
+	SystemOut string        `xml:"system-out"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// parseJUnitReport reads the JUnit XML report written by pytest
+func parseJUnitReport(path string) ([]testResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var root junitSuite
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	var tests []testResult
+	var walk func(suite junitSuite)
+	walk = func(suite junitSuite) {
+		for _, c := range suite.Cases {
+			t := testResult{Name: c.Name, Package: c.Classname, Status: "pass", Duration: c.Time}
+			failure := c.Failure
+			if failure == nil {
+				failure = c.Error
+			}
+			switch {
+			case failure != nil:
+				t.Status = "fail"
+				out := strings.TrimSpace(failure.Text)
+				if out == "" {
+					out = failure.Message
+				}
+				if c.SystemOut != "" {
+					out += "\n" + c.SystemOut
+				}
+				t.Output = lastBytes(out, maxTestOutput)
+			case c.Skipped != nil:
+				t.Status = "skip"
+			}
+			tests = append(tests, t)
+		}
+		for _, sub := range suite.Suites {
+			walk(sub)
+		}
+	}
+	walk(root)
+	return tests, nil
+}
+
+var (
+	cargoTestRe       = regexp.MustCompile(`^test (\S+) \.\.\. (ok|FAILED|ignored)`)
+	cargoTestOutputRe = regexp.MustCompile(`^---- (\S+) stdout ----$`)
+)
+
+// parseCargoTest reads the output of cargo test
+func parseCargoTest(output string) []testResult {
+	var tests []testResult
+	index := make(map[string]int)
+	lines := strings.Split(output, "\n")
+	for i := 0; i < len(lines); i++ {
+		if m := cargoTestRe.FindStringSubmatch(lines[i]); m != nil {
+			status := map[string]string{"ok": "pass", "FAILED": "fail", "ignored": "skip"}[m[2]]
+			index[m[1]] = len(tests)
+			tests = append(tests, testResult{Name: m[1], Status: status})
+			continue
+		}
+		// The outputs of the failed tests are printed after the results
+		if m := cargoTestOutputRe.FindStringSubmatch(lines[i]); m != nil {
+			var out []string
+			for i+1 < len(lines) && !strings.HasPrefix(lines[i+1], "---- ") && lines[i+1] != "failures:" {
+				i++
+				out = append(out, lines[i])
+			}
+			if idx, ok := index[m[1]]; ok {
+				tests[idx].Output = lastBytes(strings.TrimSpace(strings.Join(out, "\n")), maxTestOutput)
+			}
+		}
+	}
+	return tests
+}
+
+// parseJestReport reads the JSON report written by jest --json
+func parseJestReport(path string) ([]testResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report struct {
+		TestResults []struct {
+			Name             string `json:"name"`
+			Message          string `json:"message"`
+			Status           string `json:"status"`
+			AssertionResults []struct {
+				FullName        string   `json:"fullName"`
+				Status          string   `json:"status"`
+				Duration        float64  `json:"duration"`
+				FailureMessages []string `json:"failureMessages"`
+			} `json:"assertionResults"`
+		} `json:"testResults"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	var tests []testResult
+	for _, file := range report.TestResults {
+		if len(file.AssertionResults) == 0 && file.Status == "failed" {
+			// The test file did not run
+			tests = append(tests, testResult{Name: file.Name, Package: file.Name, Status: "fail", Output: lastBytes(file.Message, maxTestOutput)})
+			continue
+		}
+		for _, a := range file.AssertionResults {
+			t := testResult{Name: a.FullName, Package: file.Name, Duration: a.Duration / 1000}
+			switch a.Status {
+			case "passed":
+				t.Status = "pass"
+			case "failed":
+				t.Status = "fail"
+				t.Output = lastBytes(strings.Join(a.FailureMessages, "\n"), maxTestOutput)
+			default:
+				t.Status = "skip"
+			}
+			tests = append(tests, t)
+		}
+	}
+	return tests, nil
+}
@@ -8,7 +8,7 @@ import (
 )
 
 func main() {
-	listen := flag.String("l", "", "listen host:port, http://host:port/path, or sse://host:port/path (optional) serve MCP over TCP, HTTP, or SSE")
+	listen := flag.String("l", "", "listen host:port, http://host:port/path, sse://host:port/path, ws://host:port/path, or unix:///path (optional) serve MCP over TCP, HTTP, SSE, WebSocket, or a Unix socket")
 	flag.Parse()
 
 	fediService := NewFediService()
@@ -0,0 +1,128 @@
+package mcplib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// ErrRequestCancelled is the cause of the context of a request the client
+// cancelled with notifications/cancelled
+var ErrRequestCancelled = errors.New("request cancelled by the client")
+
+type requestScopeKey struct{}
+type requestInfoKey struct{}
+
+// requestScope identifies the connection requests arrive on, so the ids of
+// different clients do not collide, and how to notify its client
+type requestScope struct {
+	name   string
+	notify func(JSONRPCNotification)
+}
+
+// requestInfo is attached to the context of a tracked request
+type requestInfo struct {
+	server        *MCPServer
+	progressToken interface{}
+	notify        func(JSONRPCNotification)
+}
+
+// withRequestScope tags ctx with the connection the requests handled with
+// it come from. notify may be nil when the transport cannot send
+// notifications while a request is in flight.
+func withRequestScope(ctx context.Context, name string, notify func(JSONRPCNotification)) context.Context {
+	return context.WithValue(ctx, requestScopeKey{}, &requestScope{name: name, notify: notify})
+}
+
+func scopeFromContext(ctx context.Context) *requestScope {
+	if scope, ok := ctx.Value(requestScopeKey{}).(*requestScope); ok {
+		return scope
+	}
+	return &requestScope{}
+}
+
+func inflightKey(scope string, id interface{}) string {
+	data, _ := json.Marshal(id)
+	return scope + "\x00" + string(data)
+}
+
+// trackRequest registers an in-flight request so a notifications/cancelled
+// naming its id cancels the returned context. finish must be called once
+// the request is answered.
+func (s *MCPServer) trackRequest(ctx context.Context, req JSONRPCRequest) (context.Context, func()) {
+	if req.ID == nil {
+		return ctx, func() {}
+	}
+	scope := scopeFromContext(ctx)
+	info := &requestInfo{server: s, notify: scope.notify}
+	var params struct {
+		Meta struct {
+			ProgressToken interface{} `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if len(req.Params) > 0 && json.Unmarshal(req.Params, &params) == nil {
+		info.progressToken = params.Meta.ProgressToken
+	}
+	ctx, cancel := context.WithCancelCause(context.WithValue(ctx, requestInfoKey{}, info))
+
+	key := inflightKey(scope.name, req.ID)
+	s.inflightMu.Lock()
+	if s.inflight == nil {
+		s.inflight = make(map[string]context.CancelCauseFunc)
+	}
+	s.inflight[key] = cancel
+	s.inflightMu.Unlock()
+
+	return ctx, func() {
+		s.inflightMu.Lock()
+		delete(s.inflight, key)
+		s.inflightMu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancelRequest handles notifications/cancelled. Unknown or already
+// answered requests are ignored as the specification requires.
+func (s *MCPServer) cancelRequest(ctx context.Context, raw json.RawMessage) {
+	var params struct {
+		RequestID interface{} `json:"requestId"`
+		Reason    string      `json:"reason"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil || params.RequestID == nil {
+		return
+	}
+	key := inflightKey(scopeFromContext(ctx).name, params.RequestID)
+	s.inflightMu.Lock()
+	cancel, exists := s.inflight[key]
+	s.inflightMu.Unlock()
+	if !exists {
+		return
+	}
+	if s.verbose {
+		log.Printf("Request %v cancelled by the client: %s", params.RequestID, params.Reason)
+	}
+	cancel(ErrRequestCancelled)
+}
+
+// Progress reports the progress of the request handled with ctx by sending
+// notifications/progress to its client. done must increase on every call
+// and total is omitted when zero. Nothing is sent unless the client asked
+// for progress with a progressToken.
+func Progress(ctx context.Context, done, total float64, msg string) {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok || info.progressToken == nil || info.notify == nil {
+		return
+	}
+	params := map[string]interface{}{
+		"progressToken": info.progressToken,
+		"progress":      done,
+	}
+	if total > 0 {
+		params["total"] = total
+	}
+	if msg != "" {
+		params["message"] = msg
+	}
+	info.notify(JSONRPCNotification{JSONRPC: "2.0", Method: "notifications/progress", Params: params})
+}
@@ -0,0 +1,155 @@
+package mcplib
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// maxCompletionValues is the most values completion/complete may return
+const maxCompletionValues = 100
+
+// CompletionHandler suggests values for a prompt argument or a resource
+// template variable. value is what the user typed so far and args holds the
+// arguments already filled in, when the client sends them.
+type CompletionHandler func(ctx context.Context, value string, args map[string]string) ([]string, error)
+
+// CompleteFrom returns a CompletionHandler suggesting the values starting
+// with what was typed, ignoring case
+func CompleteFrom(values []string) CompletionHandler {
+	return func(ctx context.Context, value string, args map[string]string) ([]string, error) {
+		prefix := strings.ToLower(value)
+		var matches []string
+		for _, v := range values {
+			if strings.HasPrefix(strings.ToLower(v), prefix) {
+				matches = append(matches, v)
+			}
+		}
+		return matches, nil
+	}
+}
+
+func completionKey(refType, ref, argument string) string {
+	return refType + "\x00" + ref + "\x00" + argument
+}
+
+// RegisterPromptCompletion sets the handler completing an argument of a
+// prompt
+func (s *MCPServer) RegisterPromptCompletion(prompt, argument string, handler CompletionHandler) {
+	if s.completions == nil {
+		s.completions = make(map[string]CompletionHandler)
+	}
+	s.completions[completionKey("ref/prompt", prompt, argument)] = handler
+}
+
+// RegisterResourceCompletion sets the handler completing a variable of a
+// resource template, named by its URI template
+func (s *MCPServer) RegisterResourceCompletion(uriTemplate, variable string, handler CompletionHandler) {
+	if s.completions == nil {
+		s.completions = make(map[string]CompletionHandler)
+	}
+	s.completions[completionKey("ref/resource", uriTemplate, variable)] = handler
+}
+
+// processCompletionComplete handles completion/complete. Arguments without
+// a handler complete to nothing.
+func (s *MCPServer) processCompletionComplete(ctx context.Context, req JSONRPCRequest) JSONRPCResponse {
+	var params struct {
+		Ref struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+			URI  string `json:"uri"`
+		} `json:"ref"`
+		Argument struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"argument"`
+		Context struct {
+			Arguments map[string]string `json:"arguments"`
+		} `json:"context"`
+	}
+	invalid := func(msg string) JSONRPCResponse {
+		return JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error:   &RPCError{Code: -32602, Message: msg},
+		}
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.Argument.Name == "" {
+		return invalid("Invalid params")
+	}
+
+	var ref string
+	switch params.Ref.Type {
+	case "ref/prompt":
+		ref = params.Ref.Name
+		if !s.hasPromptArgument(ref, params.Argument.Name) {
+			return invalid("Unknown prompt argument: " + ref + " " + params.Argument.Name)
+		}
+	case "ref/resource":
+		ref = params.Ref.URI
+		if !s.hasTemplateVariable(ref, params.Argument.Name) {
+			return invalid("Unknown resource template variable: " + ref + " " + params.Argument.Name)
+		}
+	default:
+		return invalid("Invalid reference type: " + params.Ref.Type)
+	}
+
+	values := []string{}
+	if handler, exists := s.completions[completionKey(params.Ref.Type, ref, params.Argument.Name)]; exists {
+		matches, err := handler(ctx, params.Argument.Value, params.Context.Arguments)
+		if err != nil {
+			return JSONRPCResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error:   &RPCError{Code: -32000, Message: err.Error()},
+			}
+		}
+		if matches != nil {
+			values = matches
+		}
+	}
+	total := len(values)
+	if total > maxCompletionValues {
+		values = values[:maxCompletionValues]
+	}
+	return JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"completion": map[string]interface{}{
+				"values":  values,
+				"total":   total,
+				"hasMore": total > len(values),
+			},
+		},
+	}
+}
+
+func (s *MCPServer) hasPromptArgument(prompt, argument string) bool {
+	for _, p := range s.prompts {
+		if p.Name != prompt {
+			continue
+		}
+		for _, arg := range p.Arguments {
+			if arg.Name == argument {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *MCPServer) hasTemplateVariable(uriTemplate, variable string) bool {
+	for _, t := range s.resourceTemplates {
+		if t.def.URITemplate != uriTemplate {
+			continue
+		}
+		for _, v := range t.template.Variables() {
+			if v == variable {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -34,6 +34,56 @@ func tokenize(s string) []string {
 	return tokens
 }
 
+// DSLStatement is a "tool key=value ..." statement of the test DSL
+type DSLStatement struct {
+	Tool string
+	Args map[string]interface{}
+}
+
+// ParseDSLStatement parses a "tool key=value ..." statement. Values are
+// numbers, booleans, JSON objects or arrays, or strings, which may be
+// double-quoted. It returns false for empty statements.
+func ParseDSLStatement(stmt string) (DSLStatement, bool) {
+	parts := tokenize(strings.TrimSpace(stmt))
+	if len(parts) == 0 {
+		return DSLStatement{}, false
+	}
+	args := make(map[string]interface{})
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		args[strings.TrimSpace(kv[0])] = ParseDSLValue(strings.TrimSpace(kv[1]))
+	}
+	return DSLStatement{Tool: parts[0], Args: args}, true
+}
+
+// ParseDSLValue converts a DSL argument value to its JSON value
+func ParseDSLValue(val string) interface{} {
+	// Handle quoted strings
+	if strings.HasPrefix(val, "\"") && strings.HasSuffix(val, "\"") && len(val) >= 2 {
+		return val[1 : len(val)-1]
+	}
+	if strings.HasPrefix(val, "{") || strings.HasPrefix(val, "[") {
+		var v interface{}
+		if err := json.Unmarshal([]byte(val), &v); err == nil {
+			return v
+		}
+	}
+	// Try to parse as number or boolean
+	if numVal, err := strconv.ParseFloat(val, 64); err == nil {
+		return numVal
+	}
+	switch val {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return val
+}
+
 // RunDSLTests executes DSL commands for testing tools
 func RunDSLTests(tools []Tool, dsl string) error {
 	// Create a map of tool names to handlers for quick lookup
@@ -44,51 +94,18 @@ func RunDSLTests(tools []Tool, dsl string) error {
 
 	// Split DSL by semicolons and execute each statement
 	statements := strings.Split(dsl, ";")
-	for _, stmt := range statements {
-		stmt = strings.TrimSpace(stmt)
-		if stmt == "" {
+	for _, text := range statements {
+		stmt, ok := ParseDSLStatement(text)
+		if !ok {
 			continue
 		}
 
-		// Parse statement: toolName key1=val1 key2=val2 ...
-		parts := tokenize(stmt)
-		if len(parts) == 0 {
-			continue
-		}
-
-		toolName := parts[0]
+		toolName := stmt.Tool
 		handler, exists := toolMap[toolName]
 		if !exists {
 			return fmt.Errorf("unknown tool: %s", toolName)
 		}
-
-		// Parse arguments
-		args := make(map[string]interface{})
-		for _, part := range parts[1:] {
-			if strings.Contains(part, "=") {
-				kv := strings.SplitN(part, "=", 2)
-				if len(kv) == 2 {
-					key := strings.TrimSpace(kv[0])
-					val := strings.TrimSpace(kv[1])
-
-					// Handle quoted strings
-					if strings.HasPrefix(val, "\"") && strings.HasSuffix(val, "\"") && len(val) >= 2 {
-						val = val[1 : len(val)-1]
-					}
-
-					// Try to parse as number or boolean
-					if numVal, err := strconv.ParseFloat(val, 64); err == nil {
-						args[key] = numVal
-					} else if val == "true" {
-						args[key] = true
-					} else if val == "false" {
-						args[key] = false
-					} else {
-						args[key] = val
-					}
-				}
-			}
-		}
+		args := stmt.Args
 
 		// Execute the tool
 		result, err := handler(args)
@@ -144,8 +144,8 @@ func (s *MCPServer) ServeSSE(port string, basePath string, authEnabled bool) err
 }
 
 // ListenAndServe starts the MCP server based on the listen string.
-// It supports TCP (default), HTTP, and SSE protocols.
-// For HTTP and SSE protocols, authEnabled controls Bearer token authentication.
+// It supports TCP (default), HTTP, SSE, WebSocket and Unix socket protocols.
+// For all but TCP, authEnabled controls Bearer token authentication.
 func (s *MCPServer) ListenAndServe(listen string, authEnabled bool) error {
 	if listen == "" {
 		// Default stdin/stdout mode
@@ -163,6 +163,10 @@ func (s *MCPServer) ListenAndServe(listen string, authEnabled bool) error {
 		return s.ServeHTTP(config.Port, config.BasePath, authEnabled)
 	case "sse":
 		return s.ServeSSE(config.Port, config.BasePath, authEnabled)
+	case "ws":
+		return s.ServeWebSocket(config.Port, config.BasePath, authEnabled)
+	case "unix":
+		return s.ServeUnix(config.Address, authEnabled)
 	default: // "tcp"
 		return s.ServeTCP(config.Address)
 	}
@@ -212,7 +216,7 @@ func (s *MCPServer) sseHandler(w http.ResponseWriter, r *http.Request, mcpPath s
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	respChan := make(chan JSONRPCResponse, 100)
+	respChan := make(chan interface{}, 100)
 	session := &sseSession{
 		bearerToken: rawToken,
 		authResult:  authResult,
@@ -305,6 +309,7 @@ func (s *MCPServer) sseMCPHandler(w http.ResponseWriter, r *http.Request) {
 		if authResult != nil {
 			ctx = authResult.Apply(ctx)
 		}
+		ctx = withRequestScope(ctx, "http", nil)
 		resp := s.processRequestWithContext(ctx, req)
 		if resp.ID == nil {
 			w.WriteHeader(http.StatusNoContent)
@@ -355,6 +360,13 @@ func (s *MCPServer) sseMCPHandler(w http.ResponseWriter, r *http.Request) {
 	if session.timer != nil && s.httpSecurity.SessionTimeout > 0 {
 		session.timer.Reset(s.httpSecurity.SessionTimeout)
 	}
+	ctx = withRequestScope(ctx, "sse:"+sessionID, func(notification JSONRPCNotification) {
+		select {
+		case session.respChan <- notification:
+		case <-session.done:
+		default:
+		}
+	})
 	resp := s.processRequestWithContext(ctx, req)
 	if resp.ID != nil {
 		if err := s.enqueueSSEResponse(sessionID, resp); err != nil {
@@ -442,6 +454,8 @@ func (s *MCPServer) httpHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Progress cannot be streamed back in a plain HTTP response
+	ctx = withRequestScope(ctx, "http:"+r.Header.Get("Mcp-Session-Id"), nil)
 	resp := s.processRequestWithContext(ctx, req)
 	if resp.ID == nil {
 		w.WriteHeader(http.StatusNoContent)
@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -17,10 +19,10 @@ import (
 
 // ListenConfig represents the parsed configuration from a listen string
 type ListenConfig struct {
-	Protocol string // "tcp", "http", or "sse"
-	Address  string // For TCP: the full host:port string
-	Port     string // For HTTP/SSE: the port number
-	BasePath string // For HTTP/SSE: the base path (e.g., "/mcp")
+	Protocol string // "tcp", "http", "sse", "ws", or "unix"
+	Address  string // For TCP: the full host:port string, for Unix: the socket path
+	Port     string // For HTTP/SSE/WebSocket: the port number
+	BasePath string // For HTTP/SSE/WebSocket: the base path (e.g., "/mcp")
 }
 
 // ParseListenString parses a listen string into protocol, address/port, and base path
@@ -49,6 +51,25 @@ func ParseListenString(listen string) (ListenConfig, error) {
 			Port:     port,
 			BasePath: basePath,
 		}, nil
+	} else if strings.HasPrefix(listen, "ws://") {
+		port, basePath, err := parseListenURL(listen)
+		if err != nil {
+			return ListenConfig{}, fmt.Errorf("invalid WebSocket URL format")
+		}
+		return ListenConfig{
+			Protocol: "ws",
+			Port:     port,
+			BasePath: basePath,
+		}, nil
+	} else if strings.HasPrefix(listen, "unix://") {
+		path := strings.TrimPrefix(listen, "unix://")
+		if path == "" {
+			return ListenConfig{}, fmt.Errorf("invalid Unix socket URL format")
+		}
+		return ListenConfig{
+			Protocol: "unix",
+			Address:  path,
+		}, nil
 	} else {
 		// TCP mode (default)
 		return ListenConfig{
@@ -104,6 +125,7 @@ type ToolDefinition struct {
 	Name          string                 `json:"name"`
 	Description   string                 `json:"description"`
 	InputSchema   map[string]interface{} `json:"inputSchema"`
+	OutputSchema  map[string]interface{} `json:"outputSchema,omitempty"`
 	UsageExamples string                 `json:"usageExamples,omitempty"`
 }
 
@@ -117,7 +139,7 @@ type ToolCallParams struct {
 type sseSession struct {
 	bearerToken string
 	authResult  *AuthResult
-	respChan    chan JSONRPCResponse
+	respChan    chan interface{}
 	done        chan struct{}
 	doneOnce    sync.Once
 	timer       *time.Timer
@@ -214,20 +236,34 @@ type MCPServer struct {
 	prompts                []PromptDefinition
 	resources              []ResourceDefinition
 	resourceHandlers       map[string]ResourceHandler
+	resourceTemplates      []resourceTemplate
+	resourceLister         func() []ResourceDefinition
+	subscriptions          map[string]bool                    // Resource URIs clients subscribed to
+	subMu                  sync.Mutex                         // Protects subscriptions
+	inflight               map[string]context.CancelCauseFunc // Cancels of the requests being handled
+	inflightMu             sync.Mutex                         // Protects inflight
+	completions            map[string]CompletionHandler       // Completion handlers by reference and argument
+	logLevel               LogLevel                           // Minimum level of the logs sent to the client
+	logMu                  sync.Mutex                         // Protects logLevel
+	pageSize               int                                // Items per page of the list methods, 0 = all
+	serverName             string
+	serverVersion          string
 	logFile                io.Writer
 	bufr                   *bufio.Reader
 	useHeaders             bool
 	authEnabled            bool
-	sseSessions            map[string]*sseSession // SSE session state
-	httpSecurity           HTTPSecurity           // HTTP security configuration
-	limiter                *rateLimiter           // Per-IP rate limiter (nil = unlimited)
-	sseMu                  sync.RWMutex           // Protects SSE connection/session state
-	currentCtx             context.Context        // Current request context (for stdio mode)
-	authenticator          AuthenticatorFunc      // Optional token validator/transformer
-	verbose                bool                   // Enable verbose logging for HTTP mode
-	responseMode           ResponseMode           // Controls content/structuredContent in responses
-	maxHTTPRequestBodySize int64                  // Maximum allowed HTTP request body size in bytes
-	writeMu                sync.Mutex             // Serializes stdio/TCP response writes
+	sseSessions            map[string]*sseSession               // SSE session state
+	httpSecurity           HTTPSecurity                         // HTTP security configuration
+	limiter                *rateLimiter                         // Per-IP rate limiter (nil = unlimited)
+	sseMu                  sync.RWMutex                         // Protects SSE connection/session state
+	conns                  map[string]func(JSONRPCNotification) // WebSocket sessions by id
+	connMu                 sync.Mutex                           // Protects conns
+	currentCtx             context.Context                      // Current request context (for stdio mode)
+	authenticator          AuthenticatorFunc                    // Optional token validator/transformer
+	verbose                bool                                 // Enable verbose logging for HTTP mode
+	responseMode           ResponseMode                         // Controls content/structuredContent in responses
+	maxHTTPRequestBodySize int64                                // Maximum allowed HTTP request body size in bytes
+	writeMu                sync.Mutex                           // Serializes stdio/TCP response writes
 }
 
 // ToolHandler is a function that handles a tool call (legacy, no context)
@@ -290,8 +326,11 @@ type Tool struct {
 	Name          string
 	Description   string
 	InputSchema   map[string]interface{}
+	OutputSchema  map[string]interface{}
 	UsageExamples string
 	Handler       ToolHandler
+	// HandlerWithContext is used instead of Handler when set
+	HandlerWithContext ToolHandlerWithContext
 }
 
 // ToolWithContext represents a complete tool definition with context-aware handler
@@ -356,12 +395,17 @@ func NewMCPServerFromTools(tools []Tool) *MCPServer {
 			Name:          tool.Name,
 			Description:   tool.Description,
 			InputSchema:   tool.InputSchema,
+			OutputSchema:  tool.OutputSchema,
 			UsageExamples: tool.UsageExamples,
 		})
 	}
 	server := NewMCPServer(defs)
 	for _, tool := range tools {
-		server.RegisterTool(tool.Name, tool.Handler)
+		if tool.HandlerWithContext != nil {
+			server.RegisterToolWithContext(tool.Name, tool.HandlerWithContext)
+		} else {
+			server.RegisterTool(tool.Name, tool.Handler)
+		}
 	}
 	return server
 }
@@ -377,11 +421,7 @@ func (s *MCPServer) processPromptsList(req JSONRPCRequest) JSONRPCResponse {
 	for _, p := range s.prompts {
 		list = append(list, promptMeta{Name: p.Name, Description: p.Description, Arguments: p.Arguments})
 	}
-	return JSONRPCResponse{
-		JSONRPC: "2.0",
-		ID:      req.ID,
-		Result:  map[string]interface{}{"prompts": list},
-	}
+	return listResult(s, req, "prompts", list)
 }
 
 // processPromptsGet handles prompts/get
@@ -466,13 +506,11 @@ func (s *MCPServer) processPromptsApply(req JSONRPCRequest) JSONRPCResponse {
 
 // processResourcesList handles resources/list
 func (s *MCPServer) processResourcesList(req JSONRPCRequest) JSONRPCResponse {
-	return JSONRPCResponse{
-		JSONRPC: "2.0",
-		ID:      req.ID,
-		Result: map[string]interface{}{
-			"resources": s.resources,
-		},
+	resources := s.resources
+	if s.resourceLister != nil {
+		resources = append(append([]ResourceDefinition{}, s.resources...), s.resourceLister()...)
 	}
+	return listResult(s, req, "resources", resources)
 }
 
 // processResourcesRead handles resources/read
@@ -485,7 +523,7 @@ func (s *MCPServer) processResourcesRead(req JSONRPCRequest) JSONRPCResponse {
 			Error:   &RPCError{Code: -32602, Message: "Invalid params"},
 		}
 	}
-	handler, exists := s.resourceHandlers[params.URI]
+	content, mimeType, exists, err := s.readResource(params.URI)
 	if !exists {
 		return JSONRPCResponse{
 			JSONRPC: "2.0",
@@ -493,7 +531,6 @@ func (s *MCPServer) processResourcesRead(req JSONRPCRequest) JSONRPCResponse {
 			Error:   &RPCError{Code: -32601, Message: "Resource not found: " + params.URI},
 		}
 	}
-	content, err := handler(params.URI)
 	if err != nil {
 		return JSONRPCResponse{
 			JSONRPC: "2.0",
@@ -504,9 +541,12 @@ func (s *MCPServer) processResourcesRead(req JSONRPCRequest) JSONRPCResponse {
 	var contents []interface{}
 	switch v := content.(type) {
 	case string:
+		if mimeType == "" {
+			mimeType = "text/plain"
+		}
 		contents = []interface{}{map[string]interface{}{
 			"uri":      params.URI,
-			"mimeType": "text/plain",
+			"mimeType": mimeType,
 			"text":     v,
 		}}
 	case []byte:
@@ -701,34 +741,82 @@ func (s *MCPServer) SetResources(resources []ResourceDefinition) {
 // Start starts the MCP server and begins processing requests
 func (s *MCPServer) Start() {
 	s.ensureDefaultIO()
-	for {
-		payload, err := s.readNextMessage()
-		if err == io.EOF {
-			return
-		}
+	ctx := withRequestScope(s.currentCtx, "stdio", s.writeNotification)
+	s.serve(ctx, s.readNextMessage, s.writeResponse)
+}
+
+// serve handles the messages returned by read until it fails with io.EOF,
+// writing the responses with write. Requests are handled in order by the
+// calling goroutine while the reader keeps consuming the input, so
+// cancellations reach in-flight requests.
+func (s *MCPServer) serve(ctx context.Context, read func() ([]byte, error), write func([]byte)) {
+	type pendingRequest struct {
+		ctx    context.Context
+		req    JSONRPCRequest
+		finish func()
+	}
+	send := func(resp JSONRPCResponse) {
+		data, err := json.Marshal(resp)
 		if err != nil {
-			// Cannot parse a request ID here; send generic parse error with null id
-			s.sendError(nil, -32700, "Parse error: "+err.Error())
-			continue
+			data, _ = json.Marshal(JSONRPCResponse{
+				JSONRPC: "2.0",
+				Error:   &RPCError{Code: -32700, Message: "Failed to marshal response"},
+			})
 		}
-		if s.logFile != nil && len(payload) > 0 {
-			if _, err := s.logFile.Write(append(payload, '\n')); err != nil {
-				log.Printf("Failed to write to log file: %v", err)
+		write(data)
+	}
+	parseError := func(message string) {
+		// Cannot parse a request ID here; send generic parse error with null id
+		send(JSONRPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: -32700, Message: message}})
+	}
+	queue := make(chan pendingRequest, 64)
+	go func() {
+		defer close(queue)
+		for {
+			payload, err := read()
+			if err == io.EOF {
+				return
 			}
+			if err != nil {
+				parseError("Parse error: " + err.Error())
+				continue
+			}
+			s.logPayload(payload)
+			var req JSONRPCRequest
+			if err := json.Unmarshal(payload, &req); err != nil {
+				parseError("Parse error: invalid JSON")
+				continue
+			}
+			if req.Method == "notifications/cancelled" {
+				s.cancelRequest(ctx, req.Params)
+				continue
+			}
+			reqCtx, finish := s.trackRequest(ctx, req)
+			queue <- pendingRequest{ctx: reqCtx, req: req, finish: finish}
 		}
-		var req JSONRPCRequest
-		if err := json.Unmarshal(payload, &req); err != nil {
-			s.sendError(nil, -32700, "Parse error: invalid JSON")
-			continue
-		}
+	}()
 
-		resp := s.processRequest(req)
+	for pending := range queue {
+		resp := s.processRequestWithContext(pending.ctx, pending.req)
+		pending.finish()
 		if resp.ID != nil {
-			s.sendResponse(resp)
+			send(resp)
 		}
 	}
 }
 
+// logPayload appends a message to the log file, when set
+func (s *MCPServer) logPayload(data []byte) {
+	if s.logFile == nil || len(data) == 0 {
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if _, err := s.logFile.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write to log file: %v", err)
+	}
+}
+
 func (s *MCPServer) messageFramer() messageFramer {
 	return messageFramer{
 		input:      s.input,
@@ -743,39 +831,14 @@ func (s *MCPServer) messageFramer() messageFramer {
 func (s *MCPServer) readNextMessage() ([]byte, error) {
 	framer := s.messageFramer()
 	body, err := framer.readNextMessage()
+	// Responses are written concurrently with the reads in Start
+	s.writeMu.Lock()
 	s.bufr = framer.bufr
 	s.useHeaders = framer.useHeaders
+	s.writeMu.Unlock()
 	return body, err
 }
 
-// sendError sends an error JSON-RPC response
-func (s *MCPServer) sendError(id interface{}, code int, message string) {
-	errObj := RPCError{Code: code, Message: message}
-	resp := JSONRPCResponse{JSONRPC: "2.0", ID: id, Error: &errObj}
-	data, err := json.Marshal(resp)
-	if err != nil {
-		log.Printf("Failed to marshal error response: %v", err)
-		resp.ID = nil
-		data, err = json.Marshal(resp)
-		if err != nil {
-			log.Printf("Failed to marshal fallback error response: %v", err)
-			return
-		}
-	}
-	s.writeResponse(data)
-}
-
-// sendResponse sends a JSON-RPC response
-func (s *MCPServer) sendResponse(resp JSONRPCResponse) {
-	data, err := json.Marshal(resp)
-	if err != nil {
-		// Fallback
-		s.sendError(nil, -32700, "Failed to marshal response")
-		return
-	}
-	s.writeResponse(data)
-}
-
 func (s *MCPServer) writeResponse(data []byte) {
 	s.writeMu.Lock()
 	defer s.writeMu.Unlock()
@@ -797,6 +860,7 @@ type MCPClient struct {
 	bufr       *bufio.Reader
 	requestID  int
 	useHeaders bool
+	closer     io.Closer // Connection opened by DialMCPClient
 }
 
 // NewMCPClient creates a new MCP client with stdin/stdout
@@ -822,13 +886,48 @@ func (c *MCPClient) SetIO(r io.Reader, w io.Writer) {
 	}
 }
 
+// DialMCPClient connects a client to an MCP server listening on a
+// ws://, wss:// or unix:// URL, or a TCP host:port. The token, when set,
+// is sent as a Bearer token in the WebSocket handshake.
+func DialMCPClient(target string, token string) (*MCPClient, error) {
+	var conn io.ReadWriteCloser
+	if IsWebSocketURL(target) {
+		header := make(http.Header)
+		if token != "" {
+			header.Set("Authorization", "Bearer "+token)
+		}
+		ws, err := DialWebSocket(target, header, defaultMaxHTTPRequestBodySize)
+		if err != nil {
+			return nil, err
+		}
+		conn = ws
+	} else {
+		tcp, err := net.Dial("tcp", target)
+		if err != nil {
+			return nil, err
+		}
+		conn = tcp
+	}
+	c := &MCPClient{requestID: 1, closer: conn}
+	c.SetIO(conn, conn)
+	return c, nil
+}
+
+// Close closes the connection opened by DialMCPClient
+func (c *MCPClient) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
+
 // Initialize sends the initialize request and waits for response
 func (c *MCPClient) Initialize() error {
 	req := JSONRPCRequest{
 		JSONRPC: "2.0",
 		ID:      c.requestID,
 		Method:  "initialize",
-		Params:  json.RawMessage(`{"protocolVersion": "2024-11-05"}`),
+		Params:  json.RawMessage(`{"protocolVersion": "` + LatestProtocolVersion + `", "capabilities": {}, "clientInfo": {"name": "mcplib", "version": "0.1.0"}}`),
 	}
 	c.requestID++
 
@@ -852,6 +951,11 @@ func (c *MCPClient) Initialize() error {
 	if resp.Error != nil {
 		return fmt.Errorf("initialize error: %s", resp.Error.Message)
 	}
+	if result, ok := resp.Result.(map[string]interface{}); ok {
+		if version, _ := result["protocolVersion"].(string); version != "" && !isSupportedProtocolVersion(version) {
+			return fmt.Errorf("unsupported protocol version: %s", version)
+		}
+	}
 
 	// Send initialized notification
 	notif := JSONRPCRequest{
@@ -867,58 +971,83 @@ func (c *MCPClient) Initialize() error {
 	return nil
 }
 
-// ListTools sends the tools/list request and returns available tools
+// ListTools sends tools/list requests and returns the available tools of
+// all the pages
 func (c *MCPClient) ListTools() ([]ToolDefinition, error) {
-	req := JSONRPCRequest{
-		JSONRPC: "2.0",
-		ID:      c.requestID,
-		Method:  "tools/list",
-	}
-	c.requestID++
-
-	data, err := json.Marshal(req)
-	if err != nil {
-		return nil, err
-	}
-	c.writeFramed(data)
+	var tools []ToolDefinition
+	err := c.listAll("tools/list", "tools", func(data []byte) error {
+		var page []ToolDefinition
+		if err := json.Unmarshal(data, &page); err != nil {
+			return err
+		}
+		tools = append(tools, page...)
+		return nil
+	})
+	return tools, err
+}
 
-	// Read response
-	respData, err := c.readNextMessage()
-	if err != nil {
-		return nil, err
-	}
+// listAll sends a list request and the ones following its nextCursor,
+// passing the key field of every result to add
+func (c *MCPClient) listAll(method, key string, add func(data []byte) error) error {
+	cursor := ""
+	for {
+		req := JSONRPCRequest{
+			JSONRPC: "2.0",
+			ID:      c.requestID,
+			Method:  method,
+		}
+		if cursor != "" {
+			params, err := json.Marshal(map[string]string{"cursor": cursor})
+			if err != nil {
+				return err
+			}
+			req.Params = params
+		}
+		c.requestID++
 
-	var resp JSONRPCResponse
-	if err := json.Unmarshal(respData, &resp); err != nil {
-		return nil, err
-	}
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		c.writeFramed(data)
 
-	if resp.Error != nil {
-		return nil, fmt.Errorf("tools/list error: %s", resp.Error.Message)
-	}
+		// Read response
+		respData, err := c.readNextMessage()
+		if err != nil {
+			return err
+		}
 
-	// Parse tools from result
-	result, ok := resp.Result.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid tools/list response")
-	}
+		var resp JSONRPCResponse
+		if err := json.Unmarshal(respData, &resp); err != nil {
+			return fmt.Errorf("failed to parse JSON response: %v", err)
+		}
 
-	toolsData, ok := result["tools"]
-	if !ok {
-		return nil, fmt.Errorf("no tools in response")
-	}
+		if resp.Error != nil {
+			return fmt.Errorf("%s error: %s", method, resp.Error.Message)
+		}
 
-	toolsJSON, err := json.Marshal(toolsData)
-	if err != nil {
-		return nil, err
-	}
+		result, ok := resp.Result.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid %s response", method)
+		}
+		items, ok := result[key]
+		if !ok {
+			return fmt.Errorf("no %s in response", key)
+		}
+		itemsJSON, err := json.Marshal(items)
+		if err != nil {
+			return err
+		}
+		if err := add(itemsJSON); err != nil {
+			return err
+		}
 
-	var tools []ToolDefinition
-	if err := json.Unmarshal(toolsJSON, &tools); err != nil {
-		return nil, err
+		next, _ := result["nextCursor"].(string)
+		if next == "" || next == cursor {
+			return nil
+		}
+		cursor = next
 	}
-
-	return tools, nil
 }
 
 // CallTool sends a tools/call request and returns the result
@@ -994,13 +1123,26 @@ func (c *MCPClient) messageFramer() messageFramer {
 	}
 }
 
-// readNextMessage reads the next JSON-RPC message body
+// readNextMessage reads the next JSON-RPC message body, skipping the
+// notifications sent by the server
 func (c *MCPClient) readNextMessage() ([]byte, error) {
-	framer := c.messageFramer()
-	body, err := framer.readNextMessage()
-	c.bufr = framer.bufr
-	c.useHeaders = framer.useHeaders
-	return body, err
+	for {
+		framer := c.messageFramer()
+		body, err := framer.readNextMessage()
+		c.bufr = framer.bufr
+		c.useHeaders = framer.useHeaders
+		if err != nil {
+			return body, err
+		}
+		var msg struct {
+			ID     interface{} `json:"id"`
+			Method string      `json:"method"`
+		}
+		if json.Unmarshal(body, &msg) == nil && msg.ID == nil && msg.Method != "" {
+			continue
+		}
+		return body, nil
+	}
 }
 
 // writeFramed writes JSON payload using header framing if enabled
@@ -1008,58 +1150,19 @@ func (c *MCPClient) writeFramed(data []byte) {
 	c.messageFramer().writeFramed(data)
 }
 
-// ListResources sends the resources/list request and returns available resources
+// ListResources sends resources/list requests and returns the available
+// resources of all the pages
 func (c *MCPClient) ListResources() ([]ResourceDefinition, error) {
-	req := JSONRPCRequest{
-		JSONRPC: "2.0",
-		ID:      c.requestID,
-		Method:  "resources/list",
-	}
-	c.requestID++
-
-	data, err := json.Marshal(req)
-	if err != nil {
-		return nil, err
-	}
-	c.writeFramed(data)
-
-	// Read response
-	respData, err := c.readNextMessage()
-	if err != nil {
-		return nil, err
-	}
-
-	var resp JSONRPCResponse
-	if err := json.Unmarshal(respData, &resp); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON response: %v", err)
-	}
-
-	if resp.Error != nil {
-		return nil, fmt.Errorf("resources/list error: %s", resp.Error.Message)
-	}
-
-	// Parse resources from result
-	result, ok := resp.Result.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid resources/list response")
-	}
-
-	resourcesData, ok := result["resources"]
-	if !ok {
-		return nil, fmt.Errorf("no resources in response")
-	}
-
-	resourcesJSON, err := json.Marshal(resourcesData)
-	if err != nil {
-		return nil, err
-	}
-
 	var resources []ResourceDefinition
-	if err := json.Unmarshal(resourcesJSON, &resources); err != nil {
-		return nil, err
-	}
-
-	return resources, nil
+	err := c.listAll("resources/list", "resources", func(data []byte) error {
+		var page []ResourceDefinition
+		if err := json.Unmarshal(data, &page); err != nil {
+			return err
+		}
+		resources = append(resources, page...)
+		return nil
+	})
+	return resources, err
 }
 
 // ReadResource sends a resources/read request and returns the resource content
@@ -1159,56 +1262,45 @@ func (s *MCPServer) SetPrompts(prompts []PromptDefinition) {
 	s.prompts = prompts
 }
 
-// processRequest processes a JSON-RPC request and returns the response
-func (s *MCPServer) processRequest(req JSONRPCRequest) JSONRPCResponse {
-	return s.processRequestWithContext(s.currentCtx, req)
+// processRequestWithContext processes a JSON-RPC request with context and
+// returns the response. Requests cancelled by the client get a response
+// without ID, as they must not be answered.
+func (s *MCPServer) processRequestWithContext(ctx context.Context, req JSONRPCRequest) JSONRPCResponse {
+	if req.Method == "notifications/cancelled" {
+		s.cancelRequest(ctx, req.Params)
+		return JSONRPCResponse{JSONRPC: "2.0"}
+	}
+	if _, tracked := ctx.Value(requestInfoKey{}).(*requestInfo); !tracked {
+		var finish func()
+		ctx, finish = s.trackRequest(ctx, req)
+		defer finish()
+	}
+	resp := s.dispatchRequest(ctx, req)
+	if errors.Is(context.Cause(ctx), ErrRequestCancelled) {
+		resp.ID = nil
+	}
+	return resp
 }
 
-// processRequestWithContext processes a JSON-RPC request with context and returns the response
-func (s *MCPServer) processRequestWithContext(ctx context.Context, req JSONRPCRequest) JSONRPCResponse {
+// dispatchRequest runs the handler of the request method
+func (s *MCPServer) dispatchRequest(ctx context.Context, req JSONRPCRequest) JSONRPCResponse {
 	switch req.Method {
 	case "initialize":
-		var initParams struct {
-			ProtocolVersion string `json:"protocolVersion"`
-		}
-		_ = json.Unmarshal(req.Params, &initParams)
-		proto := initParams.ProtocolVersion
-		if proto == "" {
-			proto = "2024-11-05"
-		}
-		caps := map[string]interface{}{"tools": map[string]interface{}{}}
-		if len(s.prompts) > 0 {
-			caps["prompts"] = map[string]interface{}{}
-		} else {
-			caps["prompts"] = map[string]interface{}{}
-		}
-		if len(s.resources) > 0 {
-			caps["resources"] = map[string]interface{}{}
-		} else {
-			caps["resources"] = map[string]interface{}{}
-		}
+		return s.processInitialize(req)
+	case "ping":
 		return JSONRPCResponse{
 			JSONRPC: "2.0",
 			ID:      req.ID,
-			Result: map[string]interface{}{
-				"protocolVersion": proto,
-				"capabilities":    caps,
-				"serverInfo": map[string]interface{}{
-					"name":    "nsmcp",
-					"version": "0.1.0",
-				},
-			},
+			Result:  map[string]interface{}{},
 		}
+	case "logging/setLevel":
+		return s.processLoggingSetLevel(req)
+	case "completion/complete":
+		return s.processCompletionComplete(ctx, req)
 	case "notifications/initialized":
 		return JSONRPCResponse{JSONRPC: "2.0"} // No ID, no response
 	case "tools/list":
-		return JSONRPCResponse{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-			Result: map[string]interface{}{
-				"tools": s.tools,
-			},
-		}
+		return listResult(s, req, "tools", s.tools)
 	case "tools/call":
 		return s.processCallWithContext(ctx, req)
 	case "prompts/list":
@@ -1221,6 +1313,12 @@ func (s *MCPServer) processRequestWithContext(ctx context.Context, req JSONRPCRe
 		return s.processResourcesList(req)
 	case "resources/read":
 		return s.processResourcesRead(req)
+	case "resources/templates/list":
+		return s.processResourceTemplatesList(req)
+	case "resources/subscribe":
+		return s.processResourcesSubscribe(req, true)
+	case "resources/unsubscribe":
+		return s.processResourcesSubscribe(req, false)
 	default:
 		return JSONRPCResponse{
 			JSONRPC: "2.0",
@@ -1281,14 +1379,29 @@ func (s *MCPServer) formatToolResult(id interface{}, result interface{}, err err
 	switch v := result.(type) {
 	case string:
 		return s.buildToolResponse(id, v, v, false)
+	case structuredResult:
+		// Tools declaring an output schema must return structured content
+		text := fmt.Sprintf("%v", v.value)
+		if b, e := json.MarshalIndent(v.value, "", "  "); e == nil {
+			text = string(b)
+		}
+		return JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      id,
+			Result: map[string]interface{}{
+				"isError":           false,
+				"content":           []interface{}{map[string]interface{}{"type": "text", "text": text}},
+				"structuredContent": v.value,
+			},
+		}
 	case ToolCallResult:
 		out := map[string]interface{}{"isError": v.IsError}
-		if s.responseMode == ResponseModeStructured || s.responseMode == ResponseModeBoth {
-			if v.StructuredContent != nil {
-				out["structuredContent"] = v.StructuredContent
-			} else if v.Content != nil {
-				out["structuredContent"] = v.Content
-			}
+		// Structured content set by the tool is always returned, the
+		// content is only copied into it when the response mode asks
+		if v.StructuredContent != nil {
+			out["structuredContent"] = v.StructuredContent
+		} else if v.Content != nil && (s.responseMode == ResponseModeStructured || s.responseMode == ResponseModeBoth) {
+			out["structuredContent"] = v.Content
 		}
 		if s.responseMode == ResponseModeContent || s.responseMode == ResponseModeBoth {
 			if v.Content != nil {
@@ -0,0 +1,97 @@
+package mcplib
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// LogLevel is the severity of a log message sent to the client, as defined
+// by RFC 5424
+type LogLevel string
+
+const (
+	LogDebug     LogLevel = "debug"
+	LogInfo      LogLevel = "info"
+	LogNotice    LogLevel = "notice"
+	LogWarning   LogLevel = "warning"
+	LogError     LogLevel = "error"
+	LogCritical  LogLevel = "critical"
+	LogAlert     LogLevel = "alert"
+	LogEmergency LogLevel = "emergency"
+)
+
+var logLevelSeverity = map[LogLevel]int{
+	LogDebug:     0,
+	LogInfo:      1,
+	LogNotice:    2,
+	LogWarning:   3,
+	LogError:     4,
+	LogCritical:  5,
+	LogAlert:     6,
+	LogEmergency: 7,
+}
+
+// processLoggingSetLevel handles logging/setLevel
+func (s *MCPServer) processLoggingSetLevel(req JSONRPCRequest) JSONRPCResponse {
+	var params struct {
+		Level LogLevel `json:"level"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error:   &RPCError{Code: -32602, Message: "Invalid params"},
+		}
+	}
+	if _, ok := logLevelSeverity[params.Level]; !ok {
+		return JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error:   &RPCError{Code: -32602, Message: "Invalid log level: " + string(params.Level)},
+		}
+	}
+	s.logMu.Lock()
+	s.logLevel = params.Level
+	s.logMu.Unlock()
+	return JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  map[string]interface{}{},
+	}
+}
+
+// logEnabled reports whether messages of the level reach the client. Until
+// the client sets a level, info and above are sent.
+func (s *MCPServer) logEnabled(level LogLevel) bool {
+	severity, ok := logLevelSeverity[level]
+	if !ok {
+		return false
+	}
+	s.logMu.Lock()
+	min := s.logLevel
+	s.logMu.Unlock()
+	if min == "" {
+		min = LogInfo
+	}
+	return severity >= logLevelSeverity[min]
+}
+
+// Log sends a log message to the client of the request handled with ctx as
+// notifications/message. data is any JSON value. Messages below the level
+// set by the client with logging/setLevel are dropped, as are messages sent
+// outside a request or over transports that cannot notify while a request
+// is in flight.
+func Log(ctx context.Context, level LogLevel, data interface{}) {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok || info.notify == nil || info.server == nil || !info.server.logEnabled(level) {
+		return
+	}
+	params := map[string]interface{}{
+		"level": level,
+		"data":  data,
+	}
+	if name, _ := info.server.serverInfo()["name"].(string); name != "" {
+		params["logger"] = name
+	}
+	info.notify(JSONRPCNotification{JSONRPC: "2.0", Method: "notifications/message", Params: params})
+}
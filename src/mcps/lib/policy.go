@@ -0,0 +1,739 @@
+package mcplib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CommandPolicy decides which shell command lines produced by a model are
+// run. Every simple command of a line, including the ones inside command
+// substitutions and sh -c arguments, is checked against the rules and for
+// dangerous constructs. The zero value only refuses dangerous constructs.
+type CommandPolicy struct {
+	// Default is "allow" (the default) or "deny", the action for commands
+	// matching no rule
+	Default string `json:"default,omitempty"`
+
+	// Rules are evaluated in order, the first rule matching a program
+	// decides
+	Rules []CommandRule `json:"rules,omitempty"`
+
+	// Dirs lists the directories output can be redirected to besides the
+	// one the command runs in and the temporary directory
+	Dirs []string `json:"dirs,omitempty"`
+
+	// AllowDangerous disables the checks of dangerous constructs
+	AllowDangerous bool `json:"allow_dangerous,omitempty"`
+}
+
+// CommandRule allows or denies a program. A rule with flags or paths only
+// matches commands given one of them.
+type CommandRule struct {
+	// Action is "allow" or "deny"
+	Action string `json:"action"`
+	// Program is a glob matched against the program name, like "git" or
+	// "python*". Empty or "*" matches any program.
+	Program string `json:"program,omitempty"`
+	// Flags matches options like "-f", also found in groups like "-rf",
+	// or "--force", also matching "--force=value"
+	Flags []string `json:"flags,omitempty"`
+	// Paths matches path arguments and redirection targets with globs.
+	// Relative paths are resolved against the directory the command runs
+	// in, ~ is the home directory and a trailing /** matches a directory
+	// and everything below it.
+	Paths []string `json:"paths,omitempty"`
+	// Reason is told to the model when the rule refuses a command
+	Reason string `json:"reason,omitempty"`
+}
+
+// CommandRefusal explains why a command line was refused
+type CommandRefusal struct {
+	// Command is the refused command line
+	Command string `json:"command"`
+	// Segment is the simple command that was refused
+	Segment string `json:"segment,omitempty"`
+	// Rule describes the rule or check refusing the command
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+	// Hint suggests what to do instead
+	Hint string `json:"hint,omitempty"`
+}
+
+func (r *CommandRefusal) Error() string {
+	return "command refused: " + r.Reason
+}
+
+// ToolResult returns the refusal as an error result of a tool call, so the
+// model can adapt its next command
+func (r *CommandRefusal) ToolResult() ToolCallResult {
+	text := fmt.Sprintf("Command refused by policy (%s): %s", r.Rule, r.Reason)
+	if r.Segment != "" && r.Segment != r.Command {
+		text += "\nRefused part: " + r.Segment
+	}
+	if r.Hint != "" {
+		text += "\nHint: " + r.Hint
+	}
+	return ToolCallResult{
+		Content: []any{map[string]any{"type": "text", "text": text}},
+		StructuredContent: map[string]any{
+			"refused": true,
+			"command": r.Command,
+			"segment": r.Segment,
+			"rule":    r.Rule,
+			"reason":  r.Reason,
+			"hint":    r.Hint,
+		},
+		IsError: true,
+	}
+}
+
+// LoadCommandPolicy reads a JSON command policy. When path is empty the
+// file named by MCPLIB_COMMAND_POLICY is read, and without either the
+// zero policy is returned.
+func LoadCommandPolicy(path string) (*CommandPolicy, error) {
+	if path == "" {
+		path = os.Getenv("MCPLIB_COMMAND_POLICY")
+	}
+	if path == "" {
+		return &CommandPolicy{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p CommandPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid command policy %s: %v", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid command policy %s: %v", path, err)
+	}
+	return &p, nil
+}
+
+// Validate checks the actions and patterns of the policy
+func (p *CommandPolicy) Validate() error {
+	switch p.Default {
+	case "", "allow", "deny":
+	default:
+		return fmt.Errorf("unknown default action: %s", p.Default)
+	}
+	for i, rule := range p.Rules {
+		if rule.Action != "allow" && rule.Action != "deny" {
+			return fmt.Errorf("rule %d: unknown action: %q", i+1, rule.Action)
+		}
+		if _, err := path.Match(rule.Program, ""); err != nil {
+			return fmt.Errorf("rule %d: invalid program pattern: %s", i+1, rule.Program)
+		}
+		for _, pattern := range rule.Paths {
+			if _, err := filepath.Match(strings.TrimSuffix(pattern, "/**"), ""); err != nil {
+				return fmt.Errorf("rule %d: invalid path pattern: %s", i+1, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// maxPolicyDepth limits the nesting of command substitutions and sh -c
+const maxPolicyDepth = 8
+
+// Check returns why the command line may not run in dir, or nil when it
+// may
+func (p *CommandPolicy) Check(command, dir string) *CommandRefusal {
+	if p == nil {
+		return nil
+	}
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	if r := p.check(command, dir, 0); r != nil {
+		r.Command = command
+		return r
+	}
+	return nil
+}
+
+func (p *CommandPolicy) check(line, dir string, depth int) *CommandRefusal {
+	if depth > maxPolicyDepth {
+		return &CommandRefusal{Segment: line, Rule: "parse", Reason: "commands are nested too deeply to be checked", Hint: "write the commands to a script file and run it"}
+	}
+	pipelines, err := ParseCommandLine(line)
+	if err != nil {
+		return &CommandRefusal{Segment: line, Rule: "parse", Reason: fmt.Sprintf("the command line cannot be checked: %v", err), Hint: "fix the quoting of the command"}
+	}
+	for _, pipeline := range pipelines {
+		if !p.AllowDangerous {
+			if r := checkDownloadPipe(pipeline); r != nil {
+				return r
+			}
+		}
+		for _, cmd := range pipeline.Commands {
+			if r := p.checkCommand(cmd, dir, depth); r != nil {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+func (p *CommandPolicy) checkCommand(cmd ShellCommand, dir string, depth int) *CommandRefusal {
+	segment := strings.Join(cmd.Argv, " ")
+	for _, sub := range cmd.Substitutions {
+		if r := p.check(sub, dir, depth+1); r != nil {
+			return r
+		}
+	}
+	invocations := unwrapCommand(cmd.Argv)
+	if !p.AllowDangerous {
+		if r := p.checkRedirects(cmd, dir); r != nil {
+			return r
+		}
+		for _, inv := range invocations {
+			if r := checkDangerous(inv, cmd, dir); r != nil {
+				r.Segment = segment
+				return r
+			}
+		}
+	}
+	for _, inv := range invocations {
+		if r := p.checkRules(inv, cmd, dir); r != nil {
+			r.Segment = segment
+			return r
+		}
+		if script, ok := shellScriptArg(inv); ok {
+			if r := p.check(script, dir, depth+1); r != nil {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// checkRules applies the first rule matching the program
+func (p *CommandPolicy) checkRules(inv invocation, cmd ShellCommand, dir string) *CommandRefusal {
+	for i, rule := range p.Rules {
+		matched, target := rule.matches(inv, cmd, dir)
+		if !matched {
+			continue
+		}
+		if rule.Action == "allow" {
+			return nil
+		}
+		reason := rule.Reason
+		if reason == "" && target != "" {
+			reason = fmt.Sprintf("%s may not access %s", path.Base(inv.name), target)
+		} else if reason == "" {
+			reason = fmt.Sprintf("%s is not allowed", rule.describe())
+		}
+		return &CommandRefusal{
+			Rule:   fmt.Sprintf("rule %d: deny %s", i+1, rule.describe()),
+			Reason: reason,
+			Hint:   "use a different command or ask the user to run it",
+		}
+	}
+	if p.Default != "deny" {
+		return nil
+	}
+	var allowed []string
+	for _, rule := range p.Rules {
+		if rule.Action == "allow" && rule.Program != "" {
+			allowed = append(allowed, rule.Program)
+		}
+	}
+	hint := "ask the user to run it"
+	if len(allowed) > 0 {
+		hint = "allowed programs: " + strings.Join(allowed, ", ")
+	}
+	return &CommandRefusal{
+		Rule:   "default deny",
+		Reason: fmt.Sprintf("%s is not in the allowed commands", inv.name),
+		Hint:   hint,
+	}
+}
+
+func (rule CommandRule) describe() string {
+	parts := []string{rule.Program}
+	if rule.Program == "" {
+		parts[0] = "*"
+	}
+	parts = append(parts, rule.Flags...)
+	parts = append(parts, rule.Paths...)
+	return strings.Join(parts, " ")
+}
+
+// matches reports whether the rule applies to the invocation, returning
+// the path argument matched by rules with paths
+func (rule CommandRule) matches(inv invocation, cmd ShellCommand, dir string) (bool, string) {
+	if rule.Program != "" && rule.Program != "*" {
+		pattern := rule.Program
+		name := path.Base(inv.name)
+		if strings.Contains(pattern, "/") {
+			name = inv.name
+		}
+		if ok, _ := path.Match(pattern, name); !ok {
+			return false, ""
+		}
+	}
+	if len(rule.Flags) > 0 {
+		found := false
+		for _, flag := range rule.Flags {
+			if hasFlag(inv.args, flag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, ""
+		}
+	}
+	if len(rule.Paths) > 0 {
+		targets := pathArgs(inv.args)
+		for _, r := range cmd.Redirects {
+			targets = append(targets, r.Target)
+		}
+		for _, target := range targets {
+			abs := resolveCommandPath(target, dir)
+			for _, pattern := range rule.Paths {
+				if matchPath(resolveCommandPath(pattern, dir), abs) {
+					return true, abs
+				}
+			}
+		}
+		return false, ""
+	}
+	return true, ""
+}
+
+// hasFlag reports whether args give the option flag
+func hasFlag(args []string, flag string) bool {
+	short := len(flag) == 2 && flag[0] == '-' && flag[1] != '-'
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		if arg == flag || (strings.HasPrefix(flag, "--") && strings.HasPrefix(arg, flag+"=")) {
+			return true
+		}
+		if short && len(arg) > 1 && arg[0] == '-' && arg[1] != '-' && strings.IndexByte(arg[1:], flag[1]) != -1 {
+			return true
+		}
+	}
+	return false
+}
+
+// pathArgs returns the arguments that are not options
+func pathArgs(args []string) []string {
+	var paths []string
+	options := true
+	for _, arg := range args {
+		if options && arg == "--" {
+			options = false
+			continue
+		}
+		if options && strings.HasPrefix(arg, "-") {
+			continue
+		}
+		paths = append(paths, arg)
+	}
+	return paths
+}
+
+func resolveCommandPath(p, dir string) string {
+	if home, err := os.UserHomeDir(); err == nil {
+		switch {
+		case p == "~" || p == "$HOME" || p == "${HOME}":
+			p = home
+		case strings.HasPrefix(p, "~/"):
+			p = filepath.Join(home, p[2:])
+		case strings.HasPrefix(p, "$HOME/"):
+			p = filepath.Join(home, p[6:])
+		case strings.HasPrefix(p, "${HOME}/"):
+			p = filepath.Join(home, p[8:])
+		}
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	return filepath.Clean(p)
+}
+
+func matchPath(pattern, p string) bool {
+	if strings.HasSuffix(pattern, "/**") {
+		base := strings.TrimSuffix(strings.TrimSuffix(pattern, "**"), "/")
+		if base == "" {
+			return true
+		}
+		return p == base || strings.HasPrefix(p, base+"/")
+	}
+	ok, _ := filepath.Match(pattern, p)
+	return ok
+}
+
+// isUnder reports whether p is dir or inside it
+func isUnder(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// invocation is a program with its arguments, a command run by a wrapper
+// like sudo being a separate invocation
+type invocation struct {
+	name string
+	args []string
+}
+
+// commandWrappers lists the programs running another command, with the
+// options taking a value and the number of arguments before the command
+var commandWrappers = map[string]struct {
+	valueFlags string
+	skip       int
+}{
+	"sudo":    {"-u -g -C -D -h -p -r -t -U", 0},
+	"doas":    {"-u -C", 0},
+	"env":     {"-u -C -S", 0},
+	"nice":    {"-n", 0},
+	"ionice":  {"-c -n -p", 0},
+	"nohup":   {"", 0},
+	"time":    {"-f -o", 0},
+	"command": {"", 0},
+	"builtin": {"", 0},
+	"exec":    {"-a", 0},
+	"setsid":  {"", 0},
+	"stdbuf":  {"-i -o -e", 0},
+	"xargs":   {"-I -n -P -d -E -L -s -a", 0},
+	"timeout": {"-s -k", 1},
+	"watch":   {"-n -d", 0},
+	"chroot":  {"", 1},
+	"busybox": {"", 0},
+}
+
+// unwrapCommand returns the program of a command, preceded by the wrappers
+// running it
+func unwrapCommand(argv []string) []invocation {
+	var invs []invocation
+	for len(argv) > 0 {
+		for len(argv) > 0 && isAssignment(argv[0]) {
+			argv = argv[1:]
+		}
+		if len(argv) == 0 {
+			break
+		}
+		invs = append(invs, invocation{name: argv[0], args: argv[1:]})
+		wrapper, ok := commandWrappers[path.Base(argv[0])]
+		if !ok {
+			break
+		}
+		rest := argv[1:]
+		valueFlags := strings.Fields(wrapper.valueFlags)
+		for len(rest) > 0 && strings.HasPrefix(rest[0], "-") && rest[0] != "-" {
+			flag := rest[0]
+			rest = rest[1:]
+			if flag == "--" {
+				break
+			}
+			for _, vf := range valueFlags {
+				if flag == vf && len(rest) > 0 {
+					rest = rest[1:]
+				}
+			}
+		}
+		for i := 0; i < wrapper.skip && len(rest) > 0; i++ {
+			rest = rest[1:]
+		}
+		argv = rest
+	}
+	return invs
+}
+
+func isAssignment(word string) bool {
+	eq := strings.IndexByte(word, '=')
+	if eq <= 0 {
+		return false
+	}
+	for i, c := range word[:eq] {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+var shellPrograms = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true,
+	"ash": true, "fish": true, "mksh": true,
+}
+
+// shellLaunchers start a shell without naming it on their command line
+var shellLaunchers = map[string]bool{
+	"script": true, "su": true, "login": true, "tmux": true, "screen": true,
+}
+
+// RunsShell reports whether a command line starts a shell reading command
+// lines, looking through the wrappers like env, sudo and busybox that run
+// it. Wrappers given no command, programs named by an expansion and
+// command lines that cannot be parsed count as shells.
+func RunsShell(command string) bool {
+	pipelines, err := ParseCommandLine(command)
+	if err != nil {
+		return true
+	}
+	for _, pipeline := range pipelines {
+		for _, cmd := range pipeline.Commands {
+			invs := unwrapCommand(cmd.Argv)
+			for _, inv := range invs {
+				name := path.Base(inv.name)
+				if shellPrograms[name] || shellLaunchers[name] || strings.ContainsAny(inv.name, "$`") {
+					return true
+				}
+			}
+			if len(invs) > 0 {
+				if _, ok := commandWrappers[path.Base(invs[len(invs)-1].name)]; ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+var downloadPrograms = map[string]bool{"curl": true, "wget": true, "fetch": true}
+
+// isInterpreter reports whether a program runs code it is given
+func isInterpreter(name string) bool {
+	name = path.Base(name)
+	if shellPrograms[name] {
+		return true
+	}
+	for _, prefix := range []string{"python", "perl", "ruby", "node", "php"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// shellScriptArg returns the command line given to a shell with -c, or run
+// by eval
+func shellScriptArg(inv invocation) (string, bool) {
+	if path.Base(inv.name) == "eval" {
+		return strings.Join(inv.args, " "), len(inv.args) > 0
+	}
+	if !shellPrograms[path.Base(inv.name)] {
+		return "", false
+	}
+	for i, arg := range inv.args {
+		if !strings.HasPrefix(arg, "-") || arg == "--" {
+			return "", false
+		}
+		if arg[1] != '-' && strings.IndexByte(arg, 'c') != -1 {
+			for _, script := range inv.args[i+1:] {
+				if !strings.HasPrefix(script, "-") {
+					return script, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// readsScriptFromStdin reports whether an interpreter runs the code read
+// from its standard input
+func readsScriptFromStdin(inv invocation) bool {
+	for _, arg := range inv.args {
+		if arg == "-" || arg == "--" {
+			return true
+		}
+		if arg == "-c" || arg == "-e" || arg == "-m" {
+			return false
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return false
+		}
+	}
+	return true
+}
+
+func lastInvocation(cmd ShellCommand) (invocation, bool) {
+	invs := unwrapCommand(cmd.Argv)
+	if len(invs) == 0 {
+		return invocation{}, false
+	}
+	return invs[len(invs)-1], true
+}
+
+// checkDownloadPipe refuses piping downloads into an interpreter, like
+// curl | sh
+func checkDownloadPipe(pipeline ShellPipeline) *CommandRefusal {
+	download := ""
+	for _, cmd := range pipeline.Commands {
+		inv, ok := lastInvocation(cmd)
+		if !ok {
+			continue
+		}
+		// cat <(curl ...) | sh pipes a download like curl ... | sh
+		if downloadPrograms[path.Base(inv.name)] || substitutesDownload(cmd) {
+			download = strings.Join(cmd.Argv, " ")
+			continue
+		}
+		if download != "" && isInterpreter(inv.name) && readsScriptFromStdin(inv) {
+			return &CommandRefusal{
+				Segment: download + " | " + strings.Join(cmd.Argv, " "),
+				Rule:    "dangerous: download piped to interpreter",
+				Reason:  fmt.Sprintf("downloaded code is run by %s without being reviewed", path.Base(inv.name)),
+				Hint:    "download the script to a file, read it, then run it if it is safe",
+			}
+		}
+	}
+	return nil
+}
+
+// outputRedirect reports whether a redirection writes to its target
+func outputRedirect(r ShellRedirect) bool {
+	op := strings.TrimLeft(r.Op, "0123456789")
+	switch op {
+	case ">", ">>", ">|", "&>", "&>>", "<>":
+		return true
+	case ">&":
+		// >&2 duplicates a descriptor, >&file writes to the file
+		return !isDigits(r.Target) && r.Target != "-"
+	}
+	return false
+}
+
+// safeDevices can be written to without harm
+var safeDevices = map[string]bool{
+	"/dev/null": true, "/dev/stdout": true, "/dev/stderr": true, "/dev/tty": true,
+}
+
+func (p *CommandPolicy) checkRedirects(cmd ShellCommand, dir string) *CommandRefusal {
+	for _, r := range cmd.Redirects {
+		if !outputRedirect(r) {
+			continue
+		}
+		target := resolveCommandPath(r.Target, dir)
+		if safeDevices[target] || strings.HasPrefix(target, "/dev/fd/") {
+			continue
+		}
+		segment := strings.TrimSpace(strings.Join(cmd.Argv, " ") + " " + r.Op + " " + r.Target)
+		if strings.HasPrefix(target, "/dev/") {
+			return &CommandRefusal{
+				Segment: segment,
+				Rule:    "dangerous: write to device",
+				Reason:  fmt.Sprintf("writing to %s can destroy data", target),
+				Hint:    "write to a regular file instead",
+			}
+		}
+		allowed := isUnder(target, dir) || isUnder(target, filepath.Clean(os.TempDir()))
+		for _, d := range p.Dirs {
+			if isUnder(target, resolveCommandPath(d, dir)) {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return &CommandRefusal{
+				Segment: segment,
+				Rule:    "dangerous: redirection outside the working directory",
+				Reason:  fmt.Sprintf("%s is outside %s", target, dir),
+				Hint:    "write the output to a file inside the working directory",
+			}
+		}
+	}
+	return nil
+}
+
+// protectedDirs are never removed recursively
+var protectedDirs = []string{
+	"/", "/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/lib64", "/opt",
+	"/proc", "/root", "/sbin", "/srv", "/sys", "/usr", "/var",
+	"/Applications", "/Library", "/System", "/Users",
+}
+
+// checkDangerous refuses commands destroying data beyond the project
+func checkDangerous(inv invocation, cmd ShellCommand, dir string) *CommandRefusal {
+	name := path.Base(inv.name)
+	switch {
+	case name == "rm":
+		if hasFlag(inv.args, "--no-preserve-root") {
+			return &CommandRefusal{Rule: "dangerous: rm --no-preserve-root", Reason: "the command can remove the whole filesystem", Hint: "remove specific paths inside the working directory"}
+		}
+		if !hasFlag(inv.args, "-r") && !hasFlag(inv.args, "-R") && !hasFlag(inv.args, "--recursive") {
+			return nil
+		}
+		home, _ := os.UserHomeDir()
+		for _, arg := range pathArgs(inv.args) {
+			target := resolveCommandPath(arg, dir)
+			if base, ok := globBase(target); ok {
+				// rm -rf /etc/* empties /etc like rm -rf /etc removes it
+				target = base
+			}
+			protected := target == home || (target != dir && isUnder(dir, target))
+			for _, p := range protectedDirs {
+				if target == p {
+					protected = true
+				}
+			}
+			if protected {
+				return &CommandRefusal{
+					Rule:   "dangerous: recursive removal of " + target,
+					Reason: fmt.Sprintf("removing %s recursively destroys data outside the project", arg),
+					Hint:   "remove specific paths inside the working directory",
+				}
+			}
+		}
+	case name == "dd":
+		for _, arg := range inv.args {
+			if strings.HasPrefix(arg, "of=/dev/") && !safeDevices[arg[3:]] {
+				return &CommandRefusal{Rule: "dangerous: write to device", Reason: fmt.Sprintf("writing to %s can destroy data", arg[3:]), Hint: "write to a regular file instead"}
+			}
+		}
+	case strings.HasPrefix(name, "mkfs"):
+		return &CommandRefusal{Rule: "dangerous: " + name, Reason: "formatting a filesystem destroys its data", Hint: "ask the user to run it"}
+	case isInterpreter(name):
+		// sh -c "$(curl ...)" and sh <(curl ...)
+		if substitutesDownload(cmd) {
+			return &CommandRefusal{
+				Rule:   "dangerous: download run by interpreter",
+				Reason: fmt.Sprintf("downloaded code is run by %s without being reviewed", name),
+				Hint:   "download the script to a file, read it, then run it if it is safe",
+			}
+		}
+	}
+	return nil
+}
+
+// globBase returns the directory before the first path element of p with
+// glob characters, and false when p has none
+func globBase(p string) (string, bool) {
+	i := strings.IndexAny(p, "*?[")
+	if i == -1 {
+		return "", false
+	}
+	base := p[:strings.LastIndexByte(p[:i], '/')+1]
+	if base == "" {
+		return ".", true
+	}
+	return filepath.Clean(base), true
+}
+
+// substitutesDownload reports whether a command reads the output of a
+// download through $(...), `...` or <(...)
+func substitutesDownload(cmd ShellCommand) bool {
+	for _, sub := range cmd.Substitutions {
+		pipelines, err := ParseCommandLine(sub)
+		if err != nil {
+			continue
+		}
+		for _, pipeline := range pipelines {
+			for _, c := range pipeline.Commands {
+				if inner, ok := lastInvocation(c); ok && downloadPrograms[path.Base(inner.name)] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package mcplib
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LatestProtocolVersion is the newest MCP protocol version implemented
+const LatestProtocolVersion = "2025-06-18"
+
+// SupportedProtocolVersions lists the protocol versions the server and the
+// client can speak, newest first
+var SupportedProtocolVersions = []string{LatestProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// negotiateProtocolVersion picks the version answered to initialize: the
+// requested one when supported, otherwise the latest, letting the client
+// decide whether it can speak it
+func negotiateProtocolVersion(requested string) string {
+	if requested == "" {
+		// Clients predating version negotiation
+		return "2024-11-05"
+	}
+	if isSupportedProtocolVersion(requested) {
+		return requested
+	}
+	return LatestProtocolVersion
+}
+
+func isSupportedProtocolVersion(version string) bool {
+	for _, v := range SupportedProtocolVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// SetServerInfo sets the name and version reported in the serverInfo of
+// initialize. They default to the executable name and 0.1.0.
+func (s *MCPServer) SetServerInfo(name, version string) {
+	s.serverName = name
+	s.serverVersion = version
+}
+
+func (s *MCPServer) serverInfo() map[string]interface{} {
+	name := s.serverName
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	}
+	version := s.serverVersion
+	if version == "" {
+		version = "0.1.0"
+	}
+	return map[string]interface{}{"name": name, "version": version}
+}
+
+// capabilities describes what the server implements, derived from the
+// tools, prompts, resources and completions registered
+func (s *MCPServer) capabilities() map[string]interface{} {
+	caps := map[string]interface{}{
+		"logging": map[string]interface{}{},
+	}
+	if len(s.tools) > 0 || len(s.toolHandlers) > 0 || len(s.toolHandlersWithCtx) > 0 {
+		caps["tools"] = map[string]interface{}{}
+	}
+	if len(s.prompts) > 0 {
+		caps["prompts"] = map[string]interface{}{}
+	}
+	if len(s.resources) > 0 || len(s.resourceHandlers) > 0 || len(s.resourceTemplates) > 0 || s.resourceLister != nil {
+		caps["resources"] = map[string]interface{}{"subscribe": true, "listChanged": true}
+	}
+	if len(s.completions) > 0 {
+		caps["completions"] = map[string]interface{}{}
+	}
+	return caps
+}
+
+// processInitialize handles initialize
+func (s *MCPServer) processInitialize(req JSONRPCRequest) JSONRPCResponse {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return JSONRPCResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error:   &RPCError{Code: -32602, Message: "Invalid params"},
+			}
+		}
+	}
+	return JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"protocolVersion": negotiateProtocolVersion(params.ProtocolVersion),
+			"capabilities":    s.capabilities(),
+			"serverInfo":      s.serverInfo(),
+		},
+	}
+}
+
+// SetPageSize sets the number of items returned per page by the list
+// methods. Zero, the default, returns everything in one page.
+func (s *MCPServer) SetPageSize(size int) {
+	s.pageSize = size
+}
+
+// paginate returns the page of items starting at the cursor of a list
+// request, and the cursor of the next page or "" on the last one
+func paginate[T any](s *MCPServer, req JSONRPCRequest, items []T) ([]T, string, *RPCError) {
+	var params struct {
+		Cursor string `json:"cursor"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, "", &RPCError{Code: -32602, Message: "Invalid params"}
+		}
+	}
+	start := 0
+	if params.Cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(params.Cursor)
+		if err == nil {
+			start, err = strconv.Atoi(string(data))
+		}
+		if err != nil || start < 0 || start > len(items) {
+			return nil, "", &RPCError{Code: -32602, Message: "Invalid cursor"}
+		}
+	}
+	if s.pageSize <= 0 || len(items)-start <= s.pageSize {
+		return items[start:], "", nil
+	}
+	end := start + s.pageSize
+	return items[start:end], base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end))), nil
+}
+
+// listResult builds the paginated response of a list method returning the
+// items in the field key of its result
+func listResult[T any](s *MCPServer, req JSONRPCRequest, key string, items []T) JSONRPCResponse {
+	page, next, rpcErr := paginate(s, req, items)
+	if rpcErr != nil {
+		return JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}
+	}
+	if page == nil {
+		page = []T{}
+	}
+	result := map[string]interface{}{key: page}
+	if next != "" {
+		result["nextCursor"] = next
+	}
+	return JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
@@ -0,0 +1,165 @@
+package mcplib
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// ResourceTemplateDefinition describes a family of resources addressed by
+// an RFC 6570 URI template
+type ResourceTemplateDefinition struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceTemplateHandler reads a resource matched by a template. vars holds
+// the values of the template variables extracted from the URI.
+type ResourceTemplateHandler func(uri string, vars map[string]string) (interface{}, error)
+
+// JSONRPCNotification represents a JSON-RPC 2.0 notification
+type JSONRPCNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type resourceTemplate struct {
+	def      ResourceTemplateDefinition
+	template *URITemplate
+	handler  ResourceTemplateHandler
+}
+
+// RegisterResourceTemplate publishes a resource template and the handler
+// reading the resources it matches
+func (s *MCPServer) RegisterResourceTemplate(def ResourceTemplateDefinition, handler ResourceTemplateHandler) error {
+	template, err := ParseURITemplate(def.URITemplate)
+	if err != nil {
+		return err
+	}
+	s.resourceTemplates = append(s.resourceTemplates, resourceTemplate{def: def, template: template, handler: handler})
+	return nil
+}
+
+// SetResourceLister sets a function listing resources that change over
+// time, such as the concrete instances of a template. They are returned by
+// resources/list after the static resources.
+func (s *MCPServer) SetResourceLister(lister func() []ResourceDefinition) {
+	s.resourceLister = lister
+}
+
+// processResourceTemplatesList handles resources/templates/list
+func (s *MCPServer) processResourceTemplatesList(req JSONRPCRequest) JSONRPCResponse {
+	templates := make([]ResourceTemplateDefinition, 0, len(s.resourceTemplates))
+	for _, t := range s.resourceTemplates {
+		templates = append(templates, t.def)
+	}
+	return listResult(s, req, "resourceTemplates", templates)
+}
+
+// readResource resolves uri to a static resource or to the first template
+// matching it. The MIME type is the one declared for the resource, if any.
+func (s *MCPServer) readResource(uri string) (interface{}, string, bool, error) {
+	if handler, exists := s.resourceHandlers[uri]; exists {
+		mimeType := ""
+		for _, res := range s.resources {
+			if res.URI == uri {
+				mimeType = res.MimeType
+				break
+			}
+		}
+		content, err := handler(uri)
+		return content, mimeType, true, err
+	}
+	for _, t := range s.resourceTemplates {
+		if vars, ok := t.template.Match(uri); ok {
+			content, err := t.handler(uri, vars)
+			return content, t.def.MimeType, true, err
+		}
+	}
+	return nil, "", false, nil
+}
+
+// processResourcesSubscribe handles resources/subscribe and
+// resources/unsubscribe
+func (s *MCPServer) processResourcesSubscribe(req JSONRPCRequest, subscribe bool) JSONRPCResponse {
+	var params ResourceReadParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.URI == "" {
+		return JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error:   &RPCError{Code: -32602, Message: "Invalid params"},
+		}
+	}
+	s.subMu.Lock()
+	if subscribe {
+		if s.subscriptions == nil {
+			s.subscriptions = make(map[string]bool)
+		}
+		s.subscriptions[params.URI] = true
+	} else {
+		delete(s.subscriptions, params.URI)
+	}
+	s.subMu.Unlock()
+	return JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  map[string]interface{}{},
+	}
+}
+
+// NotifyResourceUpdated tells the clients subscribed to uri that the
+// resource changed. Nothing is sent when nobody subscribed to it.
+func (s *MCPServer) NotifyResourceUpdated(uri string) {
+	s.subMu.Lock()
+	subscribed := s.subscriptions[uri]
+	s.subMu.Unlock()
+	if !subscribed {
+		return
+	}
+	s.sendNotification("notifications/resources/updated", map[string]interface{}{"uri": uri})
+}
+
+// NotifyResourceListChanged tells the clients that the list of resources
+// changed
+func (s *MCPServer) NotifyResourceListChanged() {
+	s.sendNotification("notifications/resources/list_changed", nil)
+}
+
+// sendNotification writes a notification to the stdio/TCP peer and to
+// every connected SSE and WebSocket session. SSE sessions with a full queue
+// miss it.
+func (s *MCPServer) sendNotification(method string, params interface{}) {
+	notification := JSONRPCNotification{JSONRPC: "2.0", Method: method, Params: params}
+	if s.writer != nil {
+		s.writeNotification(notification)
+	}
+	s.connMu.Lock()
+	conns := make([]func(JSONRPCNotification), 0, len(s.conns))
+	for _, notify := range s.conns {
+		conns = append(conns, notify)
+	}
+	s.connMu.Unlock()
+	for _, notify := range conns {
+		notify(notification)
+	}
+	s.sseMu.RLock()
+	defer s.sseMu.RUnlock()
+	for _, session := range s.sseSessions {
+		select {
+		case session.respChan <- notification:
+		default:
+		}
+	}
+}
+
+// writeNotification writes a notification to the stdio/TCP peer
+func (s *MCPServer) writeNotification(notification JSONRPCNotification) {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		log.Printf("Failed to marshal %s notification: %v", notification.Method, err)
+		return
+	}
+	s.writeResponse(data)
+}
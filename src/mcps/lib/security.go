@@ -20,11 +20,13 @@ type HTTPSecurity struct {
 	// AllowDNSRebinding disables Host header validation on loopback listeners.
 	AllowDNSRebinding bool
 
-	// SessionTimeout is the idle duration before SSE sessions expire.
+	// SessionTimeout is the idle duration before SSE and WebSocket sessions
+	// expire.
 	// Zero means no timeout.
 	SessionTimeout time.Duration
 
-	// MaxSessions limits concurrent SSE sessions. Zero means unlimited.
+	// MaxSessions limits concurrent SSE and WebSocket sessions. Zero means
+	// unlimited.
 	MaxSessions int
 
 	// RateLimit is the max requests per second per source IP. Zero means unlimited.
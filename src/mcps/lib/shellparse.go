@@ -0,0 +1,358 @@
+package mcplib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShellCommand is a simple command of a shell command line
+type ShellCommand struct {
+	// Argv holds the words of the command after quote removal, with the
+	// leading variable assignments. Expansions are kept as written.
+	Argv []string
+	// Redirects lists the redirections of the command
+	Redirects []ShellRedirect
+	// Substitutions holds the command lines inside $(...), `...`, <(...)
+	// and >(...) found in the words of the command
+	Substitutions []string
+}
+
+// ShellRedirect is a redirection like "2>>" "log.txt"
+type ShellRedirect struct {
+	Op     string
+	Target string
+}
+
+// ShellPipeline is a list of commands connected with | or |&
+type ShellPipeline struct {
+	Commands []ShellCommand
+}
+
+type shellToken struct {
+	word string
+	op   string // Operator, empty for words
+	subs []string
+}
+
+// ParseCommandLine splits a POSIX shell command line into pipelines of
+// simple commands. Compound commands are flattened: the commands inside
+// if, while, subshells and brace groups are returned like the others.
+func ParseCommandLine(line string) ([]ShellPipeline, error) {
+	tokens, err := lexShell(line)
+	if err != nil {
+		return nil, err
+	}
+	var pipelines []ShellPipeline
+	var pipeline ShellPipeline
+	var cmd ShellCommand
+	endCommand := func() {
+		if len(cmd.Argv) > 0 || len(cmd.Redirects) > 0 || len(cmd.Substitutions) > 0 {
+			pipeline.Commands = append(pipeline.Commands, cmd)
+		}
+		cmd = ShellCommand{}
+	}
+	endPipeline := func() {
+		endCommand()
+		if len(pipeline.Commands) > 0 {
+			pipelines = append(pipelines, pipeline)
+		}
+		pipeline = ShellPipeline{}
+	}
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok.op == "":
+			cmd.Substitutions = append(cmd.Substitutions, tok.subs...)
+			if len(cmd.Argv) == 0 && shellReservedWords[tok.word] {
+				continue
+			}
+			cmd.Argv = append(cmd.Argv, tok.word)
+		case tok.op == "|" || tok.op == "|&":
+			if len(cmd.Argv) == 0 && len(cmd.Redirects) == 0 {
+				return nil, fmt.Errorf("syntax error near %q", tok.op)
+			}
+			endCommand()
+		case isRedirectOp(tok.op):
+			if i+1 >= len(tokens) || tokens[i+1].op != "" {
+				return nil, fmt.Errorf("syntax error: %q without target", tok.op)
+			}
+			i++
+			cmd.Redirects = append(cmd.Redirects, ShellRedirect{Op: tok.op, Target: tokens[i].word})
+			cmd.Substitutions = append(cmd.Substitutions, tokens[i].subs...)
+		default:
+			// ; & && || newlines and parentheses
+			endPipeline()
+		}
+	}
+	endPipeline()
+	for i := range pipelines {
+		for j := range pipelines[i].Commands {
+			cmd := &pipelines[i].Commands[j]
+			if len(cmd.Argv) > 0 && shellLoopWords[cmd.Argv[0]] {
+				// The words of for and case headers are not commands
+				cmd.Argv = nil
+			}
+		}
+	}
+	return pipelines, nil
+}
+
+var shellReservedWords = map[string]bool{
+	"!": true, "{": true, "}": true, "if": true, "then": true, "else": true,
+	"elif": true, "fi": true, "do": true, "done": true, "while": true,
+	"until": true, "esac": true, "function": true,
+}
+
+var shellLoopWords = map[string]bool{"for": true, "select": true, "case": true}
+
+func isRedirectOp(op string) bool {
+	return strings.ContainsAny(op, "<>")
+}
+
+// lexShell splits a command line into words and operators
+func lexShell(s string) ([]shellToken, error) {
+	var tokens []shellToken
+	var word strings.Builder
+	var subs []string
+	inWord := false
+	var heredocs []string
+	endWord := func() {
+		if inWord {
+			tokens = append(tokens, shellToken{word: word.String(), subs: subs})
+		}
+		word.Reset()
+		subs = nil
+		inWord = false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			endWord()
+		case c == '\n':
+			endWord()
+			tokens = append(tokens, shellToken{op: ";"})
+			// Skip the bodies of the here-documents started on the line
+			for _, delim := range heredocs {
+				for i+1 < len(s) {
+					end := strings.IndexByte(s[i+1:], '\n')
+					var line string
+					if end == -1 {
+						line, i = s[i+1:], len(s)
+					} else {
+						line, i = s[i+1:i+1+end], i+1+end
+					}
+					if strings.TrimLeft(line, "\t") == delim {
+						break
+					}
+				}
+			}
+			heredocs = nil
+		case c == '#' && !inWord:
+			for i+1 < len(s) && s[i+1] != '\n' {
+				i++
+			}
+		case c == '\\':
+			inWord = true
+			if i+1 < len(s) {
+				i++
+				if s[i] != '\n' {
+					word.WriteByte(s[i])
+				}
+			}
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			inWord = true
+			end, err := lexDoubleQuoted(s, i+1, &word, &subs)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case c == '$' || c == '`':
+			inWord = true
+			end, err := lexExpansion(s, i, &word, &subs)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case (c == '<' || c == '>') && !inWord && i+1 < len(s) && s[i+1] == '(':
+			// Process substitution
+			inWord = true
+			end, err := matchParen(s, i+1)
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, s[i+2:end])
+			word.WriteString(s[i : end+1])
+			i = end
+		case strings.IndexByte("|&;()<>", c) != -1:
+			fd := ""
+			if inWord && (c == '<' || c == '>') && isDigits(word.String()) && len(subs) == 0 {
+				// 2> and the like redirect a file descriptor
+				fd = word.String()
+				word.Reset()
+				inWord = false
+			}
+			endWord()
+			op := lexOperator(s[i:])
+			i += len(op) - 1
+			if op == "<<" || op == "<<-" {
+				if delim := heredocDelimiter(s[i+1:]); delim != "" {
+					heredocs = append(heredocs, delim)
+				}
+			}
+			tokens = append(tokens, shellToken{op: fd + op})
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+	endWord()
+	return tokens, nil
+}
+
+// lexOperator returns the operator at the start of s
+func lexOperator(s string) string {
+	for _, op := range []string{"<<<", "<<-", "&>>", "&&", "||", "|&", ";;", ">>", ">&", ">|", "<<", "<&", "<>", "&>"} {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return s[:1]
+}
+
+// heredocDelimiter returns the delimiter word following << without quotes
+func heredocDelimiter(s string) string {
+	s = strings.TrimLeft(s, " \t")
+	end := strings.IndexAny(s, " \t\n;|&<>()")
+	if end == -1 {
+		end = len(s)
+	}
+	return strings.NewReplacer("'", "", "\"", "", "\\", "").Replace(s[:end])
+}
+
+// lexDoubleQuoted reads a double-quoted string starting after the quote
+// and returns the index of the closing quote
+func lexDoubleQuoted(s string, i int, word *strings.Builder, subs *[]string) (int, error) {
+	for ; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return i, nil
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) != -1 {
+				i++
+				if s[i] != '\n' {
+					word.WriteByte(s[i])
+				}
+			} else {
+				word.WriteByte(c)
+			}
+		case '$', '`':
+			end, err := lexExpansion(s, i, word, subs)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		default:
+			word.WriteByte(c)
+		}
+	}
+	return 0, fmt.Errorf("unterminated double quote")
+}
+
+// lexExpansion reads the expansion starting with $ or ` at s[i], keeping
+// it in the word as written, and returns the index of its last byte
+func lexExpansion(s string, i int, word *strings.Builder, subs *[]string) (int, error) {
+	if s[i] == '`' {
+		for j := i + 1; j < len(s); j++ {
+			if s[j] == '\\' {
+				j++
+			} else if s[j] == '`' {
+				*subs = append(*subs, strings.ReplaceAll(s[i+1:j], "\\`", "`"))
+				word.WriteString(s[i : j+1])
+				return j, nil
+			}
+		}
+		return 0, fmt.Errorf("unterminated backquote")
+	}
+	if i+1 >= len(s) {
+		word.WriteByte('$')
+		return i, nil
+	}
+	switch s[i+1] {
+	case '(':
+		end, err := matchParen(s, i+1)
+		if err != nil {
+			return 0, err
+		}
+		if !strings.HasPrefix(s[i+1:], "((") {
+			// $((...)) is arithmetic, not a command
+			*subs = append(*subs, s[i+2:end])
+		}
+		word.WriteString(s[i : end+1])
+		return end, nil
+	case '{':
+		end := strings.IndexByte(s[i:], '}')
+		if end == -1 {
+			return 0, fmt.Errorf("unterminated ${")
+		}
+		word.WriteString(s[i : i+end+1])
+		return i + end, nil
+	}
+	word.WriteByte('$')
+	return i, nil
+}
+
+// matchParen returns the index of the parenthesis closing the one at
+// s[i], skipping quoted text
+func matchParen(s string, i int) (int, error) {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end == -1 {
+				return 0, fmt.Errorf("unterminated single quote")
+			}
+			i += end + 1
+		case '"':
+			var discard strings.Builder
+			var subs []string
+			end, err := lexDoubleQuoted(s, i+1, &discard, &subs)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unterminated parenthesis")
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,610 @@
+package mcplib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypedToolHandler handles a tool call whose arguments were validated and
+// decoded into In
+type TypedToolHandler[In, Out any] func(ctx context.Context, args In) (Out, error)
+
+// NewTypedTool builds a tool whose input schema is derived from the In
+// struct. Arguments are validated against it and decoded into In before the
+// handler runs. When Out is a struct the tool also declares an output
+// schema and its results are returned as structuredContent.
+//
+// Fields are named after their json tag and described with these tags:
+//
+//	description:"text"  describes the argument
+//	enum:"a,b,c"        lists the accepted values
+//	min:"1" max:"10"    bounds numbers, string lengths or array sizes
+//	default:"value"     is used when the argument is missing
+//	required:"true"     overrides whether the argument is required
+//
+// Arguments are required unless the field is a pointer, has a default or
+// its json tag has omitempty.
+func NewTypedTool[In, Out any](name, description string, handler TypedToolHandler[In, Out]) (Tool, error) {
+	inType := reflect.TypeOf((*In)(nil)).Elem()
+	input, err := newSchemaNode(inType, map[reflect.Type]bool{})
+	if err != nil {
+		return Tool{}, fmt.Errorf("tool %s: input: %v", name, err)
+	}
+	if input.typ != "object" || input.fields == nil {
+		return Tool{}, fmt.Errorf("tool %s: input must be a struct, got %s", name, inType)
+	}
+
+	var output map[string]interface{}
+	outType := reflect.TypeOf((*Out)(nil)).Elem()
+	if indirectType(outType).Kind() == reflect.Struct && indirectType(outType) != timeType {
+		node, err := newSchemaNode(outType, map[reflect.Type]bool{})
+		if err != nil {
+			return Tool{}, fmt.Errorf("tool %s: output: %v", name, err)
+		}
+		output = node.jsonSchema()
+	}
+
+	withCtx := func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		var in In
+		if err := input.decode(args, &in); err != nil {
+			return nil, err
+		}
+		out, err := handler(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		if output != nil {
+			return structuredResult{value: out}, nil
+		}
+		return out, nil
+	}
+	return Tool{
+		Name:         name,
+		Description:  description,
+		InputSchema:  input.jsonSchema(),
+		OutputSchema: output,
+		Handler: func(args map[string]interface{}) (interface{}, error) {
+			return withCtx(context.Background(), args)
+		},
+		HandlerWithContext: withCtx,
+	}, nil
+}
+
+// MustTypedTool is NewTypedTool for static tool tables. It panics when the
+// argument or result types cannot be described by a JSON schema.
+func MustTypedTool[In, Out any](name, description string, handler TypedToolHandler[In, Out]) Tool {
+	tool, err := NewTypedTool(name, description, handler)
+	if err != nil {
+		panic(err)
+	}
+	return tool
+}
+
+// RegisterTypedTool publishes a tool built with NewTypedTool on the server,
+// replacing any tool with the same name
+func RegisterTypedTool[In, Out any](s *MCPServer, name, description string, handler TypedToolHandler[In, Out]) error {
+	tool, err := NewTypedTool(name, description, handler)
+	if err != nil {
+		return err
+	}
+	s.AddTool(tool)
+	return nil
+}
+
+// AddTool publishes a tool on the server, replacing any tool with the same
+// name
+func (s *MCPServer) AddTool(tool Tool) {
+	def := ToolDefinition{
+		Name:          tool.Name,
+		Description:   tool.Description,
+		InputSchema:   tool.InputSchema,
+		OutputSchema:  tool.OutputSchema,
+		UsageExamples: tool.UsageExamples,
+	}
+	replaced := false
+	for i, t := range s.tools {
+		if t.Name == tool.Name {
+			s.tools[i] = def
+			replaced = true
+		}
+	}
+	if !replaced {
+		s.tools = append(s.tools, def)
+	}
+	if tool.HandlerWithContext != nil {
+		s.RegisterToolWithContext(tool.Name, tool.HandlerWithContext)
+	} else {
+		s.RegisterTool(tool.Name, tool.Handler)
+	}
+}
+
+// structuredResult is the result of a tool declaring an output schema. It
+// is always returned as structuredContent, whatever the response mode.
+type structuredResult struct {
+	value interface{}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// schemaNode is the JSON schema of a Go type, kept in a form that values
+// can be validated against
+type schemaNode struct {
+	typ      string // JSON type, empty for any value
+	format   string
+	nullable bool
+	items    *schemaNode // elements of arrays, values of maps
+	fields   []*schemaField
+}
+
+// schemaField is a property of an object with the constraints of its tags
+type schemaField struct {
+	name        string
+	node        *schemaNode
+	required    bool
+	description string
+	enum        []interface{}
+	min, max    *float64
+	def         interface{}
+}
+
+func newSchemaNode(t reflect.Type, seen map[reflect.Type]bool) (*schemaNode, error) {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+	switch t {
+	case timeType:
+		return &schemaNode{typ: "string", format: "date-time", nullable: nullable}, nil
+	case rawMessageType:
+		return &schemaNode{nullable: true}, nil
+	}
+	node := &schemaNode{nullable: nullable}
+	switch t.Kind() {
+	case reflect.String:
+		node.typ = "string"
+	case reflect.Bool:
+		node.typ = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		node.typ = "integer"
+	case reflect.Float32, reflect.Float64:
+		node.typ = "number"
+	case reflect.Interface:
+		node.nullable = true
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json uses base64 strings for byte slices
+			node.typ = "string"
+			break
+		}
+		items, err := newSchemaNode(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		node.typ = "array"
+		node.items = items
+		node.nullable = node.nullable || t.Kind() == reflect.Slice
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		items, err := newSchemaNode(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		node.typ = "object"
+		node.items = items
+		node.nullable = true
+	case reflect.Struct:
+		if seen[t] {
+			return nil, fmt.Errorf("recursive type %s is not supported", t)
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		node.typ = "object"
+		node.fields = []*schemaField{}
+		if err := node.addStructFields(t, seen); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+	return node, nil
+}
+
+// addStructFields adds the fields of a struct as properties, flattening
+// embedded structs like encoding/json does
+func (n *schemaNode) addStructFields(t reflect.Type, seen map[reflect.Type]bool) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && indirectType(f.Type).Kind() == reflect.Struct {
+			if err := n.addStructFields(indirectType(f.Type), seen); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		node, err := newSchemaNode(f.Type, seen)
+		if err != nil {
+			return fmt.Errorf("field %s: %v", f.Name, err)
+		}
+		field := &schemaField{
+			name:        name,
+			node:        node,
+			description: f.Tag.Get("description"),
+		}
+		if err := field.parseTags(f, opts); err != nil {
+			return fmt.Errorf("field %s: %v", f.Name, err)
+		}
+		n.fields = append(n.fields, field)
+	}
+	return nil
+}
+
+func (f *schemaField) parseTags(sf reflect.StructField, jsonOpts string) error {
+	if enum, ok := sf.Tag.Lookup("enum"); ok {
+		for _, value := range strings.Split(enum, ",") {
+			parsed, err := f.node.parseValue(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("enum: %v", err)
+			}
+			f.enum = append(f.enum, parsed)
+		}
+	}
+	for _, bound := range []struct {
+		tag string
+		dst **float64
+	}{{"min", &f.min}, {"max", &f.max}} {
+		value, ok := sf.Tag.Lookup(bound.tag)
+		if !ok {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %v", bound.tag, err)
+		}
+		*bound.dst = &parsed
+	}
+	if def, ok := sf.Tag.Lookup("default"); ok {
+		parsed, err := f.node.parseValue(def)
+		if err != nil {
+			return fmt.Errorf("default: %v", err)
+		}
+		f.def = parsed
+	}
+	f.required = sf.Type.Kind() != reflect.Ptr && f.def == nil && !strings.Contains(","+jsonOpts+",", ",omitempty,")
+	if required, ok := sf.Tag.Lookup("required"); ok {
+		parsed, err := strconv.ParseBool(required)
+		if err != nil {
+			return fmt.Errorf("required: %v", err)
+		}
+		f.required = parsed
+	}
+	return nil
+}
+
+// parseValue converts a tag value to the JSON value of the node type
+func (n *schemaNode) parseValue(s string) (interface{}, error) {
+	switch n.typ {
+	case "boolean":
+		return strconv.ParseBool(s)
+	case "integer":
+		v, err := strconv.ParseInt(s, 10, 64)
+		return float64(v), err
+	case "number":
+		return strconv.ParseFloat(s, 64)
+	case "string":
+		return s, nil
+	default:
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return nil, fmt.Errorf("invalid JSON value %q", s)
+		}
+		return v, nil
+	}
+}
+
+// jsonSchema renders the node as a JSON schema document
+func (n *schemaNode) jsonSchema() map[string]interface{} {
+	schema := map[string]interface{}{}
+	if n.typ != "" {
+		schema["type"] = n.typ
+	}
+	if n.format != "" {
+		schema["format"] = n.format
+	}
+	switch {
+	case n.typ == "array":
+		schema["items"] = n.items.jsonSchema()
+	case n.fields != nil:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for _, f := range n.fields {
+			properties[f.name] = f.jsonSchema()
+			if f.required {
+				required = append(required, f.name)
+			}
+		}
+		schema["properties"] = properties
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	case n.items != nil:
+		schema["additionalProperties"] = n.items.jsonSchema()
+	}
+	return schema
+}
+
+func (f *schemaField) jsonSchema() map[string]interface{} {
+	schema := f.node.jsonSchema()
+	if f.description != "" {
+		schema["description"] = f.description
+	}
+	if f.enum != nil {
+		schema["enum"] = f.enum
+	}
+	if f.def != nil {
+		schema["default"] = f.def
+	}
+	minKey, maxKey := "minimum", "maximum"
+	switch f.node.typ {
+	case "string":
+		minKey, maxKey = "minLength", "maxLength"
+	case "array":
+		minKey, maxKey = "minItems", "maxItems"
+	}
+	if f.min != nil {
+		schema[minKey] = *f.min
+	}
+	if f.max != nil {
+		schema[maxKey] = *f.max
+	}
+	return schema
+}
+
+// decode validates the arguments of a tool call, fills in the defaults and
+// decodes them into dst
+func (n *schemaNode) decode(args map[string]interface{}, dst interface{}) error {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	value, err := n.check("", args)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
+
+// check validates a value, returning it with the defaults of missing
+// object properties filled in. path names the value in errors.
+func (n *schemaNode) check(path string, v interface{}) (interface{}, error) {
+	if v == nil {
+		if n.nullable || n.typ == "" {
+			return v, nil
+		}
+		return nil, argumentError(path, "expected %s, got null", n.typ)
+	}
+	switch n.typ {
+	case "string":
+		if _, ok := v.(string); !ok {
+			return nil, argumentError(path, "expected string, got %s", jsonTypeName(v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return nil, argumentError(path, "expected boolean, got %s", jsonTypeName(v))
+		}
+	case "integer", "number":
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, argumentError(path, "expected %s, got %s", n.typ, jsonTypeName(v))
+		}
+		if n.typ == "integer" && f != math.Trunc(f) {
+			return nil, argumentError(path, "expected integer, got %v", f)
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return nil, argumentError(path, "expected array, got %s", jsonTypeName(v))
+		}
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			checked, err := n.items.check(fmt.Sprintf("%s[%d]", path, i), item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = checked
+		}
+		return out, nil
+	case "object":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, argumentError(path, "expected object, got %s", jsonTypeName(v))
+		}
+		return n.checkObject(path, m)
+	}
+	return v, nil
+}
+
+func (n *schemaNode) checkObject(path string, m map[string]interface{}) (interface{}, error) {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	if n.fields == nil {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			checked, err := n.items.check(joinPath(path, k), m[k])
+			if err != nil {
+				return nil, err
+			}
+			out[k] = checked
+		}
+		return out, nil
+	}
+	for _, f := range n.fields {
+		fieldPath := joinPath(path, f.name)
+		v, exists := m[f.name]
+		if !exists {
+			if f.def != nil {
+				out[f.name] = f.def
+			} else if f.required {
+				return nil, fmt.Errorf("missing required argument %q", fieldPath)
+			}
+			continue
+		}
+		checked, err := f.node.check(fieldPath, v)
+		if err != nil {
+			return nil, err
+		}
+		if checked != nil {
+			if err := f.checkConstraints(fieldPath, checked); err != nil {
+				return nil, err
+			}
+		}
+		out[f.name] = checked
+	}
+	return out, nil
+}
+
+// checkConstraints enforces the enum and min/max tags of a field
+func (f *schemaField) checkConstraints(path string, v interface{}) error {
+	if f.enum != nil {
+		found := false
+		for _, allowed := range f.enum {
+			if enumEqual(allowed, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values := make([]string, len(f.enum))
+			for i, allowed := range f.enum {
+				values[i] = fmt.Sprint(allowed)
+			}
+			return argumentError(path, "must be one of %s, got %v", strings.Join(values, ", "), v)
+		}
+	}
+	if f.min == nil && f.max == nil {
+		return nil
+	}
+	var size float64
+	unit := ""
+	switch value := v.(type) {
+	case string:
+		size, unit = float64(len([]rune(value))), " characters"
+	case []interface{}:
+		size, unit = float64(len(value)), " items"
+	default:
+		number, ok := toFloat(v)
+		if !ok {
+			return nil
+		}
+		size = number
+	}
+	if f.min != nil && size < *f.min {
+		return argumentError(path, "must be at least %v%s, got %v", *f.min, unit, size)
+	}
+	if f.max != nil && size > *f.max {
+		return argumentError(path, "must be at most %v%s, got %v", *f.max, unit, size)
+	}
+	return nil
+}
+
+func argumentError(path string, format string, args ...interface{}) error {
+	if path == "" {
+		return fmt.Errorf("invalid arguments: "+format, args...)
+	}
+	return fmt.Errorf("invalid argument %q: "+format, append([]interface{}{path}, args...)...)
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func enumEqual(allowed, v interface{}) bool {
+	if a, ok := toFloat(allowed); ok {
+		b, ok := toFloat(v)
+		return ok && a == b
+	}
+	return reflect.DeepEqual(allowed, v)
+}
+
+// toFloat converts the numbers decoded from JSON, or passed by in-process
+// callers, to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	if _, ok := toFloat(v); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
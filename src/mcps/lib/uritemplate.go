@@ -0,0 +1,446 @@
+package mcplib
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// URITemplate is a parsed RFC 6570 URI template. All four levels of the
+// specification are supported for expansion. Matching a URI against the
+// template is the reverse operation used to resolve parameterized resources.
+type URITemplate struct {
+	raw   string
+	parts []templatePart
+	re    *regexp.Regexp
+}
+
+type templatePart struct {
+	literal string
+	expr    *templateExpr
+}
+
+type templateExpr struct {
+	op   templateOp
+	vars []templateVar
+}
+
+type templateVar struct {
+	name    string
+	explode bool
+	prefix  int
+}
+
+// templateOp describes the expansion rules of an expression operator
+// (RFC 6570 Appendix A)
+type templateOp struct {
+	char     byte
+	first    string
+	sep      string
+	named    bool
+	ifEmpty  string
+	reserved bool
+}
+
+var templateOps = map[byte]templateOp{
+	0:   {char: 0, first: "", sep: ","},
+	'+': {char: '+', first: "", sep: ",", reserved: true},
+	'#': {char: '#', first: "#", sep: ",", reserved: true},
+	'.': {char: '.', first: ".", sep: "."},
+	'/': {char: '/', first: "/", sep: "/"},
+	';': {char: ';', first: ";", sep: ";", named: true},
+	'?': {char: '?', first: "?", sep: "&", named: true, ifEmpty: "="},
+	'&': {char: '&', first: "&", sep: "&", named: true, ifEmpty: "="},
+}
+
+var templateVarName = regexp.MustCompile(`^(?:[A-Za-z0-9_.]|%[0-9A-Fa-f]{2})+$`)
+
+// ParseURITemplate parses an RFC 6570 URI template
+func ParseURITemplate(template string) (*URITemplate, error) {
+	t := &URITemplate{raw: template}
+	rest := template
+	for rest != "" {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return nil, fmt.Errorf("unbalanced '}' in URI template %q", template)
+			}
+			t.parts = append(t.parts, templatePart{literal: rest})
+			break
+		}
+		if start > 0 {
+			if strings.IndexByte(rest[:start], '}') >= 0 {
+				return nil, fmt.Errorf("unbalanced '}' in URI template %q", template)
+			}
+			t.parts = append(t.parts, templatePart{literal: rest[:start]})
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated expression in URI template %q", template)
+		}
+		expr, err := parseTemplateExpr(rest[start+1 : start+end])
+		if err != nil {
+			return nil, fmt.Errorf("invalid URI template %q: %v", template, err)
+		}
+		t.parts = append(t.parts, templatePart{expr: expr})
+		rest = rest[start+end+1:]
+	}
+	re, err := regexp.Compile(t.pattern())
+	if err != nil {
+		return nil, fmt.Errorf("invalid URI template %q: %v", template, err)
+	}
+	t.re = re
+	return t, nil
+}
+
+func parseTemplateExpr(body string) (*templateExpr, error) {
+	if body == "" {
+		return nil, fmt.Errorf("empty expression")
+	}
+	expr := &templateExpr{op: templateOps[0]}
+	if op, ok := templateOps[body[0]]; ok && body[0] != 0 {
+		expr.op = op
+		body = body[1:]
+	} else if strings.ContainsRune("=,!@|", rune(body[0])) {
+		return nil, fmt.Errorf("reserved operator '%c'", body[0])
+	}
+	for _, spec := range strings.Split(body, ",") {
+		v := templateVar{name: spec}
+		if strings.HasSuffix(spec, "*") {
+			v.name = strings.TrimSuffix(spec, "*")
+			v.explode = true
+		} else if idx := strings.IndexByte(spec, ':'); idx >= 0 {
+			n, err := strconv.Atoi(spec[idx+1:])
+			if err != nil || n <= 0 || n >= 10000 {
+				return nil, fmt.Errorf("invalid prefix modifier in %q", spec)
+			}
+			v.name = spec[:idx]
+			v.prefix = n
+		}
+		if !templateVarName.MatchString(v.name) {
+			return nil, fmt.Errorf("invalid variable name %q", v.name)
+		}
+		expr.vars = append(expr.vars, v)
+	}
+	return expr, nil
+}
+
+// String returns the template as it was parsed
+func (t *URITemplate) String() string {
+	return t.raw
+}
+
+// Variables returns the variable names used in the template
+func (t *URITemplate) Variables() []string {
+	var names []string
+	for _, part := range t.parts {
+		if part.expr == nil {
+			continue
+		}
+		for _, v := range part.expr.vars {
+			names = append(names, v.name)
+		}
+	}
+	return names
+}
+
+// Expand builds a URI from the template. Values may be strings, string
+// lists ([]string) or associative arrays (map[string]string); other types
+// are formatted with fmt. Missing variables are left out of the result.
+func (t *URITemplate) Expand(vars map[string]interface{}) string {
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.expr == nil {
+			b.WriteString(part.literal)
+			continue
+		}
+		part.expr.expand(&b, vars)
+	}
+	return b.String()
+}
+
+func (e *templateExpr) expand(b *strings.Builder, vars map[string]interface{}) {
+	first := true
+	for _, v := range e.vars {
+		value, ok := vars[v.name]
+		if !ok || value == nil {
+			continue
+		}
+		var expanded string
+		switch val := value.(type) {
+		case []string:
+			if len(val) == 0 {
+				continue
+			}
+			expanded = e.expandList(v, val)
+		case map[string]string:
+			if len(val) == 0 {
+				continue
+			}
+			expanded = e.expandMap(v, val)
+		case string:
+			expanded = e.expandString(v, val)
+		default:
+			expanded = e.expandString(v, fmt.Sprint(val))
+		}
+		if first {
+			b.WriteString(e.op.first)
+			first = false
+		} else {
+			b.WriteString(e.op.sep)
+		}
+		b.WriteString(expanded)
+	}
+}
+
+func (e *templateExpr) expandString(v templateVar, value string) string {
+	if v.prefix > 0 && utf8.RuneCountInString(value) > v.prefix {
+		runes := []rune(value)
+		value = string(runes[:v.prefix])
+	}
+	if !e.op.named {
+		return templateEncode(value, e.op.reserved)
+	}
+	if value == "" {
+		return v.name + e.op.ifEmpty
+	}
+	return v.name + "=" + templateEncode(value, e.op.reserved)
+}
+
+func (e *templateExpr) expandList(v templateVar, values []string) string {
+	items := make([]string, len(values))
+	for i, item := range values {
+		items[i] = templateEncode(item, e.op.reserved)
+		if v.explode && e.op.named {
+			if item == "" {
+				items[i] = v.name + e.op.ifEmpty
+			} else {
+				items[i] = v.name + "=" + items[i]
+			}
+		}
+	}
+	if v.explode {
+		return strings.Join(items, e.op.sep)
+	}
+	return e.named(v, strings.Join(items, ","))
+}
+
+func (e *templateExpr) expandMap(v templateVar, values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	items := make([]string, 0, len(keys)*2)
+	for _, k := range keys {
+		key := templateEncode(k, e.op.reserved)
+		value := templateEncode(values[k], e.op.reserved)
+		if v.explode {
+			items = append(items, key+"="+value)
+		} else {
+			items = append(items, key, value)
+		}
+	}
+	if v.explode {
+		return strings.Join(items, e.op.sep)
+	}
+	return e.named(v, strings.Join(items, ","))
+}
+
+func (e *templateExpr) named(v templateVar, value string) string {
+	if !e.op.named {
+		return value
+	}
+	if value == "" {
+		return v.name + e.op.ifEmpty
+	}
+	return v.name + "=" + value
+}
+
+// templateEncode percent-encodes everything but the unreserved characters,
+// also keeping the reserved characters and existing escapes for the + and #
+// operators
+func templateEncode(s string, reserved bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isUnreserved(c):
+			b.WriteByte(c)
+		case reserved && strings.IndexByte(":/?#[]@!$&'()*+,;=", c) >= 0:
+			b.WriteByte(c)
+		case reserved && c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			b.WriteString(s[i : i+3])
+			i += 2
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// pattern builds the regular expression used by Match. Every variable has
+// its own capture group, except for the query operators which capture the
+// whole query string and are decoded by name.
+func (t *URITemplate) pattern() string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, part := range t.parts {
+		if part.expr == nil {
+			b.WriteString(regexp.QuoteMeta(part.literal))
+			continue
+		}
+		e := part.expr
+		switch e.op.char {
+		case '?', '&':
+			b.WriteString(`((?:[?&][^#]*)?)`)
+			continue
+		case '#':
+			b.WriteString(`(?:#(.*))?`)
+			continue
+		}
+		value := `[^/?#,]*`
+		if len(e.vars) == 1 {
+			value = `[^/?#]*`
+		}
+		switch e.op.char {
+		case '+':
+			value = `.*?`
+		case '.':
+			value = `[^/?#.]*`
+		case ';':
+			value = `[^/?#;]*`
+		}
+		sep := regexp.QuoteMeta(e.op.sep)
+		first := regexp.QuoteMeta(e.op.first)
+		for i, v := range e.vars {
+			lead := sep
+			if i == 0 {
+				lead = first
+			}
+			switch {
+			case v.explode:
+				if e.op.char == 0 || e.op.char == '+' {
+					b.WriteString(`(` + value + `)`)
+				} else {
+					b.WriteString(`((?:` + lead + value + `)(?:` + sep + value + `)*)?`)
+				}
+			case e.op.named:
+				b.WriteString(`(?:` + lead + regexp.QuoteMeta(v.name) + `(?:=(` + value + `))?)?`)
+			case e.op.char == 0 || e.op.char == '+':
+				if i > 0 {
+					b.WriteString(sep)
+				}
+				b.WriteString(`(` + value + `)`)
+			default:
+				b.WriteString(`(?:` + lead + `(` + value + `))?`)
+			}
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// Match checks whether uri is an expansion of the template and returns the
+// variable values. List values are returned comma separated and variables
+// missing from the URI are left out of the map.
+func (t *URITemplate) Match(uri string) (map[string]string, bool) {
+	idx := t.re.FindStringSubmatchIndex(uri)
+	if idx == nil {
+		return nil, false
+	}
+	group := func(n int) (string, bool) {
+		if idx[2*n] < 0 {
+			return "", false
+		}
+		return uri[idx[2*n]:idx[2*n+1]], true
+	}
+	vars := make(map[string]string)
+	n := 1
+	for _, part := range t.parts {
+		if part.expr == nil {
+			continue
+		}
+		e := part.expr
+		if e.op.char == '?' || e.op.char == '&' || e.op.char == '#' {
+			raw, ok := group(n)
+			n++
+			if !ok {
+				continue
+			}
+			if e.op.char != '#' {
+				matchQuery(vars, e, raw)
+			} else if len(e.vars) == 1 {
+				vars[e.vars[0].name] = unescapeTemplateValue(raw)
+			} else {
+				for i, value := range strings.Split(raw, ",") {
+					if i < len(e.vars) {
+						vars[e.vars[i].name] = unescapeTemplateValue(value)
+					}
+				}
+			}
+			continue
+		}
+		for _, v := range e.vars {
+			raw, ok := group(n)
+			n++
+			if !ok {
+				continue
+			}
+			if v.explode && e.op.char != 0 && e.op.char != '+' {
+				items := strings.Split(strings.TrimPrefix(raw, e.op.first), e.op.sep)
+				for i, item := range items {
+					if e.op.named {
+						item = strings.TrimPrefix(strings.TrimPrefix(item, v.name), "=")
+					}
+					items[i] = unescapeTemplateValue(item)
+				}
+				vars[v.name] = strings.Join(items, ",")
+				continue
+			}
+			vars[v.name] = unescapeTemplateValue(raw)
+		}
+	}
+	return vars, true
+}
+
+func matchQuery(vars map[string]string, e *templateExpr, raw string) {
+	if raw == "" {
+		return
+	}
+	wanted := make(map[string]bool, len(e.vars))
+	for _, v := range e.vars {
+		wanted[v.name] = true
+	}
+	for _, pair := range strings.Split(raw[1:], "&") {
+		name, value, _ := strings.Cut(pair, "=")
+		if !wanted[name] {
+			continue
+		}
+		value = unescapeTemplateValue(value)
+		if prev, ok := vars[name]; ok {
+			value = prev + "," + value
+		}
+		vars[name] = value
+	}
+}
+
+func unescapeTemplateValue(s string) string {
+	if v, err := url.PathUnescape(s); err == nil {
+		return v
+	}
+	return s
+}
@@ -0,0 +1,628 @@
+package mcplib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// websocketGUID is appended to the key of a WebSocket handshake (RFC 6455)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// WebSocketPingInterval is how often WebSocket peers are pinged. A peer
+// sending nothing, not even a pong, for two intervals is disconnected.
+var WebSocketPingInterval = 30 * time.Second
+
+var (
+	errWSProtocol = errors.New("websocket protocol error")
+	errWSTooLarge = errors.New("websocket message too large")
+)
+
+// wsConn is a WebSocket connection exchanging one JSON-RPC message per
+// text frame
+type wsConn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	client   bool // frames sent by clients are masked
+	maxSize  int64
+	writeMu  sync.Mutex
+	lastSeen atomic.Int64
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// newWSConn wraps an open connection. Messages larger than maxSize bytes,
+// or than the default HTTP request body limit when maxSize is not set, close
+// the connection.
+func newWSConn(conn net.Conn, br *bufio.Reader, client bool, maxSize int64) *wsConn {
+	if maxSize <= 0 {
+		maxSize = defaultMaxHTTPRequestBodySize
+	}
+	c := &wsConn{conn: conn, br: br, client: client, maxSize: maxSize, done: make(chan struct{})}
+	c.lastSeen.Store(time.Now().UnixNano())
+	return c
+}
+
+// readMessage returns the payload of the next text or binary message,
+// answering pings on the way. It returns io.EOF once the connection closed.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	fragmented := false
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			switch {
+			case errors.Is(err, errWSTooLarge):
+				c.close(1009, "message too large")
+			case errors.Is(err, errWSProtocol):
+				c.close(1002, "protocol error")
+			default:
+				c.close(1006, "")
+			}
+			return nil, io.EOF
+		}
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				c.close(1006, "")
+				return nil, io.EOF
+			}
+		case wsOpPong:
+		case wsOpClose:
+			code := 1000
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.close(code, "")
+			return nil, io.EOF
+		case wsOpText, wsOpBinary:
+			if fragmented {
+				c.close(1002, "protocol error")
+				return nil, io.EOF
+			}
+			if fin {
+				return payload, nil
+			}
+			message = payload
+			fragmented = true
+		case wsOpContinuation:
+			if !fragmented {
+				c.close(1002, "protocol error")
+				return nil, io.EOF
+			}
+			if int64(len(message)+len(payload)) > c.maxSize {
+				c.close(1009, "message too large")
+				return nil, io.EOF
+			}
+			message = append(message, payload...)
+			if fin {
+				return message, nil
+			}
+		default:
+			c.close(1002, "protocol error")
+			return nil, io.EOF
+		}
+	}
+}
+
+// readFrame reads a frame and unmasks its payload
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	c.lastSeen.Store(time.Now().UnixNano())
+	fin := header[0]&0x80 != 0
+	op := header[0] & 0x0f
+	if header[0]&0x70 != 0 {
+		// No extension was negotiated
+		return false, 0, nil, errWSProtocol
+	}
+	masked := header[1]&0x80 != 0
+	if masked == c.client {
+		// Clients must mask their frames and servers must not
+		return false, 0, nil, errWSProtocol
+	}
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+		if length < 0 {
+			return false, 0, nil, errWSProtocol
+		}
+	}
+	if op >= wsOpClose && (length > 125 || !fin) {
+		return false, 0, nil, errWSProtocol
+	}
+	if length > c.maxSize {
+		return false, 0, nil, errWSTooLarge
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// writeFrame writes a single final frame
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	header := make([]byte, 0, 14)
+	header = append(header, 0x80|op)
+	maskBit := byte(0)
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		header = append(header, maskBit|byte(n))
+	case n <= 0xffff:
+		header = append(header, maskBit|126, byte(n>>8), byte(n))
+	default:
+		header = append(header, maskBit|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	data := payload
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		header = append(header, mask[:]...)
+		data = make([]byte, len(payload))
+		for i := range payload {
+			data[i] = payload[i] ^ mask[i%4]
+		}
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	if _, err := c.conn.Write(append(header, data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// writeMessage sends a message as a text frame
+func (c *wsConn) writeMessage(data []byte) error {
+	return c.writeFrame(wsOpText, data)
+}
+
+// close sends a close frame, unless the peer is gone, and closes the
+// connection
+func (c *wsConn) close(code int, reason string) {
+	c.doneOnce.Do(func() {
+		if code != 1006 {
+			payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+			_ = c.writeFrame(wsOpClose, append(payload, reason...))
+		}
+		close(c.done)
+		_ = c.conn.Close()
+	})
+}
+
+// keepalive pings the peer until the connection closes, closing it when
+// the peer stays silent for two intervals
+func (c *wsConn) keepalive(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, c.lastSeen.Load())) > 2*interval {
+				c.close(1001, "keepalive timeout")
+				return
+			}
+			if err := c.writeFrame(wsOpPing, nil); err != nil {
+				c.close(1006, "")
+				return
+			}
+		}
+	}
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		headerHasToken(r.Header, "Connection", "upgrade") &&
+		headerHasToken(r.Header, "Upgrade", "websocket")
+}
+
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// upgradeWebSocket completes the handshake of a WebSocket upgrade request
+// and takes over its connection
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, maxSize int64) (*wsConn, error) {
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return nil, fmt.Errorf("invalid websocket key")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, fmt.Errorf("connection cannot be hijacked")
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n"
+	if headerHasToken(r.Header, "Sec-WebSocket-Protocol", "mcp") {
+		response += "Sec-WebSocket-Protocol: mcp\r\n"
+	}
+	if _, err := conn.Write([]byte(response + "\r\n")); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return newWSConn(conn, brw.Reader, false, maxSize), nil
+}
+
+// dialWebSocket opens a WebSocket to a ws://, wss:// or unix:// URL. Unix
+// sockets are served by ServeUnix, whose endpoint is at /. Messages
+// received are limited to maxSize bytes.
+func dialWebSocket(target string, header http.Header, maxSize int64) (*wsConn, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	requestURL := *u
+	switch u.Scheme {
+	case "ws":
+		requestURL.Scheme = "http"
+		conn, err = dialer.Dial("tcp", hostWithPort(u, "80"))
+	case "wss":
+		requestURL.Scheme = "https"
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostWithPort(u, "443"), &tls.Config{ServerName: u.Hostname()})
+	case "unix":
+		conn, err = dialer.Dial("unix", u.Host+u.Path)
+		requestURL = url.URL{Scheme: "http", Host: "localhost", Path: "/"}
+	default:
+		return nil, fmt.Errorf("unsupported websocket URL: %s", target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	req, err := http.NewRequest(http.MethodGet, requestURL.String(), nil)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Protocol", "mcp")
+
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		_ = conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		_ = conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed: invalid Sec-WebSocket-Accept")
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return newWSConn(conn, br, true, maxSize), nil
+}
+
+func hostWithPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// ServeWebSocket starts an HTTP server accepting WebSocket connections on
+// basePath. Every connection is a separate MCP session. Plain POST requests
+// on the same path are served as with ServeHTTP.
+func (s *MCPServer) ServeWebSocket(port string, basePath string, authEnabled bool) error {
+	s.authEnabled = authEnabled
+	if basePath == "" {
+		basePath = "/"
+	}
+	http.HandleFunc(basePath, s.streamHandler)
+	log.Printf("Starting WebSocket server on port %s with base path %s", port, basePath)
+	return http.ListenAndServe(":"+port, nil)
+}
+
+// ServeUnix serves MCP on a Unix domain socket only its owner can connect
+// to. Clients connect with a WebSocket, one session per connection, or POST
+// requests as with ServeHTTP, and authenticate the same way.
+func (s *MCPServer) ServeUnix(path string, authEnabled bool) error {
+	s.authEnabled = authEnabled
+	// Remove the socket left by a previous run, but nothing else
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = ln.Close() }()
+	if err := os.Chmod(path, 0600); err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.streamHandler)
+	log.Printf("Starting MCP server on unix socket %s", path)
+	return http.Serve(ln, mux)
+}
+
+// streamHandler serves WebSocket upgrades and Streamable HTTP requests on
+// the same path
+func (s *MCPServer) streamHandler(w http.ResponseWriter, r *http.Request) {
+	if isWebSocketUpgrade(r) {
+		s.websocketHandler(w, r)
+		return
+	}
+	s.httpHandler(w, r)
+}
+
+// websocketHandler runs an MCP session over a WebSocket connection
+func (s *MCPServer) websocketHandler(w http.ResponseWriter, r *http.Request) {
+	if s.httpSecurityCheck(w, r) {
+		return
+	}
+	// The session outlives the request handler only through the hijacked
+	// connection, so in-flight requests are cancelled when it closes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if token, ok := bearerTokenFromRequest(r); ok {
+		authResult, err := s.authorizeToken(r.Context(), token)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		ctx = authResult.Apply(ctx)
+	} else if s.authEnabled {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.httpSecurity.MaxSessions > 0 && s.sessionCount() >= s.httpSecurity.MaxSessions {
+		http.Error(w, "Too Many Sessions", http.StatusServiceUnavailable)
+		return
+	}
+
+	ws, err := upgradeWebSocket(w, r, s.maxHTTPRequestBodySize)
+	if err != nil {
+		if s.verbose {
+			log.Printf("[WS] Upgrade failed: %v", err)
+		}
+		return
+	}
+	defer ws.close(1000, "")
+	go ws.keepalive(WebSocketPingInterval)
+
+	var idle *time.Timer
+	if s.httpSecurity.SessionTimeout > 0 {
+		idle = time.AfterFunc(s.httpSecurity.SessionTimeout, func() {
+			ws.close(1001, "session timeout")
+		})
+		defer idle.Stop()
+	}
+
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	sessionID := hex.EncodeToString(id[:])
+	notify := func(notification JSONRPCNotification) {
+		data, err := json.Marshal(notification)
+		if err == nil {
+			_ = ws.writeMessage(data)
+		}
+	}
+	s.connMu.Lock()
+	if s.conns == nil {
+		s.conns = make(map[string]func(JSONRPCNotification))
+	}
+	s.conns[sessionID] = notify
+	s.connMu.Unlock()
+	defer func() {
+		s.connMu.Lock()
+		delete(s.conns, sessionID)
+		s.connMu.Unlock()
+	}()
+	if s.verbose {
+		log.Printf("[WS] Session %s connected from %s", sessionID, r.RemoteAddr)
+	}
+
+	read := func() ([]byte, error) {
+		data, err := ws.readMessage()
+		if err == nil && idle != nil {
+			idle.Reset(s.httpSecurity.SessionTimeout)
+		}
+		return data, err
+	}
+	write := func(data []byte) {
+		s.logPayload(data)
+		if err := ws.writeMessage(data); err != nil && s.verbose {
+			log.Printf("[WS] Session %s write failed: %v", sessionID, err)
+		}
+	}
+	s.serve(withRequestScope(ctx, "ws:"+sessionID, notify), read, write)
+	if s.verbose {
+		log.Printf("[WS] Session %s closed", sessionID)
+	}
+}
+
+// sessionCount returns the number of connected SSE and WebSocket sessions
+func (s *MCPServer) sessionCount() int {
+	s.sseMu.RLock()
+	n := len(s.sseSessions)
+	s.sseMu.RUnlock()
+	s.connMu.Lock()
+	n += len(s.conns)
+	s.connMu.Unlock()
+	return n
+}
+
+// WebSocketConn is a client WebSocket connection to an MCP server, read
+// and written as the newline-delimited stream of a stdio server
+type WebSocketConn struct {
+	ws      *wsConn
+	pending []byte // Unread part of the last message, for Read
+	line    []byte // Partial line written, for Write
+	lineMu  sync.Mutex
+}
+
+// IsWebSocketURL reports whether target is a ws://, wss:// or unix:// URL
+func IsWebSocketURL(target string) bool {
+	return strings.HasPrefix(target, "ws://") || strings.HasPrefix(target, "wss://") || strings.HasPrefix(target, "unix://")
+}
+
+// DialWebSocket connects to an MCP server on a ws://, wss:// or unix://
+// URL, sending header with the handshake. Messages received are limited to
+// maxSize bytes, or to the default HTTP request body limit when zero. The
+// server is pinged every WebSocketPingInterval and the connection closed
+// when it stays silent.
+func DialWebSocket(target string, header http.Header, maxSize int64) (*WebSocketConn, error) {
+	ws, err := dialWebSocket(target, header, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	go ws.keepalive(WebSocketPingInterval)
+	return &WebSocketConn{ws: ws}, nil
+}
+
+// Read returns the messages received, each followed by a newline
+func (c *WebSocketConn) Read(p []byte) (int, error) {
+	if len(c.pending) == 0 {
+		data, err := c.ws.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.pending = append(data, '\n')
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write sends every complete line written as a message
+func (c *WebSocketConn) Write(p []byte) (int, error) {
+	c.lineMu.Lock()
+	defer c.lineMu.Unlock()
+	c.line = append(c.line, p...)
+	for {
+		idx := bytes.IndexByte(c.line, '\n')
+		if idx == -1 {
+			return len(p), nil
+		}
+		message := bytes.TrimSpace(c.line[:idx])
+		c.line = c.line[idx+1:]
+		if len(message) == 0 {
+			continue
+		}
+		if err := c.ws.writeMessage(message); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Close closes the connection
+func (c *WebSocketConn) Close() error {
+	c.ws.close(1000, "")
+	return nil
+}
+
+// Done is closed once the connection is closed, by either side
+func (c *WebSocketConn) Done() <-chan struct{} {
+	return c.ws.done
+}
@@ -8,7 +8,7 @@ import (
 )
 
 func main() {
-	listen := flag.String("l", "", "listen host:port, http://host:port/path, or sse://host:port/path (optional) serve MCP over TCP, HTTP, or SSE")
+	listen := flag.String("l", "", "listen host:port, http://host:port/path, sse://host:port/path, ws://host:port/path, or unix:///path (optional) serve MCP over TCP, HTTP, SSE, WebSocket, or a Unix socket")
 	flag.Parse()
 
 	gmdService := NewMDownService()
@@ -16,6 +16,9 @@ func main() {
 	// Get all tools from the service
 	tools := gmdService.GetTools()
 	server := mcplib.NewMCPServerFromTools(tools)
+	if err := gmdService.RegisterResources(server); err != nil {
+		log.Fatalln("RegisterResources:", err)
+	}
 
 	// Start the server - this will block until the server is stopped
 	if err := server.ListenAndServe(*listen, false); err != nil {
@@ -21,6 +21,7 @@ type Section struct {
 
 // MDownService provides markdown MCP tools
 type MDownService struct {
+	content        string
 	sections       []Section
 	sectionContent map[string]string
 }
@@ -75,7 +76,7 @@ func NewMDownService() *MDownService {
 		snippet := lines[sec.StartLine+1 : sec.EndLine]
 		contentMap[sec.Name] = strings.Join(snippet, "\n")
 	}
-	return &MDownService{sections: sections, sectionContent: contentMap}
+	return &MDownService{content: content, sections: sections, sectionContent: contentMap}
 }
 
 // GetTools returns the static markdown MCP tools
@@ -172,33 +173,31 @@ func (s *MDownService) handleGetContents(args map[string]any) (any, error) {
 	if !ok || name == "" {
 		return nil, fmt.Errorf("section is required")
 	}
-	content, ok := s.sectionContent[name]
+	content, ok := s.lookupSection(name)
 	if !ok {
-		norm := normalizeSectionName(name)
-		// try normalized exact match
-		for secName, secContent := range s.sectionContent {
-			if normalizeSectionName(secName) == norm {
-				content = secContent
-				ok = true
-				break
-			}
-		}
+		return "Section not found", nil
 	}
-	if !ok {
-		norm := normalizeSectionName(name)
-		// try normalized substring match
-		for secName, secContent := range s.sectionContent {
-			if strings.Contains(normalizeSectionName(secName), norm) {
-				content = secContent
-				ok = true
-				break
-			}
+	return map[string]any{"content": content}, nil
+}
+
+// lookupSection finds a section by its exact name, then by its normalized
+// name and finally by a normalized substring match
+func (s *MDownService) lookupSection(name string) (string, bool) {
+	if content, ok := s.sectionContent[name]; ok {
+		return content, true
+	}
+	norm := normalizeSectionName(name)
+	for secName, secContent := range s.sectionContent {
+		if normalizeSectionName(secName) == norm {
+			return secContent, true
 		}
 	}
-	if !ok {
-		return "Section not found", nil
+	for secName, secContent := range s.sectionContent {
+		if strings.Contains(normalizeSectionName(secName), norm) {
+			return secContent, true
+		}
 	}
-	return map[string]any{"content": content}, nil
+	return "", false
 }
 
 func (s *MDownService) handleShowContents(args map[string]any) (any, error) {
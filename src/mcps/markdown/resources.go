@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"mcplib"
+)
+
+const (
+	documentURI     = "markdown://document"
+	sectionTemplate = "markdown://section/{name}"
+)
+
+// RegisterResources publishes the document and its sections as resources.
+// Sections are served through a URI template and listed individually.
+func (s *MDownService) RegisterResources(server *mcplib.MCPServer) error {
+	server.SetResources([]mcplib.ResourceDefinition{{
+		URI:         documentURI,
+		Name:        filepath.Base(mdPath),
+		Description: "The whole markdown document",
+		MimeType:    "text/markdown",
+	}})
+	server.RegisterResource(documentURI, func(uri string) (interface{}, error) {
+		return s.content, nil
+	})
+
+	template, err := mcplib.ParseURITemplate(sectionTemplate)
+	if err != nil {
+		return err
+	}
+	err = server.RegisterResourceTemplate(mcplib.ResourceTemplateDefinition{
+		URITemplate: sectionTemplate,
+		Name:        "section",
+		Description: "Contents of a section of the document, by name",
+		MimeType:    "text/markdown",
+	}, func(uri string, vars map[string]string) (interface{}, error) {
+		content, ok := s.lookupSection(vars["name"])
+		if !ok {
+			return nil, fmt.Errorf("section %q not found", vars["name"])
+		}
+		return content, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	server.SetResourceLister(func() []mcplib.ResourceDefinition {
+		seen := make(map[string]bool)
+		var resources []mcplib.ResourceDefinition
+		for _, sec := range s.sections {
+			if seen[sec.Name] {
+				continue
+			}
+			seen[sec.Name] = true
+			resources = append(resources, mcplib.ResourceDefinition{
+				URI:      template.Expand(map[string]interface{}{"name": sec.Name}),
+				Name:     sec.Name,
+				MimeType: "text/markdown",
+			})
+		}
+		return resources
+	})
+	return nil
+}
@@ -3,12 +3,13 @@ package main
 import (
 	"flag"
 	"log"
+	"time"
 
 	"mcplib"
 )
 
 func main() {
-	listen := flag.String("l", "", "listen host:port, http://host:port/path, or sse://host:port/path (optional) serve MCP over TCP, HTTP, or SSE")
+	listen := flag.String("l", "", "listen host:port, http://host:port/path, sse://host:port/path, ws://host:port/path, or unix:///path (optional) serve MCP over TCP, HTTP, SSE, WebSocket, or a Unix socket")
 	flag.Parse()
 
 	memoryService := NewMemoryService()
@@ -16,6 +17,10 @@ func main() {
 	// Get all tools from the service
 	tools := memoryService.GetTools()
 	server := mcplib.NewMCPServerFromTools(tools)
+	if err := memoryService.RegisterResources(server); err != nil {
+		log.Fatalln("RegisterResources:", err)
+	}
+	go memoryService.Watch(2 * time.Second)
 
 	// Start the server - this will block until the server is stopped
 	if err := server.ListenAndServe(*listen, false); err != nil {
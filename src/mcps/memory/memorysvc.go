@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,9 +24,11 @@ type Note struct {
 
 // MemoryService handles all memory/note operations
 type MemoryService struct {
+	mu          sync.Mutex
 	notes       map[string]Note
 	dbPath      string
 	lastModTime time.Time
+	server      *mcplib.MCPServer
 }
 
 // NewMemoryService creates a new MemoryService instance
@@ -210,8 +213,11 @@ func (s *MemoryService) GetTools() []mcplib.Tool {
 
 // handleAddNote handles adding a new note
 func (s *MemoryService) handleAddNote(args map[string]interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// Reload from file if necessary
-	if err := s.loadFromFile(); err != nil {
+	if err := s.refresh(); err != nil {
 		return nil, fmt.Errorf("failed to load notes: %v", err)
 	}
 
@@ -252,6 +258,7 @@ func (s *MemoryService) handleAddNote(args map[string]interface{}) (interface{},
 	if err := s.saveToFile(); err != nil {
 		return nil, fmt.Errorf("failed to save note: %v", err)
 	}
+	s.notifyChanged(true, note)
 
 	return map[string]interface{}{
 		"id":         note.ID,
@@ -262,8 +269,11 @@ func (s *MemoryService) handleAddNote(args map[string]interface{}) (interface{},
 
 // handleUpdateNote handles updating an existing note
 func (s *MemoryService) handleUpdateNote(args map[string]interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// Reload from file if necessary
-	if err := s.loadFromFile(); err != nil {
+	if err := s.refresh(); err != nil {
 		return nil, fmt.Errorf("failed to load notes: %v", err)
 	}
 
@@ -276,6 +286,7 @@ func (s *MemoryService) handleUpdateNote(args map[string]interface{}) (interface
 	if !exists {
 		return nil, fmt.Errorf("note with id %s not found", id)
 	}
+	previous := note
 
 	updated := false
 
@@ -310,6 +321,7 @@ func (s *MemoryService) handleUpdateNote(args map[string]interface{}) (interface
 		if err := s.saveToFile(); err != nil {
 			return nil, fmt.Errorf("failed to save note: %v", err)
 		}
+		s.notifyChanged(previous.Title != note.Title, previous, note)
 	}
 
 	return map[string]interface{}{
@@ -321,8 +333,11 @@ func (s *MemoryService) handleUpdateNote(args map[string]interface{}) (interface
 
 // handleDeleteNote handles deleting a note
 func (s *MemoryService) handleDeleteNote(args map[string]interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// Reload from file if necessary
-	if err := s.loadFromFile(); err != nil {
+	if err := s.refresh(); err != nil {
 		return nil, fmt.Errorf("failed to load notes: %v", err)
 	}
 
@@ -331,7 +346,8 @@ func (s *MemoryService) handleDeleteNote(args map[string]interface{}) (interface
 		return nil, fmt.Errorf("id must be a string")
 	}
 
-	if _, exists := s.notes[id]; !exists {
+	note, exists := s.notes[id]
+	if !exists {
 		return nil, fmt.Errorf("note with id %s not found", id)
 	}
 
@@ -341,6 +357,7 @@ func (s *MemoryService) handleDeleteNote(args map[string]interface{}) (interface
 	if err := s.saveToFile(); err != nil {
 		return nil, fmt.Errorf("failed to save changes: %v", err)
 	}
+	s.notifyChanged(true, note)
 
 	return map[string]interface{}{
 		"id":      id,
@@ -350,8 +367,11 @@ func (s *MemoryService) handleDeleteNote(args map[string]interface{}) (interface
 
 // handleSearchNotes handles searching notes by keywords
 func (s *MemoryService) handleSearchNotes(args map[string]interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// Reload from file if necessary
-	if err := s.loadFromFile(); err != nil {
+	if err := s.refresh(); err != nil {
 		return nil, fmt.Errorf("failed to load notes: %v", err)
 	}
 
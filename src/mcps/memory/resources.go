@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"mcplib"
+)
+
+const (
+	notesIndexURI = "memory://notes"
+	noteTemplate  = "memory://notes/{id}"
+	tagTemplate   = "memory://tags/{tag}"
+)
+
+var (
+	noteURITemplate, _ = mcplib.ParseURITemplate(noteTemplate)
+	tagURITemplate, _  = mcplib.ParseURITemplate(tagTemplate)
+)
+
+func noteURI(id string) string {
+	return noteURITemplate.Expand(map[string]interface{}{"id": id})
+}
+
+func tagURI(tag string) string {
+	return tagURITemplate.Expand(map[string]interface{}{"tag": tag})
+}
+
+// noteSummary is the entry describing a note in the index resources
+type noteSummary struct {
+	ID        string   `json:"id"`
+	URI       string   `json:"uri"`
+	Title     string   `json:"title"`
+	Tags      []string `json:"tags"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+// RegisterResources publishes the notes as resources: an index of all the
+// notes, every note by id and the notes carrying a tag. Clients subscribed
+// to them are notified when the notes change.
+func (s *MemoryService) RegisterResources(server *mcplib.MCPServer) error {
+	s.server = server
+	server.SetResources([]mcplib.ResourceDefinition{{
+		URI:         notesIndexURI,
+		Name:        "notes",
+		Description: "Index of all the notes",
+		MimeType:    "application/json",
+	}})
+	server.RegisterResource(notesIndexURI, func(uri string) (interface{}, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.refresh(); err != nil {
+			return nil, fmt.Errorf("failed to load notes: %v", err)
+		}
+		return map[string]interface{}{"notes": s.summaries(nil)}, nil
+	})
+
+	err := server.RegisterResourceTemplate(mcplib.ResourceTemplateDefinition{
+		URITemplate: noteTemplate,
+		Name:        "note",
+		Description: "A note by id",
+		MimeType:    "application/json",
+	}, func(uri string, vars map[string]string) (interface{}, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.refresh(); err != nil {
+			return nil, fmt.Errorf("failed to load notes: %v", err)
+		}
+		note, exists := s.notes[vars["id"]]
+		if !exists {
+			return nil, fmt.Errorf("note with id %s not found", vars["id"])
+		}
+		return note, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = server.RegisterResourceTemplate(mcplib.ResourceTemplateDefinition{
+		URITemplate: tagTemplate,
+		Name:        "tag",
+		Description: "The notes carrying a tag",
+		MimeType:    "application/json",
+	}, func(uri string, vars map[string]string) (interface{}, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.refresh(); err != nil {
+			return nil, fmt.Errorf("failed to load notes: %v", err)
+		}
+		tag := vars["tag"]
+		return map[string]interface{}{
+			"tag": tag,
+			"notes": s.summaries(func(note Note) bool {
+				for _, t := range note.Tags {
+					if t == tag {
+						return true
+					}
+				}
+				return false
+			}),
+		}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	server.SetResourceLister(func() []mcplib.ResourceDefinition {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.refresh(); err != nil {
+			return nil
+		}
+		var resources []mcplib.ResourceDefinition
+		for _, summary := range s.summaries(nil) {
+			resources = append(resources, mcplib.ResourceDefinition{
+				URI:      summary.URI,
+				Name:     summary.Title,
+				MimeType: "application/json",
+			})
+		}
+		return resources
+	})
+
+	// Complete the template variables with the existing ids and tags
+	server.RegisterResourceCompletion(noteTemplate, "id", func(ctx context.Context, value string, args map[string]string) ([]string, error) {
+		return s.complete(value, func(note Note) []string { return []string{note.ID} })
+	})
+	server.RegisterResourceCompletion(tagTemplate, "tag", func(ctx context.Context, value string, args map[string]string) ([]string, error) {
+		return s.complete(value, func(note Note) []string { return note.Tags })
+	})
+	return nil
+}
+
+// complete lists the distinct values taken from the notes starting with
+// prefix, sorted
+func (s *MemoryService) complete(prefix string, values func(Note) []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return nil, fmt.Errorf("failed to load notes: %v", err)
+	}
+	seen := make(map[string]bool)
+	var matches []string
+	for _, note := range s.notes {
+		for _, v := range values(note) {
+			if !seen[v] && strings.HasPrefix(v, prefix) {
+				seen[v] = true
+				matches = append(matches, v)
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// summaries lists the notes accepted by filter, most recently updated first
+func (s *MemoryService) summaries(filter func(Note) bool) []noteSummary {
+	notes := make([]Note, 0, len(s.notes))
+	for _, note := range s.notes {
+		if filter == nil || filter(note) {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i].UpdatedAt.After(notes[j].UpdatedAt)
+	})
+	out := make([]noteSummary, 0, len(notes))
+	for _, note := range notes {
+		out = append(out, noteSummary{
+			ID:        note.ID,
+			URI:       noteURI(note.ID),
+			Title:     note.Title,
+			Tags:      note.Tags,
+			UpdatedAt: note.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+	return out
+}
+
+// refresh reloads the notes when the database changed on disk, notifying
+// the subscribers of the notes that were modified by another process
+func (s *MemoryService) refresh() error {
+	previous := s.notes
+	lastModTime := s.lastModTime
+	if err := s.loadFromFile(); err != nil {
+		return err
+	}
+	if s.lastModTime.Equal(lastModTime) {
+		return nil
+	}
+	var changed []Note
+	listChanged := false
+	for id, note := range previous {
+		current, exists := s.notes[id]
+		if !exists {
+			listChanged = true
+			changed = append(changed, note)
+		} else if !current.UpdatedAt.Equal(note.UpdatedAt) {
+			listChanged = listChanged || current.Title != note.Title
+			changed = append(changed, note, current)
+		}
+	}
+	for id, note := range s.notes {
+		if _, exists := previous[id]; !exists {
+			listChanged = true
+			changed = append(changed, note)
+		}
+	}
+	if len(changed) > 0 {
+		s.notifyChanged(listChanged, changed...)
+	}
+	return nil
+}
+
+// notifyChanged sends the resource notifications for the given versions of
+// the modified notes
+func (s *MemoryService) notifyChanged(listChanged bool, notes ...Note) {
+	if s.server == nil {
+		return
+	}
+	uris := map[string]bool{notesIndexURI: true}
+	for _, note := range notes {
+		uris[noteURI(note.ID)] = true
+		for _, tag := range note.Tags {
+			uris[tagURI(tag)] = true
+		}
+	}
+	for uri := range uris {
+		s.server.NotifyResourceUpdated(uri)
+	}
+	if listChanged {
+		s.server.NotifyResourceListChanged()
+	}
+}
+
+// Watch polls the database file so changes made by other processes are
+// notified to the subscribed clients
+func (s *MemoryService) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		s.mu.Lock()
+		_ = s.refresh()
+		s.mu.Unlock()
+	}
+}
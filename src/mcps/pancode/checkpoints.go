@@ -0,0 +1,511 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mcplib"
+)
+
+// Checkpoint records the content a file had before a tool modified it
+type Checkpoint struct {
+	ID      int       `json:"id"`
+	Tool    string    `json:"tool"`
+	Path    string    `json:"path"`
+	Time    time.Time `json:"time"`
+	Existed bool      `json:"existed"`
+	Mode    uint32    `json:"mode,omitempty"`
+	// Restored is set once the content was put back
+	Restored bool `json:"restored,omitempty"`
+}
+
+// CheckpointStore keeps the checkpoints of a server session in a
+// directory of the sandbox, one file with the prior content and one with
+// the metadata per checkpoint
+type CheckpointStore struct {
+	mu          sync.Mutex
+	dir         string
+	checkpoints []*Checkpoint
+}
+
+// NewCheckpointStore creates the store of a new session under the sandbox
+// directory. The directory is created with the first checkpoint.
+func NewCheckpointStore() *CheckpointStore {
+	session := fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), os.Getpid())
+	return &CheckpointStore{dir: filepath.Join(sandboxDir, "pancode-checkpoints", session)}
+}
+
+// Snapshot saves the current content of the file at abs, which may not
+// exist yet, before tool modifies it
+func (cs *CheckpointStore) Snapshot(tool, abs string) (*Checkpoint, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cp := &Checkpoint{
+		ID:   len(cs.checkpoints) + 1,
+		Tool: tool,
+		Path: abs,
+		Time: time.Now(),
+	}
+	content, err := os.ReadFile(abs)
+	switch {
+	case err == nil:
+		cp.Existed = true
+		if info, err := os.Stat(abs); err == nil {
+			cp.Mode = uint32(info.Mode().Perm())
+		}
+	case os.IsNotExist(err):
+	default:
+		return nil, fmt.Errorf("failed to checkpoint %s: %v", abs, err)
+	}
+	if err := os.MkdirAll(cs.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %v", err)
+	}
+	if cp.Existed {
+		if err := os.WriteFile(cs.contentPath(cp), content, 0600); err != nil {
+			return nil, fmt.Errorf("failed to checkpoint %s: %v", abs, err)
+		}
+	}
+	if err := cs.saveMeta(cp); err != nil {
+		return nil, err
+	}
+	cs.checkpoints = append(cs.checkpoints, cp)
+	return cp, nil
+}
+
+func (cs *CheckpointStore) contentPath(cp *Checkpoint) string {
+	return filepath.Join(cs.dir, fmt.Sprintf("%d.orig", cp.ID))
+}
+
+func (cs *CheckpointStore) saveMeta(cp *Checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(cs.dir, fmt.Sprintf("%d.json", cp.ID)), data, 0600); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %v", err)
+	}
+	return nil
+}
+
+// content returns the content the file had at the checkpoint, nil when it
+// did not exist
+func (cs *CheckpointStore) content(cp *Checkpoint) ([]byte, error) {
+	if !cp.Existed {
+		return nil, nil
+	}
+	return os.ReadFile(cs.contentPath(cp))
+}
+
+func (cs *CheckpointStore) get(id int) (*Checkpoint, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if id < 1 || id > len(cs.checkpoints) {
+		return nil, fmt.Errorf("checkpoint %d not found", id)
+	}
+	return cs.checkpoints[id-1], nil
+}
+
+// restore puts back the content of the checkpoint, first saving the
+// current content so the restore can be undone too
+func (cs *CheckpointStore) restore(cp *Checkpoint) (*Checkpoint, error) {
+	content, err := cs.content(cp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %d: %v", cp.ID, err)
+	}
+	undo, err := cs.Snapshot("restore_checkpoint", cp.Path)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Existed {
+		if err := os.MkdirAll(filepath.Dir(cp.Path), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(cp.Path, content, os.FileMode(cp.Mode)); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %v", cp.Path, err)
+		}
+		_ = os.Chmod(cp.Path, os.FileMode(cp.Mode))
+	} else if err := os.Remove(cp.Path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove %s: %v", cp.Path, err)
+	}
+	cs.mu.Lock()
+	cp.Restored = true
+	err = cs.saveMeta(cp)
+	cs.mu.Unlock()
+	return undo, err
+}
+
+// checkpointTools returns the tools browsing and restoring the checkpoints
+func (s *PanCodeService) checkpointTools() []mcplib.Tool {
+	return []mcplib.Tool{
+		{
+			Name:        "list_checkpoints",
+			Description: "Lists the checkpoints saved before write_file, replace and patch_file modified a file, newest first",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"file_path": map[string]any{
+						"type":        "string",
+						"description": "Only list the checkpoints of this file (optional)",
+					},
+				},
+			},
+			Handler: s.handleListCheckpoints,
+		},
+		{
+			Name:        "diff_checkpoint",
+			Description: "Shows a unified diff between the content a file had at a checkpoint and its current content",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"id": map[string]any{
+						"type":        "integer",
+						"description": "Checkpoint ID returned by the modifying tool or list_checkpoints",
+					},
+				},
+				"required": []string{"id"},
+			},
+			Handler: s.handleDiffCheckpoint,
+		},
+		{
+			Name:        "restore_checkpoint",
+			Description: "Restores files to their content at a checkpoint, or undoes every modification made since a time. Restoring is checkpointed too, so it can be undone",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"id": map[string]any{
+						"type":        "integer",
+						"description": "Checkpoint to restore",
+					},
+					"since": map[string]any{
+						"type":        "string",
+						"description": "Undo the modifications made since this RFC 3339 time or Unix timestamp, newest first",
+					},
+				},
+			},
+			Handler: s.handleRestoreCheckpoint,
+		},
+	}
+}
+
+func (s *PanCodeService) handleListCheckpoints(args map[string]any) (any, error) {
+	var filter string
+	if p, ok := args["file_path"].(string); ok && p != "" {
+		abs, err := resolvePath(p)
+		if err != nil {
+			return nil, err
+		}
+		filter = abs
+	}
+	s.checkpoints.mu.Lock()
+	defer s.checkpoints.mu.Unlock()
+	list := []map[string]any{}
+	for i := len(s.checkpoints.checkpoints) - 1; i >= 0; i-- {
+		cp := s.checkpoints.checkpoints[i]
+		if filter != "" && cp.Path != filter {
+			continue
+		}
+		list = append(list, map[string]any{
+			"id":       cp.ID,
+			"tool":     cp.Tool,
+			"path":     cp.Path,
+			"time":     cp.Time.Format(time.RFC3339Nano),
+			"existed":  cp.Existed,
+			"restored": cp.Restored,
+		})
+	}
+	return map[string]any{"checkpoints": list}, nil
+}
+
+func checkpointID(args map[string]any) (int, bool) {
+	switch v := args["id"].(type) {
+	case float64:
+		return int(v), true
+	case string:
+		id, err := strconv.Atoi(v)
+		return id, err == nil
+	}
+	return 0, false
+}
+
+func (s *PanCodeService) handleDiffCheckpoint(args map[string]any) (any, error) {
+	id, ok := checkpointID(args)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+	cp, err := s.checkpoints.get(id)
+	if err != nil {
+		return nil, err
+	}
+	before, err := s.checkpoints.content(cp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %d: %v", id, err)
+	}
+	after, err := os.ReadFile(cp.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	fromName, toName := "a"+cp.Path, "b"+cp.Path
+	if !cp.Existed {
+		fromName = "/dev/null"
+	}
+	if os.IsNotExist(err) {
+		toName = "/dev/null"
+	}
+	diff := unifiedDiff(fromName, toName, string(before), string(after))
+	return map[string]any{
+		"id":      cp.ID,
+		"path":    cp.Path,
+		"changed": diff != "",
+		"diff":    diff,
+	}, nil
+}
+
+func (s *PanCodeService) handleRestoreCheckpoint(args map[string]any) (any, error) {
+	var targets []*Checkpoint
+	if id, ok := checkpointID(args); ok {
+		cp, err := s.checkpoints.get(id)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, cp)
+	} else if since, ok := args["since"].(string); ok && since != "" {
+		t, err := parseSince(since)
+		if err != nil {
+			return nil, err
+		}
+		s.checkpoints.mu.Lock()
+		for i := len(s.checkpoints.checkpoints) - 1; i >= 0; i-- {
+			cp := s.checkpoints.checkpoints[i]
+			if cp.Time.Before(t) {
+				break
+			}
+			if !cp.Restored {
+				targets = append(targets, cp)
+			}
+		}
+		s.checkpoints.mu.Unlock()
+	} else {
+		return nil, fmt.Errorf("id or since is required")
+	}
+
+	// Restoring the newest first leaves every file as it was before the
+	// oldest modification
+	restored := []map[string]any{}
+	files := map[string]bool{}
+	for _, cp := range targets {
+		undo, err := s.checkpoints.restore(cp)
+		if err != nil {
+			return nil, err
+		}
+		files[cp.Path] = true
+		restored = append(restored, map[string]any{
+			"id":   cp.ID,
+			"path": cp.Path,
+			"undo": undo.ID,
+		})
+	}
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return map[string]any{
+		"restored": restored,
+		"files":    paths,
+	}, nil
+}
+
+// parseSince parses an RFC 3339 time or a Unix timestamp in seconds
+func parseSince(since string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, since); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseFloat(since, 64); err == nil {
+		return time.Unix(0, int64(secs*float64(time.Second))), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since: %s", since)
+}
+
+// maxDiffCells bounds the line comparison of unifiedDiff
+const maxDiffCells = 4 << 20
+
+// unifiedDiff returns the differences between two texts in unified format
+// with three lines of context, or an empty string when they are equal
+func unifiedDiff(fromName, toName, before, after string) string {
+	if before == after {
+		return ""
+	}
+	a, b := splitLines(before), splitLines(after)
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	const context = 3
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk while changes are closer than twice the context
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				if run-end > context {
+					run = end + context
+				}
+				end = run
+				break
+			}
+			end = run
+		}
+		aStart, bStart, aLen, bLen := ops[start].a, ops[start].b, 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.text)
+			out.WriteByte('\n')
+			if op.noEOL {
+				out.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return out.String()
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return strconv.Itoa(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+type diffLine struct {
+	text  string
+	noEOL bool
+}
+
+type diffOp struct {
+	kind  byte // ' ', '-' or '+'
+	text  string
+	noEOL bool
+	a, b  int // Line indexes before the operation
+}
+
+func splitLines(s string) []diffLine {
+	if s == "" {
+		return nil
+	}
+	parts := strings.SplitAfter(s, "\n")
+	lines := make([]diffLine, 0, len(parts))
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+		lines = append(lines, diffLine{text: strings.TrimSuffix(p, "\n"), noEOL: !strings.HasSuffix(p, "\n")})
+	}
+	return lines
+}
+
+// diffLines aligns the lines with a longest common subsequence, replacing
+// the whole middle when the texts are too large to compare
+func diffLines(a, b []diffLine) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	var ops []diffOp
+	ai, bi := 0, 0
+	emit := func(kind byte, l diffLine) {
+		ops = append(ops, diffOp{kind: kind, text: l.text, noEOL: l.noEOL, a: ai, b: bi})
+		if kind != '+' {
+			ai++
+		}
+		if kind != '-' {
+			bi++
+		}
+	}
+	for _, l := range a[:prefix] {
+		emit(' ', l)
+	}
+	if len(ma)*len(mb) > maxDiffCells {
+		for _, l := range ma {
+			emit('-', l)
+		}
+		for _, l := range mb {
+			emit('+', l)
+		}
+	} else {
+		// lcs[i][j] is the length of the common subsequence of ma[i:], mb[j:]
+		lcs := make([][]int32, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) || j < len(mb) {
+			switch {
+			case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+				emit(' ', ma[i])
+				i++
+				j++
+			case j < len(mb) && (i == len(ma) || lcs[i][j+1] > lcs[i+1][j]):
+				emit('+', mb[j])
+				j++
+			default:
+				emit('-', ma[i])
+				i++
+			}
+		}
+	}
+	for _, l := range a[len(a)-suffix:] {
+		emit(' ', l)
+	}
+	return ops
+}
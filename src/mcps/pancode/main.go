@@ -10,11 +10,12 @@ import (
 )
 
 func main() {
-	listen := flag.String("l", "", "listen host:port, http://host:port/path, or sse://host:port/path (optional) serve MCP over TCP, HTTP, or SSE")
+	listen := flag.String("l", "", "listen host:port, http://host:port/path, sse://host:port/path, ws://host:port/path, or unix:///path (optional) serve MCP over TCP, HTTP, SSE, WebSocket, or a Unix socket")
 	workdirFlag := flag.String("workdir", "", "(optional) working directory for repository operations (or set PANCODE_WORKDIR)")
 	sandboxFlag := flag.String("sandboxdir", "", "(optional) sandbox directory for ephemeral files (or set PANCODE_SANDBOXDIR)")
 	listTools := flag.Bool("t", false, "list all available tools and exit")
 	minimalMode := flag.Bool("m", false, "enable only minimum necessary tools for coding agent")
+	policyFile := flag.String("policy", "", "(optional) JSON command policy file (or set MCPLIB_COMMAND_POLICY)")
 	flag.Parse()
 
 	// Determine effective directories: flags override env vars
@@ -36,7 +37,15 @@ func main() {
 		os.Exit(2)
 	}
 
-	pancodeService := NewPanCodeService(*minimalMode)
+	policy, err := mcplib.LoadCommandPolicy(*policyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load command policy: %v\n", err)
+		os.Exit(2)
+	}
+	// Commands may also write to the workdir and the sandbox
+	policy.Dirs = append(policy.Dirs, workDir, sandboxDir, tmpDir)
+
+	pancodeService := NewPanCodeService(*minimalMode, policy)
 
 	// Get all tools from the service
 	tools := pancodeService.GetTools()
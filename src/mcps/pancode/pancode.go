@@ -30,15 +30,23 @@ type PanCodeService struct {
 
 	// Minimal mode: only essential tools for coding
 	minimalMode bool
+
+	// Policy deciding which shell commands are run
+	policy *mcplib.CommandPolicy
+
+	// Content of the files before each modification
+	checkpoints *CheckpointStore
 }
 
 // NewPanCodeService creates a new PanCodeService instance
-func NewPanCodeService(minimalMode bool) *PanCodeService {
+func NewPanCodeService(minimalMode bool, policy *mcplib.CommandPolicy) *PanCodeService {
 	return &PanCodeService{
 		fileModTimes:     make(map[string]time.Time),
 		langCache:        make(map[string]string),
 		buildSystemCache: make(map[string]string),
 		minimalMode:      minimalMode,
+		policy:           policy,
+		checkpoints:      NewCheckpointStore(),
 	}
 }
 
@@ -308,7 +316,7 @@ func (s *PanCodeService) GetTools() []mcplib.Tool {
 		)
 	}
 
-	return tools
+	return append(tools, s.checkpointTools()...)
 }
 
 // Handler implementations
@@ -618,12 +626,16 @@ func (s *PanCodeService) handleReplace(args map[string]any) (any, error) {
 	if err != nil {
 		return nil, err
 	}
+	cp, err := s.checkpoints.Snapshot("replace", absW)
+	if err != nil {
+		return nil, err
+	}
 	err = os.WriteFile(absW, []byte(newContent), 0644)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write file: %v", err)
 	}
 
-	return map[string]any{"success": true}, nil
+	return map[string]any{"success": true, "checkpoint": cp.ID}, nil
 }
 
 func (s *PanCodeService) handleWriteFile(args map[string]any) (any, error) {
@@ -641,13 +653,18 @@ func (s *PanCodeService) handleWriteFile(args map[string]any) (any, error) {
 	if err != nil {
 		return nil, err
 	}
+	cp, err := s.checkpoints.Snapshot("write_file", abs)
+	if err != nil {
+		return nil, err
+	}
 	err = os.WriteFile(abs, []byte(content), 0644)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write file: %v", err)
 	}
 
 	return map[string]any{
-		"success": true,
+		"success":    true,
+		"checkpoint": cp.ID,
 	}, nil
 }
 
@@ -852,6 +869,9 @@ func (s *PanCodeService) handleRunShellCommand(args map[string]any) (any, error)
 			return nil, err
 		}
 	}
+	if refusal := s.policy.Check(command, cmd.Dir); refusal != nil {
+		return refusal.ToolResult(), nil
+	}
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -948,10 +968,14 @@ func (s *PanCodeService) handlePatchFile(args map[string]any) (any, error) {
 	newContent = append(newContent, fileContent[loc[1]:]...)
 
 	// Write the modified content back to the file
+	cp, err := s.checkpoints.Snapshot("patch_file", abs)
+	if err != nil {
+		return nil, err
+	}
 	err = os.WriteFile(abs, newContent, 0644)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write file: %v", err)
 	}
 
-	return map[string]any{"success": true}, nil
+	return map[string]any{"success": true, "checkpoint": cp.ID}, nil
 }
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"mcplib"
+)
+
+// placeholderRe matches {{name}} and {{name|filter}} in templates
+var placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*(?:\|\s*([a-z]+)\s*)?\}\}`)
+
+// validate checks the templates, timeout and output settings of a tool
+func (t *ToolConfig) validate() error {
+	if t.Command.Program == "" {
+		return fmt.Errorf("command program is required")
+	}
+	templates := append([]string{t.Command.Program, t.Command.Dir}, t.Command.Args...)
+	for _, v := range t.Command.Environment {
+		templates = append(templates, v)
+	}
+	switch t.Command.Stdin {
+	case "", "json", "none":
+	default:
+		templates = append(templates, t.Command.Stdin)
+	}
+	for _, tmpl := range templates {
+		for _, m := range placeholderRe.FindAllStringSubmatch(tmpl, -1) {
+			if _, ok := t.Arguments[m[1]]; !ok {
+				return fmt.Errorf("unknown argument in %q: %s", tmpl, m[1])
+			}
+			switch m[2] {
+			case "", "quote", "json", "if":
+			default:
+				return fmt.Errorf("unknown filter in %q: %s", tmpl, m[2])
+			}
+		}
+	}
+	for name, arg := range t.Arguments {
+		if arg.Default != nil && len(arg.Enum) > 0 && !inEnum(arg.Enum, arg.Default) {
+			return fmt.Errorf("default of argument %s is not one of its values", name)
+		}
+	}
+
+	if t.Command.Timeout != "" {
+		if secs, err := strconv.Atoi(t.Command.Timeout); err == nil {
+			t.timeout = time.Duration(secs) * time.Second
+		} else if d, err := time.ParseDuration(t.Command.Timeout); err == nil {
+			t.timeout = d
+		} else {
+			return fmt.Errorf("invalid timeout: %s", t.Command.Timeout)
+		}
+	}
+
+	switch t.Output.Format {
+	case "", "text", "json", "lines":
+	case "regex":
+		re, err := regexp.Compile(t.Output.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid output pattern: %v", err)
+		}
+		named := false
+		for _, name := range re.SubexpNames() {
+			if name != "" {
+				named = true
+			}
+		}
+		if !named {
+			return fmt.Errorf("output pattern has no named groups")
+		}
+		t.pattern = re
+	default:
+		return fmt.Errorf("unknown output format: %s", t.Output.Format)
+	}
+	return nil
+}
+
+// outputSchema returns the output schema declared by the tool, derived from
+// the output format unless given in the config
+func (t *ToolConfig) outputSchema() map[string]any {
+	if t.Output.Schema != nil {
+		return t.Output.Schema
+	}
+	switch t.Output.Format {
+	case "lines":
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"lines": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+			"required": []string{"lines"},
+		}
+	case "regex":
+		fields := map[string]any{}
+		for _, name := range t.pattern.SubexpNames() {
+			if name != "" {
+				fields[name] = map[string]any{"type": "string"}
+			}
+		}
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"matches": map[string]any{
+					"type":  "array",
+					"items": map[string]any{"type": "object", "properties": fields},
+				},
+			},
+			"required": []string{"matches"},
+		}
+	}
+	return nil
+}
+
+// run executes the program of the tool for a call
+func (t *ToolConfig) run(ctx context.Context, args map[string]any) (any, error) {
+	values := map[string]any{}
+	for name, arg := range t.Arguments {
+		v, ok := args[name]
+		if !ok || v == nil {
+			if arg.Required {
+				return nil, fmt.Errorf("%s is required", name)
+			}
+			if arg.Default == nil {
+				continue
+			}
+			v = arg.Default
+		}
+		if len(arg.Enum) > 0 && !inEnum(arg.Enum, v) {
+			return nil, fmt.Errorf("invalid value for %s: %v", name, v)
+		}
+		values[name] = v
+	}
+	for name, v := range args {
+		if _, declared := t.Arguments[name]; !declared {
+			values[name] = v
+		}
+	}
+
+	program := expandTemplate(t.Command.Program, values)
+	var cmdArgs []string
+	for _, arg := range t.Command.Args {
+		cmdArgs = append(cmdArgs, expandArg(arg, values)...)
+	}
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, program, cmdArgs...)
+	env := os.Environ()
+	for k, v := range t.Command.Environment {
+		if onlyMissing(v, values) {
+			continue
+		}
+		env = append(env, fmt.Sprintf("%s=%s", k, expandTemplate(v, values)))
+	}
+	cmd.Env = env
+	cmd.Dir = expandTemplate(t.Command.Dir, values)
+
+	switch t.Command.Stdin {
+	case "", "json":
+		// Marshal arguments to JSON and pass to stdin
+		stdinBytes, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stdin = bytes.NewReader(stdinBytes)
+	case "none":
+	default:
+		cmd.Stdin = strings.NewReader(expandTemplate(t.Command.Stdin, values))
+	}
+
+	var stdout, stderr bytes.Buffer
+	format := t.Output.Format
+	if format == "" || format == "text" {
+		// Keep stdout and stderr interleaved like a terminal would
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stdout
+	} else {
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+	}
+	err := cmd.Run()
+	output := stdout.String() + stderr.String()
+
+	if ctx.Err() == context.DeadlineExceeded && t.timeout > 0 {
+		return errorResult(fmt.Sprintf("timed out after %v", t.timeout), output), nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	code := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, err
+		}
+		code = exitErr.ExitCode()
+	}
+	if !t.successCode(code) {
+		msg := t.Command.Errors[code]
+		if msg == "" {
+			msg = fmt.Sprintf("exit status %d", code)
+		}
+		return errorResult(msg, output), nil
+	}
+
+	structured, err := t.parseOutput(stdout.String())
+	if err != nil {
+		return errorResult(err.Error(), output), nil
+	}
+	if structured == nil {
+		return output, nil
+	}
+	return mcplib.ToolCallResult{
+		Content:           []any{map[string]any{"type": "text", "text": output}},
+		StructuredContent: structured,
+	}, nil
+}
+
+func (t *ToolConfig) successCode(code int) bool {
+	if len(t.Command.ExitCodes) == 0 {
+		return code == 0
+	}
+	for _, c := range t.Command.ExitCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOutput turns the standard output into structuredContent, or nil
+// for the text format
+func (t *ToolConfig) parseOutput(stdout string) (map[string]any, error) {
+	switch t.Output.Format {
+	case "json":
+		var v any
+		if err := json.Unmarshal([]byte(stdout), &v); err != nil {
+			return nil, fmt.Errorf("invalid JSON output: %v", err)
+		}
+		if obj, ok := v.(map[string]any); ok {
+			return obj, nil
+		}
+		// structuredContent must be an object
+		return map[string]any{"result": v}, nil
+	case "lines":
+		lines := []string{}
+		for _, line := range strings.Split(stdout, "\n") {
+			if line = strings.TrimRight(line, "\r"); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		return map[string]any{"lines": lines}, nil
+	case "regex":
+		matches := []map[string]any{}
+		names := t.pattern.SubexpNames()
+		for _, line := range strings.Split(stdout, "\n") {
+			m := t.pattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+			if m == nil {
+				continue
+			}
+			match := map[string]any{}
+			for i, name := range names {
+				if name != "" {
+					match[name] = m[i]
+				}
+			}
+			matches = append(matches, match)
+		}
+		return map[string]any{"matches": matches}, nil
+	}
+	return nil, nil
+}
+
+func errorResult(msg, output string) mcplib.ToolCallResult {
+	text := msg
+	if output != "" {
+		text += "\n" + output
+	}
+	return mcplib.ToolCallResult{
+		Content: []any{map[string]any{"type": "text", "text": text}},
+		IsError: true,
+	}
+}
+
+// expandArg expands an element of args. An element made of a single
+// placeholder of an array argument becomes one element per item, and
+// elements only referring to missing or false arguments are dropped.
+func expandArg(arg string, values map[string]any) []string {
+	if onlyMissing(arg, values) {
+		return nil
+	}
+	if m := placeholderRe.FindStringSubmatch(arg); m != nil && m[0] == arg && m[2] == "" {
+		if items, ok := values[m[1]].([]any); ok {
+			out := make([]string, 0, len(items))
+			for _, item := range items {
+				out = append(out, formatValue(item))
+			}
+			return out
+		}
+	}
+	return []string{expandTemplate(arg, values)}
+}
+
+// onlyMissing reports whether a template has placeholders and all of them
+// refer to missing or false arguments
+func onlyMissing(tmpl string, values map[string]any) bool {
+	matches := placeholderRe.FindAllStringSubmatch(tmpl, -1)
+	if len(matches) == 0 {
+		return false
+	}
+	for _, m := range matches {
+		if v, ok := values[m[1]]; ok && v != false {
+			return false
+		}
+	}
+	return true
+}
+
+// expandTemplate replaces the placeholders of a template. {{name}} is the
+// value as is, {{name|quote}} the value quoted for a POSIX shell,
+// {{name|json}} the value encoded as JSON and {{name|if}} nothing, only
+// making the element depend on the argument. Missing arguments expand to
+// nothing.
+func expandTemplate(tmpl string, values map[string]any) string {
+	return placeholderRe.ReplaceAllStringFunc(tmpl, func(placeholder string) string {
+		m := placeholderRe.FindStringSubmatch(placeholder)
+		v, ok := values[m[1]]
+		switch m[2] {
+		case "if":
+			return ""
+		case "json":
+			data, _ := json.Marshal(v)
+			return string(data)
+		case "quote":
+			if items, isArray := v.([]any); isArray {
+				quoted := make([]string, 0, len(items))
+				for _, item := range items {
+					quoted = append(quoted, shellQuote(formatValue(item)))
+				}
+				return strings.Join(quoted, " ")
+			}
+			if !ok {
+				return "''"
+			}
+			return shellQuote(formatValue(v))
+		}
+		if !ok {
+			return ""
+		}
+		return formatValue(v)
+	})
+}
+
+// formatValue converts an argument to its text form. Objects and arrays
+// are encoded as JSON.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// shellQuote quotes a string so a POSIX shell reads it as a single word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func inEnum(enum []any, v any) bool {
+	for _, e := range enum {
+		if formatValue(e) == formatValue(v) {
+			return true
+		}
+	}
+	return false
+}
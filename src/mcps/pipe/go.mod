@@ -6,4 +6,4 @@ replace mcplib => ../lib
 
 require mcplib v0.0.0-00010101000000-000000000000
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require gopkg.in/yaml.v3 v3.0.1
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -35,6 +37,10 @@ type ArgumentConfig struct {
 	Description string `yaml:"description"`
 	Required    bool   `yaml:"required"`
 	Type        string `yaml:"type"`
+	// Enum lists the accepted values
+	Enum []any `yaml:"enum"`
+	// Default is used when the argument is missing
+	Default any `yaml:"default"`
 }
 
 // UnmarshalYAML allows ArgumentConfig to be parsed from either a simple string
@@ -53,18 +59,53 @@ func (a *ArgumentConfig) UnmarshalYAML(value *yaml.Node) error {
 		return err
 	}
 	*a = ArgumentConfig(ra)
+	if a.Type == "" {
+		a.Type = "string"
+	}
 	return nil
 }
 
+// CommandConfig describes how a tool runs its program. Args, environment
+// values, stdin and dir are templates where {{name}} is replaced by the
+// value of an argument.
+type CommandConfig struct {
+	Program     string            `yaml:"program"`
+	Environment map[string]string `yaml:"environment"`
+	Args        []string          `yaml:"args"`
+	// Stdin is "json" (the default) to pass the arguments as a JSON
+	// object, "none", or a template
+	Stdin string `yaml:"stdin"`
+	// Dir is the working directory
+	Dir string `yaml:"dir"`
+	// Timeout is a duration like "30s" or a number of seconds
+	Timeout string `yaml:"timeout"`
+	// ExitCodes lists the exit codes meaning success, 0 by default
+	ExitCodes []int `yaml:"exit_codes"`
+	// Errors maps exit codes to the error message reported for them
+	Errors map[int]string `yaml:"errors"`
+}
+
+// OutputConfig describes how the output of a tool is parsed into
+// structuredContent
+type OutputConfig struct {
+	// Format is "text" (the default), "json", "lines" or "regex"
+	Format string `yaml:"format"`
+	// Pattern is the regular expression matched against every output line
+	// by the regex format. Its named groups become the fields of a match.
+	Pattern string `yaml:"pattern"`
+	// Schema is the output schema declared by the tool
+	Schema map[string]any `yaml:"schema"`
+}
+
 // ToolConfig defines the configuration for a single tool in YAML
 type ToolConfig struct {
 	Description string                    `yaml:"description"`
 	Arguments   map[string]ArgumentConfig `yaml:"arguments"`
-	Command     struct {
-		Program     string            `yaml:"program"`
-		Environment map[string]string `yaml:"environment"`
-		Args        []string          `yaml:"args"`
-	} `yaml:"command"`
+	Command     CommandConfig             `yaml:"command"`
+	Output      OutputConfig              `yaml:"output"`
+
+	timeout time.Duration
+	pattern *regexp.Regexp
 }
 
 // Config holds multiple tool configurations
@@ -82,25 +123,45 @@ func loadConfig(path string) (*Config, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
+	for name, tcfg := range cfg.Tools {
+		if err := tcfg.validate(); err != nil {
+			return nil, fmt.Errorf("tool %s: %v", name, err)
+		}
+	}
 	return &cfg, nil
 }
 
 // buildTools constructs mcplib.Tools based on the loaded config
 func buildTools(cfg *Config) []mcplib.Tool {
+	names := make([]string, 0, len(cfg.Tools))
+	for name := range cfg.Tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	var tools []mcplib.Tool
-	for name, tcfg := range cfg.Tools {
+	for _, name := range names {
+		tcfg := cfg.Tools[name]
 		properties := map[string]any{}
 		// Build JSON schema properties for each argument, collecting required fields
 		requiredFields := []string{}
 		for argName, argCfg := range tcfg.Arguments {
-			properties[argName] = map[string]any{
+			property := map[string]any{
 				"type":        argCfg.Type,
 				"description": argCfg.Description,
 			}
+			if len(argCfg.Enum) > 0 {
+				property["enum"] = argCfg.Enum
+			}
+			if argCfg.Default != nil {
+				property["default"] = argCfg.Default
+			}
+			properties[argName] = property
 			if argCfg.Required {
 				requiredFields = append(requiredFields, argName)
 			}
 		}
+		sort.Strings(requiredFields)
 		inputSchema := map[string]any{
 			"type":       "object",
 			"properties": properties,
@@ -108,29 +169,18 @@ func buildTools(cfg *Config) []mcplib.Tool {
 		if len(requiredFields) > 0 {
 			inputSchema["required"] = requiredFields
 		}
-		handler := func(args map[string]any) (any, error) {
-			cmd := exec.Command(tcfg.Command.Program, tcfg.Command.Args...)
-			env := os.Environ()
-			for k, v := range tcfg.Command.Environment {
-				env = append(env, fmt.Sprintf("%s=%s", k, v))
-			}
-			cmd.Env = env
-
-			// Marshal arguments to JSON and pass to stdin
-			stdinBytes, err := json.Marshal(args)
-			if err != nil {
-				return nil, err
-			}
-			cmd.Stdin = bytes.NewReader(stdinBytes)
-
-			output, err := cmd.CombinedOutput()
-			return string(output), err
+		handler := func(ctx context.Context, args map[string]any) (any, error) {
+			return tcfg.run(ctx, args)
 		}
 		tools = append(tools, mcplib.Tool{
-			Name:        name,
-			Description: tcfg.Description,
-			InputSchema: inputSchema,
-			Handler:     handler,
+			Name:         name,
+			Description:  tcfg.Description,
+			InputSchema:  inputSchema,
+			OutputSchema: tcfg.outputSchema(),
+			Handler: func(args map[string]any) (any, error) {
+				return handler(context.Background(), args)
+			},
+			HandlerWithContext: handler,
 		})
 	}
 	return tools
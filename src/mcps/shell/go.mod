@@ -5,3 +5,5 @@ go 1.20.0
 replace mcplib => ../lib
 
 require mcplib v0.0.0-00010101000000-000000000000
+
+require github.com/creack/pty v1.1.24
@@ -8,17 +8,25 @@ import (
 )
 
 func main() {
-	listen := flag.String("l", "", "listen host:port, http://host:port/path, or sse://host:port/path (optional) serve MCP over TCP, HTTP, or SSE")
+	listen := flag.String("l", "", "listen host:port, http://host:port/path, sse://host:port/path, ws://host:port/path, or unix:///path (optional) serve MCP over TCP, HTTP, SSE, WebSocket, or a Unix socket")
+	policyFile := flag.String("policy", "", "(optional) JSON command policy file (or set MCPLIB_COMMAND_POLICY)")
 	flag.Parse()
 
-	shellService := NewShellService()
+	policy, err := mcplib.LoadCommandPolicy(*policyFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	shellService := NewShellService(policy)
 
 	// Get all tools from the service
 	tools := shellService.GetTools()
 	server := mcplib.NewMCPServerFromTools(tools)
 
 	// Start the server - this will block until the server is stopped
-	if err := server.ListenAndServe(*listen, false); err != nil {
+	err = server.ListenAndServe(*listen, false)
+	// Do not leave the programs of the sessions running
+	shellService.sessions.CloseAll()
+	if err != nil {
 		log.Fatalln("ListenAndServe:", err)
 	}
 }
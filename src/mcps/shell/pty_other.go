@@ -0,0 +1,33 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+var errNoPTY = errors.New("shell sessions are not supported on this platform")
+
+func startPTY(cmd *exec.Cmd, rows, cols int) (*os.File, error) {
+	return nil, errNoPTY
+}
+
+func parseSignal(name string) (syscall.Signal, bool) {
+	return 0, false
+}
+
+func signalForeground(f *os.File, pid int, sig syscall.Signal) error {
+	return errNoPTY
+}
+
+func hangup(pid int) error {
+	return errNoPTY
+}
+
+func kill(pid int) error {
+	return errNoPTY
+}
@@ -0,0 +1,57 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"github.com/creack/pty"
+)
+
+var sessionSignals = map[string]syscall.Signal{
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+	"HUP":  syscall.SIGHUP,
+	"QUIT": syscall.SIGQUIT,
+	"TSTP": syscall.SIGTSTP,
+	"CONT": syscall.SIGCONT,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// startPTY starts the command in a new session with the pseudo terminal as
+// its controlling terminal
+func startPTY(cmd *exec.Cmd, rows, cols int) (*os.File, error) {
+	return pty.StartWithSize(cmd, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)})
+}
+
+func parseSignal(name string) (syscall.Signal, bool) {
+	sig, ok := sessionSignals[name]
+	return sig, ok
+}
+
+// signalForeground sends a signal to the foreground process group of the
+// terminal, like the terminal driver does for Ctrl-C, falling back to the
+// process group of the session leader
+func signalForeground(f *os.File, pid int, sig syscall.Signal) error {
+	var pgrp int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgrp)))
+	if errno != 0 || pgrp <= 0 {
+		pgrp = int32(pid)
+	}
+	return syscall.Kill(-int(pgrp), sig)
+}
+
+// hangup sends SIGHUP to the session, as closing a terminal does
+func hangup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGHUP)
+}
+
+func kill(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"mcplib"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSessions is the number of shell sessions that can be open at once
+	maxSessions = 16
+	// maxSessionOutput is the output kept per session, older output is
+	// dropped
+	maxSessionOutput = 1 << 20
+	// maxReadOutput is the output returned by a single read
+	maxReadOutput = 64 * 1024
+	// defaultWaitTimeout is how long reads wait for a pattern by default
+	defaultWaitTimeout = 10 * time.Second
+)
+
+// ansiRe matches the terminal escape sequences removed from the output
+var ansiRe = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[()][0-9A-Za-z]|[=>78cDEHM])`)
+
+// shellSession is a program running on a pseudo terminal. Its output is
+// kept in a buffer addressed by absolute byte offsets, the cursors.
+type shellSession struct {
+	name    string
+	command string
+	pid     int
+	pty     *os.File
+	prompt  *regexp.Regexp
+	started time.Time
+	dir     string
+	shell   bool // Input is checked against the command policy
+
+	mu       sync.Mutex
+	output   []byte
+	start    int64         // Offset of output[0]
+	changed  chan struct{} // Closed and replaced when output or state change
+	exited   bool
+	exitCode int
+}
+
+// SessionManager keeps the shell sessions open between tool calls
+type SessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*shellSession
+	policy   *mcplib.CommandPolicy
+}
+
+// NewSessionManager creates a SessionManager without sessions. The
+// commands sessions are opened with, and the input sent to shells, are
+// checked against policy.
+func NewSessionManager(policy *mcplib.CommandPolicy) *SessionManager {
+	return &SessionManager{sessions: make(map[string]*shellSession), policy: policy}
+}
+
+// sessionTools returns the tools driving the shell sessions
+func (m *SessionManager) sessionTools() []mcplib.Tool {
+	return []mcplib.Tool{
+		{
+			Name:        "session_open",
+			Description: "Opens a named shell session on a pseudo terminal. The working directory, environment variables, virtualenvs and running programs persist between calls, so interactive programs like debuggers and REPLs can be driven with session_send and session_read.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{
+						"type":        "string",
+						"description": "Name of the session, used by the other session tools.",
+					},
+					"command": map[string]any{
+						"type":        "string",
+						"description": "Program to run, with its arguments. Defaults to the user shell.",
+					},
+					"cwd": map[string]any{
+						"type":        "string",
+						"description": "Working directory of the session.",
+					},
+					"env": map[string]any{
+						"type":                 "object",
+						"description":          "Environment variables added to the session.",
+						"additionalProperties": map[string]any{"type": "string"},
+					},
+					"prompt": map[string]any{
+						"type":        "string",
+						"description": "Regular expression matching the prompt of the program, waited for by session_read with wait_for_prompt.",
+					},
+					"rows": map[string]any{
+						"type":        "integer",
+						"description": "Terminal height. Defaults to 24.",
+					},
+					"cols": map[string]any{
+						"type":        "integer",
+						"description": "Terminal width. Defaults to 120.",
+					},
+				},
+				"required": []string{"name"},
+			},
+			UsageExamples: "Example: {\"name\": \"py\", \"command\": \"python3 -q\", \"prompt\": \">>> $\"} - Starts a Python REPL",
+			Handler:       m.handleOpen,
+		},
+		{
+			Name:        "session_send",
+			Description: "Sends input to a shell session, followed by a newline unless enter is false. Control characters like \\u0003 (Ctrl-C) or \\u0004 (Ctrl-D) can be sent as input.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{
+						"type":        "string",
+						"description": "Name of the session.",
+					},
+					"input": map[string]any{
+						"type":        "string",
+						"description": "Text to type into the session.",
+					},
+					"enter": map[string]any{
+						"type":        "boolean",
+						"description": "Whether to press enter after the input. Defaults to true.",
+					},
+				},
+				"required": []string{"name", "input"},
+			},
+			UsageExamples: "Example: {\"name\": \"py\", \"input\": \"print(1 + 1)\"} - Runs a line in the session",
+			Handler:       m.handleSend,
+		},
+		{
+			Name:        "session_read",
+			Description: "Reads the output of a shell session written after the cursor, returning the cursor to pass to the next read. Can wait until the output matches a regular expression or the prompt of the session, or until the program exits.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{
+						"type":        "string",
+						"description": "Name of the session.",
+					},
+					"cursor": map[string]any{
+						"type":        "integer",
+						"description": "Cursor returned by the previous read, 0 to read from the start.",
+					},
+					"wait_for": map[string]any{
+						"type":        "string",
+						"description": "Regular expression to wait for in the output after the cursor, ^ and $ match at line boundaries.",
+					},
+					"wait_for_prompt": map[string]any{
+						"type":        "boolean",
+						"description": "Wait for the prompt given to session_open.",
+					},
+					"timeout": map[string]any{
+						"type":        "number",
+						"description": "Seconds to wait. Defaults to 10 when waiting for a pattern, otherwise reads return at once unless a timeout is given, then they wait for new output.",
+					},
+					"raw": map[string]any{
+						"type":        "boolean",
+						"description": "Keep terminal escape sequences and carriage returns in the output.",
+					},
+				},
+				"required": []string{"name"},
+			},
+			UsageExamples:      "Example: {\"name\": \"py\", \"cursor\": 120, \"wait_for_prompt\": true} - Waits for the REPL to be ready and returns its output",
+			HandlerWithContext: m.handleRead,
+		},
+		{
+			Name:        "session_signal",
+			Description: "Sends a signal to the foreground program of a shell session: INT, TERM, KILL, HUP, QUIT, TSTP, CONT, USR1 or USR2.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{
+						"type":        "string",
+						"description": "Name of the session.",
+					},
+					"signal": map[string]any{
+						"type":        "string",
+						"description": "Signal to send.",
+						"enum":        []string{"INT", "TERM", "KILL", "HUP", "QUIT", "TSTP", "CONT", "USR1", "USR2"},
+					},
+				},
+				"required": []string{"name", "signal"},
+			},
+			UsageExamples: "Example: {\"name\": \"build\", \"signal\": \"INT\"} - Interrupts the running command",
+			Handler:       m.handleSignal,
+		},
+		{
+			Name:        "session_list",
+			Description: "Lists the open shell sessions with their program, process ID, state and output cursor.",
+			InputSchema: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{},
+			},
+			UsageExamples: "Example: {} - Lists the sessions",
+			Handler:       m.handleList,
+		},
+		{
+			Name:        "session_close",
+			Description: "Closes a shell session, hanging up its terminal and killing the programs still running in it.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{
+						"type":        "string",
+						"description": "Name of the session.",
+					},
+				},
+				"required": []string{"name"},
+			},
+			UsageExamples: "Example: {\"name\": \"py\"} - Closes the session",
+			Handler:       m.handleClose,
+		},
+	}
+}
+
+func (m *SessionManager) session(args map[string]any) (*shellSession, error) {
+	name, ok := args["name"].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, exists := m.sessions[name]
+	if !exists {
+		return nil, fmt.Errorf("no session named %s", name)
+	}
+	return session, nil
+}
+
+func (m *SessionManager) handleOpen(args map[string]any) (any, error) {
+	name, ok := args["name"].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	command, _ := args["command"].(string)
+	if command == "" {
+		command = defaultShell()
+	}
+	var prompt *regexp.Regexp
+	if p, ok := args["prompt"].(string); ok && p != "" {
+		re, err := compilePattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prompt: %v", err)
+		}
+		prompt = re
+	}
+	dir, _ := args["cwd"].(string)
+	if refusal := m.policy.Check(command, dir); refusal != nil {
+		return refusal.ToolResult(), nil
+	}
+	rows, cols := 24, 120
+	if r, ok := args["rows"].(float64); ok && r > 0 {
+		rows = int(r)
+	}
+	if c, ok := args["cols"].(float64); ok && c > 0 {
+		cols = int(c)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.sessions[name]; exists {
+		return nil, fmt.Errorf("session %s already exists", name)
+	}
+	if len(m.sessions) >= maxSessions {
+		return nil, fmt.Errorf("too many sessions, close one first")
+	}
+
+	parts := strings.Fields(command)
+	if runtime.GOOS != "windows" && strings.ContainsAny(command, "|&;<>()$`\\\"'*?[]#~=%") {
+		// Let the shell parse commands using its syntax
+		parts = []string{"sh", "-c", command}
+	}
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Dir = dir
+	// Programs write fewer escape sequences to dumb terminals
+	cmd.Env = append(os.Environ(), "TERM=dumb")
+	if env, ok := args["env"].(map[string]any); ok {
+		for k, v := range env {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%v", k, v))
+		}
+	}
+	f, err := startPTY(cmd, rows, cols)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %v", err)
+	}
+
+	session := &shellSession{
+		name:    name,
+		command: command,
+		pid:     cmd.Process.Pid,
+		pty:     f,
+		prompt:  prompt,
+		started: time.Now(),
+		dir:     dir,
+		shell:   mcplib.RunsShell(command),
+		changed: make(chan struct{}),
+	}
+	m.sessions[name] = session
+	go session.readOutput()
+	go session.wait(cmd)
+
+	return map[string]any{
+		"name":    name,
+		"pid":     session.pid,
+		"command": command,
+	}, nil
+}
+
+func defaultShell() string {
+	if runtime.GOOS == "windows" {
+		return "cmd"
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "sh"
+}
+
+// readOutput appends the output of the session to its buffer until the
+// terminal is closed
+func (s *shellSession) readOutput() {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := s.pty.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			s.output = append(s.output, buf[:n]...)
+			if excess := len(s.output) - maxSessionOutput; excess > 0 {
+				s.output = append([]byte(nil), s.output[excess:]...)
+				s.start += int64(excess)
+			}
+			s.notifyLocked()
+			s.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait records the exit of the program
+func (s *shellSession) wait(cmd *exec.Cmd) {
+	err := cmd.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exited = true
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		s.exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		s.exitCode = -1
+	}
+	s.notifyLocked()
+}
+
+func (s *shellSession) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (m *SessionManager) handleSend(args map[string]any) (any, error) {
+	session, err := m.session(args)
+	if err != nil {
+		return nil, err
+	}
+	input, ok := args["input"].(string)
+	if !ok {
+		return nil, fmt.Errorf("input is required")
+	}
+	if session.shell {
+		// The directory may have changed since, relative paths are
+		// resolved from where the session started
+		if refusal := m.policy.Check(input, session.dir); refusal != nil {
+			return refusal.ToolResult(), nil
+		}
+	}
+	if enter, ok := args["enter"].(bool); !ok || enter {
+		input += "\r"
+	}
+	session.mu.Lock()
+	exited := session.exited
+	cursor := session.start + int64(len(session.output))
+	session.mu.Unlock()
+	if exited {
+		return nil, fmt.Errorf("session %s has exited", session.name)
+	}
+	if _, err := session.pty.Write([]byte(input)); err != nil {
+		return nil, fmt.Errorf("failed to send input: %v", err)
+	}
+	return map[string]any{
+		"sent":   len(input),
+		"cursor": cursor,
+	}, nil
+}
+
+func (m *SessionManager) handleRead(ctx context.Context, args map[string]any) (any, error) {
+	session, err := m.session(args)
+	if err != nil {
+		return nil, err
+	}
+	var cursor int64
+	if c, ok := args["cursor"].(float64); ok && c > 0 {
+		cursor = int64(c)
+	}
+	raw, _ := args["raw"].(bool)
+
+	var pattern *regexp.Regexp
+	if p, ok := args["wait_for"].(string); ok && p != "" {
+		if pattern, err = compilePattern(p); err != nil {
+			return nil, fmt.Errorf("invalid wait_for: %v", err)
+		}
+	} else if waitPrompt, _ := args["wait_for_prompt"].(bool); waitPrompt {
+		if session.prompt == nil {
+			return nil, fmt.Errorf("session %s has no prompt", session.name)
+		}
+		pattern = session.prompt
+	}
+	var timeout time.Duration
+	if t, ok := args["timeout"].(float64); ok && t > 0 {
+		timeout = time.Duration(t * float64(time.Second))
+	} else if pattern != nil {
+		timeout = defaultWaitTimeout
+	}
+	deadline := time.After(timeout)
+
+	for {
+		session.mu.Lock()
+		truncated := cursor < session.start
+		from := cursor
+		if truncated {
+			from = session.start
+		}
+		end := session.start + int64(len(session.output))
+		if from > end {
+			from = end
+		}
+		data := append([]byte(nil), session.output[from-session.start:]...)
+		exited, exitCode := session.exited, session.exitCode
+		changed := session.changed
+		session.mu.Unlock()
+
+		text := string(data)
+		if !raw {
+			text = cleanOutput(text)
+		}
+		matched := pattern != nil && pattern.MatchString(text)
+		done := exited || timeout == 0 || matched || (pattern == nil && len(data) > 0)
+		timedOut := false
+		if !done {
+			select {
+			case <-changed:
+				continue
+			case <-deadline:
+				timedOut = true
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		next := end
+		if len(data) > maxReadOutput {
+			// Return the start, the rest is read with the next cursor
+			data = data[:maxReadOutput]
+			next = from + maxReadOutput
+			text = string(data)
+			if !raw {
+				text = cleanOutput(text)
+			}
+		}
+		result := map[string]any{
+			"output":  text,
+			"cursor":  next,
+			"running": !exited,
+		}
+		if pattern != nil {
+			result["matched"] = matched
+		}
+		if timedOut {
+			result["timed_out"] = true
+		}
+		if truncated {
+			result["truncated"] = true
+		}
+		if exited {
+			result["exit_code"] = exitCode
+		}
+		return result, nil
+	}
+}
+
+// compilePattern compiles a pattern waited for, where ^ and $ match at the
+// start and end of lines
+func compilePattern(p string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?m)" + p)
+}
+
+// cleanOutput removes terminal escape sequences and carriage returns
+func cleanOutput(s string) string {
+	s = ansiRe.ReplaceAllString(s, "")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\r", "")
+}
+
+func (m *SessionManager) handleSignal(args map[string]any) (any, error) {
+	session, err := m.session(args)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := args["signal"].(string)
+	sig, ok := parseSignal(strings.TrimPrefix(strings.ToUpper(name), "SIG"))
+	if !ok {
+		return nil, fmt.Errorf("unknown signal: %s", name)
+	}
+	if err := signalForeground(session.pty, session.pid, sig); err != nil {
+		return nil, fmt.Errorf("failed to send signal: %v", err)
+	}
+	return map[string]any{"signal": strings.ToUpper(name), "sent": true}, nil
+}
+
+func (m *SessionManager) handleList(args map[string]any) (any, error) {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.sessions))
+	for name := range m.sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sessions := make([]map[string]any, 0, len(names))
+	for _, name := range names {
+		s := m.sessions[name]
+		s.mu.Lock()
+		entry := map[string]any{
+			"name":    s.name,
+			"command": s.command,
+			"pid":     s.pid,
+			"started": s.started.Format(time.RFC3339),
+			"running": !s.exited,
+			"cursor":  s.start + int64(len(s.output)),
+		}
+		if s.exited {
+			entry["exit_code"] = s.exitCode
+		}
+		s.mu.Unlock()
+		sessions = append(sessions, entry)
+	}
+	m.mu.Unlock()
+	return map[string]any{"sessions": sessions}, nil
+}
+
+func (m *SessionManager) handleClose(args map[string]any) (any, error) {
+	session, err := m.session(args)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	delete(m.sessions, session.name)
+	m.mu.Unlock()
+	session.close()
+	return map[string]any{"name": session.name, "closed": true}, nil
+}
+
+// close hangs up the terminal and kills the programs left after a grace
+// period
+func (s *shellSession) close() {
+	s.mu.Lock()
+	exited, changed := s.exited, s.changed
+	s.mu.Unlock()
+	if !exited {
+		_ = hangup(s.pid)
+		select {
+		case <-changed:
+		case <-time.After(time.Second):
+		}
+		_ = kill(s.pid)
+	}
+	_ = s.pty.Close()
+}
+
+// CloseAll closes every session, when the server stops
+func (m *SessionManager) CloseAll() {
+	m.mu.Lock()
+	sessions := m.sessions
+	m.sessions = make(map[string]*shellSession)
+	m.mu.Unlock()
+	for _, session := range sessions {
+		session.close()
+	}
+}
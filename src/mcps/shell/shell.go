@@ -12,16 +12,20 @@ import (
 )
 
 // ShellService handles all shell-related operations
-type ShellService struct{}
+type ShellService struct {
+	sessions *SessionManager
+	// policy decides which commands are run
+	policy *mcplib.CommandPolicy
+}
 
 // NewShellService creates a new ShellService instance
-func NewShellService() *ShellService {
-	return &ShellService{}
+func NewShellService(policy *mcplib.CommandPolicy) *ShellService {
+	return &ShellService{sessions: NewSessionManager(policy), policy: policy}
 }
 
 // GetTools returns all available shell tools
 func (s *ShellService) GetTools() []mcplib.Tool {
-	return []mcplib.Tool{
+	tools := []mcplib.Tool{
 		// 1. CommandExecutor
 		{
 			Name:        "command_executor",
@@ -329,6 +333,8 @@ func (s *ShellService) GetTools() []mcplib.Tool {
 			Handler:       s.handleGetCurrentDirectory,
 		},
 	}
+	// 4. Sessions
+	return append(tools, s.sessions.sessionTools()...)
 }
 
 // Handler implementations
@@ -339,6 +345,9 @@ func (s *ShellService) handleCommandExecutor(args map[string]any) (any, error) {
 	if !ok || command == "" {
 		return nil, fmt.Errorf("command is required")
 	}
+	if refusal := s.policy.Check(command, ""); refusal != nil {
+		return refusal.ToolResult(), nil
+	}
 
 	// Default timeout is 60 seconds if not specified
 	timeout := 60
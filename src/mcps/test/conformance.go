@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// conformance runs the protocol checks every MCP server should pass
+type conformance struct {
+	target  []string
+	timeout time.Duration
+	verbose bool
+	suite   *testSuite
+	s       *session
+}
+
+// errSkip marks a check that does not apply to the server
+type errSkip string
+
+func (e errSkip) Error() string { return string(e) }
+
+func runConformance(target []string, timeout time.Duration, verbose bool) *testSuite {
+	c := &conformance{target: target, timeout: timeout, verbose: verbose, suite: &testSuite{Name: "conformance"}}
+	start := time.Now()
+	defer func() { c.suite.Duration = time.Since(start) }()
+
+	s, err := newSession(target, timeout, verbose)
+	if err != nil {
+		c.suite.add(testCase{Name: "connect", Failure: err.Error()})
+		return c.suite
+	}
+	c.s = s
+	defer s.close()
+
+	if !c.check("initialize", c.checkInitialize) {
+		// Nothing else can be checked without a session
+		return c.suite
+	}
+	c.check("initialized notification", c.checkInitialized)
+	c.check("version negotiation", c.checkVersionNegotiation)
+	c.check("ping", c.checkPing)
+	c.check("tools/list schemas", c.checkToolsList)
+	c.check("tools/call unknown tool", c.checkUnknownTool)
+	c.check("tools/call invalid params", c.checkInvalidParams)
+	c.check("unknown method", c.checkUnknownMethod)
+	c.check("parse error", c.checkParseError)
+	c.check("cancellation", c.checkCancellation)
+	c.check("resources/list", c.listCheck("resources", "resources/list", "resources"))
+	c.check("resources/templates/list", c.listCheck("resources", "resources/templates/list", "resourceTemplates"))
+	c.check("prompts/list", c.listCheck("prompts", "prompts/list", "prompts"))
+	c.check("notifications", c.checkNotifications)
+	return c.suite
+}
+
+// check runs fn as a test case and reports whether it passed
+func (c *conformance) check(name string, fn func() error) bool {
+	start := time.Now()
+	err := fn()
+	tc := testCase{Name: name, Duration: time.Since(start)}
+	if skip, ok := err.(errSkip); ok {
+		tc.Skipped = string(skip)
+	} else if err != nil {
+		tc.Failure = err.Error()
+	}
+	c.suite.add(tc)
+	return err == nil
+}
+
+// result sends a request and decodes its result, failing on errors
+func (c *conformance) result(method string, params interface{}) (map[string]interface{}, error) {
+	resp, err := c.s.request(method, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return nil, fmt.Errorf("result is not an object: %s", truncate(string(resp.Result), 200))
+	}
+	return result, nil
+}
+
+// expectError sends a request that must fail with the given code
+func (c *conformance) expectError(method string, params interface{}, code int) error {
+	resp, err := c.s.request(method, params)
+	if err != nil {
+		return err
+	}
+	if resp.Error == nil {
+		return fmt.Errorf("expected error %d, got result %s", code, truncate(string(resp.Result), 200))
+	}
+	if resp.Error.Code != code {
+		return fmt.Errorf("expected error %d, got %d (%s)", code, resp.Error.Code, resp.Error.Message)
+	}
+	return nil
+}
+
+func (c *conformance) checkInitialize() error {
+	result, err := c.s.initialize(latestProtocolVersion)
+	if err != nil {
+		return err
+	}
+	version, _ := result["protocolVersion"].(string)
+	if version == "" {
+		return fmt.Errorf("missing protocolVersion in the initialize result")
+	}
+	if !contains(supportedProtocolVersions, version) {
+		return fmt.Errorf("negotiated unknown protocol version %q", version)
+	}
+	if _, ok := result["capabilities"].(map[string]interface{}); !ok {
+		return fmt.Errorf("missing capabilities in the initialize result")
+	}
+	info, ok := result["serverInfo"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("missing serverInfo in the initialize result")
+	}
+	if name, _ := info["name"].(string); name == "" {
+		return fmt.Errorf("missing serverInfo.name in the initialize result")
+	}
+	if _, ok := info["version"].(string); !ok {
+		return fmt.Errorf("missing serverInfo.version in the initialize result")
+	}
+	return nil
+}
+
+func (c *conformance) checkInitialized() error {
+	// The notification was sent by initialize, nothing may answer it
+	if err := c.s.drain(200 * time.Millisecond); err != nil {
+		return err
+	}
+	if unexpected := c.s.takeUnexpected(); len(unexpected) > 0 {
+		return fmt.Errorf("server answered a notification: %s", describe(unexpected[0]))
+	}
+	return nil
+}
+
+func (c *conformance) checkVersionNegotiation() error {
+	// Use a separate connection: initialize may only be sent once
+	s, err := newSession(c.target, c.timeout, c.verbose)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	result, err := s.initialize("1999-01-01")
+	if err != nil {
+		// Rejecting the version is allowed
+		if _, ok := err.(*rpcError); ok {
+			return nil
+		}
+		return err
+	}
+	version, _ := result["protocolVersion"].(string)
+	if !contains(supportedProtocolVersions, version) {
+		return fmt.Errorf("server accepted unknown version 1999-01-01 and answered %q", version)
+	}
+	return nil
+}
+
+func (c *conformance) checkPing() error {
+	resp, err := c.s.request("ping", nil)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if strings.TrimSpace(string(resp.Result)) != "{}" {
+		return fmt.Errorf("expected an empty result, got %s", truncate(string(resp.Result), 200))
+	}
+	return nil
+}
+
+func (c *conformance) checkToolsList() error {
+	if c.s.capabilities != nil && !c.s.hasCapability("tools") {
+		return errSkip("server declares no tools capability")
+	}
+	var problems []string
+	seen := map[string]bool{}
+	var params interface{}
+	for page := 0; page < 100; page++ {
+		result, err := c.result("tools/list", params)
+		if err != nil {
+			return err
+		}
+		tools, ok := result["tools"].([]interface{})
+		if !ok {
+			return fmt.Errorf("tools/list result has no tools array")
+		}
+		for i, t := range tools {
+			tool, ok := t.(map[string]interface{})
+			if !ok {
+				problems = append(problems, fmt.Sprintf("tool #%d is not an object", i))
+				continue
+			}
+			name, _ := tool["name"].(string)
+			if name == "" {
+				problems = append(problems, fmt.Sprintf("tool #%d has no name", i))
+				continue
+			}
+			if seen[name] {
+				problems = append(problems, fmt.Sprintf("tool %s is listed twice", name))
+			}
+			seen[name] = true
+			problems = append(problems, checkToolSchemas(name, tool)...)
+		}
+		cursor, _ := result["nextCursor"].(string)
+		if cursor == "" {
+			break
+		}
+		params = map[string]interface{}{"cursor": cursor}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+var schemaTypes = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// checkToolSchemas validates the input and output schemas of a tool
+func checkToolSchemas(name string, tool map[string]interface{}) []string {
+	var problems []string
+	input, ok := tool["inputSchema"].(map[string]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("tool %s has no inputSchema", name)}
+	}
+	if input["type"] != "object" {
+		problems = append(problems, fmt.Sprintf("tool %s: inputSchema type must be object, got %v", name, input["type"]))
+	}
+	problems = append(problems, checkSchema(name+".inputSchema", input)...)
+	if output, exists := tool["outputSchema"]; exists {
+		schema, ok := output.(map[string]interface{})
+		if !ok || schema["type"] != "object" {
+			problems = append(problems, fmt.Sprintf("tool %s: outputSchema type must be object", name))
+		} else {
+			problems = append(problems, checkSchema(name+".outputSchema", schema)...)
+		}
+	}
+	return problems
+}
+
+// checkSchema checks the types and required properties of a JSON schema
+func checkSchema(path string, schema map[string]interface{}) []string {
+	var problems []string
+	switch t := schema["type"].(type) {
+	case nil:
+	case string:
+		if !contains(schemaTypes, t) {
+			problems = append(problems, fmt.Sprintf("%s: unknown type %q", path, t))
+		}
+	case []interface{}:
+		for _, v := range t {
+			if s, _ := v.(string); !contains(schemaTypes, s) {
+				problems = append(problems, fmt.Sprintf("%s: unknown type %v", path, v))
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("%s: type must be a string or an array", path))
+	}
+	props, _ := schema["properties"].(map[string]interface{})
+	if raw, exists := schema["properties"]; exists && props == nil {
+		problems = append(problems, fmt.Sprintf("%s: properties must be an object, got %T", path, raw))
+	}
+	if raw, exists := schema["required"]; exists {
+		required, ok := raw.([]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: required must be an array", path))
+		}
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := props[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: required property %v is not defined", path, r))
+			}
+		}
+	}
+	for name, p := range props {
+		prop, ok := p.(map[string]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s.%s: property schema must be an object", path, name))
+			continue
+		}
+		problems = append(problems, checkSchema(path+"."+name, prop)...)
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		problems = append(problems, checkSchema(path+"[]", items)...)
+	}
+	return problems
+}
+
+func (c *conformance) checkUnknownTool() error {
+	resp, err := c.s.request("tools/call", map[string]interface{}{
+		"name":      "mai-mcp-test-no-such-tool",
+		"arguments": map[string]interface{}{},
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return nil
+	}
+	// Reporting the error in the tool result is allowed too
+	var result struct {
+		IsError bool `json:"isError"`
+	}
+	if err := json.Unmarshal(resp.Result, &result); err != nil || !result.IsError {
+		return fmt.Errorf("calling an unknown tool succeeded: %s", truncate(string(resp.Result), 200))
+	}
+	return nil
+}
+
+func (c *conformance) checkInvalidParams() error {
+	return c.expectError("tools/call", map[string]interface{}{"name": 42}, -32602)
+}
+
+func (c *conformance) checkUnknownMethod() error {
+	return c.expectError("mai-mcp-test/no-such-method", map[string]interface{}{}, -32601)
+}
+
+func (c *conformance) checkParseError() error {
+	if err := c.s.sendRaw([]byte(`{"jsonrpc": "2.0", "id": 1, "method": `)); err != nil {
+		return err
+	}
+	// The answer has a null id, which wait cannot match. HTTP servers may
+	// only answer with a status code, so do not wait for long.
+	timeout := c.timeout
+	if c.s.kind != "stdio" && timeout > 2*time.Second {
+		timeout = 2 * time.Second
+	}
+	deadline := time.After(timeout)
+	for {
+		msg, err := c.s.next(deadline)
+		if err == errTimeout && c.s.kind != "stdio" {
+			return errSkip("no JSON-RPC answer to a malformed HTTP request")
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method != "" {
+			continue
+		}
+		if msg.Error == nil {
+			return fmt.Errorf("expected error -32700, got %s", describe(*msg))
+		}
+		if msg.Error.Code != -32700 {
+			return fmt.Errorf("expected error -32700, got %d (%s)", msg.Error.Code, msg.Error.Message)
+		}
+		return nil
+	}
+}
+
+func (c *conformance) checkCancellation() error {
+	// Cancelling a request that does not exist must be ignored
+	err := c.s.notify("notifications/cancelled", map[string]interface{}{
+		"requestId": "mai-mcp-test-unknown",
+		"reason":    "conformance test",
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := c.result("tools/list", nil); err != nil {
+		return fmt.Errorf("server stopped answering after a cancellation: %v", err)
+	}
+	if unexpected := c.s.takeUnexpected(); len(unexpected) > 0 {
+		return fmt.Errorf("server answered a notification: %s", describe(unexpected[0]))
+	}
+	return nil
+}
+
+// listCheck returns a check of a list method of an optional capability
+func (c *conformance) listCheck(capability, method, field string) func() error {
+	return func() error {
+		if !c.s.hasCapability(capability) {
+			return errSkip("server declares no " + capability + " capability")
+		}
+		result, err := c.result(method, nil)
+		if err != nil {
+			return err
+		}
+		if _, ok := result[field].([]interface{}); !ok {
+			return fmt.Errorf("%s result has no %s array", method, field)
+		}
+		return nil
+	}
+}
+
+func (c *conformance) checkNotifications() error {
+	var problems []string
+	for _, n := range c.s.takeNotifications() {
+		if n.JSONRPC != "2.0" {
+			problems = append(problems, fmt.Sprintf("%s: jsonrpc must be 2.0", n.Method))
+		}
+		if len(n.Params) > 0 {
+			var params map[string]interface{}
+			if err := json.Unmarshal(n.Params, &params); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: params must be an object", n.Method))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// describe summarizes a message for failure reports
+func describe(msg message) string {
+	data, _ := json.Marshal(msg)
+	return truncate(string(data), 300)
+}
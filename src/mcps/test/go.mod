@@ -0,0 +1,7 @@
+module mcptest
+
+go 1.20.0
+
+replace mcplib => ../lib
+
+require mcplib v0.0.0-00010101000000-000000000000
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// scenarioFlags collects the repeatable -s flag
+type scenarioFlags []string
+
+func (s *scenarioFlags) String() string { return strings.Join(*s, ",") }
+
+func (s *scenarioFlags) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+func main() {
+	var scenarios scenarioFlags
+	flag.Var(&scenarios, "s", "run the scenario file (can be repeated)")
+	junit := flag.String("junit", "", "write a JUnit XML report to the file")
+	update := flag.Bool("update", false, "write the snapshot files instead of comparing them")
+	timeout := flag.Duration("timeout", 30*time.Second, "time to wait for every answer of the server")
+	verbose := flag.Bool("v", false, "print the exchanged messages to stderr")
+	noConformance := flag.Bool("no-conformance", false, "skip the protocol conformance suite")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: mai-mcp-test [flags] <command [args...] | http://host:port/mcp | sse://host:port/sse>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	target := flag.Args()
+	if len(target) == 0 || (*noConformance && len(scenarios) == 0) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	// Fail early when the server cannot be reached at all
+	probe, err := newSession(target, *timeout, false)
+	if err == nil {
+		_, err = probe.initialize(latestProtocolVersion)
+		probe.close()
+		if _, ok := err.(*rpcError); ok {
+			// Reported by the conformance suite
+			err = nil
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+
+	var suites []*testSuite
+	if !*noConformance {
+		fmt.Println("== conformance")
+		suites = append(suites, runConformance(target, *timeout, *verbose))
+	}
+	for _, path := range scenarios {
+		fmt.Println("==", path)
+		suites = append(suites, runScenario(path, target, *timeout, *verbose, *update))
+	}
+
+	tests, failures, skipped := 0, 0, 0
+	for _, suite := range suites {
+		tests += len(suite.Cases)
+		failures += suite.failures()
+		skipped += suite.skipped()
+	}
+	fmt.Printf("%d tests, %d failures, %d skipped\n", tests, failures, skipped)
+
+	if *junit != "" {
+		if err := writeJUnit(*junit, suites); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+	}
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
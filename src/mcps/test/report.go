@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// testCase is the outcome of a conformance check or a scenario step
+type testCase struct {
+	Name     string
+	Duration time.Duration
+	Failure  string
+	Skipped  string
+}
+
+// testSuite groups the cases of the conformance suite or of a scenario
+type testSuite struct {
+	Name     string
+	Cases    []testCase
+	Duration time.Duration
+}
+
+func (s *testSuite) failures() int {
+	n := 0
+	for _, c := range s.Cases {
+		if c.Failure != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *testSuite) skipped() int {
+	n := 0
+	for _, c := range s.Cases {
+		if c.Skipped != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// add records a case and prints its outcome
+func (s *testSuite) add(c testCase) {
+	s.Cases = append(s.Cases, c)
+	switch {
+	case c.Failure != "":
+		fmt.Printf("FAIL %s: %s\n", c.Name, indent(c.Failure))
+	case c.Skipped != "":
+		fmt.Printf("SKIP %s: %s\n", c.Name, c.Skipped)
+	default:
+		fmt.Printf("PASS %s (%s)\n", c.Name, c.Duration.Round(time.Millisecond))
+	}
+}
+
+func indent(text string) string {
+	return strings.ReplaceAll(strings.TrimRight(text, "\n"), "\n", "\n     ")
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// writeJUnit writes the results as a JUnit XML report
+func writeJUnit(path string, suites []*testSuite) error {
+	report := junitTestSuites{}
+	var total time.Duration
+	for _, suite := range suites {
+		js := junitTestSuite{
+			Name:     suite.Name,
+			Tests:    len(suite.Cases),
+			Failures: suite.failures(),
+			Skipped:  suite.skipped(),
+			Time:     seconds(suite.Duration),
+		}
+		for _, c := range suite.Cases {
+			jc := junitTestCase{Name: c.Name, ClassName: suite.Name, Time: seconds(c.Duration)}
+			if c.Failure != "" {
+				jc.Failure = &junitMessage{Message: firstLine(c.Failure), Text: c.Failure}
+			}
+			if c.Skipped != "" {
+				jc.Skipped = &junitMessage{Message: c.Skipped}
+			}
+			js.Cases = append(js.Cases, jc)
+		}
+		report.Suites = append(report.Suites, js)
+		report.Tests += js.Tests
+		report.Failures += js.Failures
+		report.Skipped += js.Skipped
+		total += suite.Duration
+	}
+	report.Time = seconds(total)
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
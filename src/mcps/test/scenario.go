@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"mcplib"
+)
+
+// scenario runs a scenario file. Every line is a statement:
+//
+//	# comment
+//	<tool> key=value ...          call a tool, as in the mcplib DSL
+//	rpc <method> [json]           send a request
+//	notify <method> [json]        send a notification
+//	cancel <tool> key=value ...   call a tool, cancel it and check the server still answers
+//	expect <path> [op value]      check the result of the last call
+//	expect-error [code] ["text"]  check the last call failed
+//	expect-notification <method>  check a notification arrived since the last call
+//	snapshot <name>               compare the result of the last call with a snapshot file
+//
+// Calls start a test case and the checks after them belong to it.
+type scenario struct {
+	path    string
+	s       *session
+	suite   *testSuite
+	update  bool
+	timeout time.Duration
+
+	// current is the case of the last call, nil before the first one
+	current  *testCase
+	started  time.Time
+	resp     *message
+	result   interface{}
+	failed   string // why the last call failed, empty if it succeeded
+	expected bool   // the failure was checked by expect-error
+	notified []message
+}
+
+func runScenario(path string, target []string, timeout time.Duration, verbose, update bool) *testSuite {
+	suite := &testSuite{Name: filepath.Base(path)}
+	start := time.Now()
+	defer func() { suite.Duration = time.Since(start) }()
+
+	f, err := os.Open(path)
+	if err != nil {
+		suite.add(testCase{Name: "load", Failure: err.Error()})
+		return suite
+	}
+	defer f.Close()
+
+	s, err := newSession(target, timeout, verbose)
+	if err != nil {
+		suite.add(testCase{Name: "connect", Failure: err.Error()})
+		return suite
+	}
+	defer s.close()
+	if _, err := s.initialize(latestProtocolVersion); err != nil {
+		suite.add(testCase{Name: "initialize", Failure: err.Error()})
+		return suite
+	}
+
+	sc := &scenario{path: path, s: s, suite: suite, update: update, timeout: timeout}
+	scanner := bufio.NewScanner(f)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := sc.run(lineno, line); err != nil {
+			if sc.current == nil {
+				suite.add(testCase{Name: fmt.Sprintf("%d: %s", lineno, line), Failure: err.Error()})
+			} else {
+				sc.fail(fmt.Sprintf("line %d: %v", lineno, err))
+			}
+		}
+		if s.closed {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		sc.fail(err.Error())
+	}
+	sc.finish()
+	return suite
+}
+
+// run executes a statement
+func (sc *scenario) run(lineno int, line string) error {
+	word, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	switch word {
+	case "expect":
+		return sc.expect(rest)
+	case "expect-error":
+		return sc.expectError(rest)
+	case "expect-notification":
+		return sc.expectNotification(rest)
+	case "snapshot":
+		return sc.snapshot(rest)
+	}
+
+	sc.finish()
+	sc.current = &testCase{Name: fmt.Sprintf("%d: %s", lineno, line)}
+	sc.started = time.Now()
+	sc.resp, sc.result, sc.failed, sc.expected = nil, nil, "", false
+	sc.s.takeNotifications()
+
+	switch word {
+	case "rpc", "notify":
+		method, params, err := parseMethod(rest)
+		if err != nil {
+			return err
+		}
+		if word == "notify" {
+			return sc.s.notify(method, params)
+		}
+		return sc.record(sc.s.request(method, params))
+	case "cancel":
+		return sc.cancel(rest)
+	}
+	stmt, _ := mcplib.ParseDSLStatement(line)
+	return sc.record(sc.s.request("tools/call", map[string]interface{}{
+		"name":      stmt.Tool,
+		"arguments": stmt.Args,
+	}))
+}
+
+// parseMethod parses "<method> [json]"
+func parseMethod(text string) (string, interface{}, error) {
+	method, rest, _ := strings.Cut(text, " ")
+	if method == "" {
+		return "", nil, fmt.Errorf("missing method")
+	}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return method, nil, nil
+	}
+	var params interface{}
+	if err := json.Unmarshal([]byte(rest), &params); err != nil {
+		return "", nil, fmt.Errorf("invalid params: %v", err)
+	}
+	return method, params, nil
+}
+
+// record stores the response of the last call
+func (sc *scenario) record(resp *message, err error) error {
+	if err != nil {
+		return err
+	}
+	sc.resp = resp
+	if resp.Error != nil {
+		sc.failed = resp.Error.Error()
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, &sc.result); err != nil {
+		return fmt.Errorf("invalid result: %v", err)
+	}
+	if obj, ok := sc.result.(map[string]interface{}); ok && obj["isError"] == true {
+		sc.failed = "tool error: " + contentText(obj)
+	}
+	return nil
+}
+
+func (sc *scenario) cancel(text string) error {
+	stmt, ok := mcplib.ParseDSLStatement(text)
+	if !ok {
+		return fmt.Errorf("missing tool name")
+	}
+	id, err := sc.s.start("tools/call", map[string]interface{}{
+		"name":      stmt.Tool,
+		"arguments": stmt.Args,
+	})
+	if err != nil {
+		return err
+	}
+	// Give the server time to start working on the call
+	time.Sleep(100 * time.Millisecond)
+	err = sc.s.notify("notifications/cancelled", map[string]interface{}{
+		"requestId": id,
+		"reason":    "cancelled by mai-mcp-test",
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := sc.s.request("tools/list", nil)
+	if err != nil {
+		return fmt.Errorf("server stopped answering after the cancellation: %v", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("tools/list failed after the cancellation: %v", resp.Error)
+	}
+	return nil
+}
+
+// fail marks the current case as failed
+func (sc *scenario) fail(reason string) {
+	if sc.current == nil {
+		sc.suite.add(testCase{Name: "scenario", Failure: reason})
+		return
+	}
+	if sc.current.Failure != "" {
+		sc.current.Failure += "\n"
+	}
+	sc.current.Failure += reason
+}
+
+// finish records the current case
+func (sc *scenario) finish() {
+	if sc.current == nil {
+		return
+	}
+	if sc.failed != "" && !sc.expected {
+		sc.fail(sc.failed)
+	}
+	sc.current.Duration = time.Since(sc.started)
+	sc.suite.add(*sc.current)
+	sc.current = nil
+}
+
+func (sc *scenario) needCall() error {
+	if sc.current == nil {
+		return fmt.Errorf("no call to check")
+	}
+	if sc.resp == nil {
+		return fmt.Errorf("the last statement has no response to check")
+	}
+	return nil
+}
+
+// expect checks "<path> [op value]" against the result of the last call
+func (sc *scenario) expect(text string) error {
+	if err := sc.needCall(); err != nil {
+		return err
+	}
+	path, rest, _ := strings.Cut(text, " ")
+	rest = strings.TrimSpace(rest)
+	op, operand, _ := strings.Cut(rest, " ")
+	operand = strings.TrimSpace(operand)
+	if op == "" {
+		op = "exists"
+	}
+
+	value, found, err := evalPath(sc.result, path)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case "exists":
+		if !found {
+			return fmt.Errorf("%s does not exist", path)
+		}
+		return nil
+	case "missing":
+		if found {
+			return fmt.Errorf("%s exists: %s", path, show(value))
+		}
+		return nil
+	}
+	if !found {
+		return fmt.Errorf("%s does not exist", path)
+	}
+	if operand == "" {
+		return fmt.Errorf("missing value for %s", op)
+	}
+	want := parseExpected(operand)
+	ok, err := compare(value, op, want)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("expected %s %s %s, got %s", path, op, show(want), show(value))
+	}
+	return nil
+}
+
+// parseExpected parses a JSON literal, or takes the text as a bare string
+func parseExpected(text string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(text), &v); err == nil {
+		return v
+	}
+	return text
+}
+
+func compare(got interface{}, op string, want interface{}) (bool, error) {
+	switch op {
+	case "==":
+		return reflect.DeepEqual(got, want), nil
+	case "!=":
+		return !reflect.DeepEqual(got, want), nil
+	case "<", "<=", ">", ">=":
+		a, ok1 := got.(float64)
+		b, ok2 := want.(float64)
+		if !ok1 || !ok2 {
+			return false, fmt.Errorf("%s needs numbers, got %s and %s", op, show(got), show(want))
+		}
+		switch op {
+		case "<":
+			return a < b, nil
+		case "<=":
+			return a <= b, nil
+		case ">":
+			return a > b, nil
+		}
+		return a >= b, nil
+	case "contains":
+		switch g := got.(type) {
+		case string:
+			return strings.Contains(g, fmt.Sprint(want)), nil
+		case []interface{}:
+			for _, item := range g {
+				if reflect.DeepEqual(item, want) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			_, ok := g[fmt.Sprint(want)]
+			return ok, nil
+		}
+		return false, fmt.Errorf("contains needs a string, an array or an object, got %s", show(got))
+	case "matches":
+		pattern, ok := want.(string)
+		if !ok {
+			return false, fmt.Errorf("matches needs a regular expression")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid regular expression: %v", err)
+		}
+		s, ok := got.(string)
+		if !ok {
+			return false, fmt.Errorf("matches needs a string, got %s", show(got))
+		}
+		return re.MatchString(s), nil
+	}
+	return false, fmt.Errorf("unknown operator %q", op)
+}
+
+// evalPath evaluates a path like $.content[0].text or len($.tools) against
+// a JSON value
+func evalPath(root interface{}, path string) (interface{}, bool, error) {
+	if strings.HasPrefix(path, "len(") && strings.HasSuffix(path, ")") {
+		v, found, err := evalPath(root, path[4:len(path)-1])
+		if err != nil || !found {
+			return nil, found, err
+		}
+		switch t := v.(type) {
+		case []interface{}:
+			return float64(len(t)), true, nil
+		case map[string]interface{}:
+			return float64(len(t)), true, nil
+		case string:
+			return float64(len(t)), true, nil
+		}
+		return nil, false, fmt.Errorf("len needs an array, an object or a string, got %s", show(v))
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, false, fmt.Errorf("path %q must start with $", path)
+	}
+	cur := root
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			rest = rest[end+1:]
+			if key == "" {
+				return nil, false, fmt.Errorf("empty key in path %q", path)
+			}
+			obj, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, false, nil
+			}
+			if cur, ok = obj[key]; !ok {
+				return nil, false, nil
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, false, fmt.Errorf("unterminated [ in path %q", path)
+			}
+			index := rest[1:end]
+			rest = rest[end+1:]
+			if key, err := strconv.Unquote(index); err == nil {
+				obj, ok := cur.(map[string]interface{})
+				if !ok {
+					return nil, false, nil
+				}
+				if cur, ok = obj[key]; !ok {
+					return nil, false, nil
+				}
+				continue
+			}
+			n, err := strconv.Atoi(index)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid index %q in path %q", index, path)
+			}
+			arr, ok := cur.([]interface{})
+			if !ok {
+				return nil, false, nil
+			}
+			if n < 0 {
+				n += len(arr)
+			}
+			if n < 0 || n >= len(arr) {
+				return nil, false, nil
+			}
+			cur = arr[n]
+		default:
+			return nil, false, fmt.Errorf("invalid path %q", path)
+		}
+	}
+	return cur, true, nil
+}
+
+// expectError checks "[code] [\"text\"]" against the failure of the last call
+func (sc *scenario) expectError(text string) error {
+	if err := sc.needCall(); err != nil {
+		return err
+	}
+	if sc.failed == "" {
+		return fmt.Errorf("expected an error, got %s", truncate(string(sc.resp.Result), 200))
+	}
+	sc.expected = true
+	for text != "" {
+		var word string
+		if strings.HasPrefix(text, "\"") {
+			end := strings.LastIndexByte(text, '"')
+			if end == 0 {
+				return fmt.Errorf("unterminated string")
+			}
+			word, text = text[:end+1], strings.TrimSpace(text[end+1:])
+			want, err := strconv.Unquote(word)
+			if err != nil {
+				return fmt.Errorf("invalid string %s", word)
+			}
+			if !strings.Contains(sc.failed, want) {
+				return fmt.Errorf("expected an error containing %q, got %s", want, sc.failed)
+			}
+			continue
+		}
+		word, text, _ = strings.Cut(text, " ")
+		text = strings.TrimSpace(text)
+		code, err := strconv.Atoi(word)
+		if err != nil {
+			return fmt.Errorf("invalid error code %q", word)
+		}
+		if sc.resp.Error == nil {
+			return fmt.Errorf("expected error %d, got %s", code, sc.failed)
+		}
+		if sc.resp.Error.Code != code {
+			return fmt.Errorf("expected error %d, got %d (%s)", code, sc.resp.Error.Code, sc.resp.Error.Message)
+		}
+	}
+	return nil
+}
+
+// expectNotification waits for a notification sent since the last call
+func (sc *scenario) expectNotification(method string) error {
+	if sc.current == nil {
+		return fmt.Errorf("no call to check")
+	}
+	if method == "" {
+		return fmt.Errorf("missing notification method")
+	}
+	deadline := time.After(sc.timeout)
+	for {
+		sc.notified = append(sc.notified, sc.s.takeNotifications()...)
+		for i, n := range sc.notified {
+			if n.Method == method {
+				sc.notified = append(sc.notified[:i], sc.notified[i+1:]...)
+				return nil
+			}
+		}
+		msg, err := sc.s.next(deadline)
+		if err == errTimeout {
+			return fmt.Errorf("no %s notification received", method)
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "" {
+			sc.s.unexpected = append(sc.s.unexpected, *msg)
+		}
+	}
+}
+
+// snapshot compares the result of the last call with a stored snapshot
+func (sc *scenario) snapshot(name string) error {
+	if err := sc.needCall(); err != nil {
+		return err
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid snapshot name %q", name)
+	}
+	var got interface{} = sc.result
+	if sc.resp.Error != nil {
+		got = map[string]interface{}{"error": map[string]interface{}{"code": float64(sc.resp.Error.Code), "message": sc.resp.Error.Message}}
+	}
+	dir := strings.TrimSuffix(sc.path, filepath.Ext(sc.path)) + ".snapshots"
+	file := filepath.Join(dir, name+".json")
+	if sc.update {
+		data, err := json.MarshalIndent(got, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(file, append(data, '\n'), 0644)
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("snapshot %s does not exist, run with -update to create it", file)
+	}
+	if err != nil {
+		return err
+	}
+	var want interface{}
+	if err := json.Unmarshal(data, &want); err != nil {
+		return fmt.Errorf("invalid snapshot %s: %v", file, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("result differs from snapshot %s:\n%s", file, show(got))
+	}
+	return nil
+}
+
+// contentText joins the text content of a tool result
+func contentText(result map[string]interface{}) string {
+	var parts []string
+	content, _ := result["content"].([]interface{})
+	for _, c := range content {
+		if item, ok := c.(map[string]interface{}); ok {
+			if text, ok := item["text"].(string); ok {
+				parts = append(parts, text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func show(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return truncate(string(data), 300)
+}
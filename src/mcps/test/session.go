@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"mcplib"
+)
+
+const latestProtocolVersion = mcplib.LatestProtocolVersion
+
+// supportedProtocolVersions are the versions a server may negotiate
+var supportedProtocolVersions = mcplib.SupportedProtocolVersions
+
+// session is a client connection to the server under test
+type session struct {
+	t       transport
+	kind    string // stdio, http or sse
+	timeout time.Duration
+	verbose bool
+	nextID  int
+
+	// notifications holds the notifications received since they were last
+	// taken and unexpected the responses that matched no request
+	notifications []message
+	unexpected    []message
+	// capabilities are the ones the server declared on initialize
+	capabilities map[string]interface{}
+	closed       bool
+}
+
+func newSession(target []string, timeout time.Duration, verbose bool) (*session, error) {
+	t, err := dial(target)
+	if err != nil {
+		return nil, err
+	}
+	kind := "stdio"
+	switch t.(type) {
+	case *httpTransport:
+		kind = "http"
+	case *sseTransport:
+		kind = "sse"
+	}
+	return &session{t: t, kind: kind, timeout: timeout, verbose: verbose, nextID: 1}, nil
+}
+
+func (s *session) close() {
+	_ = s.t.close()
+}
+
+func (s *session) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.sendRaw(data)
+}
+
+func (s *session) sendRaw(data []byte) error {
+	if s.verbose {
+		fmt.Fprintf(os.Stderr, "--> %s\n", data)
+	}
+	return s.t.send(data)
+}
+
+// notify sends a notification
+func (s *session) notify(method string, params interface{}) error {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		msg["params"] = params
+	}
+	return s.write(msg)
+}
+
+// start sends a request and returns its id without waiting for the answer
+func (s *session) start(method string, params interface{}) (int, error) {
+	id := s.nextID
+	s.nextID++
+	msg := map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method}
+	if params != nil {
+		msg["params"] = params
+	}
+	return id, s.write(msg)
+}
+
+// request sends a request and waits for its response
+func (s *session) request(method string, params interface{}) (*message, error) {
+	id, err := s.start(method, params)
+	if err != nil {
+		return nil, err
+	}
+	return s.wait(id, s.timeout)
+}
+
+// wait reads messages until the response with the given id arrives
+func (s *session) wait(id interface{}, timeout time.Duration) (*message, error) {
+	want, _ := json.Marshal(id)
+	deadline := time.After(timeout)
+	for {
+		msg, err := s.next(deadline)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Method != "" {
+			continue
+		}
+		got, _ := json.Marshal(msg.ID)
+		if string(got) == string(want) {
+			return msg, nil
+		}
+		s.unexpected = append(s.unexpected, *msg)
+	}
+}
+
+// drain reads the messages arriving during d
+func (s *session) drain(d time.Duration) error {
+	deadline := time.After(d)
+	for {
+		msg, err := s.next(deadline)
+		if err == errTimeout {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "" {
+			s.unexpected = append(s.unexpected, *msg)
+		}
+	}
+}
+
+var (
+	errTimeout = errors.New("timeout waiting for the server")
+	errClosed  = errors.New("connection closed by the server")
+)
+
+// next returns the next message, recording notifications and answering the
+// requests made by the server
+func (s *session) next(deadline <-chan time.Time) (*message, error) {
+	if s.closed {
+		return nil, errClosed
+	}
+	select {
+	case data, ok := <-s.t.messages():
+		if !ok {
+			s.closed = true
+			return nil, errClosed
+		}
+		if s.verbose {
+			fmt.Fprintf(os.Stderr, "<-- %s\n", data)
+		}
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, fmt.Errorf("invalid JSON-RPC message %q: %v", truncate(string(data), 200), err)
+		}
+		switch {
+		case msg.isNotification():
+			s.notifications = append(s.notifications, msg)
+		case msg.Method != "":
+			s.answer(msg)
+		}
+		return &msg, nil
+	case <-deadline:
+		return nil, errTimeout
+	}
+}
+
+// answer replies to a request sent by the server. Only ping is supported.
+func (s *session) answer(req message) {
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	if req.Method == "ping" {
+		resp["result"] = map[string]interface{}{}
+	} else {
+		resp["error"] = map[string]interface{}{"code": -32601, "message": "Method not found: " + req.Method}
+	}
+	_ = s.write(resp)
+}
+
+// initialize performs the initialization handshake
+func (s *session) initialize(version string) (map[string]interface{}, error) {
+	resp, err := s.request("initialize", map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]interface{}{"name": "mai-mcp-test", "version": "1.0"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return nil, fmt.Errorf("invalid initialize result: %v", err)
+	}
+	s.capabilities, _ = result["capabilities"].(map[string]interface{})
+	if err := s.notify("notifications/initialized", nil); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// takeNotifications returns and forgets the received notifications
+func (s *session) takeNotifications() []message {
+	n := s.notifications
+	s.notifications = nil
+	return n
+}
+
+// takeUnexpected returns and forgets the responses matching no request
+func (s *session) takeUnexpected() []message {
+	u := s.unexpected
+	s.unexpected = nil
+	return u
+}
+
+// hasCapability reports whether the server declared the capability
+func (s *session) hasCapability(name string) bool {
+	_, ok := s.capabilities[name]
+	return ok
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
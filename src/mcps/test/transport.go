@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// message is any JSON-RPC message read from the server
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      interface{}     `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// isNotification reports whether the message is a notification sent by
+// the server
+func (m *message) isNotification() bool {
+	return m.Method != "" && m.ID == nil
+}
+
+// transport exchanges raw JSON-RPC messages with a server
+type transport interface {
+	// send delivers a message to the server
+	send(data []byte) error
+	// messages returns the channel of the messages sent by the server. It
+	// is closed when the connection ends.
+	messages() <-chan []byte
+	close() error
+}
+
+// dial connects to the server named by target: an http:// or https:// URL
+// speaks Streamable HTTP, an sse:// URL is the event stream of the legacy
+// SSE transport, anything else is a command started with stdio.
+func dial(target []string) (transport, error) {
+	if len(target) == 0 {
+		return nil, fmt.Errorf("no server given")
+	}
+	first := target[0]
+	switch {
+	case strings.HasPrefix(first, "http://"), strings.HasPrefix(first, "https://"):
+		return newHTTPTransport(first), nil
+	case strings.HasPrefix(first, "sse://"):
+		return newSSETransport("http://" + strings.TrimPrefix(first, "sse://"))
+	}
+	if len(target) == 1 && strings.ContainsAny(first, " \t") {
+		target = strings.Fields(first)
+	}
+	return newStdioTransport(target[0], target[1:])
+}
+
+// stdioTransport talks newline-delimited JSON with a child process
+type stdioTransport struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	out   chan []byte
+}
+
+func newStdioTransport(name string, args []string) (*stdioTransport, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %v", name, err)
+	}
+	t := &stdioTransport{cmd: cmd, stdin: stdin, out: make(chan []byte, 64)}
+	go func() {
+		defer close(t.out)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			t.out <- append([]byte(nil), line...)
+		}
+	}()
+	return t, nil
+}
+
+func (t *stdioTransport) send(data []byte) error {
+	_, err := t.stdin.Write(append(append([]byte(nil), data...), '\n'))
+	return err
+}
+
+func (t *stdioTransport) messages() <-chan []byte { return t.out }
+
+func (t *stdioTransport) close() error {
+	_ = t.stdin.Close()
+	done := make(chan error, 1)
+	go func() { done <- t.cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		_ = t.cmd.Process.Kill()
+		<-done
+	}
+	return nil
+}
+
+// httpTransport speaks Streamable HTTP: every message is POSTed and the
+// answers come in the response body, as JSON or as an event stream
+type httpTransport struct {
+	url       string
+	client    *http.Client
+	out       chan []byte
+	mu        sync.Mutex
+	sessionID string
+	pending   sync.WaitGroup
+}
+
+func newHTTPTransport(url string) *httpTransport {
+	return &httpTransport{url: url, client: &http.Client{}, out: make(chan []byte, 64)}
+}
+
+func (t *httpTransport) send(data []byte) error {
+	req, err := http.NewRequest("POST", t.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	t.mu.Unlock()
+	// Requests may block until the server answers, so they are read in the
+	// background and the answers delivered in order of arrival
+	t.pending.Add(1)
+	go func() {
+		defer t.pending.Done()
+		resp, err := t.client.Do(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "HTTP request failed: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+		if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+			t.mu.Lock()
+			t.sessionID = id
+			t.mu.Unlock()
+		}
+		if strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+			readEvents(resp.Body, func(event, data string) {
+				if event == "" || event == "message" {
+					t.out <- []byte(data)
+				}
+			})
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		body = bytes.TrimSpace(body)
+		if len(body) > 0 && (body[0] == '{' || body[0] == '[') {
+			t.out <- body
+		} else if resp.StatusCode >= 400 {
+			fmt.Fprintf(os.Stderr, "HTTP status %d: %s\n", resp.StatusCode, body)
+		}
+	}()
+	return nil
+}
+
+func (t *httpTransport) messages() <-chan []byte { return t.out }
+
+func (t *httpTransport) close() error {
+	t.pending.Wait()
+	return nil
+}
+
+// sseTransport speaks the legacy SSE transport: answers arrive on an event
+// stream opened first, which names the endpoint the messages are POSTed to
+type sseTransport struct {
+	endpoint  string
+	sessionID string
+	client    *http.Client
+	body      io.Closer
+	out       chan []byte
+}
+
+func newSSETransport(streamURL string) (*sseTransport, error) {
+	sessionID := fmt.Sprintf("mai-mcp-test-%d", time.Now().UnixNano())
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return nil, err
+	}
+	// mcplib servers expect the client to name the session
+	q := u.Query()
+	q.Set("sessionId", sessionID)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to open event stream: HTTP status %d", resp.StatusCode)
+	}
+	t := &sseTransport{sessionID: sessionID, client: &http.Client{}, body: resp.Body, out: make(chan []byte, 64)}
+	endpoint := make(chan string, 1)
+	go func() {
+		defer close(t.out)
+		readEvents(resp.Body, func(event, data string) {
+			switch event {
+			case "endpoint":
+				select {
+				case endpoint <- data:
+				default:
+				}
+			case "", "message":
+				t.out <- []byte(data)
+			}
+		})
+	}()
+	select {
+	case ep := <-endpoint:
+		ref, err := url.Parse(ep)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint %q: %v", ep, err)
+		}
+		t.endpoint = u.ResolveReference(ref).String()
+	case <-time.After(10 * time.Second):
+		resp.Body.Close()
+		return nil, fmt.Errorf("no endpoint event received")
+	}
+	return t, nil
+}
+
+func (t *sseTransport) send(data []byte) error {
+	req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-SSE-Session-ID", t.sessionID)
+	// mcplib answers the POST once the request is handled
+	go func() {
+		resp, err := t.client.Do(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "HTTP request failed: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode >= 400 {
+			fmt.Fprintf(os.Stderr, "HTTP status %d: %s\n", resp.StatusCode, bytes.TrimSpace(body))
+		}
+	}()
+	return nil
+}
+
+func (t *sseTransport) messages() <-chan []byte { return t.out }
+
+func (t *sseTransport) close() error {
+	return t.body.Close()
+}
+
+// readEvents calls fn with every event of a text/event-stream body
+func readEvents(r io.Reader, fn func(event, data string)) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	event := ""
+	var data []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				fn(event, strings.Join(data, "\n"))
+			}
+			event = ""
+			data = nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if len(data) > 0 {
+		fn(event, strings.Join(data, "\n"))
+	}
+}
@@ -102,13 +102,19 @@ func NewConfigOptions() *ConfigOptions {
 	co.RegisterOption("http.wwwroot", StringOption, "Directory to serve static web files from", "")
 	co.RegisterOption("http.debug", BooleanOption, "Log incoming HTTP requests", "false")
 
+	// Background job options
+	co.RegisterOption("jobs.merge", BooleanOption, "Append background job results to the conversation when they finish", "false")
+
 	// LLM interaction options
 	// co.RegisterOption("llm.agentfile", StringOption, "Filename to load agent instructions from current or parent directories (empty to disable)", "AGENTS.md")
 	co.RegisterOption("llm.agentfile", StringOption, "Filename to load agent instructions from current or parent directories (empty to disable)", "")
-	co.RegisterOption("llm.maxtokens", NumberOption, "Maximum tokens for AI response", "5128")
+	co.RegisterOption("llm.cache", BooleanOption, "Add prompt caching breakpoints (system prompt, memory, tools, history) for Claude and Bedrock", "true")
+	co.RegisterOption("llm.maxtokens", NumberOption, "Maximum tokens for AI response (default: model limit capped to 5128)", "5128")
 	co.RegisterOption("llm.rawmode", BooleanOption, "Send messages in raw", "false")
 	co.RegisterOption("llm.schema", StringOption, "Inline JSON schema to constrain model output", "")
 	co.RegisterOption("llm.schemafile", StringOption, "Path to JSON schema file for formatted output", "")
+	co.RegisterOption("llm.schemacheck", BooleanOption, "Validate replies against llm.schema/llm.schemafile", "true")
+	co.RegisterOption("llm.schemaretries", NumberOption, "Re-prompt the model with validation errors up to N times when the reply does not match the schema", "2")
 	co.RegisterOption("llm.stream", BooleanOption, "Enable streaming mode", "true")
 	co.RegisterOption("llm.systemprompt", StringOption, "System prompt text (overrides systempromptfile)", "")
 	co.RegisterOption("llm.systempromptfile", StringOption, "Path to system prompt file (default: ~/.config/mai/systemprompt.md)", "")
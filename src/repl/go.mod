@@ -10,7 +10,10 @@ require (
 	mai/src/wmcp/lib v0.0.0
 )
 
-require github.com/clipperhouse/uax29/v2 v2.2.0 // indirect
+require (
+	github.com/clipperhouse/uax29/v2 v2.2.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
 
 replace mai/src/mcps/lib => ../mcps/lib
 
@@ -0,0 +1,431 @@
+package main
+
+// Background prompt jobs.
+//
+// A prompt suffixed with '&' runs on its own LLMClient in a goroutine
+// against a snapshot of the conversation, similar to shell job control.
+// The reply is streamed into the job buffer instead of the terminal. Jobs
+// are listed with /jobs, attached with /fg, cancelled with /kill and their
+// result can be merged into the conversation when they finish.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trufae/mai/src/repl/llm"
+)
+
+type promptJob struct {
+	ID     int
+	Prompt string // prompt as typed by the user
+	input  string // prompt after substitutions, as sent to the model
+
+	mu      sync.Mutex
+	status  string          // running, done, error, cancelled
+	output  strings.Builder // streamed output, as it would be printed
+	reply   string          // final reply, merged into the conversation
+	note    string
+	started time.Time
+	ended   time.Time
+	merged  bool // result already appended to the conversation
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (j *promptJob) appendOutput(text string) {
+	j.mu.Lock()
+	j.output.WriteString(text)
+	j.mu.Unlock()
+}
+
+func (j *promptJob) finish(status, reply, note string) {
+	j.mu.Lock()
+	j.status = status
+	j.reply = reply
+	if j.output.Len() == 0 {
+		// Nothing was streamed, the provider only returned the reply
+		j.output.WriteString(reply)
+	}
+	j.note = note
+	j.ended = time.Now()
+	j.mu.Unlock()
+}
+
+func (j *promptJob) state() (status, output, note string, duration time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	duration = time.Since(j.started)
+	if !j.ended.IsZero() {
+		duration = j.ended.Sub(j.started)
+	}
+	return j.status, j.output.String(), j.note, duration
+}
+
+var (
+	promptJobsMu   sync.Mutex
+	promptJobsList []*promptJob
+	promptJobSeq   int
+)
+
+func newPromptJob(prompt, input string, cancel context.CancelFunc) *promptJob {
+	promptJobsMu.Lock()
+	defer promptJobsMu.Unlock()
+	promptJobSeq++
+	job := &promptJob{
+		ID:      promptJobSeq,
+		Prompt:  prompt,
+		input:   input,
+		status:  "running",
+		started: time.Now(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	promptJobsList = append(promptJobsList, job)
+	return job
+}
+
+func findPromptJob(arg string) (*promptJob, string) {
+	id, err := strconv.Atoi(strings.TrimPrefix(arg, "%"))
+	if err != nil {
+		return nil, fmt.Sprintf("Invalid job id: %s\r\n", arg)
+	}
+	promptJobsMu.Lock()
+	defer promptJobsMu.Unlock()
+	for _, job := range promptJobsList {
+		if job.ID == id {
+			return job, ""
+		}
+	}
+	return nil, fmt.Sprintf("No such job: %d\r\n", id)
+}
+
+// lastPromptJob returns the most recently started job, used when /fg is
+// called without arguments
+func lastPromptJob() *promptJob {
+	promptJobsMu.Lock()
+	defer promptJobsMu.Unlock()
+	if len(promptJobsList) == 0 {
+		return nil
+	}
+	return promptJobsList[len(promptJobsList)-1]
+}
+
+// splitBackgroundSuffix reports whether the input ends with a lone '&'
+// and returns the prompt without it
+func splitBackgroundSuffix(input string) (string, bool) {
+	if !strings.HasSuffix(input, "&") || strings.HasSuffix(input, "&&") {
+		return input, false
+	}
+	prompt := strings.TrimSpace(strings.TrimSuffix(input, "&"))
+	if prompt == "" {
+		return input, false
+	}
+	return prompt, true
+}
+
+// buildJobMessages assembles the request for a background job from the
+// current system context and a snapshot of the conversation history
+func (r *REPL) buildJobMessages(input string) []llm.Message {
+	messages := []llm.Message{}
+	if sp := r.currentSystemPrompt(); sp != "" {
+		messages = append(messages, llm.Message{Role: "system", Content: sp})
+	}
+	messages = r.appendMemoryContext(messages)
+	if userDetails := r.buildUserDetails(); userDetails != "" {
+		messages = append(messages, llm.Message{Role: "system", Content: "USER CONTEXT:\n" + userDetails})
+	}
+
+	r.requestMu.Lock()
+	if r.configOptions.GetBool("chat.log") {
+		messages = append(messages, r.messagesForPrompt()...)
+	}
+	r.requestMu.Unlock()
+
+	return append(messages, llm.Message{Role: "user", Content: input})
+}
+
+// startPromptJob runs a prompt in the background and returns immediately
+func (r *REPL) startPromptJob(input string) error {
+	processed, err := r.substituteInput(input)
+	if err != nil {
+		return err
+	}
+	messages := r.buildJobMessages(processed)
+
+	// The markdown renderer, the demo animation and the TPS statistics
+	// write to the terminal, so jobs go without them
+	config := r.buildLLMConfig()
+	config.Markdown = false
+	config.DemoMode = false
+	config.ShowTPS = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := llm.NewLLMClient(config, ctx)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to create LLM client: %v", err)
+	}
+	job := newPromptJob(input, processed, cancel)
+	client.SetOutputCallback(job.appendOutput)
+
+	go r.runPromptJob(ctx, job, client, messages)
+	fmt.Printf("[%d] started in the background (see /jobs)\r\n", job.ID)
+	return nil
+}
+
+func (r *REPL) runPromptJob(ctx context.Context, job *promptJob, client *llm.LLMClient, messages []llm.Message) {
+	defer close(job.done)
+	defer job.cancel()
+
+	// The request is bound to the job context so /kill aborts it
+	response, err := client.SendMessageContext(ctx, messages, true, nil, nil)
+	switch {
+	case ctx.Err() == context.Canceled:
+		job.finish("cancelled", "", "")
+	case err != nil:
+		job.finish("error", "", err.Error())
+	default:
+		job.finish("done", response, "")
+	}
+
+	status, _, note, duration := job.state()
+	msg := fmt.Sprintf("[%d] %s in %s  %s", job.ID, status, duration.Truncate(100*time.Millisecond), truncateJobPrompt(job.Prompt))
+	if note != "" {
+		msg += " (" + note + ")"
+	}
+	if status == "done" && r.configOptions.GetBool("jobs.merge") {
+		if mergeErr := r.mergePromptJob(job); mergeErr != nil {
+			msg += " - not merged: " + mergeErr.Error()
+		} else {
+			msg += " - merged into the conversation"
+		}
+	}
+	r.notify(msg)
+}
+
+// notify shows an asynchronous message without corrupting the input line
+func (r *REPL) notify(msg string) {
+	if r.readline != nil {
+		r.readline.Notify(msg)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r\n%s\r\n", msg)
+}
+
+// mergePromptJob appends the job prompt and its reply to the conversation
+func (r *REPL) mergePromptJob(job *promptJob) error {
+	status, _, _, _ := job.state()
+	if status != "done" {
+		return fmt.Errorf("job %d is %s", job.ID, status)
+	}
+	job.mu.Lock()
+	if job.merged {
+		job.mu.Unlock()
+		return fmt.Errorf("job %d was already merged", job.ID)
+	}
+	job.merged = true
+	reply := job.reply
+	job.mu.Unlock()
+
+	r.requestMu.Lock()
+	defer r.requestMu.Unlock()
+	r.messages = append(r.messages,
+		llm.Message{Role: "user", Content: job.input},
+		r.assistantMessageForLog(reply))
+	return nil
+}
+
+func truncateJobPrompt(prompt string) string {
+	if len(prompt) > 40 {
+		return prompt[:40] + "..."
+	}
+	return prompt
+}
+
+func registerJobCommands(r *REPL) {
+	r.commands["/jobs"] = Command{
+		Name:        "/jobs",
+		Description: "List background prompt jobs (run a prompt in the background by ending it with '&')",
+		Handler: func(r *REPL, args []string) (string, error) {
+			return r.handleJobsCommand(args)
+		},
+	}
+	r.commands["/fg"] = Command{
+		Name:        "/fg",
+		Description: "Attach to a background job and show its output",
+		Handler: func(r *REPL, args []string) (string, error) {
+			return r.foregroundJob(args[1:])
+		},
+	}
+	r.commands["/kill"] = Command{
+		Name:        "/kill",
+		Description: "Cancel a running background job",
+		Handler: func(r *REPL, args []string) (string, error) {
+			return killPromptJob(args[1:])
+		},
+	}
+}
+
+func jobsUsage() string {
+	var output strings.Builder
+	output.WriteString("Background job commands:\r\n")
+	output.WriteString("  <prompt> &         - Run a prompt in the background\r\n")
+	output.WriteString("  /jobs              - List jobs and their status\r\n")
+	output.WriteString("  /jobs merge <id>   - Append a finished job's prompt and reply to the conversation\r\n")
+	output.WriteString("  /jobs clear        - Forget finished jobs\r\n")
+	output.WriteString("  /fg [id]           - Attach to a job and print its output (Ctrl-C detaches)\r\n")
+	output.WriteString("  /kill <id|all>     - Cancel running job(s)\r\n")
+	output.WriteString("Config: jobs.merge (merge results automatically when jobs finish)\r\n")
+	return output.String()
+}
+
+func (r *REPL) handleJobsCommand(args []string) (string, error) {
+	if len(args) < 2 {
+		return promptJobsTable(), nil
+	}
+	switch args[1] {
+	case "help", "-h":
+		return jobsUsage(), nil
+	case "list", "ls":
+		return promptJobsTable(), nil
+	case "merge":
+		if len(args) < 3 {
+			return "Usage: /jobs merge <id>\r\n", nil
+		}
+		job, msg := findPromptJob(args[2])
+		if job == nil {
+			return msg, nil
+		}
+		if err := r.mergePromptJob(job); err != nil {
+			return fmt.Sprintf("%v\r\n", err), nil
+		}
+		return fmt.Sprintf("Job %d merged into the conversation\r\n", job.ID), nil
+	case "clear":
+		promptJobsMu.Lock()
+		kept := promptJobsList[:0]
+		for _, job := range promptJobsList {
+			if status, _, _, _ := job.state(); status == "running" {
+				kept = append(kept, job)
+			}
+		}
+		removed := len(promptJobsList) - len(kept)
+		promptJobsList = kept
+		promptJobsMu.Unlock()
+		return fmt.Sprintf("Removed %d finished job(s)\r\n", removed), nil
+	default:
+		return fmt.Sprintf("Unknown jobs action: %s\r\n%s", args[1], jobsUsage()), nil
+	}
+}
+
+func promptJobsTable() string {
+	promptJobsMu.Lock()
+	jobs := append([]*promptJob(nil), promptJobsList...)
+	promptJobsMu.Unlock()
+	if len(jobs) == 0 {
+		return "No background jobs. End a prompt with '&' to start one\r\n"
+	}
+	var output strings.Builder
+	output.WriteString("Jobs:\r\n")
+	for _, job := range jobs {
+		status, _, _, duration := job.state()
+		job.mu.Lock()
+		if job.merged {
+			status += "*"
+		}
+		job.mu.Unlock()
+		fmt.Fprintf(&output, "  [%d]  %-10s %8s  %s\r\n", job.ID, status, duration.Truncate(100*time.Millisecond), truncateJobPrompt(job.Prompt))
+	}
+	return output.String()
+}
+
+// foregroundJob streams the output of a job to the terminal until it
+// finishes or the user presses Ctrl-C, which detaches without cancelling
+func (r *REPL) foregroundJob(args []string) (string, error) {
+	var job *promptJob
+	if len(args) > 0 {
+		var msg string
+		if job, msg = findPromptJob(args[0]); job == nil {
+			return msg, nil
+		}
+	} else if job = lastPromptJob(); job == nil {
+		return "No background jobs\r\n", nil
+	}
+
+	r.mu.Lock()
+	r.isStreaming = true
+	ctx := r.ctx
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.isStreaming = false
+		r.mu.Unlock()
+	}()
+
+	fmt.Printf("[%d] %s\r\n", job.ID, truncateJobPrompt(job.Prompt))
+	shown := ""
+	flush := func() {
+		// The buffer only grows, so only the new text is printed
+		_, output, _, _ := job.state()
+		if len(output) > len(shown) {
+			fmt.Print(strings.ReplaceAll(output[len(shown):], "\n", "\r\n"))
+			shown = output
+		}
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-job.done:
+			status, output, note, _ := job.state()
+			flush()
+			if output != "" && !strings.HasSuffix(output, "\n") {
+				fmt.Print("\r\n")
+			}
+			switch status {
+			case "error":
+				return fmt.Sprintf("[%d] error: %s\r\n", job.ID, note), nil
+			case "cancelled":
+				return fmt.Sprintf("[%d] cancelled\r\n", job.ID), nil
+			}
+			return "", nil
+		case <-ctx.Done():
+			return fmt.Sprintf("\r\n[%d] detached, still running in the background\r\n", job.ID), nil
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func killPromptJob(args []string) (string, error) {
+	if len(args) == 0 {
+		return "Usage: /kill <id|all>\r\n", nil
+	}
+	if args[0] == "all" {
+		promptJobsMu.Lock()
+		jobs := append([]*promptJob(nil), promptJobsList...)
+		promptJobsMu.Unlock()
+		count := 0
+		for _, job := range jobs {
+			if status, _, _, _ := job.state(); status == "running" {
+				job.cancel()
+				count++
+			}
+		}
+		return fmt.Sprintf("Cancelling %d job(s)\r\n", count), nil
+	}
+	job, msg := findPromptJob(args[0])
+	if job == nil {
+		return msg, nil
+	}
+	if status, _, _, _ := job.state(); status != "running" {
+		return fmt.Sprintf("Job %d is not running\r\n", job.ID), nil
+	}
+	job.cancel()
+	return fmt.Sprintf("Cancelling job %d\r\n", job.ID), nil
+}
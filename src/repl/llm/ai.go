@@ -77,6 +77,8 @@ type Config struct {
 	MarkdownColors   bool
 	Rawdog           bool
 	ReasoningEffort  string // "", none, minimal, low, medium, high, xhigh
+	NoPromptCache    bool   // disable prompt caching breakpoints (llm.cache=false)
+	MaxTokens        int    // max output tokens (llm.maxtokens); 0 picks the model default
 
 	// DemoMode enables the simple waiting animation in the REPL when set.
 	DemoMode bool
@@ -1,11 +1,13 @@
 package llm
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 )
 
 // BedrockProvider implements the LLM provider interface for AWS Bedrock
@@ -85,12 +87,27 @@ func (p *BedrockProvider) SendMessage(messages []Message, stream bool, images []
 		model = p.DefaultModel()
 	}
 
-	// Build conversation string from messages
-	inputText := BuildConversationString(messages, false, true, "plain", false)
-
-	// Prepare the request body
-	body := map[string]string{
-		"inputText": inputText,
+	claude := isBedrockClaudeModel(model)
+	var body interface{}
+	if claude {
+		// Claude models take the Anthropic messages body, which also
+		// supports prompt caching breakpoints
+		parts := buildAnthropicMessages(messages, !p.config.NoPromptCache, 0)
+		request := map[string]interface{}{
+			"anthropic_version": "bedrock-2023-05-31",
+			"max_tokens":        EffectiveMaxTokens(p.config, model),
+			"messages":          parts.Messages,
+		}
+		if len(parts.System) > 0 {
+			request["system"] = parts.System
+		}
+		body = request
+	} else {
+		// Build conversation string from messages
+		inputText := BuildConversationString(messages, false, true, "plain", false)
+		body = map[string]string{
+			"inputText": inputText,
+		}
 	}
 
 	jsonData, err := json.Marshal(body)
@@ -109,8 +126,38 @@ func (p *BedrockProvider) SendMessage(messages []Message, stream bool, images []
 	if err != nil {
 		return "", fmt.Errorf("failed to invoke model: %v", err)
 	}
+	if !claude {
+		return string(output), nil
+	}
+
+	// The CLI writes the response body followed by its own metadata, so
+	// only decode the first JSON value
+	var response struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage anthropicUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(output)).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to parse Bedrock response: %v", err)
+	}
+	reportUsage(p.ctx, response.Usage.toUsage())
+	var text strings.Builder
+	for _, c := range response.Content {
+		if c.Type == "text" {
+			text.WriteString(c.Text)
+		}
+	}
+	accountResponseText(p.ctx, text.String())
+	return text.String(), nil
+}
 
-	return string(output), nil
+// isBedrockClaudeModel reports whether the model id (or inference profile)
+// refers to an Anthropic Claude model.
+func isBedrockClaudeModel(model string) bool {
+	model = strings.ToLower(model)
+	return strings.Contains(model, "anthropic.") || strings.Contains(model, "claude")
 }
 
 func (p *BedrockProvider) Embed(input string) ([]float64, error) {
@@ -0,0 +1,327 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ModelCapabilities describes what a model supports. Zero values mean the
+// feature is unsupported or the limit is unknown.
+type ModelCapabilities struct {
+	Vision        bool `json:"vision"`
+	Tools         bool `json:"tools"`
+	Reasoning     bool `json:"reasoning"`
+	JSONMode      bool `json:"json"`
+	ContextWindow int  `json:"context,omitempty"`
+	MaxOutput     int  `json:"max_output,omitempty"`
+}
+
+// modelCapabilityOverride is an entry of ~/.config/mai/models.json. Unset
+// fields keep the built-in value.
+type modelCapabilityOverride struct {
+	Vision        *bool `json:"vision,omitempty"`
+	Tools         *bool `json:"tools,omitempty"`
+	Reasoning     *bool `json:"reasoning,omitempty"`
+	JSONMode      *bool `json:"json,omitempty"`
+	ContextWindow *int  `json:"context,omitempty"`
+	MaxOutput     *int  `json:"max_output,omitempty"`
+}
+
+type modelCapabilityEntry struct {
+	pattern string
+	caps    ModelCapabilities
+}
+
+// builtinModelCapabilities is matched in order against the lowercase model
+// name, so more specific patterns must come first.
+var builtinModelCapabilities = []modelCapabilityEntry{
+	{"claude-opus-4*", ModelCapabilities{Vision: true, Tools: true, Reasoning: true, JSONMode: true, ContextWindow: 200000, MaxOutput: 32000}},
+	{"claude-sonnet-4*", ModelCapabilities{Vision: true, Tools: true, Reasoning: true, JSONMode: true, ContextWindow: 200000, MaxOutput: 64000}},
+	{"claude-haiku-4*", ModelCapabilities{Vision: true, Tools: true, Reasoning: true, JSONMode: true, ContextWindow: 200000, MaxOutput: 64000}},
+	{"claude-3-7*", ModelCapabilities{Vision: true, Tools: true, Reasoning: true, JSONMode: true, ContextWindow: 200000, MaxOutput: 64000}},
+	{"claude-3-5-haiku*", ModelCapabilities{Tools: true, JSONMode: true, ContextWindow: 200000, MaxOutput: 8192}},
+	{"claude-3-5*", ModelCapabilities{Vision: true, Tools: true, JSONMode: true, ContextWindow: 200000, MaxOutput: 8192}},
+	{"claude-*", ModelCapabilities{Vision: true, Tools: true, JSONMode: true, ContextWindow: 200000, MaxOutput: 4096}},
+	{"gpt-5*", ModelCapabilities{Vision: true, Tools: true, Reasoning: true, JSONMode: true, ContextWindow: 400000, MaxOutput: 128000}},
+	{"gpt-4.1*", ModelCapabilities{Vision: true, Tools: true, JSONMode: true, ContextWindow: 1047576, MaxOutput: 32768}},
+	{"gpt-4o*", ModelCapabilities{Vision: true, Tools: true, JSONMode: true, ContextWindow: 128000, MaxOutput: 16384}},
+	{"gpt-4*", ModelCapabilities{Tools: true, JSONMode: true, ContextWindow: 128000, MaxOutput: 4096}},
+	{"gpt-3.5*", ModelCapabilities{Tools: true, JSONMode: true, ContextWindow: 16385, MaxOutput: 4096}},
+	{"gpt-oss*", ModelCapabilities{Tools: true, Reasoning: true, JSONMode: true, ContextWindow: 131072, MaxOutput: 32768}},
+	{"o1-mini*", ModelCapabilities{Reasoning: true, ContextWindow: 128000, MaxOutput: 65536}},
+	{"o[134]*", ModelCapabilities{Vision: true, Tools: true, Reasoning: true, JSONMode: true, ContextWindow: 200000, MaxOutput: 100000}},
+	{"gemini-2.5*", ModelCapabilities{Vision: true, Tools: true, Reasoning: true, JSONMode: true, ContextWindow: 1048576, MaxOutput: 65536}},
+	{"gemini-3*", ModelCapabilities{Vision: true, Tools: true, Reasoning: true, JSONMode: true, ContextWindow: 1048576, MaxOutput: 65536}},
+	{"gemini-*", ModelCapabilities{Vision: true, Tools: true, JSONMode: true, ContextWindow: 1048576, MaxOutput: 8192}},
+	{"deepseek-reasoner*", ModelCapabilities{Reasoning: true, JSONMode: true, ContextWindow: 128000, MaxOutput: 32768}},
+	{"deepseek-r1*", ModelCapabilities{Reasoning: true, ContextWindow: 128000, MaxOutput: 32768}},
+	{"deepseek-*", ModelCapabilities{Tools: true, JSONMode: true, ContextWindow: 128000, MaxOutput: 8192}},
+	{"grok-4*", ModelCapabilities{Vision: true, Tools: true, Reasoning: true, JSONMode: true, ContextWindow: 256000}},
+	{"grok-*", ModelCapabilities{Tools: true, JSONMode: true, ContextWindow: 131072}},
+	{"pixtral*", ModelCapabilities{Vision: true, Tools: true, JSONMode: true, ContextWindow: 128000}},
+	{"magistral*", ModelCapabilities{Tools: true, Reasoning: true, JSONMode: true, ContextWindow: 40000}},
+	{"mistral-*", ModelCapabilities{Tools: true, JSONMode: true, ContextWindow: 128000}},
+	{"codestral*", ModelCapabilities{Tools: true, JSONMode: true, ContextWindow: 256000}},
+	{"gemma3:1b*", ModelCapabilities{JSONMode: true, ContextWindow: 32768}},
+	{"gemma3*", ModelCapabilities{Vision: true, JSONMode: true, ContextWindow: 128000}},
+	{"qwen3*", ModelCapabilities{Tools: true, Reasoning: true, JSONMode: true, ContextWindow: 40960}},
+	{"qwen2.5vl*", ModelCapabilities{Vision: true, JSONMode: true, ContextWindow: 128000}},
+	{"qwen2.5*", ModelCapabilities{Tools: true, JSONMode: true, ContextWindow: 32768}},
+	{"llama3.2-vision*", ModelCapabilities{Vision: true, JSONMode: true, ContextWindow: 128000}},
+	{"llama3*", ModelCapabilities{Tools: true, JSONMode: true, ContextWindow: 128000}},
+	{"llava*", ModelCapabilities{Vision: true, ContextWindow: 4096}},
+}
+
+var (
+	modelOverridesOnce sync.Once
+	modelOverrides     map[string]modelCapabilityOverride
+	modelOverridesErr  error
+
+	// Limits discovered from provider model listings, keyed by provider/model
+	modelMetadataMu sync.Mutex
+	modelMetadata   = map[string]Model{}
+)
+
+// ModelsFilePath returns the path of the user capability overrides file.
+func ModelsFilePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "mai", "models.json")
+}
+
+// loadModelOverrides reads ~/.config/mai/models.json once. The file maps
+// model name patterns (shell globs, optionally prefixed with "provider:")
+// to the capabilities that should be changed.
+func loadModelOverrides() (map[string]modelCapabilityOverride, error) {
+	modelOverridesOnce.Do(func() {
+		file := ModelsFilePath()
+		if file == "" {
+			return
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				modelOverridesErr = err
+			}
+			return
+		}
+		overrides := map[string]modelCapabilityOverride{}
+		if err := json.Unmarshal(data, &overrides); err != nil {
+			modelOverridesErr = fmt.Errorf("invalid %s: %v", file, err)
+			return
+		}
+		modelOverrides = make(map[string]modelCapabilityOverride, len(overrides))
+		for k, v := range overrides {
+			modelOverrides[strings.ToLower(k)] = v
+		}
+	})
+	return modelOverrides, modelOverridesErr
+}
+
+// ModelOverridesError returns the error found while loading models.json, if any.
+func ModelOverridesError() error {
+	_, err := loadModelOverrides()
+	return err
+}
+
+// modelNameCandidates returns the names a model id is matched as: the id
+// itself, the part after any "vendor/" prefix (OpenRouter) and the part
+// starting at "claude-" for Bedrock ids like "us.anthropic.claude-...".
+func modelNameCandidates(model string) []string {
+	model = strings.ToLower(strings.TrimSpace(model))
+	names := []string{model}
+	if i := strings.LastIndex(model, "/"); i >= 0 && i+1 < len(model) {
+		names = append(names, model[i+1:])
+	}
+	if i := strings.Index(model, "claude-"); i > 0 {
+		names = append(names, model[i:])
+	}
+	return names
+}
+
+func matchModelPattern(pattern string, names []string) bool {
+	for _, name := range names {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupModelCapabilities returns the capabilities of a model. The result
+// combines the built-in table, limits reported by the provider model list
+// and the user overrides. The boolean is false when nothing is known.
+func LookupModelCapabilities(provider, model string) (ModelCapabilities, bool) {
+	var caps ModelCapabilities
+	if model == "" {
+		return caps, false
+	}
+	names := modelNameCandidates(model)
+	found := false
+	for _, entry := range builtinModelCapabilities {
+		if matchModelPattern(entry.pattern, names) {
+			caps = entry.caps
+			found = true
+			break
+		}
+	}
+
+	modelMetadataMu.Lock()
+	meta, ok := modelMetadata[strings.ToLower(provider+"/"+model)]
+	modelMetadataMu.Unlock()
+	if ok {
+		if meta.ContextWindow > 0 {
+			caps.ContextWindow = meta.ContextWindow
+			found = true
+		}
+		if meta.MaxOutput > 0 {
+			caps.MaxOutput = meta.MaxOutput
+			found = true
+		}
+	}
+
+	overrides, _ := loadModelOverrides()
+	patterns := make([]string, 0, len(overrides))
+	for pattern := range overrides {
+		patterns = append(patterns, pattern)
+	}
+	// Apply generic patterns first so longer (more specific) ones win
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) < len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	if canon, ok := CanonicalProviderName(provider); ok {
+		provider = canon
+	}
+	for _, pattern := range patterns {
+		p := pattern
+		if prov, rest, ok := strings.Cut(pattern, ":"); ok {
+			if canon, known := CanonicalProviderName(prov); known {
+				if canon != provider {
+					continue
+				}
+				p = rest
+			}
+		}
+		if !matchModelPattern(p, names) {
+			continue
+		}
+		overrides[pattern].apply(&caps)
+		found = true
+	}
+	return caps, found
+}
+
+func (o modelCapabilityOverride) apply(caps *ModelCapabilities) {
+	if o.Vision != nil {
+		caps.Vision = *o.Vision
+	}
+	if o.Tools != nil {
+		caps.Tools = *o.Tools
+	}
+	if o.Reasoning != nil {
+		caps.Reasoning = *o.Reasoning
+	}
+	if o.JSONMode != nil {
+		caps.JSONMode = *o.JSONMode
+	}
+	if o.ContextWindow != nil {
+		caps.ContextWindow = *o.ContextWindow
+	}
+	if o.MaxOutput != nil {
+		caps.MaxOutput = *o.MaxOutput
+	}
+}
+
+// rememberModelMetadata records the limits exposed by a provider model
+// listing so later capability lookups can use them.
+func rememberModelMetadata(provider string, models []Model) {
+	modelMetadataMu.Lock()
+	defer modelMetadataMu.Unlock()
+	for _, m := range models {
+		if m.ContextWindow == 0 && m.MaxOutput == 0 {
+			continue
+		}
+		p := m.Provider
+		if p == "" {
+			p = provider
+		}
+		modelMetadata[strings.ToLower(p+"/"+m.ID)] = m
+	}
+}
+
+// Summary returns a compact description such as
+// "vision tools reasoning json ctx:200k out:64k".
+func (c ModelCapabilities) Summary() string {
+	var parts []string
+	if c.Vision {
+		parts = append(parts, "vision")
+	}
+	if c.Tools {
+		parts = append(parts, "tools")
+	}
+	if c.Reasoning {
+		parts = append(parts, "reasoning")
+	}
+	if c.JSONMode {
+		parts = append(parts, "json")
+	}
+	if c.ContextWindow > 0 {
+		parts = append(parts, "ctx:"+formatTokenCount(c.ContextWindow))
+	}
+	if c.MaxOutput > 0 {
+		parts = append(parts, "out:"+formatTokenCount(c.MaxOutput))
+	}
+	if len(parts) == 0 {
+		return "text"
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatTokenCount(n int) string {
+	switch {
+	case n >= 1000000 && n%1000000 < 100000:
+		return fmt.Sprintf("%dM", n/1000000)
+	case n >= 1000:
+		return fmt.Sprintf("%dk", n/1000)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+// EffectiveMaxTokens returns the max output tokens for a request: the
+// configured value, or the default capped to the model limit.
+func EffectiveMaxTokens(config *Config, model string) int {
+	const defaultMaxTokens = 5128
+	if config != nil && config.MaxTokens > 0 {
+		return config.MaxTokens
+	}
+	provider := ""
+	if config != nil {
+		provider = config.PROVIDER
+	}
+	if caps, ok := LookupModelCapabilities(provider, model); ok && caps.MaxOutput > 0 && caps.MaxOutput < defaultMaxTokens {
+		return caps.MaxOutput
+	}
+	return defaultMaxTokens
+}
+
+// SupportsNativeTools reports whether the provider implementation forwards
+// OpenAI-style tool definitions to the model.
+func SupportsNativeTools(provider string) bool {
+	provider, _ = CanonicalProviderName(provider)
+	switch provider {
+	case "openai", "lmstudio", "shimmy", "ollamacloud", "opencode", "openrouter", "xai", "deepseek", "mistral", "llamacpp":
+		return true
+	}
+	return false
+}
@@ -86,10 +86,12 @@ func (p *ClaudeProvider) ListModels(ctx context.Context) ([]Model, error) {
 		}
 
 		models = append(models, Model{
-			ID:          m.ID,
-			Name:        m.Name,
-			Description: description,
-			Provider:    "claude",
+			ID:            m.ID,
+			Name:          m.Name,
+			Description:   description,
+			Provider:      "claude",
+			ContextWindow: m.ContextWindow,
+			MaxOutput:     m.MaxTokens,
 		})
 	}
 
@@ -104,10 +106,21 @@ func (p *ClaudeProvider) SendMessage(messages []Message, stream bool, images []s
 	if effectiveModel == "" {
 		effectiveModel = p.DefaultModel()
 	}
+	cache := !p.config.NoPromptCache
+	reserved := 0
+	if cache && p.config.Schema != nil {
+		// The tool definition is the first cached prefix
+		reserved = 1
+	}
+	parts := buildAnthropicMessages(messages, cache, reserved)
+	maxTokens := EffectiveMaxTokens(p.config, effectiveModel)
 	request := map[string]interface{}{
 		"model":      effectiveModel,
-		"max_tokens": 5128,
-		"messages":   messages,
+		"max_tokens": maxTokens,
+		"messages":   parts.Messages,
+	}
+	if len(parts.System) > 0 {
+		request["system"] = parts.System
 	}
 	if reasoningEnabled(p.config.ReasoningEffort) {
 		if !claudeThinkingSupported(effectiveModel) {
@@ -115,7 +128,7 @@ func (p *ClaudeProvider) SendMessage(messages []Message, stream bool, images []s
 		}
 		request["thinking"] = map[string]interface{}{
 			"type":          "enabled",
-			"budget_tokens": reasoningBudgetTokens(p.config.ReasoningEffort, 5128),
+			"budget_tokens": reasoningBudgetTokens(p.config.ReasoningEffort, maxTokens),
 		}
 	}
 
@@ -123,13 +136,15 @@ func (p *ClaudeProvider) SendMessage(messages []Message, stream bool, images []s
 	if p.config.Schema != nil {
 		// Streaming tool_use events require different parsing; force non-stream for now
 		stream = false
-		request["tools"] = []map[string]interface{}{
-			{
-				"name":         "output_schema_tool",
-				"description":  "Return the response following the given JSON schema.",
-				"input_schema": p.config.Schema,
-			},
+		schemaTool := map[string]interface{}{
+			"name":         "output_schema_tool",
+			"description":  "Return the response following the given JSON schema.",
+			"input_schema": p.config.Schema,
+		}
+		if cache {
+			schemaTool["cache_control"] = ephemeralCacheControl()
 		}
+		request["tools"] = []map[string]interface{}{schemaTool}
 		request["tool_choice"] = map[string]interface{}{
 			"type": "tool",
 			"name": "output_schema_tool",
@@ -183,10 +198,12 @@ func (p *ClaudeProvider) SendMessage(messages []Message, stream bool, images []s
 				Name  string                 `json:"name,omitempty"`
 				Input map[string]interface{} `json:"input,omitempty"`
 			} `json:"content"`
+			Usage anthropicUsage `json:"usage"`
 		}
 		if err := json.Unmarshal(respBody, &response); err != nil {
 			return "", err
 		}
+		reportUsage(p.ctx, response.Usage.toUsage())
 		for _, c := range response.Content {
 			if c.Type == "tool_use" && c.Name == "output_schema_tool" {
 				// Return the input payload as JSON string
@@ -202,10 +219,12 @@ func (p *ClaudeProvider) SendMessage(messages []Message, stream bool, images []s
 		Content []struct {
 			Text string `json:"text"`
 		} `json:"content"`
+		Usage anthropicUsage `json:"usage"`
 	}
 	if err := json.Unmarshal(respBody, &response); err != nil {
 		return "", err
 	}
+	reportUsage(p.ctx, response.Usage.toUsage())
 	if len(response.Content) > 0 {
 		return response.Content[0].Text, nil
 	}
@@ -223,6 +242,7 @@ func (p *ClaudeProvider) parseStreamWithCallback(reader io.Reader, stopCallback
 func (p *ClaudeProvider) parseStreamWithTiming(reader io.Reader, stopCallback, firstTokenCallback, streamEndCallback func()) (string, error) {
 	var fullResponse strings.Builder
 	sd := NewStreamDemo(stopCallback, firstTokenCallback, streamEndCallback)
+	tf := thinkFilterFromContext(p.ctx)
 
 	// Check if markdown is enabled
 	markdownEnabled := false
@@ -233,6 +253,7 @@ func (p *ClaudeProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 		ResetStreamRenderer()
 	}
 	printed := false
+	var usage anthropicUsage
 	streamErr := streamEachLine(p.ctx, reader, func(line string) (bool, error) {
 		if !strings.HasPrefix(line, "data: ") {
 			return false, nil
@@ -248,12 +269,25 @@ func (p *ClaudeProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 			Delta struct {
 				Text string `json:"text"`
 			} `json:"delta"`
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			Usage *anthropicUsage `json:"usage"`
 		}
 
 		if err := json.Unmarshal([]byte(data), &response); err != nil {
 			return false, nil
 		}
 
+		switch response.Type {
+		case "message_start":
+			usage = response.Message.Usage
+		case "message_delta":
+			if response.Usage != nil {
+				usage.OutputTokens = response.Usage.OutputTokens
+			}
+		}
+
 		if response.Type == "content_block_delta" && response.Delta.Text != "" {
 			raw := response.Delta.Text
 			// Centralized demo handling
@@ -261,8 +295,8 @@ func (p *ClaudeProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 			// Filter out <think> regions from printed output in demo mode
 			// or when dropping a leading think block for this request.
 			toPrint := raw
-			if thinkHideEnabled || thinkDropLeading {
-				toPrint = FilterOutThinkForOutput(toPrint)
+			if tf.active() {
+				toPrint = tf.filter(toPrint)
 			}
 			// Trim leading whitespace/newlines on first visible output in demo mode
 			if p.config.DemoMode && !printed {
@@ -270,7 +304,7 @@ func (p *ClaudeProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 			}
 			// Format the content using our streaming-friendly formatter
 			content := FormatStreamingChunk(toPrint, markdownEnabled)
-			fmt.Print(content)
+			streamPrint(p.ctx, content)
 			if toPrint != "" {
 				printed = true
 			}
@@ -288,25 +322,26 @@ func (p *ClaudeProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 		if final := renderer.Flush(); final != "" {
 			EmitDemoTokens(final)
 			if p.config.ThinkHide {
-				trimmed := FilterOutThinkForOutput(final)
+				trimmed := tf.filter(final)
 				if !printed {
 					trimmed = strings.TrimLeft(trimmed, " \t\r\n")
 				}
-				fmt.Print(trimmed)
+				streamPrint(p.ctx, trimmed)
 			} else {
 				trimmed := TrimLeadingThink(final)
 				if !printed {
 					trimmed = strings.TrimLeft(trimmed, " \t\r\n")
 				}
-				fmt.Print(trimmed)
+				streamPrint(p.ctx, trimmed)
 			}
 		}
 	}
 
-	fmt.Println()
+	streamPrint(p.ctx, "\n")
 
 	// Call stream end callback for timing
 	sd.OnStreamEnd()
+	reportUsage(p.ctx, usage.toUsage())
 
 	if streamErr != nil {
 		return fullResponse.String(), streamErr
@@ -72,10 +72,12 @@ func (p *GeminiProvider) ListModels(ctx context.Context) ([]Model, error) {
 	// Parse response if we got one
 	type GeminiModelsResponse struct {
 		Models []struct {
-			Name        string   `json:"name"`
-			DisplayName string   `json:"displayName"`
-			Description string   `json:"description"`
-			Versions    []string `json:"supportedGenerationMethods,omitempty"`
+			Name             string   `json:"name"`
+			DisplayName      string   `json:"displayName"`
+			Description      string   `json:"description"`
+			Versions         []string `json:"supportedGenerationMethods,omitempty"`
+			InputTokenLimit  int      `json:"inputTokenLimit,omitempty"`
+			OutputTokenLimit int      `json:"outputTokenLimit,omitempty"`
 		} `json:"models"`
 	}
 
@@ -96,10 +98,12 @@ func (p *GeminiProvider) ListModels(ctx context.Context) ([]Model, error) {
 		}
 
 		models = append(models, Model{
-			ID:          modelID,
-			Name:        m.DisplayName,
-			Description: m.Description,
-			Provider:    "gemini",
+			ID:            modelID,
+			Name:          m.DisplayName,
+			Description:   m.Description,
+			Provider:      "gemini",
+			ContextWindow: m.InputTokenLimit,
+			MaxOutput:     m.OutputTokenLimit,
 		})
 	}
 
@@ -250,6 +254,7 @@ func (p *GeminiProvider) parseStreamWithCallback(reader io.Reader, stopCallback
 func (p *GeminiProvider) parseStreamWithTiming(reader io.Reader, stopCallback, firstTokenCallback, streamEndCallback func()) (string, error) {
 	var fullResponse strings.Builder
 	sd := NewStreamDemo(stopCallback, firstTokenCallback, streamEndCallback)
+	tf := thinkFilterFromContext(p.ctx)
 
 	// Check if markdown is enabled
 	markdownEnabled := false
@@ -327,14 +332,14 @@ func (p *GeminiProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 		// Centralized demo handling and then format/print the content
 		sd.OnToken(chunk)
 		toPrint := chunk
-		if thinkHideEnabled || thinkDropLeading {
-			toPrint = FilterOutThinkForOutput(toPrint)
+		if tf.active() {
+			toPrint = tf.filter(toPrint)
 		}
 		// Trim leading whitespace/newlines on first visible output in demo mode
 		if p.config.DemoMode && !printed {
 			toPrint = strings.TrimLeft(toPrint, " \t\r\n")
 		}
-		fmt.Print(FormatStreamingChunk(toPrint, markdownEnabled))
+		streamPrint(p.ctx, FormatStreamingChunk(toPrint, markdownEnabled))
 		if toPrint != "" {
 			printed = true
 		}
@@ -351,22 +356,22 @@ func (p *GeminiProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 		if final := renderer.Flush(); final != "" {
 			EmitDemoTokens(final)
 			if p.config.ThinkHide {
-				trimmed := FilterOutThinkForOutput(final)
+				trimmed := tf.filter(final)
 				if !printed {
 					trimmed = strings.TrimLeft(trimmed, " \t\r\n")
 				}
-				fmt.Print(trimmed)
+				streamPrint(p.ctx, trimmed)
 			} else {
 				trimmed := TrimLeadingThink(final)
 				if !printed {
 					trimmed = strings.TrimLeft(trimmed, " \t\r\n")
 				}
-				fmt.Print(trimmed)
+				streamPrint(p.ctx, trimmed)
 			}
 		}
 	}
 
-	fmt.Println()
+	streamPrint(p.ctx, "\n")
 
 	// Call stream end callback for timing
 	sd.OnStreamEnd()
@@ -0,0 +1,433 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateJSONOutput extracts the JSON document from a model reply
+// (dropping <think> regions and markdown code fences) and validates it
+// against a JSON schema. It returns the extracted JSON text and the list
+// of validation errors, empty when the document is valid.
+//
+// The supported keywords are a subset of JSON Schema draft 2020-12: type,
+// enum, const, required, properties, additionalProperties, items,
+// prefixItems, minItems, maxItems, uniqueItems, minLength, maxLength,
+// pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// multipleOf, minProperties, maxProperties, allOf, anyOf, oneOf, not and
+// local $ref pointers into $defs/definitions.
+func ValidateJSONOutput(schema map[string]interface{}, reply string) (string, []string) {
+	text := ExtractJSONText(reply)
+	var data interface{}
+	if err := json.Unmarshal([]byte(text), &data); err != nil {
+		return text, []string{fmt.Sprintf("output is not valid JSON: %v", err)}
+	}
+	return text, ValidateJSONSchema(schema, data)
+}
+
+// EnforceSchema validates a reply against the client schema and, while it
+// does not conform, re-prompts the model with the validation errors up to
+// retries times. onRetry is called before each attempt. It returns the
+// last reply and its remaining validation errors (empty when valid).
+func (c *LLMClient) EnforceSchema(messages []Message, reply string, retries int, onRetry func(attempt int, errs []string)) (string, []string, error) {
+	if c.Config == nil || c.Config.Schema == nil {
+		return reply, nil, nil
+	}
+	_, errs := ValidateJSONOutput(c.Config.Schema, reply)
+	for attempt := 1; len(errs) > 0 && attempt <= retries; attempt++ {
+		if onRetry != nil {
+			onRetry(attempt, errs)
+		}
+		messages = append(messages,
+			Message{Role: "assistant", Content: reply},
+			Message{Role: "user", Content: schemaRepairPrompt(errs)})
+		repaired, err := c.SendMessage(messages, false, nil, nil)
+		if err != nil {
+			return reply, errs, err
+		}
+		reply = repaired
+		_, errs = ValidateJSONOutput(c.Config.Schema, reply)
+	}
+	return reply, errs, nil
+}
+
+func schemaRepairPrompt(errs []string) string {
+	var b strings.Builder
+	b.WriteString("Your previous reply does not conform to the required JSON schema:\n")
+	for _, e := range errs {
+		b.WriteString("- ")
+		b.WriteString(e)
+		b.WriteString("\n")
+	}
+	b.WriteString("Reply again with only the corrected JSON document, without explanations or markdown fences.")
+	return b.String()
+}
+
+// ExtractJSONText returns the JSON part of a model reply
+func ExtractJSONText(reply string) string {
+	text := strings.TrimSpace(StripThink(reply))
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		if nl := strings.IndexByte(text, '\n'); nl >= 0 {
+			text = text[nl+1:] // drop the fence language tag
+		}
+		if end := strings.LastIndex(text, "```"); end >= 0 {
+			text = text[:end]
+		}
+		text = strings.TrimSpace(text)
+	}
+	return text
+}
+
+// ValidateJSONSchema validates decoded JSON data against a schema and
+// returns the errors found, each prefixed with the JSON path of the value
+func ValidateJSONSchema(schema map[string]interface{}, data interface{}) []string {
+	v := &schemaValidator{root: schema}
+	v.validate(schema, data, "$")
+	return v.errors
+}
+
+type schemaValidator struct {
+	root   map[string]interface{}
+	errors []string
+	depth  int
+}
+
+func (v *schemaValidator) addf(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+}
+
+// resolve follows a local "#/..." reference
+func (v *schemaValidator) resolve(ref string) (map[string]interface{}, bool) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, false
+	}
+	var node interface{} = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if node, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	m, ok := node.(map[string]interface{})
+	return m, ok
+}
+
+func (v *schemaValidator) validate(schema map[string]interface{}, data interface{}, path string) {
+	if v.depth > 64 {
+		v.addf(path, "schema nesting too deep (recursive $ref?)")
+		return
+	}
+	v.depth++
+	defer func() { v.depth-- }()
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, found := v.resolve(ref)
+		if !found {
+			v.addf(path, "cannot resolve $ref %q", ref)
+			return
+		}
+		v.validate(target, data, path)
+	}
+
+	if t, ok := schema["type"]; ok && !matchesSchemaType(t, data) {
+		v.addf(path, "expected %s, got %s", describeSchemaType(t), jsonTypeName(data))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, data) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.addf(path, "value %s is not one of %s", compactJSON(data), compactJSON(enum))
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, data) {
+		v.addf(path, "value must be %s", compactJSON(c))
+	}
+
+	switch value := data.(type) {
+	case map[string]interface{}:
+		v.validateObject(schema, value, path)
+	case []interface{}:
+		v.validateArray(schema, value, path)
+	case string:
+		v.validateString(schema, value, path)
+	case float64:
+		v.validateNumber(schema, value, path)
+	}
+
+	v.validateCombinators(schema, data, path)
+}
+
+func (v *schemaValidator) validateObject(schema map[string]interface{}, obj map[string]interface{}, path string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, present := obj[name]; !present {
+					v.addf(path, "missing required property %q", name)
+				}
+			}
+		}
+	}
+	props, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		childPath := path + "." + k
+		if sub, ok := props[k].(map[string]interface{}); ok {
+			v.validate(sub, obj[k], childPath)
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				v.addf(path, "unexpected property %q", k)
+			}
+		case map[string]interface{}:
+			v.validate(extra, obj[k], childPath)
+		}
+	}
+	if n, ok := schemaNumber(schema, "minProperties"); ok && float64(len(obj)) < n {
+		v.addf(path, "expected at least %v properties, got %d", n, len(obj))
+	}
+	if n, ok := schemaNumber(schema, "maxProperties"); ok && float64(len(obj)) > n {
+		v.addf(path, "expected at most %v properties, got %d", n, len(obj))
+	}
+}
+
+func (v *schemaValidator) validateArray(schema map[string]interface{}, arr []interface{}, path string) {
+	prefix, _ := schema["prefixItems"].([]interface{})
+	for i, item := range arr {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		if i < len(prefix) {
+			if sub, ok := prefix[i].(map[string]interface{}); ok {
+				v.validate(sub, item, itemPath)
+			}
+			continue
+		}
+		switch items := schema["items"].(type) {
+		case map[string]interface{}:
+			v.validate(items, item, itemPath)
+		case bool:
+			if !items {
+				v.addf(path, "unexpected item at index %d", i)
+			}
+		}
+	}
+	if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(arr)) < n {
+		v.addf(path, "expected at least %v items, got %d", n, len(arr))
+	}
+	if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(arr)) > n {
+		v.addf(path, "expected at most %v items, got %d", n, len(arr))
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := 0; i < len(arr); i++ {
+			for j := i + 1; j < len(arr); j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					v.addf(path, "items %d and %d are equal but uniqueItems is set", i, j)
+				}
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) validateString(schema map[string]interface{}, s, path string) {
+	length := float64(utf8.RuneCountInString(s))
+	if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+		v.addf(path, "string shorter than %v characters", n)
+	}
+	if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+		v.addf(path, "string longer than %v characters", n)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.addf(path, "invalid pattern %q in schema: %v", pattern, err)
+		} else if !re.MatchString(s) {
+			v.addf(path, "string %q does not match pattern %q", s, pattern)
+		}
+	}
+}
+
+func (v *schemaValidator) validateNumber(schema map[string]interface{}, n float64, path string) {
+	if min, ok := schemaNumber(schema, "minimum"); ok && n < min {
+		v.addf(path, "%v is less than the minimum %v", n, min)
+	}
+	if max, ok := schemaNumber(schema, "maximum"); ok && n > max {
+		v.addf(path, "%v is greater than the maximum %v", n, max)
+	}
+	if min, ok := schemaNumber(schema, "exclusiveMinimum"); ok && n <= min {
+		v.addf(path, "%v must be greater than %v", n, min)
+	}
+	if max, ok := schemaNumber(schema, "exclusiveMaximum"); ok && n >= max {
+		v.addf(path, "%v must be less than %v", n, max)
+	}
+	if m, ok := schemaNumber(schema, "multipleOf"); ok && m > 0 {
+		if q := n / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.addf(path, "%v is not a multiple of %v", n, m)
+		}
+	}
+}
+
+// validateCombinators checks allOf, anyOf, oneOf and not using a nested
+// validator so alternative branches do not leak their errors
+func (v *schemaValidator) validateCombinators(schema map[string]interface{}, data interface{}, path string) {
+	branchErrors := func(sub interface{}) []string {
+		m, ok := sub.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		nested := &schemaValidator{root: v.root, depth: v.depth}
+		nested.validate(m, data, path)
+		return nested.errors
+	}
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			v.errors = append(v.errors, branchErrors(sub)...)
+		}
+	}
+	if alts, ok := schema["anyOf"].([]interface{}); ok {
+		var first []string
+		matched := false
+		for _, sub := range alts {
+			errs := branchErrors(sub)
+			if len(errs) == 0 {
+				matched = true
+				break
+			}
+			if first == nil {
+				first = errs
+			}
+		}
+		if !matched {
+			v.addf(path, "value does not match any of the anyOf schemas (first: %s)", strings.Join(first, "; "))
+		}
+	}
+	if one, ok := schema["oneOf"].([]interface{}); ok {
+		count := 0
+		for _, sub := range one {
+			if len(branchErrors(sub)) == 0 {
+				count++
+			}
+		}
+		if count != 1 {
+			v.addf(path, "value must match exactly one oneOf schema, matched %d", count)
+		}
+	}
+	if not, ok := schema["not"]; ok {
+		if _, isMap := not.(map[string]interface{}); isMap && len(branchErrors(not)) == 0 {
+			v.addf(path, "value must not match the 'not' schema")
+		}
+	}
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+func matchesSchemaType(t interface{}, data interface{}) bool {
+	switch tt := t.(type) {
+	case string:
+		return matchesSingleType(tt, data)
+	case []interface{}:
+		for _, item := range tt {
+			if s, ok := item.(string); ok && matchesSingleType(s, data) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesSingleType(t string, data interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := data.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := data.([]interface{})
+		return ok
+	case "string":
+		_, ok := data.(string)
+		return ok
+	case "number":
+		_, ok := data.(float64)
+		return ok
+	case "integer":
+		n, ok := data.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := data.(bool)
+		return ok
+	case "null":
+		return data == nil
+	}
+	return true
+}
+
+func describeSchemaType(t interface{}) string {
+	if list, ok := t.([]interface{}); ok {
+		names := make([]string, 0, len(list))
+		for _, item := range list {
+			names = append(names, fmt.Sprint(item))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func jsonTypeName(data interface{}) string {
+	switch value := data.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", data)
+}
+
+func jsonEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -119,6 +119,7 @@ func (p *LlamaCliProvider) streamResponse(stdout io.ReadCloser, stdin io.WriteCl
 	scanner := bufio.NewScanner(stdout)
 	var fullResponse strings.Builder
 	sd := NewStreamDemo(nil, nil, nil)
+	tf := thinkFilterFromContext(p.ctx)
 
 	markdownEnabled := p.config.Markdown
 	if markdownEnabled {
@@ -143,14 +144,14 @@ func (p *LlamaCliProvider) streamResponse(stdout io.ReadCloser, stdin io.WriteCl
 
 		sd.OnToken(raw)
 		toPrint := raw
-		if thinkHideEnabled || thinkDropLeading {
-			toPrint = FilterOutThinkForOutput(toPrint)
+		if tf.active() {
+			toPrint = tf.filter(toPrint)
 		}
 		if p.config.DemoMode && !printed {
 			toPrint = strings.TrimLeft(toPrint, " \t\r\n")
 		}
 		formatted := FormatStreamingChunk(toPrint, markdownEnabled)
-		fmt.Print(formatted)
+		streamPrint(p.ctx, formatted)
 		if toPrint != "" {
 			printed = true
 		}
@@ -162,22 +163,22 @@ func (p *LlamaCliProvider) streamResponse(stdout io.ReadCloser, stdin io.WriteCl
 		if final := renderer.Flush(); final != "" {
 			EmitDemoTokens(final)
 			if p.config.ThinkHide {
-				trimmed := FilterOutThinkForOutput(final)
+				trimmed := tf.filter(final)
 				if !printed {
 					trimmed = strings.TrimLeft(trimmed, " \t\r\n")
 				}
-				fmt.Print(trimmed)
+				streamPrint(p.ctx, trimmed)
 			} else {
 				trimmed := TrimLeadingThink(final)
 				if !printed {
 					trimmed = strings.TrimLeft(trimmed, " \t\r\n")
 				}
-				fmt.Print(trimmed)
+				streamPrint(p.ctx, trimmed)
 			}
 		}
 	}
 
-	fmt.Println()
+	streamPrint(p.ctx, "\n")
 	sd.OnStreamEnd()
 
 	if err := scanner.Err(); err != nil {
@@ -23,25 +23,6 @@ var (
 	demoPhaseCallback func(string) // e.g. "Thinking", "Processing"
 	demoTokenCallback func(phase string, token string)
 	demoInThink       bool
-	// thinkFilterInThink tracks whether we're inside a <think> region
-	// when filtering provider output for display (so we don't print
-	// internal reasoning or the tags when demo mode is enabled).
-	thinkFilterInThink bool
-	// after closing </think>, some models emit leading newlines/spaces
-	// before visible content. When this is set, trim leading whitespace
-	// at the start of the next chunk before printing.
-	thinkJustClosed bool
-
-	// thinkHideEnabled toggles whether <think> regions are filtered out
-	// from output. It is initialized from the LLM client config per request
-	// and can be toggled via the think.show option.
-	thinkHideEnabled bool = true
-
-	// thinkDropLeading indicates that the next incoming stream/response
-	// should drop any leading <think>...</think> block (used to trim
-	// models that accidentally start with internal reasoning). This is
-	// reset for each SendMessage call.
-	thinkDropLeading bool = false
 )
 
 // SetDemoPhaseCallback sets a callback that receives phase/action updates.
@@ -122,10 +103,58 @@ func EmitDemoTokens(text string) {
 	}
 }
 
+// thinkFilter holds the state used to filter <think> regions out of a
+// streamed response. Each request gets its own filter so tags that cross
+// chunk boundaries are handled without interfering with concurrent requests.
+type thinkFilter struct {
+	// hide toggles whether <think> regions are filtered out from output.
+	// It is initialized from the client config and can be toggled via the
+	// think.show option.
+	hide bool
+	// inThink tracks whether we're inside a <think> region
+	inThink bool
+	// after closing </think>, some models emit leading newlines/spaces
+	// before visible content. When this is set, trim leading whitespace
+	// at the start of the next chunk before printing.
+	justClosed bool
+	// dropLeading indicates that the response should drop any leading
+	// <think>...</think> block (used to trim models that accidentally
+	// start with internal reasoning).
+	dropLeading bool
+}
+
+// newThinkFilter returns the filter for a new response. When hiding is
+// requested a leading think block is dropped too, since models sometimes
+// prepend internal reasoning we don't want to show.
+func newThinkFilter(hide bool) *thinkFilter {
+	return &thinkFilter{hide: hide, dropLeading: hide}
+}
+
+// thinkFilterFromContext returns the filter of the request, or a new one
+// hiding think regions when the context does not carry any
+func thinkFilterFromContext(ctx context.Context) *thinkFilter {
+	if ctx != nil {
+		if f, ok := ctx.Value(contextThinkFilterKey).(*thinkFilter); ok && f != nil {
+			return f
+		}
+	}
+	return newThinkFilter(true)
+}
+
+// active reports whether chunks need to go through the filter
+func (f *thinkFilter) active() bool {
+	return f.hide || f.dropLeading
+}
+
 // FilterOutThinkForOutput removes <think>...</think> sections and the tags
-// from a streaming chunk for display when demo mode is enabled. It maintains
-// a small package-level state so tags that cross chunk boundaries are handled.
-func FilterOutThinkForOutput(chunk string) string {
+// from a complete response for display.
+func FilterOutThinkForOutput(text string) string {
+	return newThinkFilter(true).filter(text)
+}
+
+// filter removes <think>...</think> sections and the tags from a streaming
+// chunk for display.
+func (f *thinkFilter) filter(chunk string) string {
 	if chunk == "" {
 		return ""
 	}
@@ -133,21 +162,21 @@ func FilterOutThinkForOutput(chunk string) string {
 	s := chunk
 	// If we just closed a think block in a prior chunk, trim any
 	// leading whitespace/newlines at the start of this chunk.
-	if thinkJustClosed {
+	if f.justClosed {
 		s = strings.TrimLeft(s, " \t\r\n")
-		thinkJustClosed = false
+		f.justClosed = false
 	}
 
 	// If think hide is disabled, normally we would return the chunk
 	// unchanged. However, we still want to trim a leading <think>..</think>
 	// block at the beginning of a response (models sometimes prepend
-	// internal reasoning). We use thinkDropLeading to indicate a fresh
+	// internal reasoning). We use dropLeading to indicate a fresh
 	// response where leading think blocks should be removed.
-	if !thinkHideEnabled {
+	if !f.hide {
 		// If there's a leading <think> in this chunk or the trimmed
 		// chunk, handle it similarly to the normal filter logic but
-		// only for leading blocks when thinkDropLeading is set.
-		if thinkDropLeading {
+		// only for leading blocks when dropLeading is set.
+		if f.dropLeading {
 			trimmed := strings.TrimLeft(s, " \t\r\n")
 			if strings.HasPrefix(trimmed, "<think>") {
 				// If closing tag present in this chunk, drop the leading
@@ -156,12 +185,12 @@ func FilterOutThinkForOutput(chunk string) string {
 					// Advance past the closing tag
 					s = trimmed[idx+len("</think>"):]
 					// Clear the drop flag and trim leftover whitespace
-					thinkDropLeading = false
+					f.dropLeading = false
 					s = strings.TrimLeft(s, " \t\r\n")
 				} else {
 					// No closing tag yet: enter think state and drop remainder
-					thinkFilterInThink = true
-					thinkDropLeading = false // still drop until closing tag
+					f.inThink = true
+					f.dropLeading = false // still drop until closing tag
 					return ""
 				}
 			}
@@ -171,16 +200,16 @@ func FilterOutThinkForOutput(chunk string) string {
 		return s
 	}
 	for len(s) > 0 {
-		if thinkFilterInThink {
+		if f.inThink {
 			// Look for closing tag
 			if idx := strings.Index(s, "</think>"); idx >= 0 {
 				// Skip content up to and including closing tag
 				s = s[idx+len("</think>"):]
-				thinkFilterInThink = false
+				f.inThink = false
 				// Trim any immediate whitespace/newlines following the think block
 				s = strings.TrimLeft(s, " \t\r\n")
 				// Also signal that next chunk (if any) should trim leading whitespace too
-				thinkJustClosed = true
+				f.justClosed = true
 				continue
 			}
 			// Entire remainder is within think; drop it
@@ -192,7 +221,7 @@ func FilterOutThinkForOutput(chunk string) string {
 			out.WriteString(s[:idx])
 			// Enter think region and skip the opening tag
 			s = s[idx+len("<think>"):]
-			thinkFilterInThink = true
+			f.inThink = true
 			continue
 		}
 		// No opening tag in remainder: emit all and finish
@@ -381,6 +410,9 @@ type Model struct {
 	Name        string `json:"name"`        // Human-readable name (may be the same as ID)
 	Description string `json:"description"` // Optional model description
 	Provider    string `json:"provider"`    // The provider this model belongs to
+	// Limits reported by the provider listing, when available
+	ContextWindow int `json:"context_window,omitempty"`
+	MaxOutput     int `json:"max_output,omitempty"`
 }
 
 type contextKey string
@@ -391,6 +423,9 @@ const (
 	contextFirstTokenCallbackKey  contextKey = "first_token_callback"
 	contextStreamEndCallbackKey   contextKey = "stream_end_callback"
 	contextAccountTextCallbackKey contextKey = "account_text_callback"
+	contextUsageCallbackKey       contextKey = "usage_callback"
+	contextThinkFilterKey         contextKey = "think_filter"
+	contextOutputKey              contextKey = "output"
 )
 
 // LLMClient manages interactions with LLM providers
@@ -404,6 +439,10 @@ type LLMClient struct {
 	firstTokenCallback  func()
 	streamEndCallback   func()
 	accountTextCallback func(string)
+	// Optional destination of streamed output instead of the terminal
+	outputCallback func(string)
+	// Token usage reported by the provider for the last request
+	lastUsage Usage
 }
 
 // ListModelsResult contains the list of available models with optional error
@@ -424,12 +463,6 @@ func NewLLMClient(config *Config, ctx context.Context) (*LLMClient, error) {
 		return nil, fmt.Errorf("provider %s is not available", config.PROVIDER)
 	}
 
-	// Initialize package-level think hide state from config default.
-	// This is reset per request in SendMessage as appropriate.
-	if config != nil {
-		thinkHideEnabled = config.ThinkHide
-	}
-
 	return &LLMClient{
 		Config:               config,
 		provider:             provider,
@@ -446,6 +479,19 @@ func (c *LLMClient) SetResponseStopCallback(cb func()) {
 	c.responseStopCallback = cb
 }
 
+// SetOutputCallback sets an optional callback that receives the streamed
+// output, as it would be printed, instead of the terminal. Background jobs use
+// it to capture their output.
+func (c *LLMClient) SetOutputCallback(cb func(string)) {
+	c.outputCallback = cb
+}
+
+// LastUsage returns the token usage (including prompt cache reads and
+// writes) reported by the provider for the last request, when available.
+func (c *LLMClient) LastUsage() Usage {
+	return c.lastUsage
+}
+
 // SetTimingCallbacks sets callbacks for tracking timing statistics.
 // firstTokenCallback is called when the first token is received.
 // streamEndCallback is called when the stream ends.
@@ -454,9 +500,10 @@ func (c *LLMClient) SetTimingCallbacks(firstToken func(), streamEnd func()) {
 	c.streamEndCallback = streamEnd
 }
 
-// newContext returns a cancellable context carrying the client config.
-func (c *LLMClient) newContext() (context.Context, context.CancelFunc) {
-	ctx := context.WithValue(context.Background(), contextConfigKey, c.Config)
+// newContext returns a cancellable context derived from parent carrying the
+// client config.
+func (c *LLMClient) newContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx := context.WithValue(parent, contextConfigKey, c.Config)
 	// Include optional stop callback in the context so streaming helpers can
 	// invoke it when the first token is received.
 	ctx = context.WithValue(ctx, contextStopCallbackKey, c.responseStopCallback)
@@ -464,6 +511,12 @@ func (c *LLMClient) newContext() (context.Context, context.CancelFunc) {
 	ctx = context.WithValue(ctx, contextFirstTokenCallbackKey, c.firstTokenCallback)
 	ctx = context.WithValue(ctx, contextStreamEndCallbackKey, c.streamEndCallback)
 	ctx = context.WithValue(ctx, contextAccountTextCallbackKey, c.accountTextCallback)
+	ctx = context.WithValue(ctx, contextUsageCallbackKey, func(u Usage) {
+		c.lastUsage = u
+	})
+	if c.outputCallback != nil {
+		ctx = context.WithValue(ctx, contextOutputKey, c.outputCallback)
+	}
 	ctx, cancel := context.WithCancel(ctx)
 	c.responseCancel = cancel
 	return ctx, cancel
@@ -530,6 +583,12 @@ func EstimateTokenCount(text string) int {
 
 // SendMessage sends a message to the LLM and handles the response
 func (c *LLMClient) SendMessage(messages []Message, stream bool, images []string, tools []OpenAITool) (string, error) {
+	return c.SendMessageContext(context.Background(), messages, stream, images, tools)
+}
+
+// SendMessageContext is like SendMessage, but the request is aborted when ctx
+// is cancelled.
+func (c *LLMClient) SendMessageContext(parent context.Context, messages []Message, stream bool, images []string, tools []OpenAITool) (string, error) {
 	// Track timing if TPS statistics are enabled
 	var requestStart time.Time
 	var firstTokenTime time.Time
@@ -592,30 +651,18 @@ func (c *LLMClient) SendMessage(messages []Message, stream bool, images []string
 		art.DebugBanner("LLM Query "+c.Config.PROVIDER, buf.String())
 	}
 
-	// Reset think-related streaming flags for this outgoing request so
-	// per-request state is isolated. Only drop a leading <think> block
-	// when the client requests hiding of think regions; when hiding is
-	// disabled we preserve the tags and their content for display.
-	thinkDropLeading = false
-	thinkFilterInThink = false
-	thinkJustClosed = false
-
-	// Ensure package-level hide flag reflects client config for this request
-	if c.Config != nil {
-		thinkHideEnabled = c.Config.ThinkHide
-		// If hide is enabled, mark that we should drop a leading think
-		// block for this request (models sometimes prepend internal
-		// reasoning we don't want to show when hiding is requested).
-		if c.Config.ThinkHide {
-			thinkDropLeading = true
-		}
-	}
+	// Each request filters <think> regions with its own state. Only drop a
+	// leading <think> block when the client requests hiding of think
+	// regions; when hiding is disabled we preserve the tags and their
+	// content for display.
+	thinkHide := c.Config == nil || c.Config.ThinkHide
 
 	// Single entry point for all providers; providers handle images support.
 	// Delegate to provider and capture response so we can debug-print it
 	isStreaming := stream && !c.Config.NoStream
-	ctx, cancel := c.newContext()
+	ctx, cancel := c.newContext(parent)
 	defer cancel()
+	ctx = context.WithValue(ctx, contextThinkFilterKey, newThinkFilter(thinkHide))
 	provider, err := CreateProvider(c.Config, ctx)
 	if err != nil {
 		return "", err
@@ -632,7 +679,11 @@ func (c *LLMClient) SendMessage(messages []Message, stream bool, images []string
 		)
 	}
 
+	c.lastUsage = Usage{}
 	resp, err := provider.SendMessage(messagesToSend, isStreaming, images, tools)
+	if c.Config != nil && c.Config.ShowTPS && err == nil {
+		printUsage(c.lastUsage)
+	}
 
 	// For non-streaming responses, simulate timing callbacks
 	if c.Config != nil && c.Config.ShowTPS && !isStreaming && err == nil && (resp != "" || responseChars > 0) {
@@ -752,9 +803,13 @@ func (c *LLMClient) displayTPSStats(requestStart, firstTokenTime, streamEndTime
 
 // ListModels returns a list of available models for the current provider
 func (c *LLMClient) ListModels() ([]Model, error) {
-	ctx, cancel := c.newContext()
+	ctx, cancel := c.newContext(context.Background())
 	defer cancel()
-	return c.provider.ListModels(ctx)
+	models, err := c.provider.ListModels(ctx)
+	if err == nil {
+		rememberModelMetadata(c.Config.PROVIDER, models)
+	}
+	return models, err
 }
 
 // DefaultModel returns the default model of the current provider
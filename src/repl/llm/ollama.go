@@ -507,6 +507,7 @@ func (p *OllamaProvider) parseStreamWithCallback(reader io.Reader, stopCallback
 func (p *OllamaProvider) parseStreamWithTiming(reader io.Reader, stopCallback, firstTokenCallback, streamEndCallback func()) (string, error) {
 	var fullResponse strings.Builder
 	sd := NewStreamDemo(stopCallback, firstTokenCallback, streamEndCallback)
+	tf := thinkFilterFromContext(p.ctx)
 
 	// Check if markdown is enabled
 	markdownEnabled := false
@@ -581,7 +582,7 @@ func (p *OllamaProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 				raw = response.Response
 			} else if response.Message.Thinking != "" {
 				sd.OnToken(response.Message.Thinking)
-				if thinkHideEnabled {
+				if tf.hide {
 					accountResponseText(p.ctx, response.Message.Thinking)
 				} else {
 					raw = response.Message.Thinking
@@ -600,8 +601,8 @@ func (p *OllamaProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 		// Filter out <think> regions from printed output in demo mode
 		// or when we are dropping a leading think block for this request.
 		toPrint := raw
-		if thinkHideEnabled || thinkDropLeading {
-			toPrint = FilterOutThinkForOutput(toPrint)
+		if tf.active() {
+			toPrint = tf.filter(toPrint)
 		}
 		// Color thinking chunks in cyan
 		if isThinkingChunk {
@@ -613,7 +614,7 @@ func (p *OllamaProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 		}
 		// Format for printing only, keep raw for storage
 		formatted := FormatStreamingChunk(toPrint, markdownEnabled)
-		fmt.Print(formatted)
+		streamPrint(p.ctx, formatted)
 		if toPrint != "" {
 			printed = true
 		}
@@ -634,22 +635,22 @@ func (p *OllamaProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 		if final := renderer.Flush(); final != "" {
 			EmitDemoTokens(final)
 			if p.config.ThinkHide {
-				trimmed := FilterOutThinkForOutput(final)
+				trimmed := tf.filter(final)
 				if !printed {
 					trimmed = strings.TrimLeft(trimmed, " \t\r\n")
 				}
-				fmt.Print(trimmed)
+				streamPrint(p.ctx, trimmed)
 			} else {
 				trimmed := TrimLeadingThink(final)
 				if !printed {
 					trimmed = strings.TrimLeft(trimmed, " \t\r\n")
 				}
-				fmt.Print(trimmed)
+				streamPrint(p.ctx, trimmed)
 			}
 		}
 	}
 
-	fmt.Println()
+	streamPrint(p.ctx, "\n")
 
 	// Call stream end callback for timing
 	sd.OnStreamEnd()
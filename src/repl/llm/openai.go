@@ -25,6 +25,8 @@ type OpenAIModelsResponse struct {
 		Object  string `json:"object"`
 		Created int64  `json:"created"`
 		OwnedBy string `json:"owned_by"`
+		// OpenRouter and some local servers include the context size
+		ContextLength int `json:"context_length,omitempty"`
 	} `json:"data"`
 }
 
@@ -259,7 +261,7 @@ func (p *OpenAIProvider) ListModels(ctx context.Context) ([]Model, error) {
 		if err := json.Unmarshal(body, &openaiResp); err == nil && len(openaiResp.Data) > 0 {
 			models := make([]Model, 0, len(openaiResp.Data))
 			for _, m := range openaiResp.Data {
-				models = append(models, Model{ID: m.ID, Name: m.ID, Provider: providerName, Description: "Owner: " + m.OwnedBy})
+				models = append(models, Model{ID: m.ID, Name: m.ID, Provider: providerName, Description: "Owner: " + m.OwnedBy, ContextWindow: m.ContextLength})
 			}
 			return models, true
 		}
@@ -293,13 +295,15 @@ func (p *OpenAIProvider) ListModels(ctx context.Context) ([]Model, error) {
 					owner = v
 				}
 				desc := owner
+				contextWindow := 0
 				if cl, ok := item["context_length"].(float64); ok && cl > 0 {
 					if desc != "" {
 						desc += " - "
 					}
 					desc += fmt.Sprintf("Context: %dk tokens", int(cl)/1000)
+					contextWindow = int(cl)
 				}
-				models = append(models, Model{ID: id, Name: id, Provider: providerName, Description: desc})
+				models = append(models, Model{ID: id, Name: id, Provider: providerName, Description: desc, ContextWindow: contextWindow})
 			}
 			if len(models) > 0 {
 				return models, true
@@ -381,7 +385,13 @@ func (p *OpenAIProvider) SendMessage(messages []Message, stream bool, images []s
 
 	// Mistral needs explicit max_tokens
 	if provider == "mistral" {
-		request["max_tokens"] = 5128
+		request["max_tokens"] = EffectiveMaxTokens(p.config, effectiveModel)
+	} else if p.config.MaxTokens > 0 {
+		if isOpenAIReasoningModel(effectiveModel) {
+			request["max_completion_tokens"] = p.config.MaxTokens
+		} else {
+			request["max_tokens"] = p.config.MaxTokens
+		}
 	}
 
 	// Add response_format with JSON schema if provided
@@ -467,6 +477,7 @@ func (p *OpenAIProvider) SendMessage(messages []Message, stream bool, images []s
 			accountResponseText(p.ctx, text)
 		}
 	}
+	reportUsage(p.ctx, extractOpenAIUsage(respBody))
 
 	// Check if response is in streaming format (starts with "data: ")
 	if strings.Contains(string(respBody), "data: ") {
@@ -575,6 +586,7 @@ func (p *OpenAIProvider) parseStreamWithCallback(reader io.Reader, stopCallback
 func (p *OpenAIProvider) parseStreamWithTiming(reader io.Reader, stopCallback, firstTokenCallback, streamEndCallback func()) (string, error) {
 	var fullResponse strings.Builder
 	sd := NewStreamDemo(stopCallback, firstTokenCallback, streamEndCallback)
+	tf := thinkFilterFromContext(p.ctx)
 
 	// Check if markdown is enabled
 	markdownEnabled := false
@@ -610,8 +622,8 @@ func (p *OpenAIProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 			// or if this is the start of a response where a leading
 			// <think> block should be dropped.
 			toPrint := raw
-			if thinkHideEnabled || thinkDropLeading {
-				toPrint = FilterOutThinkForOutput(toPrint)
+			if tf.active() {
+				toPrint = tf.filter(toPrint)
 			}
 			// Trim leading whitespace/newlines on first visible output in demo mode
 			if p.config.DemoMode && !printed {
@@ -619,7 +631,7 @@ func (p *OpenAIProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 			}
 			// Format the content using our streaming-friendly formatter
 			content := FormatStreamingChunk(toPrint, markdownEnabled)
-			fmt.Print(content)
+			streamPrint(p.ctx, content)
 			if toPrint != "" {
 				printed = true
 			}
@@ -640,22 +652,22 @@ func (p *OpenAIProvider) parseStreamWithTiming(reader io.Reader, stopCallback, f
 			// If the client prefers hidden thinking, filter all think
 			// regions. Otherwise only trim a leading think block.
 			if p.config.ThinkHide {
-				trimmed := FilterOutThinkForOutput(final)
+				trimmed := tf.filter(final)
 				if !printed {
 					trimmed = strings.TrimLeft(trimmed, " \t\r\n")
 				}
-				fmt.Print(trimmed)
+				streamPrint(p.ctx, trimmed)
 			} else {
 				trimmed := TrimLeadingThink(final)
 				if !printed {
 					trimmed = strings.TrimLeft(trimmed, " \t\r\n")
 				}
-				fmt.Print(trimmed)
+				streamPrint(p.ctx, trimmed)
 			}
 		}
 	}
 
-	fmt.Println()
+	streamPrint(p.ctx, "\n")
 
 	// Call stream end callback for timing
 	sd.OnStreamEnd()
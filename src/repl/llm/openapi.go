@@ -199,6 +199,7 @@ func (p *OpenAPIProvider) parseStream(reader io.Reader) (string, error) {
 func (p *OpenAPIProvider) parseStreamWithTiming(reader io.Reader, stopCallback, firstTokenCallback, streamEndCallback func()) (string, error) {
 	br := bufio.NewReader(reader)
 	sd := NewStreamDemo(stopCallback, firstTokenCallback, streamEndCallback)
+	tf := thinkFilterFromContext(p.ctx)
 	var fullResponse strings.Builder
 
 	markdownEnabled := p.config.Markdown
@@ -213,13 +214,13 @@ func (p *OpenAPIProvider) parseStreamWithTiming(reader io.Reader, stopCallback,
 		}
 		sd.OnToken(raw)
 		toPrint := raw
-		if thinkHideEnabled || thinkDropLeading {
-			toPrint = FilterOutThinkForOutput(toPrint)
+		if tf.active() {
+			toPrint = tf.filter(toPrint)
 		}
 		if p.config.DemoMode && !printed {
 			toPrint = strings.TrimLeft(toPrint, " \t\r\n")
 		}
-		fmt.Print(FormatStreamingChunk(toPrint, markdownEnabled))
+		streamPrint(p.ctx, FormatStreamingChunk(toPrint, markdownEnabled))
 		if toPrint != "" {
 			printed = true
 		}
@@ -241,22 +242,22 @@ func (p *OpenAPIProvider) parseStreamWithTiming(reader io.Reader, stopCallback,
 		if final := renderer.Flush(); final != "" {
 			EmitDemoTokens(final)
 			if p.config.ThinkHide {
-				trimmed := FilterOutThinkForOutput(final)
+				trimmed := tf.filter(final)
 				if !printed {
 					trimmed = strings.TrimLeft(trimmed, " \t\r\n")
 				}
-				fmt.Print(trimmed)
+				streamPrint(p.ctx, trimmed)
 			} else {
 				trimmed := TrimLeadingThink(final)
 				if !printed {
 					trimmed = strings.TrimLeft(trimmed, " \t\r\n")
 				}
-				fmt.Print(trimmed)
+				streamPrint(p.ctx, trimmed)
 			}
 		}
 	}
 
-	fmt.Println()
+	streamPrint(p.ctx, "\n")
 	sd.OnStreamEnd()
 	return fullResponse.String(), nil
 }
@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Usage holds the token accounting reported by a provider for one request.
+type Usage struct {
+	InputTokens      int
+	OutputTokens     int
+	CacheReadTokens  int
+	CacheWriteTokens int
+}
+
+// anthropicUsage mirrors the usage object returned by the Anthropic API
+// (also used by Claude models on Bedrock).
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+func (u anthropicUsage) toUsage() Usage {
+	return Usage{
+		InputTokens:      u.InputTokens,
+		OutputTokens:     u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	}
+}
+
+// maxCacheBreakpoints is the number of cache_control markers accepted by
+// the Anthropic API in a single request.
+const maxCacheBreakpoints = 4
+
+func ephemeralCacheControl() map[string]interface{} {
+	return map[string]interface{}{"type": "ephemeral"}
+}
+
+// anthropicRequestParts holds the system blocks and messages of an
+// Anthropic messages request.
+type anthropicRequestParts struct {
+	System      []map[string]interface{}
+	Messages    []map[string]interface{}
+	breakpoints int
+}
+
+// buildAnthropicMessages converts the generic message list into the
+// Anthropic format: system messages become top-level system blocks and the
+// rest become user/assistant turns. When cache is true, breakpoints are
+// placed on the system prompt, the MEMORY context and the last message of
+// the stable history prefix (everything before the final user turn).
+func buildAnthropicMessages(messages []Message, cache bool, reserved int) anthropicRequestParts {
+	parts := anthropicRequestParts{breakpoints: reserved}
+	for _, m := range messages {
+		if m.Content == "" {
+			continue
+		}
+		block := map[string]interface{}{"type": "text", "text": m.Content}
+		if m.Role == "system" {
+			parts.System = append(parts.System, block)
+			continue
+		}
+		role := m.Role
+		if role != "assistant" {
+			role = "user"
+		}
+		parts.Messages = append(parts.Messages, map[string]interface{}{
+			"role":    role,
+			"content": []map[string]interface{}{block},
+		})
+	}
+	if !cache {
+		return parts
+	}
+	for i, block := range parts.System {
+		text, _ := block["text"].(string)
+		if i == 0 || strings.HasPrefix(text, "<MEMORY>") {
+			parts.mark(block)
+		}
+	}
+	if n := len(parts.Messages); n > 1 {
+		content := parts.Messages[n-2]["content"].([]map[string]interface{})
+		parts.mark(content[len(content)-1])
+	}
+	return parts
+}
+
+// mark adds a cache breakpoint to the block unless the limit was reached.
+func (p *anthropicRequestParts) mark(block map[string]interface{}) {
+	if p.breakpoints >= maxCacheBreakpoints {
+		return
+	}
+	block["cache_control"] = ephemeralCacheControl()
+	p.breakpoints++
+}
+
+// printUsage shows the token and cache statistics of the last request.
+func printUsage(u Usage) {
+	if u.InputTokens == 0 && u.OutputTokens == 0 && u.CacheReadTokens == 0 && u.CacheWriteTokens == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[CACHE] Input: %d, Output: %d, Cache read: %d, Cache write: %d\n",
+		u.InputTokens, u.OutputTokens, u.CacheReadTokens, u.CacheWriteTokens)
+}
@@ -3,6 +3,7 @@ package llm
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
 )
 
@@ -15,6 +16,16 @@ func accountResponseText(ctx context.Context, text string) {
 	}
 }
 
+// reportUsage forwards the token usage of a request to the client.
+func reportUsage(ctx context.Context, u Usage) {
+	if ctx == nil {
+		return
+	}
+	if cb, ok := ctx.Value(contextUsageCallbackKey).(func(Usage)); ok && cb != nil {
+		cb(u)
+	}
+}
+
 func appendResponseText(dst *strings.Builder, ctx context.Context, text string) {
 	if text == "" {
 		return
@@ -75,6 +86,29 @@ func extractOpenAIResponseMessage(body []byte) (string, []string) {
 	return content, reasoning
 }
 
+// extractOpenAIUsage reads the token usage of a chat completion. Cached
+// prompt tokens are reported by OpenAI-compatible servers that cache the
+// prompt prefix automatically.
+func extractOpenAIUsage(body []byte) Usage {
+	var payload struct {
+		Usage struct {
+			PromptTokens        int `json:"prompt_tokens"`
+			CompletionTokens    int `json:"completion_tokens"`
+			PromptTokensDetails struct {
+				CachedTokens int `json:"cached_tokens"`
+			} `json:"prompt_tokens_details"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return Usage{}
+	}
+	return Usage{
+		InputTokens:     payload.Usage.PromptTokens,
+		OutputTokens:    payload.Usage.CompletionTokens,
+		CacheReadTokens: payload.Usage.PromptTokensDetails.CachedTokens,
+	}
+}
+
 func collectDeltaTexts(v interface{}) []string {
 	switch value := v.(type) {
 	case string:
@@ -99,3 +133,15 @@ func collectDeltaTexts(v interface{}) []string {
 	}
 	return nil
 }
+
+// streamPrint writes streamed output to the output callback of the request,
+// or to the terminal when there is none.
+func streamPrint(ctx context.Context, text string) {
+	if ctx != nil {
+		if cb, ok := ctx.Value(contextOutputKey).(func(string)); ok && cb != nil {
+			cb(text)
+			return
+		}
+	}
+	fmt.Print(text)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 
 	"golang.org/x/term"
 
@@ -196,6 +198,9 @@ func runStdinMode(config *llm.Config, configOptions *ConfigOptions, args []strin
 		dataURI := fmt.Sprintf("data:%s;base64,%s", mimeType, encoded)
 		images = append(images, dataURI)
 		fmt.Fprintf(os.Stderr, "Attaching image: %s (%d bytes)\n", config.ImagePath, len(imageData))
+		if caps, ok := llm.LookupModelCapabilities(config.PROVIDER, config.Model); ok && !caps.Vision {
+			fmt.Fprintf(os.Stderr, "Warning: model %s does not support images\n", config.Model)
+		}
 	}
 
 	// Send to LLM with streaming based on config (for stdin mode)
@@ -209,6 +214,12 @@ func runStdinMode(config *llm.Config, configOptions *ConfigOptions, args []strin
 	// Previously, stdin mode always passed false for streaming, ignoring user's --llm.stream setting
 	streamEnabled := configOptions.GetBool("llm.stream") && !config.NoStream
 
+	// Structured output is validated before printing, so it is not streamed
+	retries := schemaRetries(configOptions)
+	if config.Schema != nil && retries >= 0 {
+		streamEnabled = false
+	}
+
 	// Apply TPS setting from ui.stats to config for stdin mode
 	// This ensures TPS stats are displayed when user requests them via -c ui.stats=true
 	config.ShowTPS = configOptions.GetBool("ui.stats")
@@ -218,11 +229,33 @@ func runStdinMode(config *llm.Config, configOptions *ConfigOptions, args []strin
 		fail("REPL error: %v\n", err)
 	}
 
+	if config.Schema != nil && retries >= 0 {
+		var errs []string
+		res, errs, err = client.EnforceSchema(messages, res, retries, func(attempt int, errs []string) {
+			fmt.Fprintf(os.Stderr, "Schema validation failed (%d errors), repairing (%d/%d)...\n", len(errs), attempt, retries)
+		})
+		if err != nil {
+			fail("REPL error: %v\n", err)
+		}
+		if len(errs) > 0 {
+			fmt.Println(res)
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "Schema error: %s\n", e)
+			}
+			repl.cleanup()
+			os.Exit(exitSchemaInvalid)
+		}
+	}
+
 	if !streamEnabled {
 		fmt.Println(res)
 	}
 }
 
+// exitSchemaInvalid is the stdin mode exit status when the reply still
+// does not match llm.schema after all repair attempts
+const exitSchemaInvalid = 2
+
 // runEmbedMode handles embedding text and outputting vectors
 func runEmbedMode(config *llm.Config, configOptions *ConfigOptions, input string) {
 	// Apply config options for embed task
@@ -393,6 +426,7 @@ Files:
 ./share/mai/prompts                   : directory containing system prompts
 ~/.config/mai/apikeys.txt             : API keys configuration file (provider=key format)
 ~/.config/mai/openai_auth.json        : OpenAI Auth0 token cache used by /auth
+~/.config/mai/models.json             : model capability overrides ({"pattern": {"vision": true, "context": 32768}})
 `)
 }
 
@@ -405,6 +439,30 @@ func applyConfigOptionsToLLMConfig(config *llm.Config, opts *ConfigOptions) {
 	applyConfigOptionsToLLMConfigForTask(config, opts, "")
 }
 
+// reasoningEffortOptionSet reports whether the user chose a reasoning
+// effort through any of the options that set it
+func reasoningEffortOptionSet(opts *ConfigOptions) bool {
+	for _, key := range []string{"think.reason", "think.effort", "llm.reason", "llm.effort", "ai.reason", "ai.effort", "llm.think"} {
+		if opts.IsSet(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// warnedReasoningModels remembers the models already warned about, since
+// the config is rebuilt for every request
+var warnedReasoningModels sync.Map
+
+// warnUnsupportedReasoning warns once per model that the capability table
+// says it does not reason but an effort was set anyway
+func warnUnsupportedReasoning(model, effort string) {
+	if _, warned := warnedReasoningModels.LoadOrStore(model+"\x00"+effort, true); warned {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: model %s is not known to support reasoning, sending effort %s anyway\n", model, effort)
+}
+
 // applyConfigOptionsToLLMConfigForTask maps relevant ConfigOptions into the llm.Config for a specific task
 func applyConfigOptionsToLLMConfigForTask(config *llm.Config, opts *ConfigOptions, task string) {
 	if opts == nil {
@@ -499,6 +557,9 @@ func applyConfigOptionsToLLMConfigForTask(config *llm.Config, opts *ConfigOption
 	if opts.Get("ai.deterministic") != "" {
 		config.Deterministic = opts.GetBool("ai.deterministic")
 	}
+	if opts.Get("llm.cache") != "" {
+		config.NoPromptCache = !opts.GetBool("llm.cache")
+	}
 	if opts.Get("llm.rawmode") != "" {
 		config.Rawdog = opts.GetBool("llm.rawmode")
 	}
@@ -536,6 +597,22 @@ func applyConfigOptionsToLLMConfigForTask(config *llm.Config, opts *ConfigOption
 		}
 	}
 
+	// Models without reasoning support reject effort settings, so a default
+	// effort falls back to auto. An effort chosen by the user is kept, since
+	// the capability table may be out of date
+	if caps, ok := llm.LookupModelCapabilities(config.PROVIDER, config.Model); ok && !caps.Reasoning && config.ReasoningEffort != "" && config.ReasoningEffort != "none" {
+		if reasoningEffortOptionSet(opts) {
+			warnUnsupportedReasoning(config.Model, config.ReasoningEffort)
+		} else {
+			config.ReasoningEffort = ""
+		}
+	}
+	if opts.IsSet("llm.maxtokens") {
+		if num, err := opts.GetNumber("llm.maxtokens"); err == nil && num > 0 {
+			config.MaxTokens = int(num)
+		}
+	}
+
 	// Whether to hide internal <think> regions from user-visible output.
 	if opts.IsSet("think.show") {
 		config.ThinkHide = !opts.GetBool("think.show")
@@ -582,8 +659,12 @@ func applyConfigOptionsToLLMConfigForTask(config *llm.Config, opts *ConfigOption
 	if v := opts.Get("mcp.use"); v != "" {
 		config.UseMCP = opts.GetBool("mcp.use")
 	}
-	if v := opts.Get("mcp.native"); v != "" {
+	caps, knownCaps := llm.LookupModelCapabilities(config.PROVIDER, config.Model)
+	if opts.IsSet("mcp.native") {
 		config.MCPNative = opts.GetBool("mcp.native")
+	} else if knownCaps && config.UseMCP {
+		// Prefer native tool calling when both the model and provider support it
+		config.MCPNative = caps.Tools && llm.SupportsNativeTools(config.PROVIDER)
 	}
 	if v := opts.Get("mcp.grammar"); v == "" {
 		config.MCPGrammar = true
@@ -1001,6 +1082,10 @@ func main() {
 
 		// TODO: use MAI_COLORS ?
 		if err := repl.Run(); err != nil {
+			var exitErr *scriptExitError
+			if errors.As(err, &exitErr) {
+				os.Exit(exitErr.code)
+			}
 			fmt.Fprintf(os.Stderr, "REPL error: %v\n", err)
 			os.Exit(1)
 		}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/trufae/mai/src/repl/llm"
+)
+
+// currentModelCapabilities returns the capabilities of the active model.
+func (r *REPL) currentModelCapabilities() (string, llm.ModelCapabilities, bool) {
+	cfg := r.buildLLMConfig()
+	caps, ok := llm.LookupModelCapabilities(cfg.PROVIDER, cfg.Model)
+	return cfg.Model, caps, ok
+}
+
+// imageCapabilityWarning returns a warning when the active model is known
+// to accept only text, or an empty string otherwise.
+func (r *REPL) imageCapabilityWarning() string {
+	model, caps, ok := r.currentModelCapabilities()
+	if !ok || caps.Vision {
+		return ""
+	}
+	return fmt.Sprintf("Warning: model %s does not support images, the attachment will be ignored or rejected\r\n", model)
+}
+
+// handleModelsCommand implements /models [info [model]]
+func (r *REPL) handleModelsCommand(args []string) (string, error) {
+	if len(args) < 2 {
+		return r.listModels()
+	}
+	switch args[1] {
+	case "info":
+		cfg := r.buildLLMConfig()
+		model := cfg.Model
+		if len(args) > 2 {
+			model = args[2]
+		}
+		return r.modelInfo(cfg.PROVIDER, model), nil
+	case "file":
+		return fmt.Sprintf("%s\r\n", llm.ModelsFilePath()), nil
+	case "help":
+	default:
+		return "", fmt.Errorf("unknown /models subcommand: %s", args[1])
+	}
+	return "Usage: /models [info [model]|file|help]\r\n" +
+		"  /models              list models of the current provider with their capabilities\r\n" +
+		"  /models info [model] show the capabilities of the current (or given) model\r\n" +
+		"  /models file         show the path of the capability overrides file\r\n", nil
+}
+
+// modelInfo describes the capabilities of a model.
+func (r *REPL) modelInfo(provider, model string) string {
+	var out strings.Builder
+	caps, ok := llm.LookupModelCapabilities(provider, model)
+	fmt.Fprintf(&out, "Model: %s (%s)\r\n", model, provider)
+	if err := llm.ModelOverridesError(); err != nil {
+		fmt.Fprintf(&out, "Warning: %v\r\n", err)
+	}
+	if !ok {
+		fmt.Fprintf(&out, "No capability information, add an entry to %s\r\n", llm.ModelsFilePath())
+		return out.String()
+	}
+	yesNo := func(v bool) string {
+		if v {
+			return "yes"
+		}
+		return "no"
+	}
+	limit := func(n int) string {
+		if n == 0 {
+			return "unknown"
+		}
+		return fmt.Sprintf("%d tokens", n)
+	}
+	fmt.Fprintf(&out, "  vision:     %s\r\n", yesNo(caps.Vision))
+	fmt.Fprintf(&out, "  tools:      %s\r\n", yesNo(caps.Tools))
+	fmt.Fprintf(&out, "  reasoning:  %s\r\n", yesNo(caps.Reasoning))
+	fmt.Fprintf(&out, "  json:       %s\r\n", yesNo(caps.JSONMode))
+	fmt.Fprintf(&out, "  context:    %s\r\n", limit(caps.ContextWindow))
+	fmt.Fprintf(&out, "  max output: %s\r\n", limit(caps.MaxOutput))
+	return out.String()
+}
@@ -52,6 +52,7 @@ type ReadLine struct {
 	bgLineColor    string // Background color for the line before the prompt
 	fgPromptColor  string // Foreground color for the prompt text
 	bgPromptColor  string // Background color for the prompt text
+	reading        bool   // Whether Read is waiting for input (used by Notify)
 }
 
 // NewReadLine creates a new ReadLine instance
@@ -376,6 +377,14 @@ func (r *ReadLine) Interrupted() {
 
 // Read reads a line of input with proper cursor movement and scrolling
 func (r *ReadLine) Read() (string, error) {
+	r.mu.Lock()
+	r.reading = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.reading = false
+		r.mu.Unlock()
+	}()
 	r.prompt = r.defaultPrompt
 	r.lastInputRaw = false
 	r.Restore()
@@ -909,6 +918,20 @@ func (r *ReadLine) SetCursorPos(pos int) {
 	r.refreshLine()
 }
 
+// Notify prints an asynchronous message (e.g. a finished background job)
+// above the input line. When a line is being edited the prompt and the
+// current buffer are redrawn below the message.
+func (r *ReadLine) Notify(msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.reading {
+		fmt.Printf("\r%s\r\n", msg)
+		return
+	}
+	fmt.Printf("\r\033[2K%s\r\n", msg)
+	r.refreshLine()
+}
+
 // SetInterruptFunc sets the function to be called when Ctrl+C is pressed
 func (r *ReadLine) SetInterruptFunc(fn func()) {
 	r.interruptFunc = fn
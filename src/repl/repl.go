@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -23,6 +24,7 @@ import (
 
 	"github.com/trufae/mai/src/repl/art"
 	"github.com/trufae/mai/src/repl/llm"
+	wmcplib "mai/src/wmcp/lib"
 )
 
 // parseShellArgs parses a string into shell-like arguments, handling quotes
@@ -307,9 +309,16 @@ func (r *REPL) handleMCPAdd(args []string) (string, error) {
 	rest := args[2:]
 
 	if isMCPURL(first) && len(rest) == 0 {
-		server.Type = "http"
-		if strings.HasSuffix(strings.TrimRight(first, "/"), "/sse") {
+		lower := strings.ToLower(first)
+		switch {
+		case strings.HasPrefix(lower, "ws://") || strings.HasPrefix(lower, "wss://"):
+			server.Type = "ws"
+		case strings.HasPrefix(lower, "unix://"):
+			server.Type = "unix"
+		case strings.HasSuffix(strings.TrimRight(first, "/"), "/sse"):
 			server.Type = "sse"
+		default:
+			server.Type = "http"
 		}
 		server.URL = first
 	} else {
@@ -346,7 +355,8 @@ func (r *REPL) handleMCPAdd(args []string) (string, error) {
 // HTTP/SSE transport.
 func isMCPURL(s string) bool {
 	s = strings.ToLower(strings.TrimSpace(s))
-	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") ||
+		strings.HasPrefix(s, "ws://") || strings.HasPrefix(s, "wss://") || strings.HasPrefix(s, "unix://")
 }
 
 // handleMCPDel removes an MCP server from the configuration
@@ -522,6 +532,8 @@ func (r *REPL) handleMCPStatus() (string, error) {
 		return output.String(), nil
 	}
 
+	health := r.mcpServerHealth()
+
 	// Check if there are any mai-wmcp processes running
 	hasRunningProcesses := false
 	if output2, err := exec.Command("pgrep", "-f", "mai-wmcp").Output(); err == nil && len(output2) > 0 {
@@ -548,12 +560,78 @@ func (r *REPL) handleMCPStatus() (string, error) {
 			enabled = "enabled"
 		}
 
-		fmt.Fprintf(&output, "%s: %s, %s%s\r\n", name, status, enabled, port)
+		fmt.Fprintf(&output, "%s: %s, %s%s%s\r\n", name, status, enabled, port, formatServerHealth(health, name))
+		delete(health, name)
+	}
+
+	// Servers proxied by mai-wmcp that are not in the config
+	names := make([]string, 0, len(health))
+	for name := range health {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&output, "%s: running%s\r\n", name, formatServerHealth(health, name))
 	}
 
 	return output.String(), nil
 }
 
+// mcpServerHealth collects the health of the servers of the embedded
+// service and of the running mai-wmcp processes, keyed by server name
+func (r *REPL) mcpServerHealth() map[string]wmcplib.ServerHealth {
+	health := make(map[string]wmcplib.ServerHealth)
+	for _, h := range embedServerHealth() {
+		health[h.Name] = h
+	}
+	if r.wmcpProcess != nil && r.wmcpPort != 0 {
+		for _, h := range fetchWMCPHealth(r.wmcpPort) {
+			health[h.Name] = h
+		}
+	}
+	// Each /mcp start process proxies a single server, named after its
+	// command, so report it under the config name
+	for name, process := range r.mcpProcesses {
+		if servers := fetchWMCPHealth(process.Port); len(servers) > 0 {
+			servers[0].Name = name
+			health[name] = servers[0]
+		}
+	}
+	return health
+}
+
+// fetchWMCPHealth queries the /status/json endpoint of a mai-wmcp process
+func fetchWMCPHealth(port int) []wmcplib.ServerHealth {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://localhost:%d/status/json", port))
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	var status struct {
+		Servers []wmcplib.ServerHealth `json:"servers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil
+	}
+	return status.Servers
+}
+
+// formatServerHealth renders the health of a server as a status suffix
+func formatServerHealth(health map[string]wmcplib.ServerHealth, name string) string {
+	h, ok := health[name]
+	if !ok {
+		return ""
+	}
+	if h.State != wmcplib.ServerDegraded {
+		return ", " + string(h.State)
+	}
+	return fmt.Sprintf(", %s after %d failures (last error: %s)", h.State, h.Failures, h.LastError)
+}
+
 // handleMCPEdit opens the MCP config file for editing
 func (r *REPL) handleMCPEdit() (string, error) {
 	configPath, err := getMCPSConfigPath()
@@ -829,7 +907,8 @@ func (r *REPL) getVDBContext(message string) (string, error) {
 	return string(output), nil
 }
 
-// handleScriptCommand executes a script file containing REPL commands
+// handleScriptCommand executes a script file containing REPL commands and
+// the control flow statements described in script.go
 func (r *REPL) handleScriptCommand(scriptPath string) error {
 	// Expand ~ to home directory
 	if strings.HasPrefix(scriptPath, "~") {
@@ -839,29 +918,7 @@ func (r *REPL) handleScriptCommand(scriptPath string) error {
 		}
 		scriptPath = filepath.Join(homeDir, scriptPath[1:])
 	}
-
-	// Read the script file
-	content, err := os.ReadFile(scriptPath)
-	if err != nil {
-		return fmt.Errorf("failed to read script file: %v", err)
-	}
-
-	// Split into lines and execute each command
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue // Skip empty lines and comments
-		}
-
-		fmt.Printf("> %s\n", line)
-		err := r.handleCommand(line, "", "")
-		if err != nil {
-			return fmt.Errorf("error executing command '%s': %v", line, err)
-		}
-	}
-
-	return nil
+	return r.runScriptFile(scriptPath)
 }
 
 func (r *REPL) substituteInput(input string) (string, error) {
@@ -962,6 +1019,7 @@ func (r *REPL) sendToAI(input string, redirectType string, redirectTarget string
 
 	r.mu.Lock()
 	r.isStreaming = redirectType == ""
+	r.lastTurnStart = time.Now()
 	r.mu.Unlock()
 
 	defer func() {
@@ -1007,13 +1065,14 @@ func (r *REPL) sendToAI(input string, redirectType string, redirectTarget string
 		}
 	}
 
-	// Add user details if enabled
+	messages = r.appendMemoryContext(messages)
+
+	// Add user details if enabled. They include the current time, so keep
+	// them after the stable context to let providers cache that prefix.
 	if userDetails := r.buildUserDetails(); userDetails != "" {
 		messages = append(messages, llm.Message{Role: "system", Content: "USER CONTEXT:\n" + userDetails})
 	}
 
-	messages = r.appendMemoryContext(messages)
-
 	var vdbContext string
 	var vdbErr error
 	// If vdb option is enabled, get context from vector database and include as system context
@@ -1178,10 +1237,22 @@ func (r *REPL) sendToAI(input string, redirectType string, redirectTarget string
 		art.StopLoop()
 	}
 
+	// Validate structured output and let the model repair it when needed
+	if err == nil && response != "" {
+		if repaired, changed := r.enforceOutputSchema(client, messages, response); changed {
+			response = repaired
+			// The streamed reply was invalid, print the repaired one
+			streamEnabled = false
+		}
+	}
+
 	// Handle the assistant's response based on logging settings
 	if err == nil && response != "" {
 		// Handle redirection
 		switch redirectType {
+		case "capture":
+			// Keep the reply for the caller (script $(/ask ...) captures)
+			r.capturedReply = r.assistantMessageForLog(response).Content
 		case "file":
 			// Write response to file
 			err = os.WriteFile(redirectTarget, []byte(response), 0644)
@@ -1296,6 +1367,39 @@ func (r *REPL) sendToAI(input string, redirectType string, redirectTarget string
 	return err
 }
 
+// schemaRetries returns how many repair attempts are allowed for replies
+// that do not match the configured schema, or -1 when validation is off
+func schemaRetries(opts *ConfigOptions) int {
+	if !opts.GetBool("llm.schemacheck") {
+		return -1
+	}
+	n, err := opts.GetNumber("llm.schemaretries")
+	if err != nil || n < 0 {
+		return 0
+	}
+	return int(n)
+}
+
+// enforceOutputSchema validates a reply against the active schema and
+// re-prompts the model with the errors. It reports whether the reply
+// changed; remaining validation errors are printed as warnings.
+func (r *REPL) enforceOutputSchema(client *llm.LLMClient, messages []llm.Message, response string) (string, bool) {
+	retries := schemaRetries(&r.configOptions)
+	if client.Config.Schema == nil || retries < 0 {
+		return response, false
+	}
+	repaired, errs, err := client.EnforceSchema(messages, response, retries, func(attempt int, errs []string) {
+		fmt.Fprintf(os.Stderr, "\r\nSchema validation failed (%d errors), repairing (%d/%d)...\r\n", len(errs), attempt, retries)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Schema repair failed: %v\r\n", err)
+	}
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "Schema error: %s\r\n", e)
+	}
+	return repaired, repaired != response
+}
+
 // Legacy function kept for compatibility
 func (r *REPL) supportsStreaming() bool {
 	// Check if streaming mode is enabled in REPL
@@ -2195,6 +2299,9 @@ func (r *REPL) listModels() (string, error) {
 
 		// Display model with description if available
 		fmt.Fprintf(&output, "- %s%s", model.ID, current)
+		if caps, ok := llm.LookupModelCapabilities(model.Provider, model.ID); ok {
+			fmt.Fprintf(&output, " [%s]", caps.Summary())
+		}
 		if model.Description != "" {
 			fmt.Fprintf(&output, " - %s", model.Description)
 		}
@@ -97,6 +97,8 @@ func (r *REPL) initCommands() {
 	registerChatCommands(r)
 	registerExitCommands(r)
 	registerACPCommands(r)
+	registerJobCommands(r)
+	registerUndoCommands(r)
 
 	// Dot command: read one or more files and send their combined contents as a prompt
 	r.commands["."] = Command{
@@ -225,9 +227,9 @@ func (r *REPL) initCommands() {
 	// Only keep the models command for listing available models
 	r.commands["/models"] = Command{
 		Name:        "/models",
-		Description: "List available models",
+		Description: "List available models and their capabilities (info [model])",
 		Handler: func(r *REPL, args []string) (string, error) {
-			return r.listModels()
+			return r.handleModelsCommand(args)
 		},
 	}
 
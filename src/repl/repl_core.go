@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -346,7 +347,14 @@ func (r *REPL) Run() error {
 	// Execute initial command if provided
 	if r.initialCommand != "" {
 		if err := r.handleCommand(r.initialCommand, "", ""); err != nil {
-			fmt.Fprintf(os.Stderr, "Error executing initial command: %v\r\n", err)
+			var exitErr *scriptExitError
+			if errors.As(err, &exitErr) {
+				if r.quitAfterActions {
+					return err // propagate the script exit status
+				}
+			} else {
+				fmt.Fprintf(os.Stderr, "Error executing initial command: %v\r\n", err)
+			}
 			if r.quitAfterActions {
 				return nil // Exit if quit after actions is enabled
 			}
@@ -361,6 +369,13 @@ func (r *REPL) Run() error {
 			if err == io.EOF {
 				break
 			}
+			var exitErr *scriptExitError
+			if errors.As(err, &exitErr) {
+				if exitErr.code != 0 {
+					fmt.Fprintf(os.Stderr, "%v\r\n", err)
+				}
+				continue
+			}
 			// Don't exit the REPL loop for errors, just print them and continue
 			fmt.Fprintf(os.Stderr, "REPL error: %v\r\n", err)
 			continue
@@ -82,7 +82,7 @@ func (r *REPL) addImage(imagePath string) (string, error) {
 	r.addToHistory(fmt.Sprintf("/image %s", imagePath))
 	message := fmt.Sprintf("Image added: %s (%d bytes). Send a message to analyze it.\r\n",
 		filepath.Base(imagePath), len(imageData))
-	return message, nil
+	return message + r.imageCapabilityWarning(), nil
 }
 
 func (r *REPL) addFile(filePath string) (string, error) {
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"golang.org/x/term"
@@ -33,12 +32,12 @@ func registerHelpCommands(r *REPL) {
 	// Script command: execute a script file containing REPL commands
 	r.commands["/script"] = Command{
 		Name:        "/script",
-		Description: "Execute a script file containing REPL commands",
+		Description: "Execute a .mai script (REPL commands, let, if, for, func, exit)",
 		Handler: func(r *REPL, args []string) (string, error) {
 			if len(args) < 2 {
 				return "Usage: /script <path>\n\r", nil
 			}
-			return "", handleScriptCommand(r, args[1])
+			return "", r.handleScriptCommand(args[1])
 		},
 	}
 
@@ -93,37 +92,3 @@ func handleSlurpCommand(r *REPL) error {
 	// Send the input to the AI
 	return r.sendToAI(input, "", "", true, false)
 }
-
-func handleScriptCommand(r *REPL, scriptPath string) error {
-	// Expand ~ to home directory
-	if strings.HasPrefix(scriptPath, "~") {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return fmt.Errorf("failed to get home directory: %v", err)
-		}
-		scriptPath = filepath.Join(homeDir, scriptPath[1:])
-	}
-
-	// Read the script file
-	content, err := os.ReadFile(scriptPath)
-	if err != nil {
-		return fmt.Errorf("failed to read script file: %v", err)
-	}
-
-	// Split into lines and execute each command
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue // Skip empty lines and comments
-		}
-
-		fmt.Printf("> %s\n", line)
-		err := r.handleCommand(line, "", "")
-		if err != nil {
-			return fmt.Errorf("error executing command '%s': %v", line, err)
-		}
-	}
-
-	return nil
-}
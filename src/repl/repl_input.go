@@ -82,6 +82,10 @@ func (r *REPL) handleInput() error {
 		// Add to history
 		r.addToHistory(input)
 		err = r.handleShellInput(input[1:])
+	} else if prompt, background := splitBackgroundSuffix(input); background && !isVerbatim && redirectType == "" {
+		// Add to history
+		r.addToHistory(input)
+		err = r.startPromptJob(prompt)
 	} else {
 		// Add to history
 		r.addToHistory(input)
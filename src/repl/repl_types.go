@@ -57,6 +57,8 @@ type REPL struct {
 	mcpProcesses     map[string]*MCPProcess // Track individual MCP processes
 	mcpConfig        *MCPConfig             // Current MCP configuration
 	lastSigInt       time.Time              // timestamp of last idle-prompt SIGINT, used for double-^C exit
+	capturedReply    string                 // last reply of a "capture" redirect, read by scripts
+	lastTurnStart    time.Time              // start of the last assistant turn, the edits /undo-edits reverts
 }
 
 type pendingFile struct {
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	wmcplib "mai/src/wmcp/lib"
+)
+
+// restoreCheckpointTool is the tool of the MCP servers keeping checkpoints
+// of the files they modify, like pancode
+const restoreCheckpointTool = "restore_checkpoint"
+
+// registerUndoCommands registers the commands reverting the edits of tools
+func registerUndoCommands(r *REPL) {
+	r.commands["/undo-edits"] = Command{
+		Name:        "/undo-edits",
+		Description: "Revert the files modified by tools during the last assistant turn",
+		Handler: func(r *REPL, args []string) (string, error) {
+			return r.handleUndoEdits()
+		},
+	}
+}
+
+// handleUndoEdits asks every server keeping checkpoints to restore the
+// files modified since the last turn started
+func (r *REPL) handleUndoEdits() (string, error) {
+	r.mu.Lock()
+	since := r.lastTurnStart
+	r.mu.Unlock()
+	if since.IsZero() {
+		return "No assistant turn to undo\r\n", nil
+	}
+
+	tools := []string{restoreCheckpointTool}
+	if replEmbedActive(r) {
+		svc, err := embedGetService(r)
+		if err != nil {
+			return "", fmt.Errorf("embed transport: %v", err)
+		}
+		tools = nil
+		names, servers := svc.SnapshotServers()
+		for _, name := range names {
+			server := servers[name]
+			server.Mutex.RLock()
+			for _, tool := range server.Tools {
+				if tool.Name == restoreCheckpointTool {
+					tools = append(tools, name+wmcplib.AggregatedNameSeparator+tool.Name)
+				}
+			}
+			server.Mutex.RUnlock()
+		}
+		if len(tools) == 0 {
+			return "No MCP server keeps checkpoints of the edits\r\n", nil
+		}
+	}
+
+	arg := "since=" + since.UTC().Format(time.RFC3339Nano)
+	var output strings.Builder
+	restored := 0
+	for _, name := range tools {
+		result, err := callTool(&Tool{Name: name, Args: []string{arg}}, false, "", 60)
+		if err != nil {
+			output.WriteString(fmt.Sprintf("%s: %v\r\n", name, err))
+			continue
+		}
+		var res struct {
+			Files []string `json:"files"`
+		}
+		if err := json.Unmarshal([]byte(result), &res); err != nil {
+			output.WriteString(strings.TrimSpace(result) + "\r\n")
+			continue
+		}
+		for _, file := range res.Files {
+			output.WriteString("Restored " + file + "\r\n")
+		}
+		restored += len(res.Files)
+	}
+	if restored == 0 && output.Len() == 0 {
+		output.WriteString("No files were modified during the last turn\r\n")
+	}
+
+	// Undoing twice would revert the restore itself
+	r.mu.Lock()
+	r.lastTurnStart = time.Time{}
+	r.mu.Unlock()
+	return output.String(), nil
+}
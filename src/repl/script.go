@@ -0,0 +1,703 @@
+package main
+
+// Script language for .mai files run with /script.
+//
+// Scripts are line based. Every line that is not a statement is executed
+// like REPL input: '/cmd' runs a command, '!cmd' a shell command and any
+// other text is sent to the model as a prompt. On top of that:
+//
+//	# comment
+//	let name = value             assign a variable ("..." interpolates, '...' is literal)
+//	echo text                    print text
+//	if cond / elif cond / else / end
+//	for name in value            iterate over the non-empty lines of value
+//	for name in files <glob>     iterate over the files matching a glob
+//	func name ... end            define a function, called as 'name arg1 arg2'
+//	break, continue, return [N], exit [N]
+//
+// Values expand $name and ${name} (falling back to the environment), $?
+// (last exit status), $1..$9, $@ and $# inside functions, and $(...)
+// captures: $(/ask prompt) is the assistant reply, $(/cmd) the command
+// output and $(cmd) or $(!cmd) the stdout of a shell command.
+//
+// Conditions are 'a == b', 'a != b', 'a =~ regex', 'a !~ regex',
+// 'ok <line>' (line exits with status 0), 'exists <path>', 'empty <value>',
+// 'not <cond>' or a single value that is true unless empty, "0" or "false".
+//
+// Errors are reported as file:line and abort the script.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// scriptExitError is returned when a script runs 'exit N'
+type scriptExitError struct {
+	code int
+}
+
+func (e *scriptExitError) Error() string {
+	return fmt.Sprintf("script exited with status %d", e.code)
+}
+
+// scriptReturn, errScriptBreak and errScriptContinue unwind the block
+// stack up to the enclosing function or loop; the parser rejects them
+// where they have no target
+type scriptReturn struct {
+	code int
+}
+
+func (e *scriptReturn) Error() string { return fmt.Sprintf("return %d", e.code) }
+
+var (
+	errScriptBreak    = errors.New("break")
+	errScriptContinue = errors.New("continue")
+)
+
+// scriptLineError decorates an error with the script location
+type scriptLineError struct {
+	file string
+	line int
+	err  error
+}
+
+func (e *scriptLineError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.file, e.line, e.err)
+}
+
+func (e *scriptLineError) Unwrap() error { return e.err }
+
+type scriptNode struct {
+	line     int
+	kind     string // cmd, let, echo, if, for, files, func, break, continue, return, exit
+	name     string // variable or function name
+	text     string // command line, value, condition or iterable
+	body     []*scriptNode
+	elseBody []*scriptNode
+}
+
+var scriptIdentRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type scriptParser struct {
+	file  string
+	lines []string
+	pos   int
+	loops int // depth of the enclosing for loops
+	funcs map[string]*scriptNode
+}
+
+func (p *scriptParser) errorf(line int, format string, args ...interface{}) error {
+	return &scriptLineError{file: p.file, line: line, err: fmt.Errorf(format, args...)}
+}
+
+// parseBlock parses statements until one of the terminators is found and
+// returns the statements and the terminating keyword line
+func (p *scriptParser) parseBlock(inFunc bool, terminators ...string) ([]*scriptNode, string, error) {
+	var nodes []*scriptNode
+	for p.pos < len(p.lines) {
+		lineno := p.pos + 1
+		line := strings.TrimSpace(p.lines[p.pos])
+		p.pos++
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keyword, rest := splitScriptKeyword(line)
+		for _, t := range terminators {
+			if keyword == t {
+				return nodes, line, nil
+			}
+		}
+		node := &scriptNode{line: lineno, kind: "cmd", text: line}
+		switch keyword {
+		case "end", "else", "elif":
+			return nil, "", p.errorf(lineno, "unexpected '%s'", keyword)
+		case "let":
+			name, value, ok := strings.Cut(rest, "=")
+			name = strings.TrimSpace(name)
+			if !ok || !scriptIdentRegex.MatchString(name) {
+				return nil, "", p.errorf(lineno, "syntax: let <name> = <value>")
+			}
+			node.kind, node.name, node.text = "let", name, strings.TrimSpace(value)
+		case "echo":
+			node.kind, node.text = "echo", rest
+		case "if":
+			if err := p.parseIf(node, rest, inFunc); err != nil {
+				return nil, "", err
+			}
+		case "for":
+			fields := strings.Fields(rest)
+			if len(fields) < 3 || fields[1] != "in" || !scriptIdentRegex.MatchString(fields[0]) {
+				return nil, "", p.errorf(lineno, "syntax: for <name> in <value>")
+			}
+			node.kind, node.name = "for", fields[0]
+			node.text = strings.TrimSpace(strings.SplitN(rest, " in ", 2)[1])
+			if fields[2] == "files" {
+				node.kind = "files"
+				node.text = strings.TrimSpace(strings.TrimPrefix(node.text, "files"))
+			}
+			p.loops++
+			body, _, err := p.parseBody(lineno, inFunc, "end")
+			p.loops--
+			if err != nil {
+				return nil, "", err
+			}
+			node.body = body
+		case "func":
+			if inFunc {
+				return nil, "", p.errorf(lineno, "nested function definitions are not supported")
+			}
+			if !scriptIdentRegex.MatchString(rest) {
+				return nil, "", p.errorf(lineno, "syntax: func <name>")
+			}
+			loops := p.loops
+			p.loops = 0
+			body, _, err := p.parseBody(lineno, true, "end")
+			p.loops = loops
+			if err != nil {
+				return nil, "", err
+			}
+			node.kind, node.name, node.body = "func", rest, body
+			p.funcs[rest] = node
+			continue
+		case "break", "continue":
+			if p.loops == 0 {
+				return nil, "", p.errorf(lineno, "%s outside of a loop", keyword)
+			}
+			node.kind = keyword
+		case "return":
+			if !inFunc {
+				return nil, "", p.errorf(lineno, "return outside of a function")
+			}
+			node.kind, node.text = "return", rest
+		case "exit":
+			node.kind, node.text = "exit", rest
+		}
+		nodes = append(nodes, node)
+	}
+	if len(terminators) > 0 {
+		return nil, "", fmt.Errorf("missing '%s'", terminators[0])
+	}
+	return nodes, "", nil
+}
+
+// parseBody parses a block opened at the given line, reporting unterminated
+// blocks at the opening line
+func (p *scriptParser) parseBody(open int, inFunc bool, terminators ...string) ([]*scriptNode, string, error) {
+	nodes, term, err := p.parseBlock(inFunc, terminators...)
+	if err != nil {
+		var lineErr *scriptLineError
+		if !errors.As(err, &lineErr) {
+			err = p.errorf(open, "%v", err)
+		}
+		return nil, "", err
+	}
+	return nodes, term, nil
+}
+
+func (p *scriptParser) parseIf(node *scriptNode, cond string, inFunc bool) error {
+	if cond == "" {
+		return p.errorf(node.line, "syntax: if <condition>")
+	}
+	node.kind, node.text = "if", cond
+	body, term, err := p.parseBody(node.line, inFunc, "end", "else", "elif")
+	if err != nil {
+		return err
+	}
+	node.body = body
+	keyword, rest := splitScriptKeyword(term)
+	switch keyword {
+	case "else":
+		node.elseBody, _, err = p.parseBody(node.line, inFunc, "end")
+	case "elif":
+		// elif is an if nested in the else branch sharing the same 'end'
+		elif := &scriptNode{line: p.pos}
+		err = p.parseIf(elif, rest, inFunc)
+		node.elseBody = []*scriptNode{elif}
+	}
+	return err
+}
+
+func splitScriptKeyword(line string) (string, string) {
+	keyword, rest, _ := strings.Cut(line, " ")
+	return keyword, strings.TrimSpace(rest)
+}
+
+// scriptRunner holds the state of a running script
+type scriptRunner struct {
+	r      *REPL
+	file   string
+	vars   map[string]string
+	funcs  map[string]*scriptNode
+	args   [][]string // argument frames of the active function calls
+	status int        // exit status of the last statement ($?)
+}
+
+// runScriptFile parses and runs a .mai script
+func (r *REPL) runScriptFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read script file: %v", err)
+	}
+	p := &scriptParser{
+		file:  path,
+		lines: strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n"),
+		funcs: map[string]*scriptNode{},
+	}
+	nodes, _, err := p.parseBlock(false)
+	if err != nil {
+		return err
+	}
+	s := &scriptRunner{r: r, file: path, vars: map[string]string{}, funcs: p.funcs}
+	return s.runBlock(nodes)
+}
+
+func (s *scriptRunner) errorAt(line int, err error) error {
+	var lineErr *scriptLineError
+	var exitErr *scriptExitError
+	var ret *scriptReturn
+	if errors.As(err, &lineErr) || errors.As(err, &exitErr) || errors.As(err, &ret) ||
+		errors.Is(err, errScriptBreak) || errors.Is(err, errScriptContinue) {
+		return err
+	}
+	return &scriptLineError{file: s.file, line: line, err: err}
+}
+
+func (s *scriptRunner) runBlock(nodes []*scriptNode) error {
+	for _, node := range nodes {
+		if err := s.runNode(node); err != nil {
+			return s.errorAt(node.line, err)
+		}
+	}
+	return nil
+}
+
+func (s *scriptRunner) runNode(node *scriptNode) error {
+	switch node.kind {
+	case "let":
+		value, err := s.value(node.text)
+		if err != nil {
+			return err
+		}
+		s.vars[node.name] = value
+	case "echo":
+		text, err := s.value(node.text)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\r\n", strings.ReplaceAll(text, "\n", "\r\n"))
+	case "if":
+		ok, err := s.cond(node.text)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return s.runBlock(node.body)
+		}
+		return s.runBlock(node.elseBody)
+	case "for", "files":
+		items, err := s.items(node)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			s.vars[node.name] = item
+			err := s.runBlock(node.body)
+			if errors.Is(err, errScriptBreak) {
+				break
+			}
+			if err != nil && !errors.Is(err, errScriptContinue) {
+				return err
+			}
+		}
+	case "break":
+		return errScriptBreak
+	case "continue":
+		return errScriptContinue
+	case "return", "exit":
+		code := s.status
+		if node.text != "" {
+			text, err := s.value(node.text)
+			if err != nil {
+				return err
+			}
+			if code, err = strconv.Atoi(text); err != nil {
+				return fmt.Errorf("invalid %s status: %s", node.kind, text)
+			}
+		}
+		if node.kind == "return" {
+			return &scriptReturn{code: code}
+		}
+		return &scriptExitError{code: code}
+	default:
+		status, err := s.exec(node.text)
+		s.status = status
+		return err
+	}
+	return nil
+}
+
+func (s *scriptRunner) items(node *scriptNode) ([]string, error) {
+	value, err := s.value(node.text)
+	if err != nil {
+		return nil, err
+	}
+	if node.kind == "files" {
+		matches, err := filepath.Glob(value)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		return matches, nil
+	}
+	var items []string
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, line)
+		}
+	}
+	return items, nil
+}
+
+// exec runs a line as REPL input or function call and returns its status
+func (s *scriptRunner) exec(line string) (int, error) {
+	name, rest := splitScriptKeyword(line)
+	if fn, ok := s.funcs[name]; ok {
+		return s.call(fn, rest)
+	}
+	line, err := s.expand(line)
+	if err != nil {
+		return 1, err
+	}
+	r := s.r
+	switch {
+	case strings.HasPrefix(line, "!"):
+		err := r.executeShellCommand(line[1:])
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		if err != nil {
+			return 1, err
+		}
+		return 0, nil
+	case strings.HasPrefix(line, "/ask ") || line == "/ask":
+		fmt.Printf("> %s\n", line)
+		return s.ask(strings.TrimSpace(strings.TrimPrefix(line, "/ask")), "")
+	case strings.HasPrefix(line, "/"):
+		fmt.Printf("> %s\n", line)
+		if err := r.handleCommand(line, "", ""); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	default:
+		fmt.Printf("> %s\n", line)
+		return s.ask(line, "")
+	}
+}
+
+// ask sends a prompt to the model; captured replies are not printed
+func (s *scriptRunner) ask(prompt, redirectType string) (int, error) {
+	if prompt == "" {
+		return 1, fmt.Errorf("empty prompt")
+	}
+	s.r.capturedReply = ""
+	if err := s.r.sendToAI(prompt, redirectType, "", false, redirectType != ""); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+func (s *scriptRunner) call(fn *scriptNode, argline string) (int, error) {
+	var args []string
+	for _, arg := range parseShellArgs(argline) {
+		value, err := s.expand(arg)
+		if err != nil {
+			return 1, err
+		}
+		args = append(args, value)
+	}
+	s.args = append(s.args, args)
+	defer func() { s.args = s.args[:len(s.args)-1] }()
+
+	err := s.runBlock(fn.body)
+	var ret *scriptReturn
+	switch {
+	case errors.As(err, &ret):
+		return ret.code, nil
+	case err != nil:
+		return 1, err
+	}
+	return s.status, nil
+}
+
+// capture evaluates the contents of a $(...) expression
+func (s *scriptRunner) capture(inner string) (string, error) {
+	inner, err := s.expand(strings.TrimSpace(inner))
+	if err != nil {
+		return "", err
+	}
+	r := s.r
+	switch {
+	case strings.HasPrefix(inner, "/ask ") || inner == "/ask":
+		status, err := s.ask(strings.TrimSpace(strings.TrimPrefix(inner, "/ask")), "capture")
+		s.status = status
+		return strings.TrimSpace(r.capturedReply), err
+	case strings.HasPrefix(inner, "/"):
+		parts := strings.Fields(inner)
+		cmd, ok := r.commands[parts[0]]
+		if !ok {
+			s.status = 1
+			return "", fmt.Errorf("unknown command: %s", parts[0])
+		}
+		output, err := cmd.Handler(r, parts)
+		if err != nil {
+			s.status = 1
+			return "", err
+		}
+		s.status = 0
+		return strings.TrimRight(strings.ReplaceAll(output, "\r\n", "\n"), "\n"), nil
+	default:
+		cmd := exec.Command("sh", "-c", strings.TrimPrefix(inner, "!"))
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(err, &exitErr):
+			s.status = exitErr.ExitCode()
+		case err != nil:
+			s.status = 1
+			return "", err
+		default:
+			s.status = 0
+		}
+		return strings.TrimRight(string(out), "\n"), nil
+	}
+}
+
+// value expands a statement argument honoring "..." and '...' quoting
+func (s *scriptRunner) value(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if len(text) >= 2 {
+		switch {
+		case text[0] == '\'' && text[len(text)-1] == '\'':
+			return text[1 : len(text)-1], nil
+		case text[0] == '"' && text[len(text)-1] == '"':
+			text = text[1 : len(text)-1]
+		}
+	}
+	return s.expand(text)
+}
+
+func (s *scriptRunner) lookup(name string) (string, bool) {
+	if len(s.args) > 0 {
+		args := s.args[len(s.args)-1]
+		switch name {
+		case "@":
+			return strings.Join(args, " "), true
+		case "#":
+			return strconv.Itoa(len(args)), true
+		}
+		if n, err := strconv.Atoi(name); err == nil && n > 0 {
+			if n <= len(args) {
+				return args[n-1], true
+			}
+			return "", true
+		}
+	}
+	if name == "?" {
+		return strconv.Itoa(s.status), true
+	}
+	if v, ok := s.vars[name]; ok {
+		return v, true
+	}
+	return "", false
+}
+
+// expand replaces variables and $(...) captures in text
+func (s *scriptRunner) expand(text string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c == '\\' && i+1 < len(text) && text[i+1] == '$' {
+			out.WriteByte('$')
+			i++
+			continue
+		}
+		if c != '$' || i+1 >= len(text) {
+			out.WriteByte(c)
+			continue
+		}
+		next := text[i+1]
+		switch {
+		case next == '(':
+			end := matchingParen(text, i+1)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated $(")
+			}
+			value, err := s.capture(text[i+2 : end])
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(value)
+			i = end
+		case next == '{':
+			end := strings.IndexByte(text[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${")
+			}
+			name := text[i+2 : i+end]
+			value, ok := s.lookup(name)
+			if !ok {
+				if value, ok = os.LookupEnv(name); !ok {
+					return "", fmt.Errorf("undefined variable: %s", name)
+				}
+			}
+			out.WriteString(value)
+			i += end
+		case next == '?' || next == '@' || next == '#' || (next >= '1' && next <= '9'):
+			value, ok := s.lookup(string(next))
+			if !ok {
+				out.WriteByte(c)
+				continue
+			}
+			out.WriteString(value)
+			i++
+		default:
+			j := i + 1
+			for j < len(text) && (text[j] == '_' || (text[j] >= 'a' && text[j] <= 'z') ||
+				(text[j] >= 'A' && text[j] <= 'Z') || (j > i+1 && text[j] >= '0' && text[j] <= '9')) {
+				j++
+			}
+			value, ok := s.lookup(text[i+1 : j])
+			if j == i+1 || !ok {
+				// Unknown names are kept verbatim so prompts can mention $things
+				out.WriteByte(c)
+				continue
+			}
+			out.WriteString(value)
+			i = j - 1
+		}
+	}
+	return out.String(), nil
+}
+
+// matchingParen returns the index of the ')' closing the '(' at open
+func matchingParen(text string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+var scriptCondOps = []string{"==", "!=", "=~", "!~"}
+
+// splitCondition finds a comparison operator outside quotes and captures
+func splitCondition(cond string) (string, string, string, bool) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(cond); i++ {
+		c := cond[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '"' || c == '\'':
+			quote = c
+			continue
+		case c == '(':
+			depth++
+			continue
+		case c == ')':
+			depth--
+			continue
+		}
+		if depth > 0 || c != ' ' {
+			continue
+		}
+		for _, op := range scriptCondOps {
+			if strings.HasPrefix(cond[i+1:], op+" ") {
+				return cond[:i], op, cond[i+len(op)+2:], true
+			}
+		}
+	}
+	return "", "", "", false
+}
+
+func (s *scriptRunner) cond(cond string) (bool, error) {
+	keyword, rest := splitScriptKeyword(cond)
+	switch keyword {
+	case "not":
+		ok, err := s.cond(rest)
+		return !ok, err
+	case "ok":
+		status, err := s.exec(rest)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\r\n", err)
+		}
+		s.status = status
+		return status == 0, nil
+	case "exists":
+		path, err := s.value(rest)
+		if err != nil {
+			return false, err
+		}
+		_, err = os.Stat(path)
+		return err == nil, nil
+	case "empty":
+		value, err := s.value(rest)
+		return value == "", err
+	}
+	if left, op, right, ok := splitCondition(cond); ok {
+		lv, err := s.value(left)
+		if err != nil {
+			return false, err
+		}
+		rv, err := s.value(right)
+		if err != nil {
+			return false, err
+		}
+		switch op {
+		case "==":
+			return lv == rv, nil
+		case "!=":
+			return lv != rv, nil
+		default:
+			re, err := regexp.Compile(rv)
+			if err != nil {
+				return false, fmt.Errorf("invalid regex %q: %v", rv, err)
+			}
+			return re.MatchString(lv) == (op == "=~"), nil
+		}
+	}
+	value, err := s.value(cond)
+	if err != nil {
+		return false, err
+	}
+	return value != "" && value != "0" && value != "false", nil
+}
@@ -38,6 +38,7 @@ type ServerManager struct {
 	listenAddr string
 	wwwRoot    string
 	repl       *REPL
+	metrics    *serverMetrics
 }
 
 // Global server manager instance
@@ -130,6 +131,7 @@ func NewServerManager(config *llm.Config, listenAddr string, wwwRoot string, rep
 		listenAddr: listenAddr,
 		wwwRoot:    wwwRoot,
 		repl:       repl,
+		metrics:    newServerMetrics(),
 	}
 }
 
@@ -164,6 +166,7 @@ func (sm *ServerManager) Start() error {
 	mux.HandleFunc("/v1/chat/completions", sm.handleChatCompletions)
 	mux.HandleFunc("/api/event_logging/batch", sm.handleEventLogging)
 	mux.HandleFunc("/health", sm.handleHealth)
+	mux.Handle("/metrics", sm.metrics.registry)
 
 	// Additional simplified endpoints
 	mux.HandleFunc("/api/chat", sm.handleSimpleChat)
@@ -197,6 +200,7 @@ func (sm *ServerManager) Start() error {
 		}
 		mux.ServeHTTP(w, r)
 	})
+	handler = sm.metrics.instrument(mux, handler)
 	sm.server = &http.Server{
 		Addr:    sm.listenAddr,
 		Handler: handler,
@@ -556,7 +560,7 @@ func (sm *ServerManager) handleStreamingResponse(w http.ResponseWriter, r *http.
 		_, _ = fmt.Fprintf(w, "data: [ERROR] %v\n\n", err)
 		return
 	}
-	response, err := client.SendMessage(messages, false, nil, nil)
+	response, err := sm.sendMessage(client, messages, nil)
 	if err != nil {
 		_, _ = fmt.Fprintf(w, "data: [ERROR] %v\n\n", err)
 		return
@@ -628,7 +632,7 @@ func (sm *ServerManager) handleNonStreamingResponse(w http.ResponseWriter, r *ht
 		http.Error(w, fmt.Sprintf("LLM init error: %v", err), http.StatusInternalServerError)
 		return
 	}
-	response, err := client.SendMessage(messages, false, nil, nil)
+	response, err := sm.sendMessage(client, messages, nil)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("LLM error: %v", err), http.StatusInternalServerError)
 		return
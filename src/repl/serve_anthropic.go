@@ -204,7 +204,7 @@ func (sm *ServerManager) handleAnthropicStreamingMessages(w http.ResponseWriter,
 	}
 
 	// For now, simulate streaming with non-streaming response
-	response, err := client.SendMessage(messages, false, nil, tools)
+	response, err := sm.sendMessage(client, messages, tools)
 	if err != nil {
 		_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", fmt.Sprintf(`{"error": {"message": "LLM error: %v"}}`, err))
 		return
@@ -246,7 +246,7 @@ func (sm *ServerManager) handleAnthropicNonStreamingMessages(w http.ResponseWrit
 		return
 	}
 
-	response, err := client.SendMessage(messages, false, nil, tools)
+	response, err := sm.sendMessage(client, messages, tools)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("LLM error: %v", err), http.StatusInternalServerError)
 		return
@@ -361,7 +361,7 @@ func (sm *ServerManager) handleAnthropicComplete(w http.ResponseWriter, r *http.
 			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
 			return
 		}
-		response, err := client.SendMessage(messages, false, nil, nil)
+		response, err := sm.sendMessage(client, messages, nil)
 		if err != nil {
 			_, _ = fmt.Fprintf(w, "data: [ERROR] %v\n\n", err)
 			return
@@ -396,7 +396,7 @@ func (sm *ServerManager) handleAnthropicComplete(w http.ResponseWriter, r *http.
 	}
 
 	// Non-streaming
-	response, err := client.SendMessage(messages, false, nil, nil)
+	response, err := sm.sendMessage(client, messages, nil)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("LLM error: %v", err), http.StatusInternalServerError)
 		return
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/trufae/mai/src/repl/llm"
+	wmcplib "mai/src/wmcp/lib"
+)
+
+// serverMetrics are the Prometheus metrics exposed by the REPL web server
+type serverMetrics struct {
+	registry        *wmcplib.Metrics
+	requests        *wmcplib.CounterVec
+	requestDuration *wmcplib.HistogramVec
+	providerLatency *wmcplib.HistogramVec
+	providerErrors  *wmcplib.CounterVec
+	tokens          *wmcplib.CounterVec
+}
+
+func newServerMetrics() *serverMetrics {
+	m := wmcplib.NewMetrics()
+	return &serverMetrics{
+		registry: m,
+		requests: m.Counter("mai_http_requests_total",
+			"HTTP requests handled by the REPL server.", "endpoint", "method", "status"),
+		requestDuration: m.Histogram("mai_http_request_duration_seconds",
+			"Time spent handling HTTP requests.", wmcplib.DefaultLatencyBuckets, "endpoint"),
+		providerLatency: m.Histogram("mai_provider_request_duration_seconds",
+			"Time spent waiting for the LLM provider.", wmcplib.DefaultLatencyBuckets, "provider", "model"),
+		providerErrors: m.Counter("mai_provider_errors_total",
+			"Failed LLM provider requests.", "provider", "model"),
+		tokens: m.Counter("mai_provider_tokens_total",
+			"Tokens reported by the LLM provider by direction (input, output, cache_read, cache_write).", "provider", "model", "direction"),
+	}
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush keeps the streaming endpoints working through the recorder
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// instrument counts the requests served by mux. Requests are labeled with
+// the matched route pattern so arbitrary paths do not create new series.
+func (m *serverMetrics) instrument(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := "other"
+		if _, pattern := mux.Handler(r); pattern != "" {
+			endpoint = pattern
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		m.requestDuration.Observe(time.Since(start).Seconds(), endpoint)
+		m.requests.Inc(endpoint, r.Method, strconv.Itoa(rec.status))
+	})
+}
+
+// sendMessage sends messages to the provider recording its latency and the
+// token usage it reports
+func (sm *ServerManager) sendMessage(client *llm.LLMClient, messages []llm.Message, tools []llm.OpenAITool) (string, error) {
+	provider, model := "unknown", "unknown"
+	if client.Config != nil {
+		if client.Config.PROVIDER != "" {
+			provider = client.Config.PROVIDER
+		}
+		if client.Config.Model != "" {
+			model = client.Config.Model
+		}
+	}
+	start := time.Now()
+	response, err := client.SendMessage(messages, false, nil, tools)
+	sm.metrics.providerLatency.Observe(time.Since(start).Seconds(), provider, model)
+	if err != nil {
+		sm.metrics.providerErrors.Inc(provider, model)
+		return response, err
+	}
+	usage := client.LastUsage()
+	for direction, count := range map[string]int{
+		"input":       usage.InputTokens,
+		"output":      usage.OutputTokens,
+		"cache_read":  usage.CacheReadTokens,
+		"cache_write": usage.CacheWriteTokens,
+	} {
+		if count > 0 {
+			sm.metrics.tokens.Add(float64(count), provider, model, direction)
+		}
+	}
+	return response, nil
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -65,16 +67,23 @@ func embedGetService(r *REPL) (*wmcplib.MCPService, error) {
 		proxy = r.configOptions.GetBool("mcp.proxytools")
 	}
 
+	auditLog, err := wmcplib.OpenAuditLog(cfg.MaiOptions.Audit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: audit log disabled: %v\n", err)
+	}
+
 	service := wmcplib.NewMCPService(wmcplib.Options{
-		YoloMode:       yolo || cfg.MaiOptions.YoloMode,
-		DrunkMode:      cfg.MaiOptions.DrunkMode,
-		ReportFile:     cfg.MaiOptions.OutputReport,
-		NoPrompts:      cfg.MaiOptions.NoPrompts,
-		NonInteractive: cfg.MaiOptions.NonInteractive,
-		SessionMode:    cfg.MaiOptions.SessionMode,
-		DebugMode:      debug || cfg.MaiOptions.DebugMode,
-		ProxyToolsMode: proxy || cfg.MaiOptions.ProxyToolsMode,
-		Prompter:       newReplPrompter(r),
+		YoloMode:         yolo || cfg.MaiOptions.YoloMode,
+		DrunkMode:        cfg.MaiOptions.DrunkMode,
+		ReportFile:       cfg.MaiOptions.OutputReport,
+		NoPrompts:        cfg.MaiOptions.NoPrompts,
+		NonInteractive:   cfg.MaiOptions.NonInteractive,
+		SessionMode:      cfg.MaiOptions.SessionMode,
+		DebugMode:        debug || cfg.MaiOptions.DebugMode,
+		ProxyToolsMode:   proxy || cfg.MaiOptions.ProxyToolsMode,
+		FailureThreshold: cfg.MaiOptions.FailureThreshold,
+		AuditLog:         auditLog,
+		Prompter:         newReplPrompter(r),
 	})
 
 	if len(cfg.MCPServers) > 0 {
@@ -82,9 +91,16 @@ func embedGetService(r *REPL) (*wmcplib.MCPService, error) {
 	}
 
 	if len(service.Servers) == 0 {
+		if auditLog != nil {
+			auditLog.Close()
+		}
 		return nil, fmt.Errorf("embed transport: no MCP servers configured in %s", embedConfigPath(r))
 	}
 
+	if cfg.MaiOptions.HealthCheckInterval >= 0 {
+		go service.RunHealthChecks(time.Duration(cfg.MaiOptions.HealthCheckInterval)*time.Second, nil)
+	}
+
 	embedService = service
 	embedActiveRepl = r
 	return service, nil
@@ -126,6 +142,18 @@ func embedConfigPath(r *REPL) string {
 	return filepath.Join(home, ".config", "mai", "mcps.json")
 }
 
+// embedServerHealth returns the health of the servers of the embedded
+// service, or nil when it is not running
+func embedServerHealth() []wmcplib.ServerHealth {
+	embedServiceOnce.Lock()
+	defer embedServiceOnce.Unlock()
+
+	if embedService == nil {
+		return nil
+	}
+	return embedService.ServerHealth()
+}
+
 // embedStop disposes the embedded service (called on repl shutdown).
 func embedStop() {
 	embedServiceOnce.Lock()
@@ -133,6 +161,9 @@ func embedStop() {
 
 	if embedService != nil {
 		embedService.StopAllServers()
+		if audit := embedService.AuditLog(); audit != nil {
+			audit.Close()
+		}
 		embedService = nil
 	}
 	embedActiveRepl = nil
@@ -450,8 +481,6 @@ func embedCallTool(r *REPL, toolName string, args map[string]interface{}, timeou
 		return "", err
 	}
 
-	_ = timeoutSeconds // the library imposes its own 30s stdio timeout for now
-
 	// In proxy mode the agent may only call the two virtual tools; route them
 	// through ProcessMCPRequest which knows how to handle them.
 	if svc.ProxyToolsMode {
@@ -483,7 +512,22 @@ func embedCallTool(r *REPL, toolName string, args map[string]interface{}, timeou
 		ID:      time.Now().UnixNano(),
 	}
 
-	resp, err := svc.SendRequest(server, req)
+	// Ctrl-C cancels r.ctx, which tells the server to abandon the call
+	r.mu.Lock()
+	ctx := r.ctx
+	r.mu.Unlock()
+	if timeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeoutSeconds)*time.Second)
+		defer cancel()
+	}
+	resp, err := svc.SendRequestWithContext(ctx, "mai-repl", server, req)
+	if errors.Is(err, wmcplib.ErrRequestCancelled) {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("tool call timed out after %ds", timeoutSeconds)
+		}
+		return "", fmt.Errorf("tool call interrupted")
+	}
 	if err != nil {
 		return "", err
 	}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strings"
 )
 
@@ -463,3 +465,78 @@ func getPrompt(config Config, serverName, promptName string, params map[string]i
 
 	formatContentOutput(config, body)
 }
+
+// auditEntry mirrors the entries returned by the /audit endpoint
+type auditEntry struct {
+	Time       string      `json:"time"`
+	Client     string      `json:"client"`
+	Server     string      `json:"server"`
+	Tool       string      `json:"tool"`
+	Args       interface{} `json:"args"`
+	Decision   string      `json:"decision"`
+	Source     string      `json:"source"`
+	ResultSize int         `json:"resultSize"`
+	DurationMs int64       `json:"durationMs"`
+	IsError    bool        `json:"isError"`
+	Error      string      `json:"error"`
+}
+
+func queryAudit(config Config, filters map[string]interface{}) {
+	// A positional argument is the tool, as in 'mai-tool audit shell/run'
+	if tool, ok := filters["0"]; ok {
+		filters["tool"] = tool
+		delete(filters, "0")
+	}
+	query := url.Values{}
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		query.Set(key, fmt.Sprintf("%v", filters[key]))
+	}
+	endpoint := "/audit"
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	body, err := makeGetRequest(config, buildApiUrl(config, endpoint))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if config.JsonOutput || config.XmlOutput {
+		formatJsonPrettyOutput(config, body)
+		return
+	}
+
+	var result struct {
+		Entries []auditEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		fmt.Printf("Error parsing audit log: %v\n", err)
+		os.Exit(1)
+	}
+	if len(result.Entries) == 0 {
+		if !config.Quiet {
+			fmt.Println("No audit entries found")
+		}
+		return
+	}
+	for _, e := range result.Entries {
+		status := "ok"
+		if e.Error != "" {
+			status = "error: " + e.Error
+		} else if e.IsError {
+			status = "tool error"
+		}
+		fmt.Printf("%s %s/%s %s by %s (%s) %dms %dB %s\n",
+			e.Time, e.Server, e.Tool, e.Decision, e.Source, e.Client, e.DurationMs, e.ResultSize, status)
+		if !config.Quiet && e.Args != nil {
+			args, _ := json.Marshal(e.Args)
+			fmt.Printf("  args: %s\n", args)
+		}
+	}
+}
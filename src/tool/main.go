@@ -65,6 +65,7 @@ func printUsage() {
 	fmt.Println("  prompts get <server>/<name>    Render a prompt (accepts params)")
 	fmt.Println("  resources [list]               List all available resources")
 	fmt.Println("  resources read <server>/<uri>  Read a resource by URI")
+	fmt.Println("  audit [tool=T] [since=1h]      Query the audit log (also server=, client=, decision=, limit=)")
 }
 
 func main() {
@@ -174,6 +175,8 @@ func main() {
 		callTool(config, serverName, toolName, params)
 	case "servers":
 		listServers(config)
+	case "audit":
+		queryAudit(config, parseParams(flag.Args()[1:]))
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
 		printUsage()
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"sort"
 	"strconv"
@@ -24,8 +25,47 @@ func writeTextResponse(w http.ResponseWriter, content string) {
 
 func setCORSHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Native-Tool-Call, MCP-Protocol-Version, Mcp-Session-Id, Last-Event-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Native-Tool-Call, X-Mai-Profile, MCP-Protocol-Version, Mcp-Session-Id, Last-Event-ID")
+}
+
+// requestProfile returns the profile selected with the /p/{profile} path
+// prefix or the X-Mai-Profile header
+func requestProfile(r *http.Request) string {
+	if profile := mux.Vars(r)["profile"]; profile != "" {
+		return profile
+	}
+	return r.Header.Get("X-Mai-Profile")
+}
+
+// requestClient identifies the HTTP client for the audit log
+func requestClient(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if agent := r.UserAgent(); agent != "" {
+		return fmt.Sprintf("%s (%s)", agent, host)
+	}
+	return host
+}
+
+// profileServerTools returns the tools visible to the request grouped by
+// server, with the server names sorted
+func profileServerTools(s *wmcplib.MCPService, r *http.Request) ([]string, map[string][]wmcplib.Tool, error) {
+	tools, err := s.ProfileTools(requestProfile(r))
+	if err != nil {
+		return nil, nil, err
+	}
+	names := []string{}
+	byServer := make(map[string][]wmcplib.Tool)
+	for _, t := range tools {
+		if _, ok := byServer[t.Server]; !ok {
+			names = append(names, t.Server)
+		}
+		byServer[t.Server] = append(byServer[t.Server], t.Tool)
+	}
+	return names, byServer, nil
 }
 
 // writeProxyToolsText renders the two proxy tools in the plain-text catalog
@@ -58,9 +98,6 @@ func listToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 			return
 		}
 
-		s.Mutex.RLock()
-		defer s.Mutex.RUnlock()
-
 		var output strings.Builder
 		output.WriteString("# Tools Catalog\n\n")
 
@@ -70,9 +107,13 @@ func listToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 			return
 		}
 
-		for _, server := range s.Servers {
-			server.Mutex.RLock()
-			for _, tool := range server.Tools {
+		serverNames, serverTools, err := profileServerTools(s, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		for _, serverName := range serverNames {
+			for _, tool := range serverTools[serverName] {
 				output.WriteString(fmt.Sprintf("- ToolName: %s\n", tool.Name))
 				output.WriteString(fmt.Sprintf("  Description: %s\n", tool.Description))
 				if len(tool.Parameters) > 0 {
@@ -87,7 +128,6 @@ func listToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 					}
 				}
 			}
-			server.Mutex.RUnlock()
 		}
 
 		writeTextResponse(w, output.String())
@@ -338,6 +378,17 @@ func listResourcesHandler(s *wmcplib.MCPService) http.HandlerFunc {
 				}
 				output.WriteString("\n")
 			}
+			for _, template := range server.ResourceTemplates {
+				output.WriteString(fmt.Sprintf("- URI Template: %s\n", template.URITemplate))
+				output.WriteString(fmt.Sprintf("  Name: %s\n", template.Name))
+				if template.Description != "" {
+					output.WriteString(fmt.Sprintf("  Description: %s\n", template.Description))
+				}
+				if template.MimeType != "" {
+					output.WriteString(fmt.Sprintf("  MIME Type: %s\n", template.MimeType))
+				}
+				output.WriteString("\n")
+			}
 			server.Mutex.RUnlock()
 		}
 
@@ -366,6 +417,29 @@ func jsonResourcesHandler(s *wmcplib.MCPService) http.HandlerFunc {
 	}
 }
 
+func jsonResourceTemplatesHandler(s *wmcplib.MCPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("HTTP %s %s", r.Method, r.URL.String())
+		s.Mutex.RLock()
+		defer s.Mutex.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		result := make(map[string][]wmcplib.ResourceTemplate)
+		for serverName, server := range s.Servers {
+			server.Mutex.RLock()
+			templates := make([]wmcplib.ResourceTemplate, len(server.ResourceTemplates))
+			copy(templates, server.ResourceTemplates)
+			server.Mutex.RUnlock()
+			result[serverName] = templates
+		}
+
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// readResourceHandler reads a resource of a server. The URI may contain
+// slashes and may be an expansion of one of the server resource templates.
 func readResourceHandler(s *wmcplib.MCPService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -375,17 +449,23 @@ func readResourceHandler(s *wmcplib.MCPService) http.HandlerFunc {
 		log.Printf("HTTP %s %s - Server: %s, Resource: %s", r.Method, r.URL.String(), serverName, resourceURI)
 
 		s.Mutex.RLock()
-		server, exists := s.Servers[serverName]
+		_, exists := s.Servers[serverName]
 		s.Mutex.RUnlock()
 		if !exists {
 			http.Error(w, fmt.Sprintf("Server '%s' not found", serverName), http.StatusNotFound)
 			return
 		}
 
+		server, rawURI, err := s.ResolveResource(serverName + wmcplib.AggregatedNameSeparator + resourceURI)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
 		req := wmcplib.JSONRPCRequest{
 			JSONRPC: "2.0",
 			Method:  "resources/read",
-			Params:  wmcplib.ReadResourceParams{URI: resourceURI},
+			Params:  wmcplib.ReadResourceParams{URI: rawURI},
 			ID:      5,
 		}
 
@@ -417,9 +497,6 @@ func jsonToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 			return
 		}
 
-		s.Mutex.RLock()
-		defer s.Mutex.RUnlock()
-
 		w.Header().Set("Content-Type", "application/json")
 		res := make(map[string][]wmcplib.Tool)
 		if s.ProxyToolsMode {
@@ -432,17 +509,13 @@ func jsonToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 			w.Write(jsonBytes)
 			return
 		}
-		for serverName, server := range s.Servers {
-			server.Mutex.RLock()
-			tools := make([]wmcplib.Tool, len(server.Tools))
-			copy(tools, server.Tools)
-			for i := range tools {
-				if len(tools[i].Parameters) == 0 && tools[i].InputSchema != nil {
-					tools[i].Parameters = wmcplib.ExtractParametersFromSchema(tools[i].InputSchema)
-				}
-			}
+		_, serverTools, err := profileServerTools(s, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		for serverName, tools := range serverTools {
 			res[serverName] = tools
-			server.Mutex.RUnlock()
 		}
 
 		jsonBytes, err := json.Marshal(res)
@@ -466,9 +539,6 @@ func simpleToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 			return
 		}
 
-		s.Mutex.RLock()
-		defer s.Mutex.RUnlock()
-
 		var output strings.Builder
 
 		if s.ProxyToolsMode {
@@ -477,10 +547,14 @@ func simpleToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 			return
 		}
 
-		for serverName, server := range s.Servers {
-			server.Mutex.RLock()
+		serverNames, serverTools, err := profileServerTools(s, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		for _, serverName := range serverNames {
 			notFirst := false
-			for _, tool := range server.Tools {
+			for _, tool := range serverTools[serverName] {
 				if notFirst {
 					output.WriteString("--\n")
 				}
@@ -521,7 +595,6 @@ func simpleToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 					}
 				}
 			}
-			server.Mutex.RUnlock()
 		}
 
 		writeTextResponse(w, output.String())
@@ -579,9 +652,6 @@ func quietToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 			return
 		}
 
-		s.Mutex.RLock()
-		defer s.Mutex.RUnlock()
-
 		if s.ProxyToolsMode {
 			var output strings.Builder
 			for _, tool := range wmcplib.ProxyTools() {
@@ -604,16 +674,14 @@ func quietToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 
 		categoryOrder := []string{"File", "Analysis", "Inspection", "Metadata", "Editing"}
 		toolsByCategory := make(map[string][]wmcplib.QuietToolEntry)
-		serverNames := make([]string, 0, len(s.Servers))
-		for serverName := range s.Servers {
-			serverNames = append(serverNames, serverName)
+		serverNames, serverTools, err := profileServerTools(s, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
 		}
-		sort.Strings(serverNames)
 
 		for _, serverName := range serverNames {
-			server := s.Servers[serverName]
-			server.Mutex.RLock()
-			for _, tool := range server.Tools {
+			for _, tool := range serverTools[serverName] {
 				entry := wmcplib.BuildQuietToolEntry(serverName, tool)
 				cat := entry.Category
 				if cat == "" {
@@ -621,7 +689,6 @@ func quietToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 				}
 				toolsByCategory[cat] = append(toolsByCategory[cat], entry)
 			}
-			server.Mutex.RUnlock()
 		}
 
 		var output strings.Builder
@@ -684,9 +751,6 @@ func markdownToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 			return
 		}
 
-		s.Mutex.RLock()
-		defer s.Mutex.RUnlock()
-
 		w.Header().Set("Content-Type", "text/markdown")
 
 		var output strings.Builder
@@ -721,13 +785,22 @@ func markdownToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 			return
 		}
 
-		for serverName, server := range s.Servers {
-			server.Mutex.RLock()
+		serverNames, serverTools, err := profileServerTools(s, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		_, servers := s.SnapshotServers()
+		for _, serverName := range serverNames {
+			command := ""
+			if server, ok := servers[serverName]; ok {
+				command = server.Command
+			}
 			output.WriteString(fmt.Sprintf("## Server: %s\n", serverName))
-			output.WriteString(fmt.Sprintf("Command: `%s`\n", server.Command))
-			output.WriteString(fmt.Sprintf("Tools: %d\n\n", len(server.Tools)))
+			output.WriteString(fmt.Sprintf("Command: `%s`\n", command))
+			output.WriteString(fmt.Sprintf("Tools: %d\n\n", len(serverTools[serverName])))
 
-			for _, tool := range server.Tools {
+			for _, tool := range serverTools[serverName] {
 				output.WriteString(fmt.Sprintf("### %s\n", tool.Name))
 				output.WriteString(fmt.Sprintf("**Description:** %s\n\n", tool.Description))
 
@@ -788,7 +861,6 @@ func markdownToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
 
 				output.WriteString(fmt.Sprintf("**Usage:** `POST /call/%s/%s`\n\n", serverName, tool.Name))
 			}
-			server.Mutex.RUnlock()
 		}
 
 		w.Write([]byte(output.String()))
@@ -854,7 +926,7 @@ func proxyCallHandler(s *wmcplib.MCPService, w http.ResponseWriter, r *http.Requ
 		Params:  wmcplib.CallToolParams{Name: toolName, Arguments: arguments},
 		ID:      time.Now().UnixNano(),
 	}
-	resp, _ := s.ProcessMCPRequest(req)
+	resp, _ := s.ProcessMCPRequestFrom(req, requestProfile(r), requestClient(r))
 	if resp == nil {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -941,9 +1013,26 @@ func callToolHandler(s *wmcplib.MCPService) http.HandlerFunc {
 		nonInteractiveParam := r.URL.Query().Get("nonInteractive")
 		requestNonInteractive := strings.ToLower(nonInteractiveParam) == "true"
 
-		s.Mutex.RLock()
-		server, exists := s.Servers[serverName]
-		s.Mutex.RUnlock()
+		var server *wmcplib.MCPServer
+		var profileTool *wmcplib.ProfileTool
+		exists := false
+		if profile := requestProfile(r); profile != "" || s.DefaultProfile != "" {
+			name := toolName
+			if serverName != "" {
+				name = serverName + wmcplib.AggregatedNameSeparator + toolName
+			}
+			resolved, t, err := s.ResolveProfileTool(profile, name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			server, profileTool, exists = resolved, &t, true
+			serverName, toolName = t.Server, t.Original
+		} else {
+			s.Mutex.RLock()
+			server, exists = s.Servers[serverName]
+			s.Mutex.RUnlock()
+		}
 		if !exists {
 			for name, _server := range s.Servers {
 				if matched, ok := wmcplib.FindBestToolMatch(_server.Tools, toolName, s.DrunkMode); ok {
@@ -1092,15 +1181,19 @@ func callToolHandler(s *wmcplib.MCPService) http.HandlerFunc {
 
 		if s.DrunkMode && len(arguments) > 0 {
 			var foundTool *wmcplib.Tool
-			server.Mutex.RLock()
-			for _, tool := range server.Tools {
-				if tool.Name == toolName {
-					t := tool
-					foundTool = &t
-					break
+			if profileTool != nil {
+				foundTool = &profileTool.Tool
+			} else {
+				server.Mutex.RLock()
+				for _, tool := range server.Tools {
+					if tool.Name == toolName {
+						t := tool
+						foundTool = &t
+						break
+					}
 				}
+				server.Mutex.RUnlock()
 			}
-			server.Mutex.RUnlock()
 
 			if foundTool != nil && len(foundTool.Parameters) > 0 {
 				numericKeys := make([]int, 0)
@@ -1147,6 +1240,10 @@ func callToolHandler(s *wmcplib.MCPService) http.HandlerFunc {
 			}
 		}
 
+		if profileTool != nil {
+			arguments = profileTool.ApplyArguments(arguments)
+		}
+
 		toolRequest := wmcplib.JSONRPCRequest{
 			JSONRPC: "2.0",
 			Method:  "tools/call",
@@ -1156,10 +1253,15 @@ func callToolHandler(s *wmcplib.MCPService) http.HandlerFunc {
 
 		debugLog("Calling tool %s on server %s with arguments: %v", toolName, serverName, arguments)
 
-		response, err := s.SendRequest(server, toolRequest)
+		response, err := s.SendRequestFrom(requestClient(r), server, toolRequest)
 		if err != nil {
 			log.Printf("ERROR: Failed to send request to server %s for tool %s: %v", serverName, toolName, err)
-			http.Error(w, fmt.Sprintf("Failed to call tool: %v", err), http.StatusInternalServerError)
+			status := http.StatusInternalServerError
+			var unavailable *wmcplib.ServerUnavailableError
+			if errors.As(err, &unavailable) {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, fmt.Sprintf("Failed to call tool: %v", err), status)
 			return
 		}
 
@@ -1237,17 +1339,28 @@ func callToolHandler(s *wmcplib.MCPService) http.HandlerFunc {
 func statusHandler(s *wmcplib.MCPService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("HTTP %s %s", r.Method, r.URL.String())
-		s.Mutex.RLock()
-		defer s.Mutex.RUnlock()
 
+		names, servers := s.SnapshotServers()
 		var output strings.Builder
 		output.WriteString("# MCP Service Status\n\n")
 
-		for serverName, server := range s.Servers {
+		for _, serverName := range names {
+			server := servers[serverName]
+			health := server.Health()
 			server.Mutex.RLock()
 			output.WriteString(fmt.Sprintf("## Server: %s\n", serverName))
 			output.WriteString(fmt.Sprintf("Command: `%s`\n", server.Command))
-			output.WriteString("Status: Running\n")
+			output.WriteString(fmt.Sprintf("Status: %s\n", health.State))
+			output.WriteString(fmt.Sprintf("Timeout: %s\n", health.Timeout))
+			if health.Failures > 0 {
+				output.WriteString(fmt.Sprintf("Consecutive failures: %d\n", health.Failures))
+			}
+			if health.LastError != "" {
+				output.WriteString(fmt.Sprintf("Last error: %s (%s)\n", health.LastError, health.LastErrorAt))
+			}
+			if health.LastCheck != "" {
+				output.WriteString(fmt.Sprintf("Last health check: %s\n", health.LastCheck))
+			}
 			output.WriteString(fmt.Sprintf("Tools: %d\n", len(server.Tools)))
 			output.WriteString(fmt.Sprintf("Prompts: %d\n", len(server.Prompts)))
 			output.WriteString(fmt.Sprintf("Resources: %d\n\n", len(server.Resources)))
@@ -1258,6 +1371,53 @@ func statusHandler(s *wmcplib.MCPService) http.HandlerFunc {
 	}
 }
 
+// jsonStatusHandler returns the health of every server
+func jsonStatusHandler(s *wmcplib.MCPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("HTTP %s %s", r.Method, r.URL.String())
+		writeJSON(w, http.StatusOK, map[string]interface{}{"servers": s.ServerHealth()})
+	}
+}
+
+// auditHandler queries the audit log, filtering by the tool, server, client,
+// decision, since and limit parameters
+func auditHandler(s *wmcplib.MCPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w)
+		log.Printf("HTTP %s %s", r.Method, r.URL.String())
+		audit := s.AuditLog()
+		if audit == nil {
+			writeJSONError(w, http.StatusNotFound, "audit log is disabled")
+			return
+		}
+		q := r.URL.Query()
+		since, err := wmcplib.ParseAuditSince(q.Get("since"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query := wmcplib.AuditQuery{
+			Tool:     q.Get("tool"),
+			Server:   q.Get("server"),
+			Client:   q.Get("client"),
+			Decision: q.Get("decision"),
+			Since:    since,
+		}
+		if limit := q.Get("limit"); limit != "" {
+			if query.Limit, err = strconv.Atoi(limit); err != nil {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %v", err))
+				return
+			}
+		}
+		entries, err := audit.Query(query)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+	}
+}
+
 func openapiHandler(s *wmcplib.MCPService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("HTTP %s %s", r.Method, r.URL.String())
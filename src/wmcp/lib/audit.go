@@ -0,0 +1,460 @@
+package wmcplib
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAuditMaxSize is the size in megabytes at which the audit log
+	// is rotated
+	DefaultAuditMaxSize = 10
+	// DefaultAuditMaxFiles is the number of rotated audit logs kept
+	DefaultAuditMaxFiles = 5
+	// auditRedacted replaces the secrets found in the logged arguments
+	auditRedacted = "[REDACTED]"
+)
+
+// Decision sources recorded in the audit log
+const (
+	AuditSourceYolo      = "yolo"
+	AuditSourcePolicy    = "policy"
+	AuditSourceUser      = "user"
+	AuditSourceUnchecked = "unchecked"
+)
+
+// AuditConfig configures the audit log of tool executions
+type AuditConfig struct {
+	// Disabled turns the audit log off
+	Disabled bool `json:"disabled,omitempty"`
+	// File is the path of the log, AuditLogFile() when empty
+	File string `json:"file,omitempty"`
+	// MaxSize is the size in megabytes at which the log is rotated
+	MaxSize int `json:"maxSize,omitempty"`
+	// MaxFiles is the number of rotated logs kept
+	MaxFiles int `json:"maxFiles,omitempty"`
+	// HashArgs logs only the hash of the arguments
+	HashArgs bool `json:"hashArgs,omitempty"`
+	// RedactKeys are extra argument names whose values are redacted
+	RedactKeys []string `json:"redactKeys,omitempty"`
+	// RedactPatterns are extra regular expressions redacted from values
+	RedactPatterns []string `json:"redactPatterns,omitempty"`
+}
+
+// AuditEntry is a line of the audit log
+type AuditEntry struct {
+	Time       string      `json:"time"`
+	Client     string      `json:"client,omitempty"`
+	Session    string      `json:"session,omitempty"`
+	Server     string      `json:"server"`
+	Tool       string      `json:"tool"`
+	Args       interface{} `json:"args,omitempty"`
+	ArgsHash   string      `json:"argsHash"`
+	Decision   string      `json:"decision"`
+	Source     string      `json:"source"`
+	ResultSize int         `json:"resultSize,omitempty"`
+	DurationMs int64       `json:"durationMs,omitempty"`
+	IsError    bool        `json:"isError,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// AuditQuery filters the entries returned by AuditLog.Query. Empty fields
+// match everything.
+type AuditQuery struct {
+	Tool     string
+	Server   string
+	Client   string
+	Decision string
+	Since    time.Time
+	Limit    int
+}
+
+// AuditLog is an append-only JSONL log of tool executions
+type AuditLog struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	hashArgs bool
+	keys     []string
+	patterns []*regexp.Regexp
+	file     *os.File
+	size     int64
+}
+
+// secretKeys are the argument names whose values are always redacted
+var secretKeys = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "secret_key", "access_key",
+	"privatekey", "private_key", "authorization", "cookie", "credential", "credentials"}
+
+// secretPatterns match well known credential formats inside values
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)bearer\s+[a-z0-9._~+/=-]+`),
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{20,}`),
+	regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+}
+
+// AuditLogFile returns the default path of the audit log. It can be
+// overridden with MAI_MCP_AUDIT_FILE.
+func AuditLogFile() string {
+	if file := os.Getenv("MAI_MCP_AUDIT_FILE"); file != "" {
+		return file
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "mai", "wmcp-audit.jsonl")
+}
+
+// OpenAuditLog opens the audit log described by cfg. It returns nil when the
+// log is disabled.
+func OpenAuditLog(cfg AuditConfig) (*AuditLog, error) {
+	if cfg.Disabled {
+		return nil, nil
+	}
+	path := cfg.File
+	if path == "" {
+		path = AuditLogFile()
+	}
+	if path == "" {
+		return nil, fmt.Errorf("cannot determine the audit log path")
+	}
+	a := &AuditLog{
+		path:     path,
+		maxSize:  int64(cfg.MaxSize) * 1024 * 1024,
+		maxFiles: cfg.MaxFiles,
+		hashArgs: cfg.HashArgs,
+		keys:     append([]string(nil), secretKeys...),
+		patterns: append([]*regexp.Regexp(nil), secretPatterns...),
+	}
+	if a.maxSize <= 0 {
+		a.maxSize = DefaultAuditMaxSize * 1024 * 1024
+	}
+	if a.maxFiles <= 0 {
+		a.maxFiles = DefaultAuditMaxFiles
+	}
+	for _, key := range cfg.RedactKeys {
+		a.keys = append(a.keys, strings.ReplaceAll(strings.ToLower(key), "-", "_"))
+	}
+	for _, pattern := range cfg.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit redact pattern %q: %v", pattern, err)
+		}
+		a.patterns = append(a.patterns, re)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %v", err)
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Path returns the path of the current log file
+func (a *AuditLog) Path() string {
+	return a.path
+}
+
+func (a *AuditLog) open() error {
+	file, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %v", err)
+	}
+	a.file = file
+	a.size = info.Size()
+	return nil
+}
+
+// rotatedPath returns the path of the n-th rotated log, 0 is the current one
+func (a *AuditLog) rotatedPath(n int) string {
+	if n == 0 {
+		return a.path
+	}
+	return fmt.Sprintf("%s.%d", a.path, n)
+}
+
+// rotate renames log to log.1, log.1 to log.2 and so on, dropping the oldest.
+// The log stays closed when the new file cannot be opened.
+func (a *AuditLog) rotate() error {
+	a.file.Close()
+	a.file = nil
+	os.Remove(a.rotatedPath(a.maxFiles))
+	for n := a.maxFiles - 1; n >= 0; n-- {
+		if _, err := os.Stat(a.rotatedPath(n)); err == nil {
+			os.Rename(a.rotatedPath(n), a.rotatedPath(n+1))
+		}
+	}
+	return a.open()
+}
+
+// Record redacts the arguments of the entry and appends it to the log. The
+// hash is computed over the redacted arguments, so it cannot be used to
+// guess the secrets.
+func (a *AuditLog) Record(entry AuditEntry, args interface{}) error {
+	var redacted interface{}
+	if args != nil {
+		redacted = a.redact("", args)
+	}
+	argsJSON, _ := json.Marshal(redacted)
+	sum := sha256.Sum256(argsJSON)
+	entry.ArgsHash = "sha256:" + hex.EncodeToString(sum[:])
+	if !a.hashArgs {
+		entry.Args = redacted
+	}
+	if entry.Time == "" {
+		entry.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %v", err)
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+	if a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+	return nil
+}
+
+// redact returns a copy of v with the secrets replaced
+func (a *AuditLog) redact(key string, v interface{}) interface{} {
+	if key != "" && a.secretKey(key) {
+		return auditRedacted
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = a.redact(k, item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = a.redact("", item)
+		}
+		return out
+	case string:
+		for _, re := range a.patterns {
+			val = re.ReplaceAllString(val, auditRedacted)
+		}
+		return val
+	case nil, bool, float64, int, int64:
+		return val
+	}
+	// Normalize structs and other types through JSON so nested secrets
+	// are found too
+	data, err := json.Marshal(v)
+	if err != nil {
+		return auditRedacted
+	}
+	var generic interface{}
+	if json.Unmarshal(data, &generic) != nil {
+		return auditRedacted
+	}
+	return a.redact("", generic)
+}
+
+// secretKey reports whether the argument name ends with a secret name, so
+// api-token and github_token match while max_tokens does not
+func (a *AuditLog) secretKey(key string) bool {
+	key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	for _, secret := range a.keys {
+		if strings.HasSuffix(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns the entries matching q, oldest first. With a limit only the
+// most recent entries are returned.
+func (a *AuditLog) Query(q AuditQuery) ([]AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries := []AuditEntry{}
+	for n := a.maxFiles; n >= 0; n-- {
+		file, err := os.Open(a.rotatedPath(n))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to open audit log: %v", err)
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var entry AuditEntry
+			if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+				continue
+			}
+			if q.matches(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %v", err)
+		}
+	}
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[len(entries)-q.Limit:]
+	}
+	return entries, nil
+}
+
+func (q AuditQuery) matches(entry AuditEntry) bool {
+	if q.Tool != "" && entry.Tool != q.Tool && entry.Server+"/"+entry.Tool != q.Tool {
+		return false
+	}
+	if q.Server != "" && entry.Server != q.Server {
+		return false
+	}
+	if q.Client != "" && !strings.Contains(entry.Client, q.Client) {
+		return false
+	}
+	if q.Decision != "" && entry.Decision != q.Decision {
+		return false
+	}
+	if !q.Since.IsZero() {
+		t, err := time.Parse(time.RFC3339Nano, entry.Time)
+		if err != nil || t.Before(q.Since) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseAuditSince parses the since filter of a query: a duration relative
+// to now (1h, 30m), an RFC3339 timestamp or a date (2006-01-02)
+func ParseAuditSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since value %q, expected a duration, RFC3339 time or date", value)
+}
+
+// Close closes the log file
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// AuditLog returns the audit log of the service, nil when disabled
+func (s *MCPService) AuditLog() *AuditLog {
+	return s.audit
+}
+
+// setClientName records the clientInfo sent by a transport client, the
+// empty client being the stdio or in-process one
+func (s *MCPService) setClientName(client, name string) {
+	s.sessionLock.Lock()
+	defer s.sessionLock.Unlock()
+	if s.clientNames == nil {
+		s.clientNames = make(map[string]string)
+	}
+	s.clientNames[client] = name
+}
+
+// auditClient names a transport client in the audit log by the clientInfo
+// it sent and its HTTP user agent and address
+func (s *MCPService) auditClient(client string) string {
+	s.sessionLock.Lock()
+	name := s.clientNames[client]
+	s.sessionLock.Unlock()
+	switch {
+	case name != "" && client != "":
+		return name + " via " + client
+	case name != "":
+		return name
+	case client != "":
+		return client
+	}
+	return "local"
+}
+
+// auditToolCall appends a tools/call request and its outcome to the audit log
+func (s *MCPService) auditToolCall(client string, server *MCPServer, request JSONRPCRequest, source string, response *JSONRPCResponse, callErr error, elapsed time.Duration, denied bool) {
+	if s.audit == nil {
+		return
+	}
+	var params CallToolParams
+	DecodeJSONRPCParams(request.Params, &params)
+	entry := AuditEntry{
+		Client:   s.auditClient(client),
+		Session:  s.EnsureSessionID(),
+		Server:   server.Name,
+		Tool:     params.Name,
+		Decision: "allow",
+		Source:   source,
+	}
+	if denied {
+		entry.Decision = "deny"
+	} else {
+		entry.DurationMs = elapsed.Milliseconds()
+	}
+	if callErr != nil {
+		entry.Error = callErr.Error()
+	}
+	if response != nil {
+		if response.Result != nil {
+			result, _ := json.Marshal(response.Result)
+			entry.ResultSize = len(result)
+			entry.IsError = resultIsError(response.Result)
+		}
+		if response.Error != nil {
+			entry.IsError = true
+		}
+	}
+	if err := s.audit.Record(entry, params.Arguments); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package wmcplib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ErrRequestCancelled is returned by SendRequestWithContext when its
+// context is cancelled before the server answers
+var ErrRequestCancelled = errors.New("request cancelled")
+
+// errServerBusy is returned when the context of a request ends while it
+// waits for the exchange in progress with a stdio server. It counts as a
+// cancellation.
+var errServerBusy = serverBusyError{}
+
+type serverBusyError struct{}
+
+func (serverBusyError) Error() string { return "request cancelled while waiting for the server" }
+
+func (serverBusyError) Is(target error) bool { return target == ErrRequestCancelled }
+
+// cancelServerRequest tells the server to stop working on a request whose
+// caller gave up. It is best effort: servers may still answer.
+func (s *MCPService) cancelServerRequest(ctx context.Context, server *MCPServer, request JSONRPCRequest) {
+	if request.ID == nil {
+		return
+	}
+	reason := "cancelled"
+	if cause := context.Cause(ctx); cause != nil {
+		reason = cause.Error()
+	}
+	notification := JSONRPCRequest{
+		JSONRPC: "2.0",
+		Method:  "notifications/cancelled",
+		Params:  map[string]interface{}{"requestId": request.ID, "reason": reason},
+	}
+	reqBytes, err := json.Marshal(notification)
+	if err != nil {
+		return
+	}
+	debugLog(s.DebugMode, "Cancelling request %v of server %s: %s", request.ID, server.Name, reason)
+
+	if !server.IsHTTP {
+		// Callers of sendStdio hold the request slot
+		if err := s.sendStdioRequest(server, reqBytes); err != nil {
+			log.Printf("Warning: failed to cancel request %v of server %s: %v", request.ID, server.Name, err)
+		}
+		return
+	}
+	postCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := s.doHTTP(server, &http.Client{}, func() (*http.Request, error) {
+		return s.newHTTPRequest(postCtx, server, reqBytes)
+	})
+	if err != nil {
+		log.Printf("Warning: failed to cancel request %v of server %s: %v", request.ID, server.Name, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func clientRequestKey(client string, id interface{}) string {
+	data, _ := json.Marshal(id)
+	return client + "\x00" + string(data)
+}
+
+// trackClientRequest returns the context of a request forwarded for a
+// client, cancelled when the client sends notifications/cancelled for it.
+// done must be called once the request is answered.
+func (s *MCPService) trackClientRequest(client string, id interface{}) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	key := clientRequestKey(client, id)
+	s.clientRequestsLock.Lock()
+	if s.clientRequests == nil {
+		s.clientRequests = make(map[string]context.CancelCauseFunc)
+	}
+	s.clientRequests[key] = cancel
+	s.clientRequestsLock.Unlock()
+	return ctx, func() {
+		s.clientRequestsLock.Lock()
+		delete(s.clientRequests, key)
+		s.clientRequestsLock.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancelClientRequest handles a notifications/cancelled sent by a client.
+// Requests already answered are ignored.
+func (s *MCPService) cancelClientRequest(client string, rawParams interface{}) {
+	var params struct {
+		RequestID interface{} `json:"requestId"`
+		Reason    string      `json:"reason"`
+	}
+	if err := DecodeJSONRPCParams(rawParams, &params); err != nil || params.RequestID == nil {
+		return
+	}
+	s.clientRequestsLock.Lock()
+	cancel, exists := s.clientRequests[clientRequestKey(client, params.RequestID)]
+	s.clientRequestsLock.Unlock()
+	if !exists {
+		return
+	}
+	reason := params.Reason
+	if reason == "" {
+		reason = "cancelled by the client"
+	}
+	cancel(errors.New(reason))
+}
@@ -19,23 +19,88 @@ type MaiOptions struct {
 	NonInteractive bool   `json:"nonInteractive,omitempty"`
 	SessionMode    bool   `json:"sessionMode,omitempty"`
 	ProxyToolsMode bool   `json:"proxyToolsMode,omitempty"`
+	Profile        string `json:"profile,omitempty"`
+	// HealthCheckInterval is the number of seconds between two pings of
+	// every server, a negative value disables the health checks
+	HealthCheckInterval int `json:"healthCheckInterval,omitempty"`
+	// FailureThreshold is the number of consecutive failures that mark a
+	// server degraded
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// Audit configures the audit log of tool calls
+	Audit AuditConfig `json:"audit,omitempty"`
+	// ManageAPI enables the routes that start, stop and reconfigure servers,
+	// for local clients presenting ManageToken (random when empty)
+	ManageAPI   bool   `json:"manageAPI,omitempty"`
+	ManageToken string `json:"manageToken,omitempty"`
 }
 
 // Config represents the main configuration structure
 type Config struct {
 	MCPServers map[string]MCPServerConfig `json:"mcpServers"`
 	MaiOptions MaiOptions                 `json:"maiOptions,omitempty"`
+	Profiles   map[string]ProfileConfig   `json:"profiles,omitempty"`
 }
 
 // MCPServerConfig represents the configuration for a single MCP server
 type MCPServerConfig struct {
-	Type        string            `json:"type"`
-	Command     string            `json:"command,omitempty"`
-	Args        []string          `json:"args,omitempty"`
-	URL         string            `json:"url,omitempty"`
-	Env         map[string]string `json:"env,omitempty"`
-	Tools       map[string]bool   `json:"tools,omitempty"`
-	SessionMode bool              `json:"sessionMode,omitempty"`
+	Type          string            `json:"type"`
+	Command       string            `json:"command,omitempty"`
+	Args          []string          `json:"args,omitempty"`
+	URL           string            `json:"url,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+	Tools         map[string]bool   `json:"tools,omitempty"`
+	DisabledTools []string          `json:"disabledTools,omitempty"`
+	SessionMode   bool              `json:"sessionMode,omitempty"`
+	// Spec is the OpenAPI 3 document (JSON or YAML) of openapi servers,
+	// URL overrides its server URL
+	Spec string `json:"spec,omitempty"`
+	// Headers are sent with every openapi request, $VARS are expanded
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout is the number of seconds to wait for a response, zero waits
+	// as long as the server takes
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// Validate checks that the entry has the fields required by its type
+func (c MCPServerConfig) Validate(name string) error {
+	if c.Type != "stdio" && c.Type != "http" && c.Type != "sse" && c.Type != "ws" && c.Type != "unix" && c.Type != "openapi" {
+		return fmt.Errorf("server %s: type must be 'stdio', 'http', 'sse', 'ws', 'unix', or 'openapi'", name)
+	}
+	if c.Type == "openapi" && c.Spec == "" {
+		return fmt.Errorf("server %s: spec cannot be empty for openapi type", name)
+	}
+	if c.Type == "stdio" && c.Command == "" {
+		return fmt.Errorf("server %s: command cannot be empty for stdio type", name)
+	}
+	if (c.Type == "http" || c.Type == "sse" || c.Type == "ws" || c.Type == "unix") && c.URL == "" {
+		return fmt.Errorf("server %s: url cannot be empty for %s type", name, c.Type)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("server %s: timeout cannot be negative", name)
+	}
+	return nil
+}
+
+// CommandString returns the command line or URL used to start the server
+func (c MCPServerConfig) CommandString() string {
+	if c.Type == "http" || c.Type == "sse" || c.Type == "ws" || c.Type == "unix" {
+		return c.URL
+	}
+	if c.Type == "openapi" {
+		return "openapi:" + c.Spec
+	}
+	cmdParts := []string{c.Command}
+	cmdParts = append(cmdParts, c.Args...)
+	return formatCommandString(cmdParts)
+}
+
+// DefaultConfigPath returns the path of the default config file
+func DefaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "mai", "mcps.json")
 }
 
 // LoadConfigFromJSON loads the configuration from a JSON string
@@ -50,14 +115,8 @@ func LoadConfigFromJSON(jsonStr string) (*Config, error) {
 	}
 
 	for name, server := range config.MCPServers {
-		if server.Type != "stdio" && server.Type != "http" && server.Type != "sse" {
-			return nil, fmt.Errorf("server %s: type must be 'stdio', 'http', or 'sse'", name)
-		}
-		if server.Type == "stdio" && server.Command == "" {
-			return nil, fmt.Errorf("server %s: command cannot be empty for stdio type", name)
-		}
-		if (server.Type == "http" || server.Type == "sse") && server.URL == "" {
-			return nil, fmt.Errorf("server %s: url cannot be empty for %s type", name, server.Type)
+		if err := server.Validate(name); err != nil {
+			return nil, err
 		}
 	}
 
@@ -67,11 +126,10 @@ func LoadConfigFromJSON(jsonStr string) (*Config, error) {
 // LoadConfig loads the configuration from a file
 func LoadConfig(configPath string) (*Config, error) {
 	if configPath == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
+		configPath = DefaultConfigPath()
+		if configPath == "" {
 			return &Config{MCPServers: make(map[string]MCPServerConfig)}, nil
 		}
-		configPath = filepath.Join(home, ".config", "mai", "mcps.json")
 	}
 
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
@@ -93,14 +151,8 @@ func LoadConfig(configPath string) (*Config, error) {
 	}
 
 	for name, server := range config.MCPServers {
-		if server.Type != "stdio" && server.Type != "http" && server.Type != "sse" {
-			return nil, fmt.Errorf("server %s: type must be 'stdio', 'http', or 'sse'", name)
-		}
-		if server.Type == "stdio" && server.Command == "" {
-			return nil, fmt.Errorf("server %s: command cannot be empty for stdio type", name)
-		}
-		if (server.Type == "http" || server.Type == "sse") && server.URL == "" {
-			return nil, fmt.Errorf("server %s: url cannot be empty for %s type", name, server.Type)
+		if err := server.Validate(name); err != nil {
+			return nil, err
 		}
 	}
 
@@ -112,14 +164,7 @@ func (c *Config) BuildServerCommands() map[string]string {
 	commands := make(map[string]string)
 
 	for name, server := range c.MCPServers {
-		if server.Type == "http" || server.Type == "sse" {
-			commands[name] = server.URL
-		} else {
-			cmdParts := []string{server.Command}
-			cmdParts = append(cmdParts, server.Args...)
-			cmdStr := formatCommandString(cmdParts)
-			commands[name] = cmdStr
-		}
+		commands[name] = server.CommandString()
 	}
 
 	return commands
@@ -165,6 +210,9 @@ type MAIServer struct {
 	Env     map[string]string `json:"env,omitempty"`
 	Enabled bool              `json:"enabled"`
 	Tools   map[string]bool   `json:"tools,omitempty"`
+	Spec    string            `json:"spec,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout int               `json:"timeout,omitempty"`
 }
 
 // LoadMAIConfig loads configuration from MAI's mcps.json format
@@ -195,7 +243,11 @@ func LoadMAIConfig(configPath string) (*Config, error) {
 
 		srvType := server.Type
 		if srvType == "" {
-			if server.URL != "" {
+			if strings.HasPrefix(server.URL, "ws://") || strings.HasPrefix(server.URL, "wss://") {
+				srvType = "ws"
+			} else if strings.HasPrefix(server.URL, "unix://") {
+				srvType = "unix"
+			} else if server.URL != "" {
 				srvType = "http"
 			} else {
 				srvType = "stdio"
@@ -209,6 +261,9 @@ func LoadMAIConfig(configPath string) (*Config, error) {
 			URL:     server.URL,
 			Env:     server.Env,
 			Tools:   server.Tools,
+			Spec:    server.Spec,
+			Headers: server.Headers,
+			Timeout: server.Timeout,
 		}
 	}
 
@@ -217,16 +272,27 @@ func LoadMAIConfig(configPath string) (*Config, error) {
 
 // StartMCPServersFromConfig starts MCP servers from the given config
 func StartMCPServersFromConfig(service *MCPService, config *Config) {
-	commands := config.BuildServerCommands()
-
-	for name, cmdStr := range commands {
-		serverConfig := config.MCPServers[name]
-		if err := service.StartServerWithEnvAndTools(name, cmdStr, serverConfig.Env, serverConfig.Tools, serverConfig.SessionMode); err != nil {
+	service.SetProfiles(config.Profiles)
+	for name, serverConfig := range config.MCPServers {
+		if err := service.startConfiguredServer(name, serverConfig); err != nil {
 			fmt.Printf("Failed to start server %s: %v\n", name, err)
 		}
 	}
 }
 
+// LoadConfigFile loads a config file in either the mcpServers format or
+// MAI's servers format
+func LoadConfigFile(configPath string) (*Config, error) {
+	config, err := LoadConfig(configPath)
+	if err == nil && len(config.MCPServers) > 0 {
+		return config, nil
+	}
+	if maiConfig, maiErr := LoadMAIConfig(configPath); maiErr == nil {
+		return maiConfig, nil
+	}
+	return config, err
+}
+
 // GetServerNameFromCommand extracts server name from the command string
 func GetServerNameFromCommand(command string) string {
 	parts := strings.Fields(command)
@@ -1,3 +1,9 @@
 module wmcplib
 
 go 1.20.0
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require mai/src/mcps/lib v0.0.0
+
+replace mai/src/mcps/lib => ../../mcps/lib
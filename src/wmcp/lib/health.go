@@ -0,0 +1,287 @@
+package wmcplib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ServerState is the health of a backend server as seen by the bridge
+type ServerState string
+
+const (
+	// ServerHealthy servers answer requests normally
+	ServerHealthy ServerState = "healthy"
+	// ServerDegraded servers failed too many consecutive requests. Calls fail
+	// fast until the cooldown expires or a health check succeeds.
+	ServerDegraded ServerState = "degraded"
+)
+
+const (
+	// DefaultFailureThreshold is the number of consecutive failures that
+	// mark a server degraded
+	DefaultFailureThreshold = 3
+	// DefaultHealthCheckInterval is the time between two pings of a server
+	DefaultHealthCheckInterval = 30 * time.Second
+	// hungRequestAfter is how long a request without a configured timeout
+	// can keep a stdio server busy before the health check takes it for
+	// hung, longer than what tools like run_tests take by default
+	hungRequestAfter = 10 * time.Minute
+	// circuitCooldown is how long a degraded server rejects calls before a
+	// single call is let through to probe it
+	circuitCooldown = 30 * time.Second
+)
+
+// serverHealth tracks the failures of a server for the circuit breaker
+type serverHealth struct {
+	mu          sync.Mutex
+	state       ServerState
+	failures    int
+	lastError   string
+	lastErrorAt time.Time
+	lastCheck   time.Time
+	openedAt    time.Time
+	probing     bool
+	checking    bool
+}
+
+// ServerHealth is a snapshot of the health of a server
+type ServerHealth struct {
+	Name        string      `json:"name"`
+	State       ServerState `json:"state"`
+	Failures    int         `json:"failures"`
+	LastError   string      `json:"lastError,omitempty"`
+	LastErrorAt string      `json:"lastErrorAt,omitempty"`
+	LastCheck   string      `json:"lastCheck,omitempty"`
+	Timeout     string      `json:"timeout"`
+}
+
+// ServerUnavailableError is returned without contacting a degraded server
+type ServerUnavailableError struct {
+	Server    string
+	Failures  int
+	LastError string
+	RetryIn   time.Duration
+}
+
+func (e *ServerUnavailableError) Error() string {
+	return fmt.Sprintf("MCP server '%s' is degraded after %d consecutive failures (last error: %s); retrying in %s",
+		e.Server, e.Failures, e.LastError, e.RetryIn.Round(time.Second))
+}
+
+// requestTimeout returns the configured timeout of the server. Zero means
+// requests wait as long as the server takes, since tools like test runners
+// legitimately run for minutes.
+func (server *MCPServer) requestTimeout() time.Duration {
+	return server.timeout
+}
+
+// timeoutAfter is time.After, except that a zero timeout never fires
+func timeoutAfter(timeout time.Duration) <-chan time.Time {
+	if timeout <= 0 {
+		return nil
+	}
+	return time.After(timeout)
+}
+
+// Health returns a snapshot of the server health
+func (server *MCPServer) Health() ServerHealth {
+	h := &server.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	health := ServerHealth{
+		Name:      server.Name,
+		State:     h.state,
+		Failures:  h.failures,
+		LastError: h.lastError,
+		Timeout:   "none",
+	}
+	if timeout := server.requestTimeout(); timeout > 0 {
+		health.Timeout = timeout.String()
+	}
+	if health.State == "" {
+		health.State = ServerHealthy
+	}
+	if !h.lastErrorAt.IsZero() {
+		health.LastErrorAt = h.lastErrorAt.Format(time.RFC3339)
+	}
+	if !h.lastCheck.IsZero() {
+		health.LastCheck = h.lastCheck.Format(time.RFC3339)
+	}
+	return health
+}
+
+// ServerHealth returns the health of every server sorted by name
+func (s *MCPService) ServerHealth() []ServerHealth {
+	names, servers := s.SnapshotServers()
+	health := make([]ServerHealth, 0, len(names))
+	for _, name := range names {
+		health = append(health, servers[name].Health())
+	}
+	return health
+}
+
+func (s *MCPService) failureThreshold() int {
+	if s.FailureThreshold > 0 {
+		return s.FailureThreshold
+	}
+	return DefaultFailureThreshold
+}
+
+// checkCircuit fails fast while a degraded server is cooling down. Once the
+// cooldown expires a single request is let through to probe the server.
+func (s *MCPService) checkCircuit(server *MCPServer) error {
+	h := &server.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.state != ServerDegraded {
+		return nil
+	}
+	remaining := circuitCooldown - time.Since(h.openedAt)
+	if remaining <= 0 && !h.probing {
+		h.probing = true
+		return nil
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &ServerUnavailableError{
+		Server:    server.Name,
+		Failures:  h.failures,
+		LastError: h.lastError,
+		RetryIn:   remaining,
+	}
+}
+
+// recordResult updates the circuit breaker with the outcome of a request.
+// Only transport failures count, JSON-RPC errors prove the server is alive.
+func (s *MCPService) recordResult(server *MCPServer, err error) {
+	h := &server.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.probing = false
+	if errors.Is(err, ErrRequestCancelled) {
+		// The server did not fail, the client gave up
+		return
+	}
+	if err == nil {
+		if h.state == ServerDegraded {
+			log.Printf("MCP server '%s' recovered", server.Name)
+		}
+		h.state = ServerHealthy
+		h.failures = 0
+		return
+	}
+	h.failures++
+	h.lastError = err.Error()
+	h.lastErrorAt = time.Now()
+	if h.state == ServerDegraded {
+		h.openedAt = h.lastErrorAt
+		return
+	}
+	if h.failures >= s.failureThreshold() {
+		h.state = ServerDegraded
+		h.openedAt = h.lastErrorAt
+		log.Printf("ERROR: MCP server '%s' marked degraded after %d consecutive failures: %v", server.Name, h.failures, err)
+	}
+}
+
+// resetHealth closes the circuit of a server that was just (re)started
+func (s *MCPService) resetHealth(server *MCPServer) {
+	h := &server.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state = ServerHealthy
+	h.failures = 0
+	h.probing = false
+}
+
+// pingServer sends a ping to the server bypassing the circuit breaker, so a
+// degraded server is closed again as soon as it answers. A stdio server that
+// does not answer within timeout, or stays busy with a request for longer
+// than hungRequestAfter or its request timeout, is killed and restarted.
+func (s *MCPService) pingServer(server *MCPServer, timeout time.Duration) {
+	h := &server.health
+	h.mu.Lock()
+	if h.checking {
+		h.mu.Unlock()
+		return
+	}
+	h.checking = true
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	request := JSONRPCRequest{JSONRPC: "2.0", Method: "ping", ID: time.Now().UnixNano()}
+	var err error
+	if server.IsHTTP {
+		_, err = s.sendHTTPRequest(ctx, server, request)
+	} else {
+		_, err = s.sendStdio(ctx, server, request)
+	}
+	skipped := false
+	switch {
+	case server.IsHTTP && errors.Is(err, ErrRequestCancelled):
+		err = fmt.Errorf("no answer to the health check within %v", timeout)
+	case errors.Is(err, errServerBusy):
+		busy, limit := server.busyFor(), hungRequestAfter
+		if timeout := server.requestTimeout(); timeout > limit {
+			limit = timeout
+		}
+		if busy < limit {
+			// A long request is running, the server is checked next time
+			debugLog(s.DebugMode, "Skipping health check of busy server %s", server.Name)
+			skipped = true
+			break
+		}
+		log.Printf("ERROR: Server %s has been busy with a request for %v", server.Name, busy.Round(time.Second))
+		dropUnresponsive(server)
+		err = fmt.Errorf("request running for %v", busy.Round(time.Second))
+	case errors.Is(err, ErrRequestCancelled):
+		log.Printf("ERROR: Server %s did not answer the health check within %v", server.Name, timeout)
+		dropUnresponsive(server)
+		err = fmt.Errorf("no answer to the health check within %v", timeout)
+	}
+	if !skipped {
+		if err != nil {
+			debugLog(s.DebugMode, "Health check of server %s failed: %v", server.Name, err)
+		}
+		s.recordResult(server, err)
+	}
+
+	h.mu.Lock()
+	h.checking = false
+	h.lastCheck = time.Now()
+	h.mu.Unlock()
+}
+
+// RunHealthChecks pings every server at the given interval. Servers that do
+// not implement ping still count as healthy since they answer with an error.
+// It returns when stop is closed or the service shuts down.
+func (s *MCPService) RunHealthChecks(interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if s.isShuttingDown() {
+			return
+		}
+		_, servers := s.SnapshotServers()
+		for _, server := range servers {
+			if server.openapi != nil {
+				continue
+			}
+			go s.pingServer(server, interval)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package wmcplib
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// subscriberSet fans out notifications to the connected MCP clients
+type subscriberSet struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]subscriber
+}
+
+// subscriber is a notification listener of a client
+type subscriber struct {
+	client string
+	ch     chan JSONRPCNotification
+}
+
+// SubscribeNotifications registers a listener for the notifications the
+// bridge sends to its clients. The returned function unsubscribes it.
+func (s *MCPService) SubscribeNotifications() (<-chan JSONRPCNotification, func()) {
+	return s.SubscribeNotificationsFrom("")
+}
+
+// SubscribeNotificationsFrom is SubscribeNotifications for the listener of
+// a client, as named in ProcessMCPRequestFrom. The resource subscriptions
+// of the client are dropped when its last listener unsubscribes.
+func (s *MCPService) SubscribeNotificationsFrom(client string) (<-chan JSONRPCNotification, func()) {
+	set := &s.subscribers
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if set.subs == nil {
+		set.subs = make(map[int]subscriber)
+	}
+	id := set.next
+	set.next++
+	ch := make(chan JSONRPCNotification, 16)
+	set.subs[id] = subscriber{client: client, ch: ch}
+	return ch, func() {
+		set.mu.Lock()
+		if _, ok := set.subs[id]; !ok {
+			set.mu.Unlock()
+			return
+		}
+		delete(set.subs, id)
+		close(ch)
+		last := true
+		for _, sub := range set.subs {
+			if sub.client == client {
+				last = false
+				break
+			}
+		}
+		set.mu.Unlock()
+		if last {
+			s.dropClientResources(client)
+		}
+	}
+}
+
+// notify sends a notification to every subscriber. Slow subscribers miss
+// notifications instead of blocking the caller.
+func (s *MCPService) notify(method string) {
+	s.sendNotification(JSONRPCNotification{JSONRPC: "2.0", Method: method}, func(string) bool { return true })
+}
+
+// notifyClient is notify for the listeners of a single client
+func (s *MCPService) notifyClient(client, method string, params interface{}) {
+	msg := JSONRPCNotification{JSONRPC: "2.0", Method: method, Params: params}
+	s.sendNotification(msg, func(c string) bool { return c == client })
+}
+
+func (s *MCPService) sendNotification(msg JSONRPCNotification, match func(client string) bool) {
+	set := &s.subscribers
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	for _, sub := range set.subs {
+		if !match(sub.client) {
+			continue
+		}
+		select {
+		case sub.ch <- msg:
+		default:
+			debugLog(s.DebugMode, "Dropped %s notification for a slow client", msg.Method)
+		}
+	}
+}
+
+// notifyListChanged tells the clients that the set of servers changed, so
+// the aggregated tools, prompts and resources must be listed again.
+func (s *MCPService) notifyListChanged() {
+	s.notify("notifications/tools/list_changed")
+	if !s.NoPrompts {
+		s.notify("notifications/prompts/list_changed")
+	}
+	s.notify("notifications/resources/list_changed")
+}
+
+// toolEnabled applies the per-server tool filter. A non-empty enabled map
+// is an allow list of the tools set to true, and the disabled tools are
+// hidden in any case.
+func toolEnabled(enabled map[string]bool, disabled []string, name string) bool {
+	if containsString(disabled, name) {
+		return false
+	}
+	return len(enabled) == 0 || enabled[name]
+}
+
+// startConfiguredServer starts the server described by a config entry,
+// replacing any running server with the same name.
+func (s *MCPService) startConfiguredServer(name string, cfg MCPServerConfig) error {
+	if err := cfg.Validate(name); err != nil {
+		return err
+	}
+	s.removeServer(name)
+	if cfg.Type == "openapi" {
+		return s.startOpenAPIServer(name, cfg)
+	}
+	return s.startServer(name, cfg.CommandString(), cfg.Env, cfg.Tools, cfg.DisabledTools, cfg.SessionMode, time.Duration(cfg.Timeout)*time.Second)
+}
+
+// removeServer stops and forgets a server, returning false if it is unknown
+func (s *MCPService) removeServer(name string) bool {
+	s.Mutex.Lock()
+	server, ok := s.Servers[name]
+	if ok {
+		delete(s.Servers, name)
+	}
+	s.Mutex.Unlock()
+	if !ok {
+		return false
+	}
+	s.stopServer(server)
+	log.Printf("Stopped MCP server: %s", name)
+	return true
+}
+
+// AddServer starts a new server from a config entry, replacing any running
+// server with the same name
+func (s *MCPService) AddServer(name string, cfg MCPServerConfig) error {
+	if name == "" {
+		return fmt.Errorf("server name is required")
+	}
+	err := s.startConfiguredServer(name, cfg)
+	s.notifyListChanged()
+	return err
+}
+
+// StopServer stops a running server and removes it from the service
+func (s *MCPService) StopServer(name string) error {
+	if !s.removeServer(name) {
+		return fmt.Errorf("server %s not found", name)
+	}
+	s.notifyListChanged()
+	return nil
+}
+
+// RestartServer stops a server and starts it again with the same command,
+// environment and tool filter
+func (s *MCPService) RestartServer(name string) error {
+	s.Mutex.RLock()
+	server, ok := s.Servers[name]
+	s.Mutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("server %s not found", name)
+	}
+	server.Mutex.RLock()
+	command := server.Command
+	env := server.env
+	tools := server.EnabledTools
+	disabled := server.DisabledTools
+	session := server.UseSession
+	timeout := server.timeout
+	server.Mutex.RUnlock()
+
+	s.metrics.restarts.Inc(name, "manual")
+	var err error
+	if server.openapi != nil {
+		// Reload the spec so changes to the document are picked up
+		cfg := server.openapi.config
+		cfg.Tools = tools
+		cfg.DisabledTools = disabled
+		err = s.startConfiguredServer(name, cfg)
+	} else {
+		s.removeServer(name)
+		err = s.startServer(name, command, env, tools, disabled, session, timeout)
+	}
+	s.notifyListChanged()
+	return err
+}
+
+// SetServerTools replaces the tool filter of a server and reloads its tools.
+// An empty allow list enables every tool that is not disabled.
+func (s *MCPService) SetServerTools(name string, tools map[string]bool, disabled []string) error {
+	s.Mutex.RLock()
+	server, ok := s.Servers[name]
+	s.Mutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("server %s not found", name)
+	}
+	server.Mutex.Lock()
+	server.EnabledTools = tools
+	server.DisabledTools = disabled
+	server.Mutex.Unlock()
+	if err := s.loadTools(server); err != nil {
+		return err
+	}
+	s.notify("notifications/tools/list_changed")
+	return nil
+}
+
+// ServerTools returns a copy of the tool filter of a server: its allow list
+// and its disabled tools
+func (s *MCPService) ServerTools(name string) (map[string]bool, []string, error) {
+	s.Mutex.RLock()
+	server, ok := s.Servers[name]
+	s.Mutex.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("server %s not found", name)
+	}
+	server.Mutex.RLock()
+	defer server.Mutex.RUnlock()
+	tools := make(map[string]bool, len(server.EnabledTools))
+	for k, v := range server.EnabledTools {
+		tools[k] = v
+	}
+	return tools, append([]string(nil), server.DisabledTools...), nil
+}
+
+// ReloadConfig applies the differences between two configurations: servers
+// that were removed are stopped, new ones are started and the ones whose
+// entry changed are restarted. Servers not present in oldConfig (for
+// example the ones given on the command line) are left alone unless
+// newConfig defines them. Profiles are replaced by the new ones.
+func (s *MCPService) ReloadConfig(oldConfig, newConfig *Config) {
+	var oldServers, newServers map[string]MCPServerConfig
+	if oldConfig != nil {
+		oldServers = oldConfig.MCPServers
+	}
+	if newConfig != nil {
+		newServers = newConfig.MCPServers
+	}
+
+	changed := false
+	if newConfig != nil && (oldConfig == nil || !reflect.DeepEqual(oldConfig.Profiles, newConfig.Profiles)) {
+		s.SetProfiles(newConfig.Profiles)
+		changed = true
+	}
+	for _, name := range sortedServerNames(oldServers) {
+		if _, ok := newServers[name]; !ok {
+			if s.removeServer(name) {
+				changed = true
+			}
+		}
+	}
+	for _, name := range sortedServerNames(newServers) {
+		cfg := newServers[name]
+		prev, existed := oldServers[name]
+		if existed && reflect.DeepEqual(prev, cfg) {
+			continue
+		}
+		if existed {
+			log.Printf("Config changed, restarting MCP server: %s", name)
+		}
+		if err := s.startConfiguredServer(name, cfg); err != nil {
+			log.Printf("Failed to start server %s: %v", name, err)
+		}
+		changed = true
+	}
+	if changed {
+		s.notifyListChanged()
+	}
+}
+
+func sortedServerNames(servers map[string]MCPServerConfig) []string {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WatchConfig polls the config file and reloads the servers when it changes.
+// current is the configuration that was used to start the service. Invalid
+// or missing files are reported and ignored. It returns when stop is closed.
+func (s *MCPService) WatchConfig(path string, current *Config, interval time.Duration, stop <-chan struct{}) {
+	var lastMod time.Time
+	var lastSize int64
+	if info, err := os.Stat(path); err == nil {
+		lastMod, lastSize = info.ModTime(), info.Size()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if s.isShuttingDown() {
+			return
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Equal(lastMod) && info.Size() == lastSize {
+			continue
+		}
+		lastMod, lastSize = info.ModTime(), info.Size()
+
+		config, err := LoadConfigFile(path)
+		if err != nil {
+			log.Printf("Warning: ignoring invalid config %s: %v", path, err)
+			continue
+		}
+		log.Printf("Reloading config from %s", path)
+		s.ReloadConfig(current, config)
+		current = config
+	}
+}
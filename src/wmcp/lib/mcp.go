@@ -2,6 +2,7 @@ package wmcplib
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -138,6 +139,8 @@ func promptExistsOnServer(server *MCPServer, name string) bool {
 	return false
 }
 
+// resourceExistsOnServer reports whether uri is a listed resource of the
+// server or an expansion of one of its resource templates
 func resourceExistsOnServer(server *MCPServer, uri string) bool {
 	server.Mutex.RLock()
 	defer server.Mutex.RUnlock()
@@ -147,7 +150,7 @@ func resourceExistsOnServer(server *MCPServer, uri string) bool {
 			return true
 		}
 	}
-	return false
+	return matchResourceTemplate(server, uri)
 }
 
 // ResolveTool resolves a (possibly aggregated) tool name back to its owning
@@ -338,6 +341,19 @@ func DecodeJSONRPCParams(src interface{}, dest interface{}) error {
 // This is the method any transport (HTTP, stdio, direct function call from
 // mai-repl) should call after decoding the incoming JSON.
 func (s *MCPService) ProcessMCPRequest(req JSONRPCRequest) (*JSONRPCResponse, bool) {
+	return s.ProcessMCPRequestForProfile(req, "")
+}
+
+// ProcessMCPRequestForProfile is ProcessMCPRequest for a client that selected
+// a profile. The empty name selects DefaultProfile.
+func (s *MCPService) ProcessMCPRequestForProfile(req JSONRPCRequest, profile string) (*JSONRPCResponse, bool) {
+	return s.ProcessMCPRequestFrom(req, profile, "")
+}
+
+// ProcessMCPRequestFrom is ProcessMCPRequestForProfile on behalf of a client,
+// which is recorded in the audit log. The empty client is the one named in
+// the initialize request.
+func (s *MCPService) ProcessMCPRequestFrom(req JSONRPCRequest, profile, client string) (*JSONRPCResponse, bool) {
 	if req.JSONRPC != "" && req.JSONRPC != "2.0" {
 		return &JSONRPCResponse{
 			JSONRPC: "2.0",
@@ -358,21 +374,29 @@ func (s *MCPService) ProcessMCPRequest(req JSONRPCRequest) (*JSONRPCResponse, bo
 	case "initialize":
 		var params struct {
 			ProtocolVersion string `json:"protocolVersion"`
+			ClientInfo      struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"clientInfo"`
 		}
 		if err := DecodeJSONRPCParams(req.Params, &params); err != nil {
 			return &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: RPCError{Code: -32602, Message: "invalid params"}}, false
 		}
+		if params.ClientInfo.Name != "" {
+			s.setClientName(client, strings.TrimSpace(params.ClientInfo.Name+" "+params.ClientInfo.Version))
+		}
 		protocol := params.ProtocolVersion
 		if protocol == "" {
 			protocol = "2024-11-05"
 		}
+		listChanged := map[string]interface{}{"listChanged": true}
 		capabilities := map[string]interface{}{
-			"tools": map[string]interface{}{},
+			"tools": listChanged,
 		}
 		if !s.NoPrompts {
-			capabilities["prompts"] = map[string]interface{}{}
+			capabilities["prompts"] = listChanged
 		}
-		capabilities["resources"] = map[string]interface{}{}
+		capabilities["resources"] = map[string]interface{}{"listChanged": true, "subscribe": true}
 		return &JSONRPCResponse{
 			JSONRPC: "2.0",
 			ID:      req.ID,
@@ -387,12 +411,24 @@ func (s *MCPService) ProcessMCPRequest(req JSONRPCRequest) (*JSONRPCResponse, bo
 		}, false
 	case "notifications/initialized":
 		return nil, true
+	case "notifications/cancelled":
+		s.cancelClientRequest(client, req.Params)
+		return nil, true
 	case "tools/list":
 		var tools []Tool
 		if s.ProxyToolsMode {
 			tools = ProxyTools()
 		} else {
-			tools = s.AggregateToolList()
+			profileTools, err := s.ProfileTools(profile)
+			if err != nil {
+				return &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: RPCError{Code: -32602, Message: err.Error()}}, false
+			}
+			tools = make([]Tool, 0, len(profileTools))
+			for _, t := range profileTools {
+				tool := t.Tool
+				tool.Name = t.QualifiedName()
+				tools = append(tools, tool)
+			}
 		}
 		return &JSONRPCResponse{
 			JSONRPC: "2.0",
@@ -428,7 +464,17 @@ func (s *MCPService) ProcessMCPRequest(req JSONRPCRequest) (*JSONRPCResponse, bo
 				}, false
 			}
 		}
-		server, toolName, err := s.ResolveTool(params.Name)
+		var server *MCPServer
+		var toolName string
+		var err error
+		if profile == "" && s.DefaultProfile == "" {
+			server, toolName, err = s.ResolveTool(params.Name)
+		} else {
+			var t ProfileTool
+			server, t, err = s.ResolveProfileTool(profile, params.Name)
+			toolName = t.Original
+			params.Arguments = t.ApplyArguments(params.Arguments)
+		}
 		if err != nil {
 			return &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: RPCError{Code: -32000, Message: err.Error()}}, false
 		}
@@ -438,7 +484,21 @@ func (s *MCPService) ProcessMCPRequest(req JSONRPCRequest) (*JSONRPCResponse, bo
 			Params:  CallToolParams{Name: toolName, Arguments: params.Arguments},
 			ID:      req.ID,
 		}
-		forwardResp, forwardErr := s.SendRequest(server, forward)
+		ctx, done := s.trackClientRequest(client, req.ID)
+		defer done()
+		forwardResp, forwardErr := s.SendRequestWithContext(ctx, client, server, forward)
+		if errors.Is(forwardErr, ErrRequestCancelled) {
+			// Cancelled requests are not answered
+			return nil, true
+		}
+		var unavailable *ServerUnavailableError
+		if errors.As(forwardErr, &unavailable) {
+			// Report it as a tool error so the model can pick another tool
+			return &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]interface{}{
+				"content": []Content{{Type: "text", Text: unavailable.Error()}},
+				"isError": true,
+			}}, false
+		}
 		if forwardErr != nil {
 			return &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: RPCError{Code: -32000, Message: forwardErr.Error()}}, false
 		}
@@ -490,6 +550,30 @@ func (s *MCPService) ProcessMCPRequest(req JSONRPCRequest) (*JSONRPCResponse, bo
 			ID:      req.ID,
 			Result:  map[string]interface{}{"resources": s.AggregateResourceList()},
 		}, false
+	case "resources/templates/list":
+		return &JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Result:  map[string]interface{}{"resourceTemplates": s.AggregateResourceTemplateList()},
+		}, false
+	case "resources/subscribe", "resources/unsubscribe":
+		var params ReadResourceParams
+		if err := DecodeJSONRPCParams(req.Params, &params); err != nil {
+			return &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: RPCError{Code: -32602, Message: "invalid params"}}, false
+		}
+		if params.URI == "" {
+			return &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: RPCError{Code: -32602, Message: "resource URI is required"}}, false
+		}
+		var err error
+		if req.Method == "resources/subscribe" {
+			err = s.SubscribeResource(client, params.URI)
+		} else {
+			err = s.UnsubscribeResource(client, params.URI)
+		}
+		if err != nil {
+			return &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: RPCError{Code: -32000, Message: err.Error()}}, false
+		}
+		return &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]interface{}{}}, false
 	case "resources/read":
 		var params ReadResourceParams
 		if err := DecodeJSONRPCParams(req.Params, &params); err != nil {
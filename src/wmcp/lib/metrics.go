@@ -0,0 +1,347 @@
+package wmcplib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the histogram buckets, in seconds, used for
+// request latencies
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics is a minimal registry of counters, gauges and histograms that is
+// rendered in the Prometheus text exposition format
+type Metrics struct {
+	mu        sync.Mutex
+	families  []*metricFamily
+	collector []func()
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels []string
+	value  float64
+	counts []uint64
+	count  uint64
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	m *Metrics
+	f *metricFamily
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	m *Metrics
+	f *metricFamily
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	m *Metrics
+	f *metricFamily
+}
+
+// NewMetrics creates an empty registry
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+func (m *Metrics) register(name, help, kind string, buckets []float64, labels []string) *metricFamily {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := &metricFamily{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*metricSeries),
+	}
+	m.families = append(m.families, f)
+	return f
+}
+
+// Counter registers a counter
+func (m *Metrics) Counter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{m: m, f: m.register(name, help, "counter", nil, labels)}
+}
+
+// Gauge registers a gauge
+func (m *Metrics) Gauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{m: m, f: m.register(name, help, "gauge", nil, labels)}
+}
+
+// Histogram registers a histogram with the given upper bounds
+func (m *Metrics) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{m: m, f: m.register(name, help, "histogram", buckets, labels)}
+}
+
+// OnCollect registers a function run before the metrics are written, used
+// to update gauges that mirror state kept elsewhere
+func (m *Metrics) OnCollect(fn func()) {
+	m.mu.Lock()
+	m.collector = append(m.collector, fn)
+	m.mu.Unlock()
+}
+
+// seriesFor returns the series of the label values, m.mu must be held
+func (f *metricFamily) seriesFor(values []string) *metricSeries {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labels: append([]string(nil), values...)}
+		if f.kind == "histogram" {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Inc adds one to the counter
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the counter
+func (c *CounterVec) Add(v float64, values ...string) {
+	c.m.mu.Lock()
+	c.f.seriesFor(values).value += v
+	c.m.mu.Unlock()
+}
+
+// Set sets the gauge to v
+func (g *GaugeVec) Set(v float64, values ...string) {
+	g.m.mu.Lock()
+	g.f.seriesFor(values).value = v
+	g.m.mu.Unlock()
+}
+
+// Reset removes every series of the gauge
+func (g *GaugeVec) Reset() {
+	g.m.mu.Lock()
+	g.f.series = make(map[string]*metricSeries)
+	g.m.mu.Unlock()
+}
+
+// Observe records a value in the histogram
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	s := h.f.seriesFor(values)
+	for i, bound := range h.f.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+// Write renders the metrics in the Prometheus text exposition format
+func (m *Metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	collectors := append([]func(){}, m.collector...)
+	m.mu.Unlock()
+	for _, fn := range collectors {
+		fn()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+	for _, f := range m.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			labels := formatLabels(f.labels, s.labels, "", "")
+			if f.kind != "histogram" {
+				fmt.Fprintf(&b, "%s%s %s\n", f.name, labels, formatFloat(s.value))
+				continue
+			}
+			for i, bound := range f.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, formatLabels(f.labels, s.labels, "le", formatFloat(bound)), s.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, formatLabels(f.labels, s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, labels, formatFloat(s.value))
+			fmt.Fprintf(&b, "%s_count%s %d\n", f.name, labels, s.count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP exposes the metrics on a /metrics endpoint
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	parts := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		parts = append(parts, name+"=\""+escapeLabelValue(values[i])+"\"")
+	}
+	if extraName != "" {
+		parts = append(parts, extraName+"=\""+extraValue+"\"")
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(v string) string {
+	return helpEscaper.Replace(v)
+}
+
+// serviceMetrics are the metrics collected by an MCPService
+type serviceMetrics struct {
+	registry     *Metrics
+	toolCalls    *CounterVec
+	toolDuration *HistogramVec
+	toolErrors   *CounterVec
+	denials      *CounterVec
+	restarts     *CounterVec
+	serverUp     *GaugeVec
+}
+
+func newServiceMetrics(s *MCPService) *serviceMetrics {
+	m := NewMetrics()
+	sm := &serviceMetrics{
+		registry: m,
+		toolCalls: m.Counter("mai_wmcp_tool_calls_total",
+			"Tool calls forwarded to the MCP servers.", "server", "tool"),
+		toolDuration: m.Histogram("mai_wmcp_tool_call_duration_seconds",
+			"Time spent waiting for the result of a tool call.", DefaultLatencyBuckets, "server", "tool"),
+		toolErrors: m.Counter("mai_wmcp_tool_errors_total",
+			"Failed tool calls by reason (transport, rpc, tool, unavailable or cancelled).", "server", "tool", "reason"),
+		denials: m.Counter("mai_wmcp_permission_denials_total",
+			"Tool calls rejected before reaching the server by the user, the permission policy or because the tool does not exist.", "server", "tool"),
+		restarts: m.Counter("mai_wmcp_server_restarts_total",
+			"MCP server restarts by reason (crash or manual).", "server", "reason"),
+		serverUp: m.Gauge("mai_wmcp_server_healthy",
+			"Whether the MCP server is healthy (1) or degraded (0).", "server"),
+	}
+	m.OnCollect(func() {
+		sm.serverUp.Reset()
+		for _, health := range s.ServerHealth() {
+			up := 0.0
+			if health.State == ServerHealthy {
+				up = 1
+			}
+			sm.serverUp.Set(up, health.Name)
+		}
+	})
+	return sm
+}
+
+// Metrics returns the registry with the service metrics, served by the
+// /metrics endpoint
+func (s *MCPService) Metrics() *Metrics {
+	return s.metrics.registry
+}
+
+// observeToolCall records the outcome and latency of a tools/call request
+func (s *MCPService) observeToolCall(server *MCPServer, request JSONRPCRequest, response *JSONRPCResponse, err error, elapsed time.Duration) {
+	tool := toolCallName(request)
+	var unavailable *ServerUnavailableError
+	if errors.As(err, &unavailable) {
+		s.metrics.toolErrors.Inc(server.Name, tool, "unavailable")
+		return
+	}
+	s.metrics.toolCalls.Inc(server.Name, tool)
+	s.metrics.toolDuration.Observe(elapsed.Seconds(), server.Name, tool)
+	switch {
+	case errors.Is(err, ErrRequestCancelled):
+		s.metrics.toolErrors.Inc(server.Name, tool, "cancelled")
+	case err != nil:
+		s.metrics.toolErrors.Inc(server.Name, tool, "transport")
+	case response == nil:
+	case response.Error != nil:
+		s.metrics.toolErrors.Inc(server.Name, tool, "rpc")
+	case resultIsError(response.Result):
+		s.metrics.toolErrors.Inc(server.Name, tool, "tool")
+	}
+}
+
+// toolCallName extracts the tool name of a tools/call request
+func toolCallName(request JSONRPCRequest) string {
+	switch params := request.Params.(type) {
+	case CallToolParams:
+		return params.Name
+	case *CallToolParams:
+		return params.Name
+	case map[string]interface{}:
+		name, _ := params["name"].(string)
+		return name
+	}
+	var params CallToolParams
+	paramsBytes, _ := json.Marshal(request.Params)
+	json.Unmarshal(paramsBytes, &params)
+	return params.Name
+}
+
+func resultIsError(result interface{}) bool {
+	switch r := result.(type) {
+	case map[string]interface{}:
+		isError, _ := r["isError"].(bool)
+		return isError
+	case nil:
+		return false
+	}
+	var parsed struct {
+		IsError bool `json:"isError"`
+	}
+	resultBytes, _ := json.Marshal(result)
+	json.Unmarshal(resultBytes, &parsed)
+	return parsed.IsError
+}
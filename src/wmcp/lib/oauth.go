@@ -0,0 +1,726 @@
+package wmcplib
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth 2.1 authorization for remote MCP servers, following the MCP
+// authorization spec: protected resource metadata (RFC 9728), authorization
+// server metadata (RFC 8414), dynamic client registration (RFC 7591) and
+// the authorization code flow with PKCE using a loopback redirect.
+
+// oauthCallbackTimeout bounds how long we wait for the user to log in.
+const oauthCallbackTimeout = 5 * time.Minute
+
+// OAuthToken is the stored authorization state for one MCP server.
+type OAuthToken struct {
+	Resource      string    `json:"resource"`
+	AccessToken   string    `json:"access_token"`
+	RefreshToken  string    `json:"refresh_token,omitempty"`
+	TokenType     string    `json:"token_type,omitempty"`
+	Scope         string    `json:"scope,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at,omitempty"`
+	TokenEndpoint string    `json:"token_endpoint"`
+	ClientID      string    `json:"client_id"`
+	ClientSecret  string    `json:"client_secret,omitempty"`
+	RedirectURI   string    `json:"redirect_uri,omitempty"`
+}
+
+// expired reports whether the access token is expired or about to.
+func (t *OAuthToken) expired() bool {
+	return !t.ExpiresAt.IsZero() && time.Now().Add(30*time.Second).After(t.ExpiresAt)
+}
+
+type oauthServerMetadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	RegistrationEndpoint  string   `json:"registration_endpoint,omitempty"`
+	ScopesSupported       []string `json:"scopes_supported,omitempty"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+type oauthResourceMetadata struct {
+	Resource             string   `json:"resource"`
+	AuthorizationServers []string `json:"authorization_servers"`
+	ScopesSupported      []string `json:"scopes_supported,omitempty"`
+}
+
+type oauthTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// oauthState keeps the tokens loaded in memory, keyed by resource URL.
+// Stored tokens are never modified, a refresh stores a new one.
+type oauthState struct {
+	mu     sync.Mutex
+	tokens map[string]*OAuthToken
+	// flows serializes the refreshes and authorization flows of each
+	// resource, so a pending login does not block the other servers
+	flows map[string]*sync.Mutex
+}
+
+// token returns the token of a resource, loading it from disk the first
+// time it is needed.
+func (o *oauthState) token(resource string) *OAuthToken {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	token := o.tokens[resource]
+	if token == nil {
+		if token = loadOAuthToken(resource); token != nil {
+			o.store(resource, token)
+		}
+	}
+	return token
+}
+
+// store remembers the token of a resource. Callers must hold o.mu.
+func (o *oauthState) store(resource string, token *OAuthToken) {
+	if o.tokens == nil {
+		o.tokens = make(map[string]*OAuthToken)
+	}
+	o.tokens[resource] = token
+}
+
+func (o *oauthState) setToken(resource string, token *OAuthToken) {
+	o.mu.Lock()
+	o.store(resource, token)
+	o.mu.Unlock()
+}
+
+// lockResource takes the flow lock of a resource and returns its unlock
+// function.
+func (o *oauthState) lockResource(resource string) func() {
+	o.mu.Lock()
+	if o.flows == nil {
+		o.flows = make(map[string]*sync.Mutex)
+	}
+	flow := o.flows[resource]
+	if flow == nil {
+		flow = &sync.Mutex{}
+		o.flows[resource] = flow
+	}
+	o.mu.Unlock()
+	flow.Lock()
+	return flow.Unlock
+}
+
+// OAuthTokenDir returns the directory where OAuth tokens are stored. It can
+// be overridden with MAI_MCP_OAUTH_DIR.
+func OAuthTokenDir() string {
+	if dir := os.Getenv("MAI_MCP_OAUTH_DIR"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "mai", "mcp-oauth")
+}
+
+// oauthResourceURL returns the canonical resource URL of an HTTP server.
+// The configured URL is used because SSE servers later switch server.URL to
+// the message endpoint announced by the stream.
+func oauthResourceURL(server *MCPServer) string {
+	raw := server.Command
+	if raw == "" {
+		raw = server.URL
+	}
+	raw = strings.Replace(raw, "sses://", "https://", 1)
+	raw = strings.Replace(raw, "sse://", "http://", 1)
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return u.String()
+}
+
+func oauthTokenFile(resource string) string {
+	dir := OAuthTokenDir()
+	if dir == "" {
+		return ""
+	}
+	host := "server"
+	if u, err := url.Parse(resource); err == nil && u.Host != "" {
+		host = strings.NewReplacer(":", "_", "/", "_").Replace(u.Host)
+	}
+	sum := sha256.Sum256([]byte(resource))
+	return filepath.Join(dir, host+"-"+hex.EncodeToString(sum[:4])+".json")
+}
+
+func loadOAuthToken(resource string) *OAuthToken {
+	file := oauthTokenFile(resource)
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	var token OAuthToken
+	if err := json.Unmarshal(data, &token); err != nil || token.Resource != resource {
+		return nil
+	}
+	return &token
+}
+
+func saveOAuthToken(token *OAuthToken) error {
+	file := oauthTokenFile(token.Resource)
+	if file == "" {
+		return fmt.Errorf("cannot determine the token directory")
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0600)
+}
+
+// ForgetOAuthToken removes the stored authorization of an HTTP server so
+// the next request runs the authorization flow again.
+func (s *MCPService) ForgetOAuthToken(server *MCPServer) error {
+	resource := oauthResourceURL(server)
+	s.oauth.mu.Lock()
+	delete(s.oauth.tokens, resource)
+	s.oauth.mu.Unlock()
+	file := oauthTokenFile(resource)
+	if file == "" {
+		return nil
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// oauthAccessToken returns a valid access token for the server, refreshing
+// it silently when it expired. It never starts an interactive flow.
+func (s *MCPService) oauthAccessToken(server *MCPServer) string {
+	resource := oauthResourceURL(server)
+	token := s.oauth.token(resource)
+	if token == nil {
+		return ""
+	}
+	if !token.expired() {
+		return token.AccessToken
+	}
+
+	unlock := s.oauth.lockResource(resource)
+	defer unlock()
+	// Another request may have refreshed it while we waited
+	if token = s.oauth.token(resource); token == nil {
+		return ""
+	}
+	if token.expired() {
+		refreshed, err := s.refreshOAuthToken(token)
+		if err != nil {
+			debugLog(s.DebugMode, "OAuth refresh for %s failed: %v", resource, err)
+			return ""
+		}
+		s.oauth.setToken(resource, refreshed)
+		token = refreshed
+	}
+	return token.AccessToken
+}
+
+// authorizeServer handles a 401 answer from the server. It first tries to
+// refresh the stored token and falls back to the interactive authorization
+// code flow.
+func (s *MCPService) authorizeServer(server *MCPServer, challenge, staleToken string) error {
+	resource := oauthResourceURL(server)
+	// Only the requests to this server wait for the login to complete
+	unlock := s.oauth.lockResource(resource)
+	defer unlock()
+
+	token := s.oauth.token(resource)
+	if token != nil && token.AccessToken != staleToken && !token.expired() {
+		// Another request already obtained a new token
+		return nil
+	}
+	if token != nil && token.RefreshToken != "" {
+		refreshed, err := s.refreshOAuthToken(token)
+		if err == nil {
+			s.oauth.setToken(resource, refreshed)
+			return nil
+		}
+		debugLog(s.DebugMode, "OAuth refresh for %s failed: %v", resource, err)
+	}
+
+	token, err := s.runOAuthFlow(resource, challenge, token)
+	if err != nil {
+		return fmt.Errorf("authorization for %s failed: %v", resource, err)
+	}
+	s.oauth.setToken(resource, token)
+	return nil
+}
+
+// refreshOAuthToken exchanges the refresh token for a new access token and
+// tries to save the result. Callers must hold the flow lock of the resource.
+func (s *MCPService) refreshOAuthToken(current *OAuthToken) (*OAuthToken, error) {
+	if current.RefreshToken == "" {
+		return nil, fmt.Errorf("no refresh token")
+	}
+	token := *current
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+		"client_id":     {token.ClientID},
+		"resource":      {token.Resource},
+	}
+	if token.ClientSecret != "" {
+		form.Set("client_secret", token.ClientSecret)
+	}
+	resp, err := oauthTokenRequest(token.TokenEndpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	token.AccessToken = resp.AccessToken
+	token.TokenType = resp.TokenType
+	if resp.RefreshToken != "" {
+		token.RefreshToken = resp.RefreshToken
+	}
+	if resp.Scope != "" {
+		token.Scope = resp.Scope
+	}
+	token.ExpiresAt = oauthExpiry(resp.ExpiresIn)
+	debugLog(s.DebugMode, "OAuth token refreshed for %s", token.Resource)
+	// The old refresh token may be spent already, so the new token is used
+	// even when it cannot be stored
+	if err := saveOAuthToken(&token); err != nil {
+		log.Printf("Warning: cannot store OAuth token for %s: %v", token.Resource, err)
+	}
+	return &token, nil
+}
+
+// runOAuthFlow performs discovery, client registration and the
+// authorization code flow with PKCE. Callers must hold the flow lock of the
+// resource.
+func (s *MCPService) runOAuthFlow(resource, challenge string, previous *OAuthToken) (*OAuthToken, error) {
+	params := parseWWWAuthenticate(challenge)
+
+	resourceMeta := discoverResourceMetadata(resource, params["resource_metadata"])
+	issuer := oauthOrigin(resource)
+	scope := params["scope"]
+	if resourceMeta != nil {
+		if len(resourceMeta.AuthorizationServers) > 0 {
+			issuer = resourceMeta.AuthorizationServers[0]
+		}
+		if scope == "" && len(resourceMeta.ScopesSupported) > 0 {
+			scope = strings.Join(resourceMeta.ScopesSupported, " ")
+		}
+	}
+	serverMeta := discoverServerMetadata(issuer)
+	debugLog(s.DebugMode, "OAuth issuer %s: authorize=%s token=%s register=%s", issuer,
+		serverMeta.AuthorizationEndpoint, serverMeta.TokenEndpoint, serverMeta.RegistrationEndpoint)
+	if len(serverMeta.CodeChallengeMethods) > 0 && !containsString(serverMeta.CodeChallengeMethods, "S256") {
+		return nil, fmt.Errorf("authorization server does not support PKCE S256")
+	}
+
+	// Reuse the previous loopback port so the registered redirect matches
+	listener, err := oauthListen(previous)
+	if err != nil {
+		return nil, fmt.Errorf("cannot start the redirect listener: %v", err)
+	}
+	defer listener.Close()
+	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/callback", listener.Addr().(*net.TCPAddr).Port)
+
+	clientID, clientSecret := "", ""
+	if previous != nil && previous.RedirectURI == redirectURI && previous.TokenEndpoint == serverMeta.TokenEndpoint {
+		clientID, clientSecret = previous.ClientID, previous.ClientSecret
+	}
+	if clientID == "" {
+		clientID = os.Getenv("MAI_MCP_OAUTH_CLIENT_ID")
+		clientSecret = os.Getenv("MAI_MCP_OAUTH_CLIENT_SECRET")
+	}
+	if clientID == "" {
+		if serverMeta.RegistrationEndpoint == "" {
+			return nil, fmt.Errorf("no registration endpoint, set MAI_MCP_OAUTH_CLIENT_ID")
+		}
+		clientID, clientSecret, err = registerOAuthClient(serverMeta.RegistrationEndpoint, redirectURI, scope)
+		if err != nil {
+			return nil, fmt.Errorf("client registration failed: %v", err)
+		}
+		debugLog(s.DebugMode, "OAuth registered client %s", clientID)
+	}
+
+	verifier := randomURLString(32)
+	sum := sha256.Sum256([]byte(verifier))
+	codeChallenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	state := randomURLString(16)
+
+	authURL, err := url.Parse(serverMeta.AuthorizationEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization endpoint: %v", err)
+	}
+	q := authURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", clientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	q.Set("state", state)
+	q.Set("resource", resource)
+	if scope != "" {
+		q.Set("scope", scope)
+	}
+	authURL.RawQuery = q.Encode()
+
+	code, err := s.waitOAuthCallback(listener, authURL.String(), state)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {clientID},
+		"code_verifier": {verifier},
+		"resource":      {resource},
+	}
+	if clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+	resp, err := oauthTokenRequest(serverMeta.TokenEndpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	token := &OAuthToken{
+		Resource:      resource,
+		AccessToken:   resp.AccessToken,
+		RefreshToken:  resp.RefreshToken,
+		TokenType:     resp.TokenType,
+		Scope:         resp.Scope,
+		ExpiresAt:     oauthExpiry(resp.ExpiresIn),
+		TokenEndpoint: serverMeta.TokenEndpoint,
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		RedirectURI:   redirectURI,
+	}
+	if err := saveOAuthToken(token); err != nil {
+		log.Printf("Warning: cannot store OAuth token for %s: %v", resource, err)
+	}
+	return token, nil
+}
+
+// waitOAuthCallback opens the authorization URL and waits for the redirect
+// carrying the authorization code.
+func (s *MCPService) waitOAuthCallback(listener net.Listener, authURL, state string) (string, error) {
+	type result struct {
+		code string
+		err  error
+	}
+	done := make(chan result, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var res result
+		switch {
+		case q.Get("error") != "":
+			res.err = fmt.Errorf("%s %s", q.Get("error"), q.Get("error_description"))
+		case q.Get("state") != state:
+			res.err = fmt.Errorf("state mismatch in authorization response")
+		case q.Get("code") == "":
+			res.err = fmt.Errorf("missing authorization code")
+		default:
+			res.code = q.Get("code")
+		}
+		if res.err != nil {
+			http.Error(w, "Authorization failed: "+res.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Authorization complete, you can close this window.")
+		}
+		select {
+		case done <- res:
+		default:
+		}
+	})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(listener)
+	defer srv.Shutdown(context.Background())
+
+	opener := s.OAuthOpener
+	if opener == nil {
+		opener = openOAuthBrowser
+	}
+	if err := opener(authURL); err != nil {
+		return "", fmt.Errorf("cannot open authorization URL: %v", err)
+	}
+
+	select {
+	case res := <-done:
+		return res.code, res.err
+	case <-time.After(oauthCallbackTimeout):
+		return "", fmt.Errorf("timeout waiting for authorization")
+	}
+}
+
+// openOAuthBrowser prints the authorization URL and tries to open it.
+func openOAuthBrowser(authURL string) error {
+	fmt.Fprintf(os.Stderr, "MCP server requires authorization, open this URL to continue:\n%s\n", authURL)
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", authURL)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", authURL)
+	default:
+		cmd = exec.Command("xdg-open", authURL)
+	}
+	// Failing to launch a browser is fine, the URL was printed
+	_ = cmd.Start()
+	return nil
+}
+
+func oauthListen(previous *OAuthToken) (net.Listener, error) {
+	if previous != nil && previous.RedirectURI != "" {
+		if u, err := url.Parse(previous.RedirectURI); err == nil {
+			if l, err := net.Listen("tcp", "127.0.0.1:"+u.Port()); err == nil {
+				return l, nil
+			}
+		}
+	}
+	return net.Listen("tcp", "127.0.0.1:0")
+}
+
+func registerOAuthClient(endpoint, redirectURI, scope string) (string, string, error) {
+	body := map[string]interface{}{
+		"client_name":                "mai-wmcp",
+		"redirect_uris":              []string{redirectURI},
+		"grant_types":                []string{"authorization_code", "refresh_token"},
+		"response_types":             []string{"code"},
+		"token_endpoint_auth_method": "none",
+	}
+	if scope != "" {
+		body["scope"] = scope
+	}
+	reqBytes, _ := json.Marshal(body)
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(endpoint, "application/json", strings.NewReader(string(reqBytes)))
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	respBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", "", fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBytes)))
+	}
+	var reg struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := json.Unmarshal(respBytes, &reg); err != nil || reg.ClientID == "" {
+		return "", "", fmt.Errorf("invalid registration response: %s", strings.TrimSpace(string(respBytes)))
+	}
+	return reg.ClientID, reg.ClientSecret, nil
+}
+
+func oauthTokenRequest(endpoint string, form url.Values) (*oauthTokenResponse, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBytes, _ := io.ReadAll(resp.Body)
+	var token oauthTokenResponse
+	if err := json.Unmarshal(respBytes, &token); err != nil {
+		return nil, fmt.Errorf("invalid token response (status %d): %s", resp.StatusCode, strings.TrimSpace(string(respBytes)))
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("%s %s", token.Error, token.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return nil, fmt.Errorf("token request failed with status %d", resp.StatusCode)
+	}
+	return &token, nil
+}
+
+// discoverResourceMetadata fetches the protected resource metadata, either
+// from the URL announced in WWW-Authenticate or from the well-known paths.
+func discoverResourceMetadata(resource, announced string) *oauthResourceMetadata {
+	var candidates []string
+	if announced != "" {
+		candidates = append(candidates, announced)
+	}
+	if u, err := url.Parse(resource); err == nil {
+		origin := u.Scheme + "://" + u.Host
+		if path := strings.TrimSuffix(u.Path, "/"); path != "" {
+			candidates = append(candidates, origin+"/.well-known/oauth-protected-resource"+path)
+		}
+		candidates = append(candidates, origin+"/.well-known/oauth-protected-resource")
+	}
+	for _, candidate := range candidates {
+		var meta oauthResourceMetadata
+		if fetchOAuthJSON(candidate, &meta) == nil && len(meta.AuthorizationServers) > 0 {
+			return &meta
+		}
+	}
+	return nil
+}
+
+// discoverServerMetadata fetches the authorization server metadata. Servers
+// without metadata get the default endpoints relative to the issuer.
+func discoverServerMetadata(issuer string) *oauthServerMetadata {
+	issuer = strings.TrimSuffix(issuer, "/")
+	var candidates []string
+	if u, err := url.Parse(issuer); err == nil {
+		origin := u.Scheme + "://" + u.Host
+		if path := strings.TrimSuffix(u.Path, "/"); path != "" {
+			candidates = append(candidates,
+				origin+"/.well-known/oauth-authorization-server"+path,
+				origin+"/.well-known/openid-configuration"+path,
+				issuer+"/.well-known/openid-configuration")
+		} else {
+			candidates = append(candidates,
+				origin+"/.well-known/oauth-authorization-server",
+				origin+"/.well-known/openid-configuration")
+		}
+	}
+	for _, candidate := range candidates {
+		var meta oauthServerMetadata
+		if fetchOAuthJSON(candidate, &meta) == nil && meta.AuthorizationEndpoint != "" && meta.TokenEndpoint != "" {
+			return &meta
+		}
+	}
+	return &oauthServerMetadata{
+		Issuer:                issuer,
+		AuthorizationEndpoint: issuer + "/authorize",
+		TokenEndpoint:         issuer + "/token",
+		RegistrationEndpoint:  issuer + "/register",
+	}
+}
+
+func fetchOAuthJSON(endpoint string, v interface{}) error {
+	client := &http.Client{Timeout: 15 * time.Second}
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("MCP-Protocol-Version", "2025-06-18")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// parseWWWAuthenticate extracts the auth-params of a Bearer challenge.
+func parseWWWAuthenticate(header string) map[string]string {
+	params := map[string]string{}
+	header = strings.TrimSpace(header)
+	if len(header) >= 6 && strings.EqualFold(header[:6], "bearer") {
+		header = header[6:]
+	}
+	for header != "" {
+		header = strings.TrimLeft(header, " ,")
+		eq := strings.IndexByte(header, '=')
+		if eq <= 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(header[:eq]))
+		header = strings.TrimSpace(header[eq+1:])
+		var value string
+		if strings.HasPrefix(header, "\"") {
+			end := 1
+			for end < len(header) && header[end] != '"' {
+				if header[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end > len(header) {
+				end = len(header)
+			}
+			value = strings.ReplaceAll(header[1:end], "\\", "")
+			if end < len(header) {
+				end++
+			}
+			header = header[end:]
+		} else {
+			end := strings.IndexByte(header, ',')
+			if end < 0 {
+				end = len(header)
+			}
+			value = strings.TrimSpace(header[:end])
+			header = header[end:]
+		}
+		params[key] = value
+	}
+	return params
+}
+
+func oauthOrigin(resource string) string {
+	u, err := url.Parse(resource)
+	if err != nil {
+		return resource
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func oauthExpiry(expiresIn int64) time.Time {
+	if expiresIn <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(expiresIn) * time.Second)
+}
+
+func randomURLString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
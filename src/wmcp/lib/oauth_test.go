@@ -0,0 +1,287 @@
+package wmcplib
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// authServer is a stand-in MCP server protected by its own authorization
+// server, implementing the discovery, registration, authorize and token
+// endpoints used by the authorization code flow.
+type authServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	codes     map[string]string // code -> code_challenge
+	issued    int
+	refreshed int
+}
+
+func newAuthServer(t *testing.T) *authServer {
+	a := &authServer{codes: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
+		if !a.validToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer resource_metadata="%s/.well-known/oauth-protected-resource/mcp", scope="mcp"`, a.URL))
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			fmt.Fprintln(w, "ok")
+			return
+		}
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.ID == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		var result interface{} = map[string]interface{}{}
+		switch req.Method {
+		case "initialize":
+			result = map[string]interface{}{"protocolVersion": "2025-06-18", "capabilities": map[string]interface{}{"tools": map[string]interface{}{}}}
+		case "tools/list":
+			result = map[string]interface{}{"tools": []Tool{{Name: "remote_tool"}}}
+		}
+		json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result})
+	})
+	mux.HandleFunc("/.well-known/oauth-protected-resource/mcp", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oauthResourceMetadata{Resource: a.URL + "/mcp", AuthorizationServers: []string{a.URL + "/auth"}})
+	})
+	mux.HandleFunc("/.well-known/oauth-authorization-server/auth", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oauthServerMetadata{
+			Issuer:                a.URL + "/auth",
+			AuthorizationEndpoint: a.URL + "/auth/authorize",
+			TokenEndpoint:         a.URL + "/auth/token",
+			RegistrationEndpoint:  a.URL + "/auth/register",
+			CodeChallengeMethods:  []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/auth/register", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"client_id":"client-1"}`)
+	})
+	mux.HandleFunc("/auth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != "client-1" || q.Get("code_challenge_method") != "S256" || q.Get("resource") != a.URL+"/mcp" {
+			t.Errorf("unexpected authorization request: %s", r.URL.RawQuery)
+		}
+		a.mu.Lock()
+		code := fmt.Sprintf("code-%d", len(a.codes))
+		a.codes[code] = q.Get("code_challenge")
+		a.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+code+"&state="+q.Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("/auth/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			challenge, ok := a.codes[r.Form.Get("code")]
+			if !ok || challenge != pkceChallenge(r.Form.Get("code_verifier")) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_grant"}`)
+				return
+			}
+			delete(a.codes, r.Form.Get("code"))
+		case "refresh_token":
+			if r.Form.Get("refresh_token") != "refresh" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_grant"}`)
+				return
+			}
+			a.refreshed++
+		}
+		a.issued++
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":3600,"refresh_token":"refresh"}`, a.issued)
+	})
+	a.Server = httptest.NewServer(mux)
+	t.Cleanup(a.Close)
+	return a
+}
+
+func (a *authServer) validToken(token string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return token == fmt.Sprintf("token-%d", a.issued) && a.issued > 0
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// followAuthorization stands in for the browser: it opens the authorization
+// URL and follows the redirect to the loopback callback.
+func followAuthorization(authURL string) error {
+	resp, err := http.Get(authURL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("callback answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	t.Setenv("MAI_MCP_OAUTH_DIR", t.TempDir())
+	auth := newAuthServer(t)
+	s := NewMCPService(Options{OAuthOpener: followAuthorization})
+	server := &MCPServer{Name: "remote", URL: auth.URL + "/mcp", IsHTTP: true}
+
+	get := func() *http.Response {
+		resp, err := s.doHTTP(server, http.DefaultClient, func() (*http.Request, error) {
+			return http.NewRequest("GET", server.URL, nil)
+		})
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := get(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status after authorization = %d, want 200", resp.StatusCode)
+	}
+	if token := s.GetBearerToken(server); token != "token-1" {
+		t.Fatalf("bearer token = %q, want token-1", token)
+	}
+
+	// A new service reads the stored token and refreshes it once expired
+	s = NewMCPService(Options{OAuthOpener: func(string) error {
+		t.Error("the authorization flow ran again instead of refreshing")
+		return fmt.Errorf("unexpected login")
+	}})
+	stored := s.oauth.token(oauthResourceURL(server))
+	if stored == nil || stored.ClientID != "client-1" {
+		t.Fatalf("stored token = %+v", stored)
+	}
+	expired := *stored
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	s.oauth.setToken(oauthResourceURL(server), &expired)
+	if token := s.GetBearerToken(server); token != "token-2" || auth.refreshed != 1 {
+		t.Fatalf("bearer token after refresh = %q (%d refreshes), want token-2", token, auth.refreshed)
+	}
+	if resp := get(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status after refresh = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestOAuthPendingLoginDoesNotBlockOtherServers(t *testing.T) {
+	t.Setenv("MAI_MCP_OAUTH_DIR", t.TempDir())
+	auth := newAuthServer(t)
+	opened := make(chan struct{})
+	release := make(chan struct{})
+	s := NewMCPService(Options{OAuthOpener: func(authURL string) error {
+		close(opened)
+		<-release
+		return followAuthorization(authURL)
+	}})
+	pending := &MCPServer{Name: "pending", URL: auth.URL + "/mcp", IsHTTP: true}
+	other := &MCPServer{Name: "other", URL: "https://other.example/mcp", IsHTTP: true}
+	s.oauth.setToken(oauthResourceURL(other), &OAuthToken{Resource: oauthResourceURL(other), AccessToken: "other-token"})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.authorizeServer(pending, "", "")
+	}()
+	<-opened
+
+	got := make(chan string, 1)
+	go func() { got <- s.GetBearerToken(other) }()
+	select {
+	case token := <-got:
+		if token != "other-token" {
+			t.Errorf("bearer token of the other server = %q", token)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a pending login blocked the requests to another server")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("authorization failed: %v", err)
+	}
+	if token := s.GetBearerToken(pending); token != "token-1" {
+		t.Fatalf("bearer token = %q, want token-1", token)
+	}
+}
+
+func TestOAuthPendingLoginDoesNotBlockTheService(t *testing.T) {
+	t.Setenv("MAI_MCP_OAUTH_DIR", t.TempDir())
+	auth := newAuthServer(t)
+	opened := make(chan struct{})
+	release := make(chan struct{})
+	s := NewMCPService(Options{OAuthOpener: func(authURL string) error {
+		close(opened)
+		<-release
+		return followAuthorization(authURL)
+	}})
+	s.Servers["local"] = &MCPServer{Name: "local", Tools: []Tool{{Name: "local_tool"}}}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.startServer("remote", auth.URL+"/mcp", nil, nil, nil, false, 0)
+	}()
+	<-opened
+
+	resolved := make(chan error, 1)
+	go func() {
+		_, _, err := s.ResolveTool("local_tool")
+		resolved <- err
+	}()
+	select {
+	case err := <-resolved:
+		if err != nil {
+			t.Errorf("resolving a tool of another server: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a pending login while starting a server blocked the service")
+	}
+	if _, servers := s.SnapshotServers(); servers["remote"] != nil {
+		t.Error("the server was registered before it was initialized")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("starting the server failed: %v", err)
+	}
+	if _, name, err := s.ResolveTool("remote_tool"); err != nil || name != "remote_tool" {
+		t.Fatalf("tool of the started server = %q, %v", name, err)
+	}
+}
+
+func TestOAuthRefreshedTokenIsUsedWhenItCannotBeSaved(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("MAI_MCP_OAUTH_DIR", dir)
+	auth := newAuthServer(t)
+	s := NewMCPService(Options{OAuthOpener: followAuthorization})
+	server := &MCPServer{Name: "remote", URL: auth.URL + "/mcp", IsHTTP: true}
+	resource := oauthResourceURL(server)
+	if err := s.authorizeServer(server, "", ""); err != nil {
+		t.Fatalf("authorization failed: %v", err)
+	}
+
+	// A file in place of the token directory makes saving fail
+	blocked := dir + "/blocked"
+	if err := os.WriteFile(blocked, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MAI_MCP_OAUTH_DIR", blocked+"/tokens")
+	expired := *s.oauth.token(resource)
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	s.oauth.setToken(resource, &expired)
+	if token := s.GetBearerToken(server); token != "token-2" {
+		t.Fatalf("bearer token after refresh = %q, want token-2", token)
+	}
+}
@@ -0,0 +1,564 @@
+package wmcplib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxOpenAPIResponse limits how much of a response body is returned to the
+// model.
+const maxOpenAPIResponse = 1 << 20
+
+// openAPIMaxRefDepth bounds $ref expansion so recursive schemas terminate.
+const openAPIMaxRefDepth = 5
+
+var openAPIMethods = []string{"get", "put", "post", "delete", "patch", "head", "options"}
+
+var (
+	invalidToolNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+	repeatedUnderscores  = regexp.MustCompile(`__+`)
+)
+
+// openAPIBackend serves the operations of an OpenAPI 3 document as the tools
+// of an in-process MCP server.
+type openAPIBackend struct {
+	config     MCPServerConfig
+	doc        map[string]interface{}
+	title      string
+	version    string
+	baseURL    string
+	tools      []Tool
+	operations map[string]*openAPIOperation
+	client     *http.Client
+}
+
+type openAPIOperation struct {
+	method      string
+	path        string
+	params      []openAPIParam
+	bodyType    string
+	hasBody     bool
+	requireBody bool
+}
+
+type openAPIParam struct {
+	key      string
+	name     string
+	in       string
+	required bool
+}
+
+// loadOpenAPIBackend parses the spec file of the server config
+func loadOpenAPIBackend(cfg MCPServerConfig) (*openAPIBackend, error) {
+	data, err := os.ReadFile(cfg.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAPI spec: %v", err)
+	}
+	var doc map[string]interface{}
+	ext := strings.ToLower(filepath.Ext(cfg.Spec))
+	if ext == ".json" || bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec: %v", err)
+	}
+	if version := fmt.Sprint(doc["openapi"]); !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("%s is not an OpenAPI 3 document", cfg.Spec)
+	}
+
+	b := &openAPIBackend{
+		config:     cfg,
+		doc:        doc,
+		operations: make(map[string]*openAPIOperation),
+		client:     &http.Client{Timeout: 60 * time.Second},
+	}
+	if cfg.Timeout > 0 {
+		b.client.Timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	if info, ok := doc["info"].(map[string]interface{}); ok {
+		b.title, _ = info["title"].(string)
+		b.version, _ = info["version"].(string)
+	}
+	b.baseURL = cfg.URL
+	if b.baseURL == "" {
+		b.baseURL = openAPIServerURL(doc)
+	}
+	if !strings.HasPrefix(b.baseURL, "http://") && !strings.HasPrefix(b.baseURL, "https://") {
+		return nil, fmt.Errorf("no absolute server URL in %s, set \"url\" in the server config", cfg.Spec)
+	}
+	b.baseURL = strings.TrimSuffix(b.baseURL, "/")
+	b.buildTools()
+	return b, nil
+}
+
+// openAPIServerURL returns the first server URL with its variables replaced
+// by their default values
+func openAPIServerURL(doc map[string]interface{}) string {
+	servers, _ := doc["servers"].([]interface{})
+	if len(servers) == 0 {
+		return ""
+	}
+	server, _ := servers[0].(map[string]interface{})
+	u, _ := server["url"].(string)
+	vars, _ := server["variables"].(map[string]interface{})
+	for name, v := range vars {
+		if m, ok := v.(map[string]interface{}); ok {
+			u = strings.ReplaceAll(u, "{"+name+"}", fmt.Sprint(m["default"]))
+		}
+	}
+	return u
+}
+
+// buildTools turns every operation of the document into a tool
+func (b *openAPIBackend) buildTools() {
+	paths, _ := b.doc["paths"].(map[string]interface{})
+	pathNames := make([]string, 0, len(paths))
+	for p := range paths {
+		pathNames = append(pathNames, p)
+	}
+	sort.Strings(pathNames)
+
+	for _, p := range pathNames {
+		item, _ := b.resolve(paths[p], 0).(map[string]interface{})
+		if item == nil {
+			continue
+		}
+		shared, _ := item["parameters"].([]interface{})
+		for _, method := range openAPIMethods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name := b.toolName(op, method, p)
+			tool, operation := b.buildOperation(op, shared, method, p)
+			tool.Name = name
+			b.tools = append(b.tools, tool)
+			b.operations[name] = operation
+		}
+	}
+}
+
+// toolName derives a unique tool name from the operationId, or from the
+// method and path when there is none
+func (b *openAPIBackend) toolName(op map[string]interface{}, method, path string) string {
+	base, _ := op["operationId"].(string)
+	if base == "" {
+		// "get /pets/{petId}" becomes "get_pets_petId"
+		base = method + "_" + strings.NewReplacer("/", "_", "{", "", "}", "").Replace(path)
+		base = repeatedUnderscores.ReplaceAllString(base, "_")
+	}
+	base = invalidToolNameChars.ReplaceAllString(base, "_")
+	base = strings.Trim(base, "_")
+	if len(base) > 60 {
+		base = base[:60]
+	}
+	name := base
+	for i := 2; b.operations[name] != nil; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	return name
+}
+
+func (b *openAPIBackend) buildOperation(op map[string]interface{}, shared []interface{}, method, path string) (Tool, *openAPIOperation) {
+	operation := &openAPIOperation{method: strings.ToUpper(method), path: path}
+	properties := make(map[string]interface{})
+	var required []interface{}
+
+	var params []interface{}
+	params = append(params, shared...)
+	if own, ok := op["parameters"].([]interface{}); ok {
+		params = append(params, own...)
+	}
+	// Operation parameters override the path-level ones with the same name
+	// and location.
+	seen := make(map[string]int)
+	for _, raw := range params {
+		param, _ := b.resolve(raw, 0).(map[string]interface{})
+		if param == nil {
+			continue
+		}
+		name, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+		if name == "" || in == "" {
+			continue
+		}
+		prop := map[string]interface{}{"type": "string"}
+		if schema, ok := param["schema"].(map[string]interface{}); ok {
+			prop = copySchema(schema)
+		}
+		if desc, ok := param["description"].(string); ok && desc != "" {
+			prop["description"] = desc
+		}
+		p := openAPIParam{key: name, name: name, in: in}
+		p.required, _ = param["required"].(bool)
+		if in == "path" {
+			p.required = true
+		}
+		if idx, ok := seen[in+":"+name]; ok {
+			p.key = operation.params[idx].key
+			operation.params[idx] = p
+		} else {
+			if _, clash := properties[p.key]; clash {
+				p.key = in + "_" + name
+			}
+			seen[in+":"+name] = len(operation.params)
+			operation.params = append(operation.params, p)
+		}
+		properties[p.key] = prop
+	}
+	for _, p := range operation.params {
+		if p.required {
+			required = append(required, p.key)
+		}
+	}
+
+	if body, ok := b.resolve(op["requestBody"], 0).(map[string]interface{}); ok {
+		content, _ := body["content"].(map[string]interface{})
+		bodyType, media := pickMediaType(content)
+		if bodyType != "" {
+			operation.hasBody = true
+			operation.bodyType = bodyType
+			operation.requireBody, _ = body["required"].(bool)
+			prop := map[string]interface{}{}
+			if schema, ok := media["schema"].(map[string]interface{}); ok {
+				prop = copySchema(schema)
+			}
+			if desc, ok := body["description"].(string); ok && desc != "" {
+				prop["description"] = desc
+			} else if _, ok := prop["description"]; !ok {
+				prop["description"] = "Request body (" + bodyType + ")"
+			}
+			properties["body"] = prop
+			if operation.requireBody {
+				required = append(required, "body")
+			}
+		}
+	}
+
+	var desc []string
+	for _, key := range []string{"summary", "description"} {
+		if text, ok := op[key].(string); ok && strings.TrimSpace(text) != "" {
+			desc = append(desc, strings.TrimSpace(text))
+		}
+	}
+	desc = append(desc, fmt.Sprintf("(%s %s)", operation.method, path))
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	tool := Tool{
+		Description: strings.Join(desc, "\n\n"),
+		InputSchema: schema,
+	}
+	tool.Parameters = ExtractParametersFromSchema(schema)
+	return tool, operation
+}
+
+// pickMediaType prefers JSON request bodies, then forms, then anything else
+func pickMediaType(content map[string]interface{}) (string, map[string]interface{}) {
+	types := make([]string, 0, len(content))
+	for t := range content {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	rank := func(t string) int {
+		switch {
+		case t == "application/json" || strings.HasSuffix(t, "+json"):
+			return 0
+		case t == "application/x-www-form-urlencoded":
+			return 1
+		case strings.HasPrefix(t, "text/"):
+			return 2
+		}
+		return 3
+	}
+	sort.SliceStable(types, func(i, j int) bool { return rank(types[i]) < rank(types[j]) })
+	if len(types) == 0 {
+		return "", nil
+	}
+	media, _ := content[types[0]].(map[string]interface{})
+	return types[0], media
+}
+
+// resolve returns a copy of v with the local $ref pointers expanded and the
+// YAML specific map types converted to JSON ones
+func (b *openAPIBackend) resolve(v interface{}, depth int) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := value["$ref"].(string); ok {
+			if depth >= openAPIMaxRefDepth {
+				return map[string]interface{}{}
+			}
+			return b.resolve(b.lookupRef(ref), depth+1)
+		}
+		out := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			out[k] = b.resolve(item, depth)
+		}
+		return out
+	case map[interface{}]interface{}:
+		// YAML mappings with non-string keys (e.g. status codes)
+		out := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			out[fmt.Sprint(k)] = b.resolve(item, depth)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, item := range value {
+			out[i] = b.resolve(item, depth)
+		}
+		return out
+	}
+	return v
+}
+
+// lookupRef follows a "#/a/b" JSON pointer inside the document
+func (b *openAPIBackend) lookupRef(ref string) interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		log.Printf("Warning: unsupported OpenAPI reference %s", ref)
+		return map[string]interface{}{}
+	}
+	var node interface{} = b.doc
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return map[string]interface{}{}
+		}
+		node = m[part]
+	}
+	if node == nil {
+		return map[string]interface{}{}
+	}
+	return node
+}
+
+// copySchema makes a shallow copy so descriptions can be set per tool
+func copySchema(schema map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(schema))
+	for k, v := range schema {
+		out[k] = v
+	}
+	return out
+}
+
+// handle answers the MCP requests sent to the backend
+func (b *openAPIBackend) handle(request JSONRPCRequest) *JSONRPCResponse {
+	switch request.Method {
+	case "initialize":
+		name := b.title
+		if name == "" {
+			name = "openapi"
+		}
+		return &JSONRPCResponse{JSONRPC: "2.0", ID: request.ID, Result: map[string]interface{}{
+			"protocolVersion": "2024-11-05",
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": name, "version": b.version},
+		}}
+	case "tools/list":
+		return &JSONRPCResponse{JSONRPC: "2.0", ID: request.ID, Result: map[string]interface{}{"tools": b.tools}}
+	case "tools/call":
+		var params CallToolParams
+		if err := DecodeJSONRPCParams(request.Params, &params); err != nil {
+			return &JSONRPCResponse{JSONRPC: "2.0", ID: request.ID, Error: RPCError{Code: -32602, Message: "invalid params"}}
+		}
+		operation, ok := b.operations[params.Name]
+		if !ok {
+			return &JSONRPCResponse{JSONRPC: "2.0", ID: request.ID, Error: RPCError{Code: -32602, Message: fmt.Sprintf("unknown tool: %s", params.Name)}}
+		}
+		result, err := b.call(operation, params.Arguments)
+		if err != nil {
+			return &JSONRPCResponse{JSONRPC: "2.0", ID: request.ID, Result: map[string]interface{}{
+				"content": []Content{{Type: "text", Text: err.Error()}},
+				"isError": true,
+			}}
+		}
+		return &JSONRPCResponse{JSONRPC: "2.0", ID: request.ID, Result: result}
+	}
+	return &JSONRPCResponse{JSONRPC: "2.0", ID: request.ID, Error: RPCError{Code: -32601, Message: fmt.Sprintf("method not found: %s", request.Method)}}
+}
+
+// call performs the HTTP request of an operation and returns the tool
+// result, with the parsed response as structured content.
+func (b *openAPIBackend) call(op *openAPIOperation, args map[string]interface{}) (map[string]interface{}, error) {
+	path := op.path
+	query := url.Values{}
+	headers := http.Header{}
+	var cookies []string
+	for _, p := range op.params {
+		value, ok := args[p.key]
+		if !ok || value == nil {
+			if p.required {
+				return nil, fmt.Errorf("missing required parameter '%s'", p.key)
+			}
+			continue
+		}
+		switch p.in {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+p.name+"}", url.PathEscape(formatOpenAPIValue(value)))
+		case "query":
+			if list, ok := value.([]interface{}); ok {
+				for _, item := range list {
+					query.Add(p.name, formatOpenAPIValue(item))
+				}
+			} else {
+				query.Set(p.name, formatOpenAPIValue(value))
+			}
+		case "header":
+			headers.Set(p.name, formatOpenAPIValue(value))
+		case "cookie":
+			cookies = append(cookies, p.name+"="+url.QueryEscape(formatOpenAPIValue(value)))
+		}
+	}
+
+	target := b.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if op.hasBody {
+		if value, ok := args["body"]; ok && value != nil {
+			data, err := encodeOpenAPIBody(op.bodyType, value)
+			if err != nil {
+				return nil, err
+			}
+			body = bytes.NewReader(data)
+			headers.Set("Content-Type", op.bodyType)
+		} else if op.requireBody {
+			return nil, fmt.Errorf("missing required parameter 'body'")
+		}
+	}
+
+	req, err := http.NewRequest(op.method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header = headers
+	if len(cookies) > 0 {
+		req.Header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	req.Header.Set("Accept", "application/json, */*;q=0.5")
+	for k, v := range b.config.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %v", op.method, target, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOpenAPIResponse))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	structured := map[string]interface{}{
+		"status":      resp.StatusCode,
+		"contentType": contentType,
+	}
+	text := string(data)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var parsed interface{}
+	if (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) && json.Unmarshal(data, &parsed) == nil {
+		structured["body"] = parsed
+		if pretty, err := json.MarshalIndent(parsed, "", "  "); err == nil {
+			text = string(pretty)
+		}
+	} else {
+		structured["body"] = text
+	}
+	if resp.StatusCode >= 400 {
+		text = fmt.Sprintf("HTTP %d\n%s", resp.StatusCode, text)
+	}
+	return map[string]interface{}{
+		"content":           []Content{{Type: "text", Text: text}},
+		"structuredContent": structured,
+		"isError":           resp.StatusCode >= 400,
+	}, nil
+}
+
+func formatOpenAPIValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
+
+// encodeOpenAPIBody serializes the body argument for the media type
+func encodeOpenAPIBody(mediaType string, value interface{}) ([]byte, error) {
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("body must be an object for %s", mediaType)
+		}
+		form := url.Values{}
+		for k, v := range fields {
+			form.Set(k, formatOpenAPIValue(v))
+		}
+		return []byte(form.Encode()), nil
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return json.Marshal(value)
+	}
+	if text, ok := value.(string); ok {
+		return []byte(text), nil
+	}
+	return json.Marshal(value)
+}
+
+// startOpenAPIServer registers an in-process server for an OpenAPI spec
+func (s *MCPService) startOpenAPIServer(name string, cfg MCPServerConfig) error {
+	backend, err := loadOpenAPIBackend(cfg)
+	if err != nil {
+		return err
+	}
+
+	server := &MCPServer{
+		Name:          name,
+		Command:       cfg.CommandString(),
+		URL:           backend.baseURL,
+		Tools:         []Tool{},
+		EnabledTools:  cfg.Tools,
+		DisabledTools: cfg.DisabledTools,
+		openapi:       backend,
+		timeout:       backend.client.Timeout,
+	}
+	if err := s.InitializeServer(server); err != nil {
+		return fmt.Errorf("failed to initialize server: %v", err)
+	}
+	if err := s.loadTools(server); err != nil {
+		log.Printf("Warning: failed to load tools for server %s: %v", name, err)
+	}
+	if err := s.registerServer(server); err != nil {
+		return err
+	}
+	log.Printf("Loaded OpenAPI server %s from %s (%s)", name, cfg.Spec, backend.baseURL)
+	return nil
+}
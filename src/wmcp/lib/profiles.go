@@ -0,0 +1,294 @@
+package wmcplib
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ProfileConfig describes a virtual toolset: which tools a client sees and
+// how they are presented.
+type ProfileConfig struct {
+	// Tools selects tools with "server/glob" or "glob" patterns. Patterns
+	// starting with "!" exclude tools. An empty list selects every tool.
+	Tools []string `json:"tools,omitempty"`
+	// Overrides is keyed by "server/tool" or "tool"
+	Overrides map[string]ToolOverride `json:"overrides,omitempty"`
+}
+
+// ToolOverride changes how a tool is exposed in a profile
+type ToolOverride struct {
+	Name        string                 `json:"name,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Arguments   map[string]interface{} `json:"arguments,omitempty"`
+	Defaults    map[string]interface{} `json:"defaults,omitempty"`
+	Hide        []string               `json:"hide,omitempty"`
+}
+
+// ProfileTool is a tool as seen through a profile
+type ProfileTool struct {
+	Server   string
+	Original string
+	Tool     Tool
+	// Alias is true when the tool was renamed and is exposed without the
+	// server prefix
+	Alias    bool
+	override *ToolOverride
+}
+
+// QualifiedName returns the name used in the aggregated MCP listing
+func (t ProfileTool) QualifiedName() string {
+	if t.Alias {
+		return t.Tool.Name
+	}
+	return t.Server + AggregatedNameSeparator + t.Tool.Name
+}
+
+// ApplyArguments injects the fixed and default values of the profile and
+// drops the hidden parameters the client should not set.
+func (t ProfileTool) ApplyArguments(args map[string]interface{}) map[string]interface{} {
+	if t.override == nil {
+		return args
+	}
+	result := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		result[k] = v
+	}
+	for _, name := range t.override.Hide {
+		delete(result, name)
+	}
+	for k, v := range t.override.Defaults {
+		if _, ok := result[k]; !ok {
+			result[k] = v
+		}
+	}
+	for k, v := range t.override.Arguments {
+		result[k] = v
+	}
+	return result
+}
+
+// SetProfiles replaces the profiles defined in the configuration
+func (s *MCPService) SetProfiles(profiles map[string]ProfileConfig) {
+	s.profilesLock.Lock()
+	s.profiles = profiles
+	s.profilesLock.Unlock()
+}
+
+// ProfileNames returns the names of the configured profiles
+func (s *MCPService) ProfileNames() []string {
+	s.profilesLock.RLock()
+	defer s.profilesLock.RUnlock()
+	names := make([]string, 0, len(s.profiles))
+	for name := range s.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupProfile resolves the profile name, falling back to DefaultProfile.
+// A nil profile means that every tool is exposed unchanged.
+func (s *MCPService) lookupProfile(name string) (*ProfileConfig, error) {
+	if name == "" {
+		name = s.DefaultProfile
+	}
+	if name == "" {
+		return nil, nil
+	}
+	s.profilesLock.RLock()
+	defer s.profilesLock.RUnlock()
+	profile, ok := s.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile '%s' not found", name)
+	}
+	return &profile, nil
+}
+
+// ProfileTools returns the tools visible in a profile, sorted by server.
+// The empty name selects DefaultProfile, or every tool when it is unset.
+func (s *MCPService) ProfileTools(name string) ([]ProfileTool, error) {
+	profile, err := s.lookupProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	names, snapshot := s.SnapshotServers()
+	tools := make([]ProfileTool, 0)
+	for _, serverName := range names {
+		server := snapshot[serverName]
+		server.Mutex.RLock()
+		for _, tool := range server.Tools {
+			if len(tool.Parameters) == 0 && tool.InputSchema != nil {
+				tool.Parameters = ExtractParametersFromSchema(tool.InputSchema)
+			}
+			entry := ProfileTool{Server: serverName, Original: tool.Name, Tool: tool}
+			if profile != nil {
+				if !profile.selects(serverName, tool.Name) {
+					continue
+				}
+				entry.override = profile.overrideFor(serverName, tool.Name)
+				entry.apply()
+			}
+			tools = append(tools, entry)
+		}
+		server.Mutex.RUnlock()
+	}
+	return tools, nil
+}
+
+// ResolveProfileTool finds a tool exposed by a profile from its aggregated
+// ("server::tool"), alias or plain name.
+func (s *MCPService) ResolveProfileTool(profile, name string) (*MCPServer, ProfileTool, error) {
+	tools, err := s.ProfileTools(profile)
+	if err != nil {
+		return nil, ProfileTool{}, err
+	}
+	serverName, toolName, qualified := splitAggregatedIdentifier(name)
+	var matches []ProfileTool
+	for _, t := range tools {
+		if qualified {
+			if t.Server == serverName && t.Tool.Name == toolName {
+				matches = append(matches, t)
+			}
+		} else if t.Tool.Name == name {
+			matches = append(matches, t)
+		}
+	}
+	if len(matches) == 0 && s.DrunkMode {
+		candidates := make([]Tool, 0, len(tools))
+		for _, t := range tools {
+			if !qualified || t.Server == serverName {
+				candidates = append(candidates, Tool{Name: t.Tool.Name})
+			}
+		}
+		if matched, ok := findBestToolMatch(candidates, toolName, true); ok {
+			for _, t := range tools {
+				if t.Tool.Name == matched && (!qualified || t.Server == serverName) {
+					matches = append(matches, t)
+				}
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, ProfileTool{}, fmt.Errorf("tool '%s' not found", name)
+	case 1:
+	default:
+		return nil, ProfileTool{}, fmt.Errorf("tool '%s' is available on multiple servers; prefix with server name", name)
+	}
+	s.Mutex.RLock()
+	server, ok := s.Servers[matches[0].Server]
+	s.Mutex.RUnlock()
+	if !ok {
+		return nil, ProfileTool{}, fmt.Errorf("server '%s' not found", matches[0].Server)
+	}
+	return server, matches[0], nil
+}
+
+// selects reports whether the profile exposes the tool
+func (p *ProfileConfig) selects(server, tool string) bool {
+	included := true
+	for _, pattern := range p.Tools {
+		if !strings.HasPrefix(pattern, "!") {
+			included = false
+			break
+		}
+	}
+	for _, pattern := range p.Tools {
+		exclude := strings.HasPrefix(pattern, "!")
+		if matchToolPattern(strings.TrimPrefix(pattern, "!"), server, tool) {
+			if exclude {
+				return false
+			}
+			included = true
+		}
+	}
+	return included
+}
+
+func (p *ProfileConfig) overrideFor(server, tool string) *ToolOverride {
+	if o, ok := p.Overrides[server+"/"+tool]; ok {
+		return &o
+	}
+	if o, ok := p.Overrides[tool]; ok {
+		return &o
+	}
+	return nil
+}
+
+// matchToolPattern matches "server/glob" or "glob" against a tool
+func matchToolPattern(pattern, server, tool string) bool {
+	if i := strings.Index(pattern, "/"); i >= 0 {
+		if ok, _ := path.Match(pattern[:i], server); !ok {
+			return false
+		}
+		pattern = pattern[i+1:]
+	}
+	ok, _ := path.Match(pattern, tool)
+	return ok
+}
+
+// apply renames the tool and rewrites its schema following the override
+func (t *ProfileTool) apply() {
+	o := t.override
+	if o == nil {
+		return
+	}
+	if o.Name != "" {
+		t.Tool.Name = o.Name
+		t.Alias = true
+	}
+	if o.Description != "" {
+		t.Tool.Description = o.Description
+	}
+	if t.Tool.InputSchema == nil || (len(o.Hide) == 0 && len(o.Arguments) == 0 && len(o.Defaults) == 0) {
+		return
+	}
+
+	hidden := make(map[string]bool)
+	for _, name := range o.Hide {
+		hidden[name] = true
+	}
+	for name := range o.Arguments {
+		hidden[name] = true
+	}
+
+	schema := make(map[string]interface{}, len(t.Tool.InputSchema))
+	for k, v := range t.Tool.InputSchema {
+		schema[k] = v
+	}
+	if props, ok := t.Tool.InputSchema["properties"].(map[string]interface{}); ok {
+		newProps := make(map[string]interface{}, len(props))
+		for name, prop := range props {
+			if hidden[name] {
+				continue
+			}
+			if def, ok := o.Defaults[name]; ok {
+				if m, ok := prop.(map[string]interface{}); ok {
+					withDefault := make(map[string]interface{}, len(m)+1)
+					for k, v := range m {
+						withDefault[k] = v
+					}
+					withDefault["default"] = def
+					prop = withDefault
+				}
+			}
+			newProps[name] = prop
+		}
+		schema["properties"] = newProps
+	}
+	if required, ok := t.Tool.InputSchema["required"].([]interface{}); ok {
+		newRequired := make([]interface{}, 0, len(required))
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, hasDefault := o.Defaults[name]; hidden[name] || hasDefault {
+				continue
+			}
+			newRequired = append(newRequired, r)
+		}
+		schema["required"] = newRequired
+	}
+	t.Tool.InputSchema = schema
+	t.Tool.Parameters = ExtractParametersFromSchema(schema)
+}
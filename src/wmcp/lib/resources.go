@@ -0,0 +1,260 @@
+package wmcplib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	mcplib "mai/src/mcps/lib"
+)
+
+// resourceSubscription is a resource URI subscribed by a client, as it
+// named it, and the resource of the server it resolves to
+type resourceSubscription struct {
+	client string
+	uri    string
+	server string
+	rawURI string
+}
+
+func resourceSubKey(client, uri string) string {
+	return client + "\x00" + uri
+}
+
+// AggregateResourceTemplateList returns the combined resource templates
+// across all servers, prefixed with the server name like the resources.
+func (s *MCPService) AggregateResourceTemplateList() []ResourceTemplate {
+	names, snapshot := s.SnapshotServers()
+	templates := make([]ResourceTemplate, 0)
+	for _, name := range names {
+		server := snapshot[name]
+		server.Mutex.RLock()
+		for _, template := range server.ResourceTemplates {
+			copyTemplate := template
+			copyTemplate.URITemplate = name + AggregatedNameSeparator + template.URITemplate
+			templates = append(templates, copyTemplate)
+		}
+		server.Mutex.RUnlock()
+	}
+	return templates
+}
+
+// matchResourceTemplate reports whether uri is an expansion of one of the
+// resource templates of the server
+func matchResourceTemplate(server *MCPServer, uri string) bool {
+	for _, template := range server.ResourceTemplates {
+		parsed, err := mcplib.ParseURITemplate(template.URITemplate)
+		if err != nil {
+			continue
+		}
+		if _, ok := parsed.Match(uri); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SubscribeResource subscribes a client to the updates of a (possibly
+// aggregated) resource URI. The subscription is forwarded to the owning
+// server when no other client is subscribed to the resource.
+func (s *MCPService) SubscribeResource(client, uri string) error {
+	server, rawURI, err := s.ResolveResource(uri)
+	if err != nil {
+		return err
+	}
+
+	key := resourceSubKey(client, uri)
+	s.resourceSubsLock.Lock()
+	if _, exists := s.resourceSubs[key]; exists {
+		s.resourceSubsLock.Unlock()
+		return nil
+	}
+	if s.resourceSubs == nil {
+		s.resourceSubs = make(map[string]*resourceSubscription)
+	}
+	s.resourceSubs[key] = &resourceSubscription{client: client, uri: uri, server: server.Name, rawURI: rawURI}
+	first := s.backendSubscribers(server.Name, rawURI) == 1
+	s.resourceSubsLock.Unlock()
+
+	if !first {
+		return nil
+	}
+	if err := s.forwardSubscription(server, "resources/subscribe", rawURI); err != nil {
+		s.resourceSubsLock.Lock()
+		delete(s.resourceSubs, key)
+		s.resourceSubsLock.Unlock()
+		return err
+	}
+	debugLog(s.DebugMode, "Subscribed to resource %s of server %s", rawURI, server.Name)
+	return nil
+}
+
+// UnsubscribeResource drops a subscription made with SubscribeResource.
+// The owning server is told when no client is subscribed to the resource.
+func (s *MCPService) UnsubscribeResource(client, uri string) error {
+	key := resourceSubKey(client, uri)
+	s.resourceSubsLock.Lock()
+	sub, exists := s.resourceSubs[key]
+	if !exists {
+		s.resourceSubsLock.Unlock()
+		return fmt.Errorf("resource '%s' is not subscribed", uri)
+	}
+	delete(s.resourceSubs, key)
+	last := s.backendSubscribers(sub.server, sub.rawURI) == 0
+	s.resourceSubsLock.Unlock()
+
+	if !last {
+		return nil
+	}
+	return s.releaseSubscription(sub)
+}
+
+// dropClientResources drops the subscriptions of a client whose session
+// ended
+func (s *MCPService) dropClientResources(client string) {
+	s.resourceSubsLock.Lock()
+	var released []*resourceSubscription
+	for key, sub := range s.resourceSubs {
+		if sub.client != client {
+			continue
+		}
+		delete(s.resourceSubs, key)
+		if s.backendSubscribers(sub.server, sub.rawURI) == 0 {
+			released = append(released, sub)
+		}
+	}
+	s.resourceSubsLock.Unlock()
+
+	for _, sub := range released {
+		if err := s.releaseSubscription(sub); err != nil {
+			log.Printf("Warning: failed to unsubscribe from resource %s of server %s: %v", sub.rawURI, sub.server, err)
+		}
+	}
+}
+
+// releaseSubscription unsubscribes from the resource of a server nobody
+// is subscribed to anymore
+func (s *MCPService) releaseSubscription(sub *resourceSubscription) error {
+	_, snapshot := s.SnapshotServers()
+	server, exists := snapshot[sub.server]
+	if !exists {
+		return nil
+	}
+	return s.forwardSubscription(server, "resources/unsubscribe", sub.rawURI)
+}
+
+// backendSubscribers counts the subscriptions resolving to the resource of
+// a server. Callers hold resourceSubsLock.
+func (s *MCPService) backendSubscribers(server, uri string) int {
+	count := 0
+	for _, sub := range s.resourceSubs {
+		if sub.server == server && sub.rawURI == uri {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *MCPService) forwardSubscription(server *MCPServer, method, uri string) error {
+	server.Mutex.RLock()
+	supported := server.openapi == nil && (!server.HasCapabilities || server.SupportsSubscribe)
+	server.Mutex.RUnlock()
+	if !supported {
+		return fmt.Errorf("server '%s' does not support resource subscriptions", server.Name)
+	}
+	response, err := s.SendRequest(server, JSONRPCRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  ReadResourceParams{URI: uri},
+		ID:      "7",
+	})
+	if err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%s failed: %v", method, response.Error)
+	}
+	return nil
+}
+
+// resubscribeResources renews the subscriptions of a restarted server
+func (s *MCPService) resubscribeResources(server *MCPServer) {
+	s.resourceSubsLock.Lock()
+	uris := make(map[string]bool)
+	for _, sub := range s.resourceSubs {
+		if sub.server == server.Name {
+			uris[sub.rawURI] = true
+		}
+	}
+	s.resourceSubsLock.Unlock()
+
+	for uri := range uris {
+		if err := s.forwardSubscription(server, "resources/subscribe", uri); err != nil {
+			log.Printf("Warning: failed to subscribe again to resource %s of server %s: %v", uri, server.Name, err)
+		}
+	}
+}
+
+// handleServerNotification handles a message sent by a server if it is a
+// notification and reports whether it was one. Resource updates are
+// forwarded to the subscribed clients only and list changes reload the catalog
+// of the server.
+func (s *MCPService) handleServerNotification(server *MCPServer, payload []byte) bool {
+	var msg struct {
+		ID     interface{}     `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(payload, &msg); err != nil || msg.Method == "" || msg.ID != nil {
+		return false
+	}
+	debugLog(s.DebugMode, "Received %s notification from server %s", msg.Method, server.Name)
+
+	switch msg.Method {
+	case "notifications/resources/updated":
+		var params ReadResourceParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil || params.URI == "" {
+			return true
+		}
+		s.resourceSubsLock.Lock()
+		var subs []resourceSubscription
+		for _, sub := range s.resourceSubs {
+			if sub.server == server.Name && sub.rawURI == params.URI {
+				subs = append(subs, *sub)
+			}
+		}
+		s.resourceSubsLock.Unlock()
+		for _, sub := range subs {
+			s.notifyClient(sub.client, msg.Method, map[string]interface{}{"uri": sub.uri})
+		}
+	case "notifications/resources/list_changed":
+		// Reloading sends requests whose responses are read by the caller
+		go func() {
+			if err := s.loadResources(server); err != nil {
+				log.Printf("Warning: failed to reload resources for server %s: %v", server.Name, err)
+			}
+			if err := s.loadResourceTemplates(server); err != nil {
+				log.Printf("Warning: failed to reload resource templates for server %s: %v", server.Name, err)
+			}
+			s.notify(msg.Method)
+		}()
+	case "notifications/tools/list_changed":
+		go func() {
+			if err := s.loadTools(server); err != nil {
+				log.Printf("Warning: failed to reload tools for server %s: %v", server.Name, err)
+			}
+			s.notify(msg.Method)
+		}()
+	case "notifications/prompts/list_changed":
+		if s.NoPrompts {
+			break
+		}
+		go func() {
+			if err := s.loadPrompts(server); err != nil {
+				log.Printf("Warning: failed to reload prompts for server %s: %v", server.Name, err)
+			}
+			s.notify(msg.Method)
+		}()
+	}
+	return true
+}
@@ -3,8 +3,10 @@ package wmcplib
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -13,6 +15,8 @@ import (
 	"os/exec"
 	"strings"
 	"time"
+
+	mcplib "mai/src/mcps/lib"
 )
 
 // StartServer starts an MCP server process or connects to HTTP endpoint
@@ -27,8 +31,17 @@ func (s *MCPService) StartServerWithEnv(name, command string, env map[string]str
 
 // StartServerWithEnvAndTools starts an MCP server process with custom environment variables and tool filtering
 func (s *MCPService) StartServerWithEnvAndTools(name, command string, env map[string]string, enabledTools map[string]bool, sessionMode bool) error {
-	s.Mutex.Lock()
-	defer s.Mutex.Unlock()
+	return s.startServer(name, command, env, enabledTools, nil, sessionMode, 0)
+}
+
+// startServer starts a server whose requests time out after timeout, or
+// never when zero. The server is connected, authorized and initialized
+// without holding s.Mutex, since a first OAuth login waits for the user,
+// and is registered once it is ready.
+func (s *MCPService) startServer(name, command string, env map[string]string, enabledTools map[string]bool, disabledTools []string, sessionMode bool, timeout time.Duration) error {
+	if mcplib.IsWebSocketURL(command) {
+		return s.startSocketServer(name, command, enabledTools, disabledTools, sessionMode, timeout)
+	}
 
 	isHTTP := strings.HasPrefix(command, "http://") || strings.HasPrefix(command, "https://")
 	isSSE := strings.HasPrefix(command, "sse://") || strings.HasPrefix(command, "sses://")
@@ -49,22 +62,21 @@ func (s *MCPService) StartServerWithEnvAndTools(name, command string, env map[st
 			Prompts:       []Prompt{},
 			Resources:     []Resource{},
 			EnabledTools:  enabledTools,
+			DisabledTools: disabledTools,
 			UseSession:    sessionMode,
+			timeout:       timeout,
 			stderrDone:    make(chan struct{}),
 			stderrActive:  false,
 			monitorDone:   make(chan struct{}),
 			monitorActive: false,
 		}
 
-		s.Servers[name] = server
-
 		server.sseResponseChan = make(chan *JSONRPCResponse, 10)
 		server.sseRequestID = make(chan string, 1)
 
 		if isSSE {
 			endpointURL, err := s.connectSSE(server)
 			if err != nil {
-				delete(s.Servers, name)
 				return fmt.Errorf("failed to connect to SSE server: %v", err)
 			}
 			if server.UseSession && strings.Contains(endpointURL, "session_id=") {
@@ -97,7 +109,7 @@ func (s *MCPService) StartServerWithEnvAndTools(name, command string, env map[st
 		}
 
 		if err := s.InitializeServer(server); err != nil {
-			delete(s.Servers, name)
+			s.stopServer(server)
 			return fmt.Errorf("failed to initialize server: %v", err)
 		}
 
@@ -115,8 +127,14 @@ func (s *MCPService) StartServerWithEnvAndTools(name, command string, env map[st
 			if err := s.loadResources(server); err != nil {
 				log.Printf("Warning: failed to load resources for server %s: %v", name, err)
 			}
+			if err := s.loadResourceTemplates(server); err != nil {
+				log.Printf("Warning: failed to load resource templates for server %s: %v", name, err)
+			}
 		}
 
+		if err := s.registerServer(server); err != nil {
+			return err
+		}
 		if isSSE {
 			log.Printf("Connected to SSE MCP server: %s", name)
 		} else {
@@ -167,21 +185,23 @@ func (s *MCPService) StartServerWithEnvAndTools(name, command string, env map[st
 		Stderr:        stderr,
 		Tools:         []Tool{},
 		EnabledTools:  enabledTools,
+		DisabledTools: disabledTools,
 		UseSession:    sessionMode,
+		env:           env,
+		timeout:       timeout,
+		stdoutLines:   make(chan []byte, 16),
 		stderrDone:    make(chan struct{}),
 		stderrActive:  true,
 		monitorDone:   make(chan struct{}),
 		monitorActive: true,
 	}
 
-	s.Servers[name] = server
-
+	go s.readStdout(server, stdout, server.stdoutLines)
 	go s.handleStderr(server)
 	go s.monitorServer(server)
 
 	if err := s.InitializeServer(server); err != nil {
 		s.stopServer(server)
-		delete(s.Servers, name)
 		return fmt.Errorf("failed to initialize server: %v", err)
 	}
 
@@ -199,12 +219,114 @@ func (s *MCPService) StartServerWithEnvAndTools(name, command string, env map[st
 		if err := s.loadResources(server); err != nil {
 			log.Printf("Warning: failed to load resources for server %s: %v", name, err)
 		}
+		if err := s.loadResourceTemplates(server); err != nil {
+			log.Printf("Warning: failed to load resource templates for server %s: %v", name, err)
+		}
 	}
 
+	if err := s.registerServer(server); err != nil {
+		return err
+	}
 	log.Printf("Started MCP server: %s", name)
 	return nil
 }
 
+// registerServer adds a started server to the service, stopping the server
+// with the same name it replaces
+func (s *MCPService) registerServer(server *MCPServer) error {
+	s.Mutex.Lock()
+	if s.shuttingDown {
+		s.Mutex.Unlock()
+		s.stopServer(server)
+		return fmt.Errorf("service is shutting down")
+	}
+	old := s.Servers[server.Name]
+	s.Servers[server.Name] = server
+	s.Mutex.Unlock()
+	if old != nil && old != server {
+		s.stopServer(old)
+	}
+	return nil
+}
+
+// startSocketServer connects to a server listening on a WebSocket or Unix
+// socket URL. Messages are exchanged as with stdio servers, and the
+// connection is redialed when it drops.
+func (s *MCPService) startSocketServer(name, command string, enabledTools map[string]bool, disabledTools []string, sessionMode bool, timeout time.Duration) error {
+	server := &MCPServer{
+		Name:          name,
+		Command:       command,
+		URL:           command,
+		Tools:         []Tool{},
+		EnabledTools:  enabledTools,
+		DisabledTools: disabledTools,
+		UseSession:    sessionMode,
+		timeout:       timeout,
+	}
+	if err := s.connectSocket(server); err != nil {
+		return fmt.Errorf("failed to connect to socket server: %v", err)
+	}
+
+	if err := s.InitializeServer(server); err != nil {
+		s.stopServer(server)
+		return fmt.Errorf("failed to initialize server: %v", err)
+	}
+
+	if err := s.loadTools(server); err != nil {
+		log.Printf("Warning: failed to load tools for server %s: %v", name, err)
+	}
+
+	if !s.NoPrompts && (!server.HasCapabilities || server.SupportsPrompts) {
+		if err := s.loadPrompts(server); err != nil {
+			log.Printf("Warning: failed to load prompts for server %s: %v", name, err)
+		}
+	}
+
+	if !server.HasCapabilities || server.SupportsResources {
+		if err := s.loadResources(server); err != nil {
+			log.Printf("Warning: failed to load resources for server %s: %v", name, err)
+		}
+		if err := s.loadResourceTemplates(server); err != nil {
+			log.Printf("Warning: failed to load resource templates for server %s: %v", name, err)
+		}
+	}
+
+	if err := s.registerServer(server); err != nil {
+		return err
+	}
+	log.Printf("Connected to socket MCP server: %s", name)
+	return nil
+}
+
+// maxSocketMessageSize matches the largest line read from stdio servers
+const maxSocketMessageSize = 10 * 1024 * 1024
+
+// connectSocket dials the socket of a server and reads its messages like
+// the output of a stdio server. The token of MAI_MCP_AUTH_<DOMAIN> is sent
+// as with HTTP servers.
+func (s *MCPService) connectSocket(server *MCPServer) error {
+	header := make(http.Header)
+	if token := staticBearerToken(server); token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	conn, err := mcplib.DialWebSocket(server.Command, header, maxSocketMessageSize)
+	if err != nil {
+		return err
+	}
+	server.socket = conn
+	server.Stdin = conn
+	server.Stdout = conn
+	server.Stderr = nil
+	server.stderrDone = make(chan struct{})
+	close(server.stderrDone)
+	server.monitorDone = make(chan struct{})
+	server.monitorActive = true
+	server.stdoutLines = make(chan []byte, 16)
+	go s.readStdout(server, conn, server.stdoutLines)
+	go s.monitorServer(server)
+	return nil
+}
+
 // InitializeServer performs the MCP handshake
 func (s *MCPService) InitializeServer(server *MCPServer) error {
 	clientCapabilities := map[string]interface{}{
@@ -240,6 +362,9 @@ func (s *MCPService) InitializeServer(server *MCPServer) error {
 			server.HasCapabilities = true
 			_, server.SupportsPrompts = caps["prompts"]
 			_, server.SupportsResources = caps["resources"]
+			if resourceCaps, ok := caps["resources"].(map[string]interface{}); ok {
+				server.SupportsSubscribe, _ = resourceCaps["subscribe"].(bool)
+			}
 			server.Mutex.Unlock()
 		}
 	}
@@ -250,28 +375,30 @@ func (s *MCPService) InitializeServer(server *MCPServer) error {
 		Params:  map[string]interface{}{},
 	}
 
+	if server.openapi != nil {
+		return nil
+	}
+
 	if server.IsHTTP {
 		reqBytes, _ := json.Marshal(initNotification)
-		httpReq, err := http.NewRequest("POST", server.URL, bytes.NewBuffer(reqBytes))
-		if err != nil {
-			return fmt.Errorf("failed to create notification request: %v", err)
-		}
-
-		httpReq.Header.Set("Content-Type", "application/json")
-		httpReq.Header.Set("Accept", "application/json, text/event-stream")
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := s.doHTTP(server, client, func() (*http.Request, error) {
+			httpReq, err := http.NewRequest("POST", server.URL, bytes.NewBuffer(reqBytes))
+			if err != nil {
+				return nil, fmt.Errorf("failed to create notification request: %v", err)
+			}
 
-		server.Mutex.RLock()
-		sessionID := server.SessionID
-		server.Mutex.RUnlock()
-		if sessionID != "" {
-			httpReq.Header.Set("Mcp-Session-Id", sessionID)
-		}
+			httpReq.Header.Set("Content-Type", "application/json")
+			httpReq.Header.Set("Accept", "application/json, text/event-stream")
 
-		if token := s.GetBearerToken(server); token != "" {
-			httpReq.Header.Set("Authorization", "Bearer "+token)
-		}
-		client := &http.Client{Timeout: 30 * time.Second}
-		resp, err := client.Do(httpReq)
+			server.Mutex.RLock()
+			sessionID := server.SessionID
+			server.Mutex.RUnlock()
+			if sessionID != "" {
+				httpReq.Header.Set("Mcp-Session-Id", sessionID)
+			}
+			return httpReq, nil
+		})
 		if err != nil {
 			return fmt.Errorf("notification request failed: %v", err)
 		}
@@ -315,13 +442,9 @@ func (s *MCPService) loadTools(server *MCPServer) error {
 	}
 
 	var filteredTools []Tool
-	if len(server.EnabledTools) == 0 {
-		filteredTools = toolsResult.Tools
-	} else {
-		for _, tool := range toolsResult.Tools {
-			if enabled, exists := server.EnabledTools[tool.Name]; exists && enabled {
-				filteredTools = append(filteredTools, tool)
-			}
+	for _, tool := range toolsResult.Tools {
+		if toolEnabled(server.EnabledTools, server.DisabledTools, tool.Name) {
+			filteredTools = append(filteredTools, tool)
 		}
 	}
 
@@ -389,6 +512,63 @@ func (s *MCPService) loadResources(server *MCPServer) error {
 	return nil
 }
 
+// loadResourceTemplates loads the resource templates from the server
+func (s *MCPService) loadResourceTemplates(server *MCPServer) error {
+	templatesRequest := JSONRPCRequest{JSONRPC: "2.0", Method: "resources/templates/list", Params: map[string]interface{}{}, ID: "6"}
+
+	response, err := s.SendRequest(server, templatesRequest)
+	if err != nil {
+		return err
+	}
+
+	if response.Error != nil {
+		debugLog(s.DebugMode, "resources/templates/list failed on %s: %v", server.Name, response.Error)
+		return nil
+	}
+
+	resultBytes, _ := json.Marshal(response.Result)
+	var list ResourceTemplatesListResult
+	if err := json.Unmarshal(resultBytes, &list); err != nil {
+		return fmt.Errorf("failed to parse resource templates response: %v", err)
+	}
+
+	var templates []ResourceTemplate
+	for _, template := range list.ResourceTemplates {
+		if _, err := mcplib.ParseURITemplate(template.URITemplate); err != nil {
+			log.Printf("Warning: ignoring resource template of server %s: %v", server.Name, err)
+			continue
+		}
+		templates = append(templates, template)
+	}
+
+	server.Mutex.Lock()
+	server.ResourceTemplates = templates
+	server.Mutex.Unlock()
+
+	log.Printf("Loaded %d resource templates for server %s", len(templates), server.Name)
+	return nil
+}
+
+// readStdout reads the messages written by a stdio server. Notifications
+// are handled as they arrive and the responses are queued for sendStdio.
+// The channel is closed when the server output ends.
+func (s *MCPService) readStdout(server *MCPServer, stdout io.Reader, lines chan<- []byte) {
+	defer close(lines)
+	scanner := bufio.NewScanner(stdout)
+	buf := make([]byte, 64*1024)
+	scanner.Buffer(buf, 10*1024*1024)
+	for scanner.Scan() {
+		line := append([]byte(nil), scanner.Bytes()...)
+		if s.handleServerNotification(server, line) {
+			continue
+		}
+		lines <- line
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("ERROR: Scanner error while reading output of server %s: %v", server.Name, err)
+	}
+}
+
 // handleStderr reads from the stderr pipe and logs all messages
 func (s *MCPService) handleStderr(server *MCPServer) {
 	scanner := bufio.NewScanner(server.Stderr)
@@ -399,7 +579,8 @@ func (s *MCPService) handleStderr(server *MCPServer) {
 	close(server.stderrDone)
 }
 
-// monitorServer monitors the server process and restarts it if it crashes.
+// monitorServer monitors the server process, or the connection of socket
+// servers, and restarts it if it crashes.
 // When the process exits the loop terminates and monitorDone is closed, so a
 // subsequent restart can safely wait on it. The restart itself runs in a
 // separate goroutine to avoid a self-deadlock on monitorDone.
@@ -410,6 +591,16 @@ func (s *MCPService) monitorServer(server *MCPServer) {
 		return
 	}
 
+	if server.Process == nil {
+		<-server.socket.Done()
+		if !server.monitorActive || s.isShuttingDown() {
+			return
+		}
+		log.Printf("ERROR: MCP server '%s' disconnected", server.Name)
+		go s.scheduleRestart(server)
+		return
+	}
+
 	err := server.Process.Wait()
 	if !server.monitorActive || s.isShuttingDown() {
 		return
@@ -432,13 +623,33 @@ func (s *MCPService) scheduleRestart(server *MCPServer) {
 		return
 	}
 	log.Printf("Restarting MCP server '%s'...", server.Name)
-	if err := s.restartServer(server); err != nil {
+	s.metrics.restarts.Inc(server.Name, "crash")
+	err := s.restartServer(server)
+	// Socket servers run on their own, so they are redialed until they are
+	// back or removed
+	for delay := 2 * time.Second; err != nil && server.socket != nil && s.isRegistered(server); {
+		log.Printf("ERROR: Failed to reconnect to MCP server '%s', retrying in %v: %v", server.Name, delay, err)
+		time.Sleep(delay)
+		if delay < 30*time.Second {
+			delay *= 2
+		}
+		err = s.restartServer(server)
+	}
+	s.recordResult(server, err)
+	if err != nil {
 		log.Printf("ERROR: Failed to restart MCP server '%s': %v", server.Name, err)
 	} else {
 		log.Printf("Successfully restarted MCP server '%s'", server.Name)
 	}
 }
 
+// isRegistered reports whether the server is still in use by the service
+func (s *MCPService) isRegistered(server *MCPServer) bool {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+	return !s.shuttingDown && s.Servers[server.Name] == server
+}
+
 func (s *MCPService) isShuttingDown() bool {
 	s.Mutex.RLock()
 	defer s.Mutex.RUnlock()
@@ -470,6 +681,13 @@ func (s *MCPService) restartServer(server *MCPServer) error {
 	waitClosed(server.stderrDone, 2*time.Second)
 	waitClosed(server.monitorDone, 2*time.Second)
 
+	if server.socket != nil {
+		if err := s.connectSocket(server); err != nil {
+			return fmt.Errorf("failed to reconnect: %v", err)
+		}
+		return s.reloadServer(server)
+	}
+
 	parts := strings.Fields(server.Command)
 	if len(parts) == 0 {
 		return fmt.Errorf("empty command")
@@ -477,6 +695,14 @@ func (s *MCPService) restartServer(server *MCPServer) error {
 
 	cmd := exec.Command(parts[0], parts[1:]...)
 
+	if len(server.env) > 0 {
+		cmdEnv := os.Environ()
+		for key, value := range server.env {
+			cmdEnv = append(cmdEnv, fmt.Sprintf("%s=%s", key, value))
+		}
+		cmd.Env = cmdEnv
+	}
+
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return fmt.Errorf("failed to create stdin pipe: %v", err)
@@ -505,9 +731,17 @@ func (s *MCPService) restartServer(server *MCPServer) error {
 	server.stderrActive = true
 	server.monitorActive = true
 
+	server.stdoutLines = make(chan []byte, 16)
+	go s.readStdout(server, stdout, server.stdoutLines)
 	go s.handleStderr(server)
 	go s.monitorServer(server)
 
+	return s.reloadServer(server)
+}
+
+// reloadServer initializes a restarted server and reloads what it offers
+func (s *MCPService) reloadServer(server *MCPServer) error {
+	s.resetHealth(server)
 	if err := s.InitializeServer(server); err != nil {
 		s.stopServer(server)
 		return fmt.Errorf("failed to initialize server: %v", err)
@@ -526,6 +760,10 @@ func (s *MCPService) restartServer(server *MCPServer) error {
 	if err := s.loadResources(server); err != nil {
 		log.Printf("Warning: failed to load resources for restarted server %s: %v", server.Name, err)
 	}
+	if err := s.loadResourceTemplates(server); err != nil {
+		log.Printf("Warning: failed to load resource templates for restarted server %s: %v", server.Name, err)
+	}
+	s.resubscribeResources(server)
 
 	return nil
 }
@@ -556,6 +794,9 @@ func (s *MCPService) stopServer(server *MCPServer) {
 		// misbehaving server can't pin the REPL on shutdown.
 		waitClosed(server.stderrDone, 2*time.Second)
 		waitClosed(server.monitorDone, 2*time.Second)
+	} else if server.SSEConnected && server.Stdout != nil {
+		// Closing the event stream terminates listenSSEResponses.
+		server.Stdout.Close()
 	}
 }
 
@@ -597,21 +838,16 @@ func (s *MCPService) connectSSE(server *MCPServer) (string, error) {
 
 	debugLog(s.DebugMode, "Connecting to SSE endpoint: %s", sseURL)
 
-	req, err := http.NewRequest("GET", sseURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create SSE request: %v", err)
-	}
-
-	if token := s.GetBearerToken(server); token != "" {
-		req.Header.Set("Authorization", "Bearer "+token)
-		debugLog(s.DebugMode, "Using bearer token for SSE connection")
-	}
-
-	req.Header.Set("Accept", "text/event-stream")
-	req.Header.Set("Cache-Control", "no-cache")
-
 	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := s.doHTTP(server, client, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", sseURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SSE request: %v", err)
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Cache-Control", "no-cache")
+		return req, nil
+	})
 	if err != nil {
 		return "", fmt.Errorf("SSE connection failed: %v", err)
 	}
@@ -649,7 +885,7 @@ func (s *MCPService) connectSSE(server *MCPServer) (string, error) {
 }
 
 // sendHTTPRequestViaSSE sends a request via HTTP and gets response from SSE stream
-func (s *MCPService) sendHTTPRequestViaSSE(server *MCPServer, request JSONRPCRequest) (*JSONRPCResponse, error) {
+func (s *MCPService) sendHTTPRequestViaSSE(ctx context.Context, server *MCPServer, request JSONRPCRequest) (*JSONRPCResponse, error) {
 	reqBytes, err := json.Marshal(request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
@@ -659,31 +895,17 @@ func (s *MCPService) sendHTTPRequestViaSSE(server *MCPServer, request JSONRPCReq
 
 	debugLog(s.DebugMode, "Sending SSE request to %s (ID: %s): %s", server.URL, requestID, string(reqBytes))
 
-	httpReq, err := http.NewRequest("POST", server.URL, bytes.NewBuffer(reqBytes))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %v", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Accept", "application/json, text/event-stream")
-
-	server.Mutex.RLock()
-	sessionID := server.SessionID
-	server.Mutex.RUnlock()
-	if sessionID != "" {
-		httpReq.Header.Set("Mcp-Session-Id", sessionID)
-		if server.UseSession {
-			httpReq.Header.Set("X-SSE-Session-ID", sessionID)
+	client := &http.Client{Timeout: server.requestTimeout()}
+	resp, err := s.doHTTP(server, client, func() (*http.Request, error) {
+		return s.newHTTPRequest(ctx, server, reqBytes)
+	})
+	if ctx.Err() != nil {
+		if err == nil {
+			resp.Body.Close()
 		}
+		s.cancelServerRequest(ctx, server, request)
+		return nil, ErrRequestCancelled
 	}
-
-	if token := s.GetBearerToken(server); token != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+token)
-		debugLog(s.DebugMode, "Using bearer token for %s", server.URL)
-	}
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("HTTP request failed: %v", err)
 	}
@@ -710,13 +932,16 @@ func (s *MCPService) sendHTTPRequestViaSSE(server *MCPServer, request JSONRPCReq
 	if err := json.Unmarshal(respBytes, &response); err != nil {
 		debugLog(s.DebugMode, "Direct response parse failed, waiting for SSE response")
 
-		timeout := 30 * time.Second
+		timeout := server.requestTimeout()
 		select {
 		case response := <-server.sseResponseChan:
 			debugLog(s.DebugMode, "Received SSE response for ID %v", response.ID)
 			return response, nil
-		case <-time.After(timeout):
+		case <-timeoutAfter(timeout):
 			return nil, fmt.Errorf("timeout waiting for SSE response, HTTP body: %s", string(respBytes))
+		case <-ctx.Done():
+			s.cancelServerRequest(ctx, server, request)
+			return nil, ErrRequestCancelled
 		}
 	}
 
@@ -770,6 +995,11 @@ func (s *MCPService) listenSSEResponses(server *MCPServer) {
 					continue
 				}
 
+				if s.handleServerNotification(server, []byte(payload)) {
+					currentEvent = ""
+					continue
+				}
+
 				if response.JSONRPC != "" {
 					select {
 					case server.sseResponseChan <- &response:
@@ -801,20 +1031,9 @@ func (s *MCPService) listenSSEResponses(server *MCPServer) {
 	}
 }
 
-// sendHTTPRequest sends a JSONRPC request to an HTTP MCP server
-func (s *MCPService) sendHTTPRequest(server *MCPServer, request JSONRPCRequest) (*JSONRPCResponse, error) {
-	if server.SSEConnected && server.sseResponseChan != nil {
-		return s.sendHTTPRequestViaSSE(server, request)
-	}
-
-	reqBytes, err := json.Marshal(request)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %v", err)
-	}
-
-	debugLog(s.DebugMode, "Sending HTTP request to %s: %s", server.URL, string(reqBytes))
-
-	httpReq, err := http.NewRequest("POST", server.URL, bytes.NewBuffer(reqBytes))
+// newHTTPRequest builds a JSON-RPC POST request carrying the session headers.
+func (s *MCPService) newHTTPRequest(ctx context.Context, server *MCPServer, reqBytes []byte) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", server.URL, bytes.NewBuffer(reqBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP request: %v", err)
 	}
@@ -831,16 +1050,33 @@ func (s *MCPService) sendHTTPRequest(server *MCPServer, request JSONRPCRequest)
 			httpReq.Header.Set("X-SSE-Session-ID", sessionID)
 		}
 	}
+	return httpReq, nil
+}
 
-	if token := s.GetBearerToken(server); token != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+token)
-		debugLog(s.DebugMode, "Using bearer token for %s", server.URL)
-	} else {
-		debugLog(s.DebugMode, "No bearer token found for %s", server.URL)
+// sendHTTPRequest sends a JSONRPC request to an HTTP MCP server
+func (s *MCPService) sendHTTPRequest(ctx context.Context, server *MCPServer, request JSONRPCRequest) (*JSONRPCResponse, error) {
+	if server.SSEConnected && server.sseResponseChan != nil {
+		return s.sendHTTPRequestViaSSE(ctx, server, request)
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(httpReq)
+	reqBytes, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	debugLog(s.DebugMode, "Sending HTTP request to %s: %s", server.URL, string(reqBytes))
+
+	client := &http.Client{Timeout: server.requestTimeout()}
+	resp, err := s.doHTTP(server, client, func() (*http.Request, error) {
+		return s.newHTTPRequest(ctx, server, reqBytes)
+	})
+	if ctx.Err() != nil {
+		if err == nil {
+			resp.Body.Close()
+		}
+		s.cancelServerRequest(ctx, server, request)
+		return nil, ErrRequestCancelled
+	}
 	if err != nil {
 		return nil, fmt.Errorf("HTTP request failed: %v", err)
 	}
@@ -873,8 +1109,13 @@ func (s *MCPService) sendHTTPRequest(server *MCPServer, request JSONRPCRequest)
 
 			if line == "" && dataBuffer.Len() > 0 {
 				payload := dataBuffer.String()
+				dataBuffer.Reset()
 				debugLog(s.DebugMode, "Received HTTP SSE payload from %s: %s", server.URL, payload)
 
+				if s.handleServerNotification(server, []byte(payload)) {
+					continue
+				}
+
 				var response JSONRPCResponse
 				if err := json.Unmarshal([]byte(payload), &response); err != nil {
 					return nil, fmt.Errorf("failed to unmarshal SSE response: %v", err)
@@ -885,6 +1126,10 @@ func (s *MCPService) sendHTTPRequest(server *MCPServer, request JSONRPCRequest)
 		}
 
 		if err := scanner.Err(); err != nil {
+			if ctx.Err() != nil {
+				s.cancelServerRequest(ctx, server, request)
+				return nil, ErrRequestCancelled
+			}
 			return nil, fmt.Errorf("failed to read SSE response: %v", err)
 		}
 
@@ -918,12 +1163,21 @@ func (s *MCPService) sendHTTPRequest(server *MCPServer, request JSONRPCRequest)
 	return &response, nil
 }
 
-// GetBearerToken gets the bearer token for an HTTP server from environment variables
+// GetBearerToken gets the bearer token for an HTTP server. A static token
+// from the MAI_MCP_AUTH_<DOMAIN> environment variable takes precedence over
+// the token obtained with the OAuth authorization flow.
 func (s *MCPService) GetBearerToken(server *MCPServer) string {
-	if !server.IsHTTP {
+	if !server.IsHTTP && !server.IsSSE {
 		return ""
 	}
+	if token := staticBearerToken(server); token != "" {
+		return token
+	}
+	return s.oauthAccessToken(server)
+}
 
+// staticBearerToken reads MAI_MCP_AUTH_<DOMAIN> for the server host.
+func staticBearerToken(server *MCPServer) string {
 	u, err := url.Parse(server.URL)
 	if err != nil {
 		return ""
@@ -935,3 +1189,32 @@ func (s *MCPService) GetBearerToken(server *MCPServer) string {
 
 	return os.Getenv(envVar)
 }
+
+// doHTTP sends a request built by newRequest with the server bearer token.
+// When the server answers 401 and no static token is configured, the OAuth
+// authorization flow runs and the request is retried once.
+func (s *MCPService) doHTTP(server *MCPServer, client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		token := s.GetBearerToken(server)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+			debugLog(s.DebugMode, "Using bearer token for %s", server.URL)
+		} else {
+			debugLog(s.DebugMode, "No bearer token found for %s", server.URL)
+		}
+		resp, err := client.Do(req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || attempt > 0 || staticBearerToken(server) != "" {
+			return resp, err
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		debugLog(s.DebugMode, "Server %s requires authorization: %s", server.URL, challenge)
+		if err := s.authorizeServer(server, challenge, token); err != nil {
+			return nil, err
+		}
+	}
+}
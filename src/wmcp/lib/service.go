@@ -1,8 +1,8 @@
 package wmcplib
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -22,29 +22,43 @@ type Options struct {
 	SessionMode    bool
 	DebugMode      bool
 	ProxyToolsMode bool
-	Prompter       Prompter
+	// DefaultProfile is used by clients that do not select a profile
+	DefaultProfile string
+	// FailureThreshold overrides DefaultFailureThreshold when positive
+	FailureThreshold int
+	// AuditLog records every tool call, nil disables auditing
+	AuditLog *AuditLog
+	Prompter Prompter
+	// OAuthOpener overrides how authorization URLs are shown (see MCPService)
+	OAuthOpener func(authURL string) error
 }
 
 // NewMCPService creates a new MCPService. A nil opts.Prompter is legal but
 // means the service will reject interactive decisions; the mai-wmcp binary
 // supplies a StdinPrompter, and mai-repl supplies its TUI prompter.
 func NewMCPService(opts Options) *MCPService {
-	return &MCPService{
-		Servers:        make(map[string]*MCPServer),
-		YoloMode:       opts.YoloMode,
-		DrunkMode:      opts.DrunkMode,
-		NoPrompts:      opts.NoPrompts,
-		NonInteractive: opts.NonInteractive,
-		SessionMode:    opts.SessionMode,
-		DebugMode:      opts.DebugMode,
-		ProxyToolsMode: opts.ProxyToolsMode,
-		prompter:       opts.Prompter,
-		toolPerms:      make(map[string]ToolPermission),
-		promptPerms:    make(map[string]PromptPermission),
-		reportEnabled:  opts.ReportFile != "",
-		reportFile:     opts.ReportFile,
-		report:         Report{Entries: []ReportEntry{}},
-	}
+	s := &MCPService{
+		Servers:          make(map[string]*MCPServer),
+		YoloMode:         opts.YoloMode,
+		DrunkMode:        opts.DrunkMode,
+		NoPrompts:        opts.NoPrompts,
+		NonInteractive:   opts.NonInteractive,
+		SessionMode:      opts.SessionMode,
+		DebugMode:        opts.DebugMode,
+		ProxyToolsMode:   opts.ProxyToolsMode,
+		DefaultProfile:   opts.DefaultProfile,
+		FailureThreshold: opts.FailureThreshold,
+		prompter:         opts.Prompter,
+		OAuthOpener:      opts.OAuthOpener,
+		toolPerms:        make(map[string]ToolPermission),
+		promptPerms:      make(map[string]PromptPermission),
+		reportEnabled:    opts.ReportFile != "",
+		reportFile:       opts.ReportFile,
+		report:           Report{Entries: []ReportEntry{}},
+		audit:            opts.AuditLog,
+	}
+	s.metrics = newServiceMetrics(s)
+	return s
 }
 
 // SetPrompter replaces the service's Prompter. Useful when the transport
@@ -93,11 +107,13 @@ func (s *MCPService) handlePromptPermissions(request JSONRPCRequest) error {
 	return nil
 }
 
-// handleToolPermissions handles tool permissions and not-found logic.
-func (s *MCPService) handleToolPermissions(request JSONRPCRequest) (*JSONRPCResponse, error) {
+// handleToolPermissions handles tool permissions and not-found logic. It
+// also returns who decided, one of the AuditSource values.
+func (s *MCPService) handleToolPermissions(request JSONRPCRequest) (*JSONRPCResponse, string, error) {
 	if s.YoloMode || request.Method != "tools/call" {
-		return nil, nil
+		return nil, AuditSourceYolo, nil
 	}
+	source := AuditSourcePolicy
 
 	var callParams CallToolParams
 	paramsBytes, _ := json.Marshal(request.Params)
@@ -105,18 +121,21 @@ func (s *MCPService) handleToolPermissions(request JSONRPCRequest) (*JSONRPCResp
 
 	if !s.isToolAvailable(callParams.Name) {
 		if s.yoloToolNotFoundMode {
-			return nil, fmt.Errorf("tool '%s' does not exist", callParams.Name)
+			return nil, source, fmt.Errorf("tool '%s' does not exist", callParams.Name)
 		}
 
+		if !s.NonInteractive && s.prompter != nil {
+			source = AuditSourceUser
+		}
 		decision := s.promptToolNotFoundDecision(callParams.Name)
 
 		switch decision {
 		case YoloToolNotFound:
-			return nil, fmt.Errorf("tool '%s' does not exist", callParams.Name)
+			return nil, source, fmt.Errorf("tool '%s' does not exist", callParams.Name)
 		case YoloCustomResponse:
 			customResponse, err := s.readCustomResponse("Enter your custom response: ")
 			if err != nil || customResponse == "" {
-				return nil, fmt.Errorf("tool '%s' does not exist", callParams.Name)
+				return nil, source, fmt.Errorf("tool '%s' does not exist", callParams.Name)
 			}
 			return &JSONRPCResponse{
 				JSONRPC: "2.0",
@@ -124,21 +143,21 @@ func (s *MCPService) handleToolPermissions(request JSONRPCRequest) (*JSONRPCResp
 					Content: []Content{{Type: "text", Text: customResponse}},
 				},
 				ID: request.ID,
-			}, nil
+			}, source, nil
 		case YoloModify:
 			newParams, err := s.promptModifyTool(&callParams)
 			if err != nil {
 				if errors.Is(err, ErrPromptCancelled) {
-					return nil, fmt.Errorf("tool execution cancelled by user")
+					return nil, source, fmt.Errorf("tool execution cancelled by user")
 				}
-				return nil, fmt.Errorf("failed to parse modified params: %v", err)
+				return nil, source, fmt.Errorf("failed to parse modified params: %v", err)
 			}
 
 			callParams = *newParams
 			request.Params = callParams
 
 			if !s.isToolAvailable(callParams.Name) {
-				return nil, fmt.Errorf("modified tool '%s' also does not exist", callParams.Name)
+				return nil, source, fmt.Errorf("modified tool '%s' also does not exist", callParams.Name)
 			}
 		case YoloGuideModel:
 			return &JSONRPCResponse{
@@ -147,67 +166,70 @@ func (s *MCPService) handleToolPermissions(request JSONRPCRequest) (*JSONRPCResp
 					Content: []Content{{Type: "text", Text: "The tool you requested doesn't exist. Please check the available tools list."}},
 				},
 				ID: request.ID,
-			}, nil
+			}, source, nil
 		case YoloAlwaysRespondToolNotFound:
 			s.yoloToolNotFoundMode = true
-			return nil, fmt.Errorf("tool '%s' does not exist", callParams.Name)
+			return nil, source, fmt.Errorf("tool '%s' does not exist", callParams.Name)
 		}
 	}
 
 	paramsJSON, _ := json.Marshal(callParams.Arguments)
 
 	if s.checkToolPermission(callParams.Name, string(paramsJSON)) {
-		return nil, nil
+		return nil, source, nil
 	}
 
+	if s.prompter != nil {
+		source = AuditSourceUser
+	}
 	decision := s.promptYoloDecision(callParams.Name, string(paramsJSON))
 
 	switch decision {
 	case YoloApprove:
-		return nil, nil
+		return nil, source, nil
 	case YoloReject:
-		return nil, fmt.Errorf("tool execution rejected by user")
+		return nil, source, fmt.Errorf("tool execution rejected by user")
 	case YoloPermitToolForever, YoloPermitAllToolsForever:
 		s.YoloMode = true
-		return nil, nil
+		return nil, source, nil
 	case YoloPermitToolWithParamsForever, YoloRejectForever:
 		s.storeToolPermission(callParams.Name, string(paramsJSON), decision)
 		if decision == YoloRejectForever {
-			return nil, fmt.Errorf("tool execution rejected by user policy")
+			return nil, source, fmt.Errorf("tool execution rejected by user policy")
 		}
 	case YoloModify:
 		newCallParams, err := s.promptModifyTool(&callParams)
 		if err != nil {
 			if errors.Is(err, ErrPromptCancelled) {
-				return nil, fmt.Errorf("tool execution cancelled by user")
+				return nil, source, fmt.Errorf("tool execution cancelled by user")
 			}
-			return nil, fmt.Errorf("failed to parse modified params: %v", err)
+			return nil, source, fmt.Errorf("failed to parse modified params: %v", err)
 		}
 		callParams = *newCallParams
 		request.Params = callParams
 		paramsJSON, _ = json.Marshal(callParams.Arguments)
 		if s.checkToolPermission(callParams.Name, string(paramsJSON)) {
-			return nil, nil
+			return nil, source, nil
 		}
 		decision2 := s.promptYoloDecision(callParams.Name, string(paramsJSON))
 		switch decision2 {
 		case YoloApprove:
-			return nil, nil
+			return nil, source, nil
 		case YoloReject:
-			return nil, fmt.Errorf("tool execution rejected by user")
+			return nil, source, fmt.Errorf("tool execution rejected by user")
 		case YoloPermitToolForever, YoloPermitAllToolsForever:
 			s.YoloMode = true
 		case YoloPermitToolWithParamsForever, YoloRejectForever:
 			s.storeToolPermission(callParams.Name, string(paramsJSON), decision2)
 			if decision2 == YoloRejectForever {
-				return nil, fmt.Errorf("tool execution rejected by user policy")
+				return nil, source, fmt.Errorf("tool execution rejected by user policy")
 			}
 		case YoloModify:
-			return nil, fmt.Errorf("multiple modifications not supported in one prompt")
+			return nil, source, fmt.Errorf("multiple modifications not supported in one prompt")
 		case YoloCustomToolResponse:
 			customResponse, err := s.readCustomResponse("Enter your custom response: ")
 			if err != nil || customResponse == "" {
-				return nil, fmt.Errorf("tool execution rejected by user")
+				return nil, source, fmt.Errorf("tool execution rejected by user")
 			}
 			return &JSONRPCResponse{
 				JSONRPC: "2.0",
@@ -215,12 +237,12 @@ func (s *MCPService) handleToolPermissions(request JSONRPCRequest) (*JSONRPCResp
 					Content: []Content{{Type: "text", Text: customResponse}},
 				},
 				ID: request.ID,
-			}, nil
+			}, source, nil
 		}
 	case YoloCustomToolResponse:
 		customResponse, err := s.readCustomResponse("Enter your custom response: ")
 		if err != nil || customResponse == "" {
-			return nil, fmt.Errorf("tool execution rejected by user")
+			return nil, source, fmt.Errorf("tool execution rejected by user")
 		}
 		return &JSONRPCResponse{
 			JSONRPC: "2.0",
@@ -228,10 +250,10 @@ func (s *MCPService) handleToolPermissions(request JSONRPCRequest) (*JSONRPCResp
 				Content: []Content{{Type: "text", Text: customResponse}},
 			},
 			ID: request.ID,
-		}, nil
+		}, source, nil
 	}
 
-	return nil, nil
+	return nil, source, nil
 }
 
 // ApplyDrunkMode reassigns arguments for tools/call when drunk mode is on.
@@ -317,12 +339,14 @@ func (s *MCPService) ApplyDrunkMode(request *JSONRPCRequest) {
 
 // sendStdioRequest sends the request to a stdio server
 func (s *MCPService) sendStdioRequest(server *MCPServer, reqBytes []byte) error {
-	if server.Process.ProcessState != nil {
-		log.Printf("ERROR: Server %s process has exited with state: %v", server.Name, server.Process.ProcessState)
-		return fmt.Errorf("server process has exited")
-	}
-	if server.Process.Process != nil {
-		debugLog(s.DebugMode, "Server %s process PID: %d", server.Name, server.Process.Process.Pid)
+	if server.Process != nil {
+		if server.Process.ProcessState != nil {
+			log.Printf("ERROR: Server %s process has exited with state: %v", server.Name, server.Process.ProcessState)
+			return fmt.Errorf("server process has exited")
+		}
+		if server.Process.Process != nil {
+			debugLog(s.DebugMode, "Server %s process PID: %d", server.Name, server.Process.Process.Pid)
+		}
 	}
 
 	if _, err := server.Stdin.Write(reqBytes); err != nil {
@@ -336,74 +360,218 @@ func (s *MCPService) sendStdioRequest(server *MCPServer, reqBytes []byte) error
 	return nil
 }
 
-// readStdioResponse reads the response from a stdio server with a timeout
-func (s *MCPService) readStdioResponse(server *MCPServer) ([]byte, error) {
-	type scanResult struct {
-		ok    bool
-		bytes []byte
-		err   error
-	}
-
-	resultChan := make(chan scanResult, 1)
-	go func() {
-		scanner := bufio.NewScanner(server.Stdout)
-		buf := make([]byte, 10*1024*1024)
-		scanner.Buffer(buf, 10*1024*1024)
-		ok := scanner.Scan()
-		var err error
-		var bytes []byte
-		if ok {
-			bytes = scanner.Bytes()
-		} else {
-			err = scanner.Err()
-		}
-		resultChan <- scanResult{ok: ok, bytes: bytes, err: err}
-	}()
-
-	timeout := 30 * time.Second
-	select {
-	case result := <-resultChan:
-		if !result.ok {
-			if result.err != nil {
-				log.Printf("ERROR: Scanner error while reading response from server %s: %v", server.Name, result.err)
-			} else {
+// readStdioResponse waits for the response to the request with the given id
+// until the timeout expires or ctx is cancelled. Lines answering another
+// request, like the late answer to a cancelled one, and notifications are
+// discarded.
+func (s *MCPService) readStdioResponse(ctx context.Context, server *MCPServer, lines <-chan []byte, id interface{}) ([]byte, error) {
+	timeout := server.requestTimeout()
+	deadline := timeoutAfter(timeout)
+	want := normalizeID(id)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ErrRequestCancelled
+		case line, ok := <-lines:
+			if !ok {
 				log.Printf("ERROR: No response received from server %s (EOF or empty)", server.Name)
+				return nil, fmt.Errorf("failed to read response")
+			}
+			if got, match := responseID(line); id != nil && (!match || got != want) {
+				debugLog(s.DebugMode, "Discarding unrelated message from server %s: %s", server.Name, string(line))
+				continue
 			}
-			return nil, fmt.Errorf("failed to read response")
+			return line, nil
+		case <-deadline:
+			log.Printf("ERROR: Timeout waiting for response from server %s after %v", server.Name, timeout)
+			dropUnresponsive(server)
+			return nil, fmt.Errorf("timeout waiting for response after %v", timeout)
 		}
-		return result.bytes, nil
-	case <-time.After(timeout):
-		log.Printf("ERROR: Timeout waiting for response from server %s after %v", server.Name, timeout)
-		return nil, fmt.Errorf("timeout waiting for response")
 	}
 }
 
+// dropUnresponsive kills a hung stdio server, or disconnects a socket
+// server, and lets the monitor restart it
+func dropUnresponsive(server *MCPServer) {
+	if server.Process != nil && server.Process.Process != nil {
+		log.Printf("Killing unresponsive MCP server '%s'", server.Name)
+		_ = server.Process.Process.Kill()
+	} else if server.socket != nil {
+		log.Printf("Disconnecting unresponsive MCP server '%s'", server.Name)
+		server.socket.Close()
+	}
+}
+
+// lockRequests waits for the exchange in progress with a stdio server to
+// end, or returns errServerBusy when ctx ends first
+func (server *MCPServer) lockRequests(ctx context.Context) error {
+	server.requestOnce.Do(func() {
+		server.requestSlot = make(chan struct{}, 1)
+	})
+	select {
+	case server.requestSlot <- struct{}{}:
+		server.busySince.Store(time.Now().UnixNano())
+		return nil
+	case <-ctx.Done():
+		return errServerBusy
+	}
+}
+
+func (server *MCPServer) unlockRequests() {
+	server.busySince.Store(0)
+	<-server.requestSlot
+}
+
+// busyFor returns how long the exchange in progress has been running
+func (server *MCPServer) busyFor() time.Duration {
+	since := server.busySince.Load()
+	if since == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, since))
+}
+
+// responseID returns the normalized id of a JSON-RPC response line, and
+// false when the line is not a response
+func responseID(line []byte) (string, bool) {
+	var msg struct {
+		ID     interface{} `json:"id"`
+		Method string      `json:"method"`
+	}
+	if json.Unmarshal(line, &msg) != nil || msg.Method != "" || msg.ID == nil {
+		return "", false
+	}
+	return normalizeID(msg.ID), true
+}
+
+// normalizeID renders a JSON-RPC id so that equal ids compare equal
+// whatever their Go type
+func normalizeID(id interface{}) string {
+	raw, err := json.Marshal(id)
+	if err != nil {
+		return fmt.Sprint(id)
+	}
+	var v interface{}
+	if json.Unmarshal(raw, &v) == nil {
+		raw, _ = json.Marshal(v)
+	}
+	return string(raw)
+}
+
 // SendRequest sends a JSONRPC request to the target server (stdio or HTTP)
 // and returns the response. It enforces permissions and drunk-mode rewriting
-// before the request is sent downstream.
+// before the request is sent downstream. Requests to degraded servers fail
+// fast with a ServerUnavailableError.
 func (s *MCPService) SendRequest(server *MCPServer, request JSONRPCRequest) (*JSONRPCResponse, error) {
+	return s.SendRequestFrom("", server, request)
+}
+
+// SendRequestFrom is SendRequest on behalf of a client, which is recorded
+// in the audit log
+func (s *MCPService) SendRequestFrom(client string, server *MCPServer, request JSONRPCRequest) (*JSONRPCResponse, error) {
+	return s.SendRequestWithContext(context.Background(), client, server, request)
+}
+
+// SendRequestWithContext is SendRequestFrom bound to ctx. When ctx is
+// cancelled before the server answers, the server is sent a
+// notifications/cancelled for the request and ErrRequestCancelled is
+// returned.
+func (s *MCPService) SendRequestWithContext(ctx context.Context, client string, server *MCPServer, request JSONRPCRequest) (*JSONRPCResponse, error) {
+	source := AuditSourceUnchecked
+	if !server.IsHTTP {
+		if err := s.handlePromptPermissions(request); err != nil {
+			return nil, err
+		}
+
+		permResponse, permSource, permErr := s.handleToolPermissions(request)
+		source = permSource
+		if permErr != nil {
+			s.metrics.denials.Inc(server.Name, toolCallName(request))
+			s.auditToolCall(client, server, request, source, permResponse, permErr, 0, true)
+			return permResponse, permErr
+		}
+
+		if s.DrunkMode && request.Method == "tools/call" {
+			s.ApplyDrunkMode(&request)
+		}
+	}
+
+	if request.Method != "tools/call" {
+		return s.forwardRequest(ctx, server, request)
+	}
+	start := time.Now()
+	response, err := s.forwardRequest(ctx, server, request)
+	elapsed := time.Since(start)
+	s.observeToolCall(server, request, response, err, elapsed)
+	s.auditToolCall(client, server, request, source, response, err, elapsed, false)
+	return response, err
+}
+
+// forwardRequest delivers an already authorized request to the server
+func (s *MCPService) forwardRequest(ctx context.Context, server *MCPServer, request JSONRPCRequest) (*JSONRPCResponse, error) {
 	if server.IsHTTP {
-		return s.sendHTTPRequest(server, request)
+		if err := s.checkCircuit(server); err != nil {
+			return nil, err
+		}
+		response, err := s.sendHTTPRequest(ctx, server, request)
+		s.recordResult(server, err)
+		return response, err
 	}
 
-	if err := s.handlePromptPermissions(request); err != nil {
+	if server.openapi != nil {
+		response := server.openapi.handle(request)
+		if request.Method == "tools/call" {
+			s.logToolCall(server, request, response)
+		}
+		return response, nil
+	}
+
+	if err := s.checkCircuit(server); err != nil {
+		return nil, err
+	}
+	response, err := s.sendStdio(ctx, server, request)
+	s.recordResult(server, err)
+	if err != nil {
 		return nil, err
 	}
 
-	permResponse, permErr := s.handleToolPermissions(request)
-	if permErr != nil {
-		return permResponse, permErr
+	if request.Method == "tools/call" {
+		s.logToolCall(server, request, response)
 	}
 
-	if s.DrunkMode && request.Method == "tools/call" {
-		s.ApplyDrunkMode(&request)
+	return response, nil
+}
+
+// sendStdio performs a request/response exchange with a stdio server.
+// Clients reuse ids, so the request is sent with an id unique to the
+// server and the response gets the id of the request back.
+func (s *MCPService) sendStdio(ctx context.Context, server *MCPServer, request JSONRPCRequest) (*JSONRPCResponse, error) {
+	if err := server.lockRequests(ctx); err != nil {
+		return nil, err
 	}
+	defer server.unlockRequests()
 
-	reqBytes, err := json.Marshal(request)
+	wire := request
+	if request.ID != nil {
+		server.stdioSeq++
+		wire.ID = server.stdioSeq
+	}
+	reqBytes, err := json.Marshal(wire)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
+	// Discard the responses that arrived after their request timed out
+	lines := server.stdoutLines
+	for drained := false; !drained; {
+		select {
+		case _, ok := <-lines:
+			drained = !ok
+		default:
+			drained = true
+		}
+	}
+
 	debugLog(s.DebugMode, "Sending JSONRPC request to server %s: %s", server.Name, string(reqBytes))
 
 	if err := s.sendStdioRequest(server, reqBytes); err != nil {
@@ -412,7 +580,13 @@ func (s *MCPService) SendRequest(server *MCPServer, request JSONRPCRequest) (*JS
 
 	debugLog(s.DebugMode, "Request sent to server %s, waiting for response", server.Name)
 
-	responseBytes, err := s.readStdioResponse(server)
+	responseBytes, err := s.readStdioResponse(ctx, server, lines, wire.ID)
+	if errors.Is(err, ErrRequestCancelled) {
+		// A late answer carries the id of this request, so the next
+		// request skips it
+		s.cancelServerRequest(ctx, server, wire)
+		return nil, err
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -433,21 +607,22 @@ func (s *MCPService) SendRequest(server *MCPServer, request JSONRPCRequest) (*JS
 		log.Printf("ERROR: Failed to unmarshal response from server %s: %v, raw response: %s", server.Name, err, string(responseBytes))
 		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
 	}
+	response.ID = request.ID
+	return &response, nil
+}
 
-	if request.Method == "tools/call" {
-		var toolParams CallToolParams
-		paramsBytes, _ := json.Marshal(request.Params)
-		json.Unmarshal(paramsBytes, &toolParams)
+// logToolCall logs an executed tool call and adds it to the report
+func (s *MCPService) logToolCall(server *MCPServer, request JSONRPCRequest, response *JSONRPCResponse) {
+	var toolParams CallToolParams
+	paramsBytes, _ := json.Marshal(request.Params)
+	json.Unmarshal(paramsBytes, &toolParams)
 
-		log.Printf("MCP tool executed - Server: %s, Tool: %s, Params: %s",
-			server.Name, toolParams.Name, string(paramsBytes))
+	log.Printf("MCP tool executed - Server: %s, Tool: %s, Params: %s",
+		server.Name, toolParams.Name, string(paramsBytes))
 
-		if s.reportEnabled {
-			s.addReportEntry(server.Name, toolParams.Name, toolParams.Arguments, response.Result, nil)
-		}
+	if s.reportEnabled {
+		s.addReportEntry(server.Name, toolParams.Name, toolParams.Arguments, response.Result, nil)
 	}
-
-	return &response, nil
 }
 
 // isToolAvailable checks if a tool is available in any server
@@ -0,0 +1,194 @@
+package wmcplib
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// TestStdioLateAnswerIsNotReturnedToNextRequest cancels a request and then
+// sends another one with the same client id. The stand-in server answers
+// the cancelled request late, right before answering the second one.
+func TestStdioLateAnswerIsNotReturnedToNextRequest(t *testing.T) {
+	stdin, serverIn := io.Pipe()
+	defer stdin.Close()
+	server := &MCPServer{Name: "slow", Stdin: serverIn, stdoutLines: make(chan []byte, 8)}
+	received := make(chan JSONRPCRequest, 8)
+	go func() {
+		var pending interface{}
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			var req JSONRPCRequest
+			if json.Unmarshal(scanner.Bytes(), &req) != nil {
+				continue
+			}
+			received <- req
+			switch req.Method {
+			case "slow":
+				pending = req.ID
+			case "fast":
+				for _, answer := range []map[string]interface{}{
+					{"jsonrpc": "2.0", "id": pending, "result": "late"},
+					{"jsonrpc": "2.0", "id": req.ID, "result": "fast"},
+				} {
+					line, _ := json.Marshal(answer)
+					server.stdoutLines <- line
+				}
+			}
+		}
+	}()
+
+	s := NewMCPService(Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+	_, err := s.sendStdio(ctx, server, JSONRPCRequest{JSONRPC: "2.0", Method: "slow", ID: 1})
+	if !errors.Is(err, ErrRequestCancelled) {
+		t.Fatalf("cancelled request error = %v", err)
+	}
+	if req := <-received; req.Method != "notifications/cancelled" {
+		t.Fatalf("server received %q after the cancel, want notifications/cancelled", req.Method)
+	}
+
+	done := make(chan *JSONRPCResponse, 1)
+	go func() {
+		response, err := s.sendStdio(context.Background(), server, JSONRPCRequest{JSONRPC: "2.0", Method: "fast", ID: 1})
+		if err != nil {
+			t.Errorf("request failed: %v", err)
+		}
+		done <- response
+	}()
+	select {
+	case response := <-done:
+		if response == nil || response.Result != "fast" {
+			t.Fatalf("response = %+v, want the answer to the second request", response)
+		}
+		if response.ID != 1 {
+			t.Fatalf("response id = %v, want the client id 1", response.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no response to the second request")
+	}
+}
+
+// silentServer returns a stdio server that reads its requests and never
+// answers them
+func silentServer(t *testing.T) *MCPServer {
+	stdin, serverIn := io.Pipe()
+	t.Cleanup(func() { stdin.Close() })
+	go io.Copy(io.Discard, stdin)
+	return &MCPServer{Name: "hung", Stdin: serverIn, stdoutLines: make(chan []byte)}
+}
+
+func TestHealthCheckOfHungServerFails(t *testing.T) {
+	s := NewMCPService(Options{})
+	server := silentServer(t)
+	done := make(chan struct{})
+	go func() {
+		s.pingServer(server, 50*time.Millisecond)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the health check of a hung server did not return")
+	}
+	if health := server.Health(); health.Failures != 1 || health.LastError == "" {
+		t.Fatalf("health = %+v, want a failure", health)
+	}
+}
+
+func TestHealthCheckWaitsForBusyServer(t *testing.T) {
+	s := NewMCPService(Options{})
+	server := silentServer(t)
+	if err := server.lockRequests(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.pingServer(server, 50*time.Millisecond)
+	if health := server.Health(); health.Failures != 0 {
+		t.Fatalf("health = %+v, a long request is not a failure", health)
+	}
+
+	// A request running for longer than hungRequestAfter is taken for hung
+	server.busySince.Store(time.Now().Add(-hungRequestAfter - time.Minute).UnixNano())
+	s.pingServer(server, 50*time.Millisecond)
+	if health := server.Health(); health.Failures != 1 {
+		t.Fatalf("health = %+v, want a failure", health)
+	}
+	server.unlockRequests()
+}
+
+// answeringServer returns a stdio server answering every request with an
+// empty result, and the channel receiving the methods of the requests
+func answeringServer(t *testing.T) (*MCPServer, <-chan string) {
+	stdin, serverIn := io.Pipe()
+	t.Cleanup(func() { stdin.Close() })
+	server := &MCPServer{Name: "files", Stdin: serverIn, stdoutLines: make(chan []byte, 8)}
+	methods := make(chan string, 8)
+	go func() {
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			var req JSONRPCRequest
+			if json.Unmarshal(scanner.Bytes(), &req) != nil {
+				continue
+			}
+			methods <- req.Method
+			line, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": map[string]interface{}{}})
+			server.stdoutLines <- line
+		}
+	}()
+	return server, methods
+}
+
+func TestResourceUpdatesOnlyReachSubscribers(t *testing.T) {
+	s := NewMCPService(Options{})
+	server, methods := answeringServer(t)
+	server.Resources = []Resource{{URI: "file:///a", Name: "a"}}
+	s.Servers[server.Name] = server
+	uri := server.Name + AggregatedNameSeparator + "file:///a"
+
+	subscribed, unsubscribe := s.SubscribeNotificationsFrom("a")
+	other, unsubscribeOther := s.SubscribeNotificationsFrom("b")
+	defer unsubscribeOther()
+	if err := s.SubscribeResource("a", uri); err != nil {
+		t.Fatal(err)
+	}
+	if method := <-methods; method != "resources/subscribe" {
+		t.Fatalf("server received %q, want resources/subscribe", method)
+	}
+
+	s.handleServerNotification(server, []byte(`{"jsonrpc":"2.0","method":"notifications/resources/updated","params":{"uri":"file:///a"}}`))
+	select {
+	case msg := <-subscribed:
+		if params, _ := msg.Params.(map[string]interface{}); params["uri"] != uri {
+			t.Fatalf("update = %+v, want the aggregated URI", msg)
+		}
+	default:
+		t.Fatal("the subscribed client got no update")
+	}
+	select {
+	case msg := <-other:
+		t.Fatalf("a client that did not subscribe got %+v", msg)
+	default:
+	}
+
+	// The session of the client ends
+	unsubscribe()
+	select {
+	case method := <-methods:
+		if method != "resources/unsubscribe" {
+			t.Fatalf("server received %q, want resources/unsubscribe", method)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the subscription was not released")
+	}
+	if err := s.UnsubscribeResource("a", uri); err == nil {
+		t.Fatal("the subscription of the client outlived its session")
+	}
+}
@@ -1,9 +1,14 @@
 package wmcplib
 
 import (
+	"context"
 	"io"
 	"os/exec"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	mcplib "mai/src/mcps/lib"
 )
 
 // JSONRPC structures
@@ -21,6 +26,13 @@ type JSONRPCResponse struct {
 	ID      interface{} `json:"id"`
 }
 
+// JSONRPCNotification is a JSON-RPC message that expects no response.
+type JSONRPCNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
 type RPCError struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
@@ -41,6 +53,7 @@ type Tool struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	InputSchema map[string]interface{} `json:"inputSchema"`
+	OutputSchema map[string]interface{} `json:"outputSchema,omitempty"`
 	Parameters  []ToolParameter        `json:"parameters,omitempty"`
 }
 
@@ -182,6 +195,19 @@ type ResourcesListResult struct {
 	Resources []Resource `json:"resources"`
 }
 
+// ResourceTemplate describes a family of resources addressed by an RFC 6570
+// URI template
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type ResourceTemplatesListResult struct {
+	ResourceTemplates []ResourceTemplate `json:"resourceTemplates"`
+}
+
 type ReadResourceParams struct {
 	URI string `json:"uri"`
 }
@@ -211,10 +237,14 @@ type MCPServer struct {
 	Stdin         io.WriteCloser
 	Stdout        io.ReadCloser
 	Stderr        io.ReadCloser
+	// stdoutLines carries the responses read from a stdio server
+	stdoutLines   chan []byte
 	Tools         []Tool
 	Prompts       []Prompt
 	Resources     []Resource
+	ResourceTemplates []ResourceTemplate
 	EnabledTools  map[string]bool
+	DisabledTools []string
 	UseSession    bool
 	SessionID     string
 	SSEURL        string
@@ -222,6 +252,22 @@ type MCPServer struct {
 	HasCapabilities   bool
 	SupportsPrompts   bool
 	SupportsResources bool
+	SupportsSubscribe bool
+	env           map[string]string
+	openapi       *openAPIBackend
+	// socket is the connection of WebSocket and Unix socket servers
+	socket        *mcplib.WebSocketConn
+	timeout       time.Duration
+	health        serverHealth
+	// requestSlot serializes the request/response exchanges on stdio, see
+	// lockRequests
+	requestSlot   chan struct{}
+	requestOnce   sync.Once
+	// busySince is the start in unix nanoseconds of the exchange holding
+	// requestSlot, zero when idle
+	busySince     atomic.Int64
+	// stdioSeq numbers the requests written to stdio, guarded by requestSlot
+	stdioSeq      int64
 	Mutex         sync.RWMutex
 	stderrDone    chan struct{}
 	stderrActive  bool
@@ -244,6 +290,10 @@ type MCPService struct {
 	DebugMode            bool
 	SessionMode          bool
 	ProxyToolsMode       bool
+	DefaultProfile       string
+	// FailureThreshold is the number of consecutive failures that mark a
+	// server degraded (DefaultFailureThreshold when zero)
+	FailureThreshold     int
 	prompter             Prompter
 	yoloToolNotFoundMode bool
 	toolPerms            map[string]ToolPermission
@@ -256,5 +306,23 @@ type MCPService struct {
 	reportLock           sync.RWMutex
 	sessionLock          sync.Mutex
 	sessionID            string
+	// clientNames maps the transport clients to the clientInfo they sent
+	// in their initialize request, guarded by sessionLock
+	clientNames map[string]string
 	shuttingDown         bool
+	// OAuthOpener presents the authorization URL to the user. When nil the
+	// URL is printed and opened in the default browser.
+	OAuthOpener func(authURL string) error
+	oauth       oauthState
+	metrics     *serviceMetrics
+	audit       *AuditLog
+	subscribers subscriberSet
+	// resourceSubs holds the resources subscribed by the clients
+	resourceSubs     map[string]*resourceSubscription
+	resourceSubsLock sync.Mutex
+	profiles     map[string]ProfileConfig
+	profilesLock sync.RWMutex
+	// clientRequests cancels the tool calls forwarded for the clients
+	clientRequests     map[string]context.CancelCauseFunc
+	clientRequestsLock sync.Mutex
 }
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	wmcplib "wmcplib"
 
@@ -19,6 +20,7 @@ import (
 func showHelp() {
 	fmt.Println(`Usage: mai-wmcp [options] "server1" "server2" ...
   Options:
+     -A FILE  Audit log of tool calls (default: ~/.config/mai/wmcp-audit.jsonl, 'off' disables)
      -b URL   Base URL to listen on (default: :8989)
      -c FILE  Path to config file (default: ~/.config/mai/mcps.json)
      -C JSON  Config as JSON string (alternative to -c)
@@ -30,9 +32,11 @@ func showHelp() {
      -k       Drunk mode (permissive tool matching and parameter assignment)
      -K DIR   Directory with cert.pem and key.pem for HTTPS (default: ~/.config/mai/wmcp-certs)
      -l URL   Listen URL with scheme, e.g. http://:8989 or https://:9999
+     -M       Enable the server management API (POST/DELETE/PATCH /servers) for local clients with a token
      -n       Skip loading config file
      -o FILE  Output report to FILE
      -p       Skip loading prompts (only expose tools)
+     -P NAME  Default tools profile for clients that do not select one
      -s       Enable session ID tracking (disabled by default to prevent SSE hijacking)
      -S       Serve MCP JSON-RPC over stdio instead of HTTP
      -t       Load MCP servers and list tools, prompts, and resources, then quit
@@ -47,7 +51,10 @@ func showHelp() {
     Config file: mai-wmcp -c /path/to/config.json
     Config JSON: mai-wmcp -C '{"mcpServers":{"myserver":{"type":"stdio","command":"mycommand"}}}'
     List mode: mai-wmcp -t "r2pm -r r2mcp" "timemcp"
-    HTTP/SSE servers use bearer auth from MAI_MCP_AUTH_<DOMAIN> env vars (domain sanitized)`)
+    Profiles: curl http://localhost:8989/p/coder/tools (or the X-Mai-Profile header)
+    HTTP/SSE servers use bearer auth from MAI_MCP_AUTH_<DOMAIN> env vars (domain sanitized)
+    or the OAuth authorization flow, with tokens stored in ~/.config/mai/mcp-oauth
+    The config file is watched and servers are started, stopped or restarted when it changes`)
 }
 
 func showVersion() {
@@ -217,6 +224,8 @@ func main() {
 
 	var config *wmcplib.Config
 	var configErr error
+	// watchPath is the config file the servers were loaded from, if any
+	watchPath := ""
 
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
@@ -273,12 +282,18 @@ func main() {
 
 		if configErr != nil || config == nil || len(config.MCPServers) == 0 {
 			config, configErr = wmcplib.LoadConfig(configPath)
-			if configErr != nil || config == nil || len(config.MCPServers) == 0 {
+			if configErr == nil && config != nil && len(config.MCPServers) > 0 {
+				watchPath = configPath
+				if watchPath == "" {
+					watchPath = wmcplib.DefaultConfigPath()
+				}
+			} else {
 				if configPath != "" {
 					if _, err := os.Stat(configPath); err == nil {
 						config, configErr = wmcplib.LoadMAIConfig(configPath)
 						if configErr == nil {
 							log.Printf("Loaded MAI config from %s", configPath)
+							watchPath = configPath
 						}
 					}
 				}
@@ -290,6 +305,7 @@ func main() {
 							config, configErr = wmcplib.LoadMAIConfig(maiConfigPath)
 							if configErr == nil {
 								log.Printf("Loaded config from %s", maiConfigPath)
+								watchPath = maiConfigPath
 							}
 						}
 					}
@@ -318,6 +334,12 @@ func main() {
 	noPromptsMode := false
 	sessionMode := false
 	proxyToolsMode := false
+	defaultProfile := ""
+	healthInterval := wmcplib.DefaultHealthCheckInterval
+	failureThreshold := 0
+	auditConfig := wmcplib.AuditConfig{}
+	manageAPI := false
+	configManageToken := ""
 	if config != nil {
 		yoloMode = config.MaiOptions.YoloMode
 		drunkMode = config.MaiOptions.DrunkMode
@@ -327,6 +349,14 @@ func main() {
 		noPromptsMode = config.MaiOptions.NoPrompts
 		sessionMode = config.MaiOptions.SessionMode
 		proxyToolsMode = config.MaiOptions.ProxyToolsMode
+		defaultProfile = config.MaiOptions.Profile
+		if config.MaiOptions.HealthCheckInterval != 0 {
+			healthInterval = time.Duration(config.MaiOptions.HealthCheckInterval) * time.Second
+		}
+		failureThreshold = config.MaiOptions.FailureThreshold
+		auditConfig = config.MaiOptions.Audit
+		manageAPI = config.MaiOptions.ManageAPI
+		configManageToken = config.MaiOptions.ManageToken
 	}
 
 	for i := 0; i < len(args); i++ {
@@ -385,6 +415,8 @@ func main() {
 				stdioMode = true
 			case "-x":
 				proxyToolsMode = true
+			case "-M":
+				manageAPI = true
 			case "-c":
 				i++
 			case "-C":
@@ -429,6 +461,25 @@ func main() {
 					showHelp()
 					os.Exit(1)
 				}
+			case "-P":
+				if i+1 < len(args) {
+					defaultProfile = args[i+1]
+					i++
+				} else {
+					fmt.Println("Error: -P requires a profile name")
+					showHelp()
+					os.Exit(1)
+				}
+			case "-A":
+				if i+1 < len(args) {
+					auditConfig.File = args[i+1]
+					auditConfig.Disabled = auditConfig.File == "off"
+					i++
+				} else {
+					fmt.Println("Error: -A requires a filename")
+					showHelp()
+					os.Exit(1)
+				}
 			case "-o":
 				if i+1 < len(args) {
 					outputReport = args[i+1]
@@ -474,16 +525,31 @@ func main() {
 		os.Exit(1)
 	}
 
+	var auditLog *wmcplib.AuditLog
+	if !toolsList {
+		var err error
+		auditLog, err = wmcplib.OpenAuditLog(auditConfig)
+		if err != nil {
+			log.Printf("Warning: audit log disabled: %v", err)
+		}
+		if auditLog != nil {
+			defer auditLog.Close()
+		}
+	}
+
 	service := wmcplib.NewMCPService(wmcplib.Options{
-		YoloMode:       yoloMode,
-		DrunkMode:      drunkMode,
-		ReportFile:     outputReport,
-		NoPrompts:      noPromptsMode,
-		NonInteractive: nonInteractiveMode,
-		SessionMode:    sessionMode,
-		DebugMode:      debugMode,
-		ProxyToolsMode: proxyToolsMode,
-		Prompter:       wmcplib.NewStdinPrompter(),
+		YoloMode:         yoloMode,
+		DrunkMode:        drunkMode,
+		ReportFile:       outputReport,
+		NoPrompts:        noPromptsMode,
+		NonInteractive:   nonInteractiveMode,
+		SessionMode:      sessionMode,
+		DebugMode:        debugMode,
+		ProxyToolsMode:   proxyToolsMode,
+		DefaultProfile:   defaultProfile,
+		FailureThreshold: failureThreshold,
+		AuditLog:         auditLog,
+		Prompter:         wmcplib.NewStdinPrompter(),
 	})
 
 	defer service.StopAllServers()
@@ -501,6 +567,11 @@ func main() {
 	if !skipConfig && config != nil && len(config.MCPServers) > 0 {
 		wmcplib.StartMCPServersFromConfig(service, config)
 	}
+	if defaultProfile != "" {
+		if _, err := service.ProfileTools(""); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
 	if len(service.Servers) == 0 {
 		if toolsList {
 			fmt.Println("Error: No MCP servers available to list")
@@ -515,20 +586,36 @@ func main() {
 		os.Exit(0)
 	}
 
+	if !skipConfig && watchPath != "" {
+		go service.WatchConfig(watchPath, config, 2*time.Second, nil)
+	}
+	if healthInterval > 0 {
+		go service.RunHealthChecks(healthInterval, nil)
+	}
+
 	if stdioMode {
 		runStdioBridge(service)
 		return
 	}
 
-	router := mux.NewRouter()
+	// Resource URIs in the paths keep their "scheme://" double slash
+	router := mux.NewRouter().SkipClean(true)
 
 	registerMCPRoutes(router, service)
+	token := ""
+	if manageAPI {
+		var generated bool
+		token, generated = manageToken(configManageToken)
+		if generated {
+			log.Printf("Server management API enabled, authenticate with: Authorization: Bearer %s", token)
+		} else {
+			log.Printf("Server management API enabled")
+		}
+	}
+	registerServerRoutes(router, service, token)
 
-	router.HandleFunc("/tools", listToolsHandler(service)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/tools/json", jsonToolsHandler(service)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/tools/quiet", quietToolsHandler(service)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/tools/simple", simpleToolsHandler(service)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/tools/markdown", markdownToolsHandler(service)).Methods("GET", "OPTIONS")
+	registerToolRoutes(router, service)
+	registerToolRoutes(router.PathPrefix("/p/{profile}").Subrouter(), service)
 
 	router.HandleFunc("/prompts", listPromptsHandler(service)).Methods("GET")
 	router.HandleFunc("/prompts/json", jsonPromptsHandler(service)).Methods("GET")
@@ -538,17 +625,16 @@ func main() {
 
 	router.HandleFunc("/resources", listResourcesHandler(service)).Methods("GET")
 	router.HandleFunc("/resources/json", jsonResourcesHandler(service)).Methods("GET")
-	router.HandleFunc("/resources/{server}/{uri}", readResourceHandler(service)).Methods("GET")
+	router.HandleFunc("/resources/templates", jsonResourceTemplatesHandler(service)).Methods("GET")
+	router.HandleFunc("/resources/{server}/{uri:.+}", readResourceHandler(service)).Methods("GET")
 
 	router.HandleFunc("/status", statusHandler(service)).Methods("GET")
+	router.HandleFunc("/status/json", jsonStatusHandler(service)).Methods("GET")
+	router.Handle("/metrics", service.Metrics()).Methods("GET")
+	router.HandleFunc("/audit", auditHandler(service)).Methods("GET")
 
 	router.HandleFunc("/openapi.json", openapiHandler(service)).Methods("GET", "OPTIONS")
 
-	router.HandleFunc("/tools/{server}/{tool}", callToolHandler(service)).Methods("GET", "POST", "OPTIONS")
-	router.HandleFunc("/call/{tool}", callToolHandler(service)).Methods("GET", "POST", "OPTIONS")
-	router.HandleFunc("/call/{server}/{tool}", callToolHandler(service)).Methods("GET", "POST", "OPTIONS")
-	router.HandleFunc("/v1/tool/{tool}", callToolHandler(service)).Methods("GET", "POST", "OPTIONS")
-
 	router.HandleFunc("/", rootHandler).Methods("GET")
 
 	if envBaseURL := os.Getenv("MAI_WMCP_BASEURL"); envBaseURL != "" {
@@ -581,6 +667,21 @@ func main() {
 	}
 }
 
+// registerToolRoutes registers the tool listing and calling endpoints. They
+// are mounted both at the root and under /p/{profile}.
+func registerToolRoutes(router *mux.Router, service *wmcplib.MCPService) {
+	router.HandleFunc("/tools", listToolsHandler(service)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/tools/json", jsonToolsHandler(service)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/tools/quiet", quietToolsHandler(service)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/tools/simple", simpleToolsHandler(service)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/tools/markdown", markdownToolsHandler(service)).Methods("GET", "OPTIONS")
+
+	router.HandleFunc("/tools/{server}/{tool}", callToolHandler(service)).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/call/{tool}", callToolHandler(service)).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/call/{server}/{tool}", callToolHandler(service)).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/v1/tool/{tool}", callToolHandler(service)).Methods("GET", "POST", "OPTIONS")
+}
+
 func resolveTLSCerts(certDir string) (string, string, error) {
 	if certDir == "" {
 		if env := os.Getenv("MAI_WMCP_CERTDIR"); env != "" {
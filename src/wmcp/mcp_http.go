@@ -2,10 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	wmcplib "wmcplib"
 
@@ -14,10 +16,16 @@ import (
 
 // registerMCPRoutes registers the single JSON-RPC endpoint used by MCP
 // clients (the bridge exposes a single aggregated view of all child servers).
+//
+// Clients select a profile with the /p/{profile}/mcp endpoint or the
+// X-Mai-Profile header.
 func registerMCPRoutes(router *mux.Router, service *wmcplib.MCPService) {
 	handler := mcpJSONRPCHandler(service)
 	router.HandleFunc("/", handler).Methods("POST", "OPTIONS")
 	router.HandleFunc("/mcp", handler).Methods("POST", "OPTIONS")
+	router.HandleFunc("/mcp", mcpEventStreamHandler(service)).Methods("GET")
+	router.HandleFunc("/p/{profile}/mcp", handler).Methods("POST", "OPTIONS")
+	router.HandleFunc("/p/{profile}/mcp", mcpEventStreamHandler(service)).Methods("GET")
 }
 
 func writeJSONRPCResponse(w http.ResponseWriter, sessionID string, resp *wmcplib.JSONRPCResponse) {
@@ -86,7 +94,7 @@ func mcpJSONRPCHandler(service *wmcplib.MCPService) http.HandlerFunc {
 			return
 		}
 
-		response, notification := service.ProcessMCPRequest(request)
+		response, notification := service.ProcessMCPRequestFrom(request, requestProfile(r), requestClient(r))
 		if notification {
 			if sessionID != "" {
 				w.Header().Set("Mcp-Session-Id", sessionID)
@@ -107,6 +115,56 @@ func mcpJSONRPCHandler(service *wmcplib.MCPService) http.HandlerFunc {
 	}
 }
 
+// mcpEventStreamHandler serves the optional GET stream of the Streamable
+// HTTP transport, used to push server notifications such as
+// notifications/tools/list_changed to the client.
+func mcpEventStreamHandler(service *wmcplib.MCPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w)
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		notifications, unsubscribe := service.SubscribeNotificationsFrom(requestClient(r))
+		defer unsubscribe()
+
+		if service.SessionMode {
+			w.Header().Set("Mcp-Session-Id", service.EnsureSessionID())
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(30 * time.Second)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+					return
+				}
+			case msg, ok := <-notifications:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(msg)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", data); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
 // rootHandler serves the human-readable help page at "/".
 func rootHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("HTTP %s %s", r.Method, r.URL.String())
@@ -125,7 +183,11 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 Available endpoints:
 
 - POST /mcp - Streamable HTTP MCP endpoint
+- GET /mcp - Event stream with server notifications (tools/list_changed, ...)
 - GET /status - Service status
+- GET /status/json - Server health states and last errors in JSON format
+- GET /metrics - Prometheus metrics (tool calls, latencies, errors, denials, restarts)
+- GET /audit?tool=&since= - Query the audit log of tool calls and permission decisions
 - GET /tools - List all available tools
 - GET /tools/json - List all available tools in JSON format
 - GET /tools/quiet - List all tools in minimal format
@@ -149,7 +211,19 @@ Available endpoints:
  Resources endpoints:
  - GET /resources - List all available resources
  - GET /resources/json - List all available resources in JSON format
- - GET /resources/{server}/{uri} - Read a resource by URI from a server
+ - GET /resources/templates - List the resource templates of every server in JSON format
+ - GET /resources/{server}/{uri} - Read a resource by URI (or template expansion) from a server
+
+ Profiles:
+ - /p/{profile}/mcp, /p/{profile}/tools/..., /p/{profile}/call/... - Same endpoints restricted to a profile
+ - The X-Mai-Profile header selects a profile on the regular endpoints
+
+ Servers endpoints (all but GET need -M, a local client and the management token):
+ - GET /servers - List running servers in JSON format
+ - POST /servers - Start a server from a JSON config entry ({"name":..., "type":..., "command":...})
+ - DELETE /servers/{name} - Stop and remove a server
+ - POST /servers/{name}/restart - Restart a server
+ - PATCH /servers/{name}/tools - Update the tool filter ({"tool":true|false|null}, false adds to disabledTools)
 
  Examples:
  - curl http://localhost:8989/tools
@@ -162,6 +236,8 @@ Available endpoints:
  - curl http://localhost:8989/prompts/json
  - curl http://localhost:8989/prompts/server1/myPrompt?topic=xyz
  - curl -X POST http://localhost:8989/prompts/server1/myPrompt -H "Content-Type: application/json" -d '{"topic":"xyz"}'
+ - curl -X POST http://localhost:8989/servers -H "Authorization: Bearer $TOKEN" -H "Content-Type: application/json" -d '{"name":"time","type":"stdio","command":"mai-mcp-time"}'
+ - curl -X PATCH http://localhost:8989/servers/time/tools -H "Authorization: Bearer $TOKEN" -H "Content-Type: application/json" -d '{"get_time":false}'
 `
 	w.Write([]byte(usage))
 }
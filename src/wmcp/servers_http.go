@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	wmcplib "wmcplib"
+
+	"github.com/gorilla/mux"
+)
+
+// addServerRequest is the body accepted by POST /servers: a config entry
+// like the ones found in mcps.json plus the server name.
+type addServerRequest struct {
+	Name string `json:"name"`
+	wmcplib.MCPServerConfig
+}
+
+// serverInfo describes a running server in GET /servers
+type serverInfo struct {
+	Name      string          `json:"name"`
+	Command   string          `json:"command"`
+	Tools     int             `json:"tools"`
+	Prompts   int             `json:"prompts"`
+	Resources int             `json:"resources"`
+	Filter    map[string]bool `json:"filter,omitempty"`
+	Disabled  []string        `json:"disabledTools,omitempty"`
+	State     string          `json:"state"`
+	LastError string          `json:"lastError,omitempty"`
+}
+
+// manageTokenEnv sets the token of the server management API
+const manageTokenEnv = "MAI_WMCP_MANAGE_TOKEN"
+
+// manageToken returns the token required by the server management API: the
+// one from the environment or the config, or a random one that is reported
+// as generated.
+func manageToken(configured string) (string, bool) {
+	if token := os.Getenv(manageTokenEnv); token != "" {
+		return token, false
+	}
+	if configured != "" {
+		return configured, false
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Failed to generate the management token: %v", err)
+	}
+	return hex.EncodeToString(b), true
+}
+
+// registerServerRoutes registers the endpoints used to manage the child
+// servers at runtime. Listing the servers is always possible, but starting,
+// stopping and reconfiguring them runs arbitrary commands, so those routes
+// only exist when a management token is given.
+func registerServerRoutes(router *mux.Router, service *wmcplib.MCPService, token string) {
+	router.HandleFunc("/servers", listServersHandler(service)).Methods("GET", "OPTIONS")
+	if token == "" {
+		return
+	}
+	router.HandleFunc("/servers", requireManageAccess(token, addServerHandler(service))).Methods("POST")
+	router.HandleFunc("/servers/{name}", requireManageAccess(token, deleteServerHandler(service))).Methods("DELETE")
+	router.HandleFunc("/servers/{name}/restart", requireManageAccess(token, restartServerHandler(service))).Methods("POST")
+	router.HandleFunc("/servers/{name}/tools", requireManageAccess(token, patchServerToolsHandler(service))).Methods("PATCH")
+}
+
+// requireManageAccess only lets loopback clients presenting the management
+// token through. Like the mcplib HTTP transport, requests with a body must
+// be JSON, so web pages cannot send them without a CORS preflight, which
+// these routes never answer.
+func requireManageAccess(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			log.Printf("HTTP %s %s rejected: client %s is not local", r.Method, r.URL.String(), r.RemoteAddr)
+			writeJSONError(w, http.StatusForbidden, "Server management is only allowed from localhost")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			log.Printf("HTTP %s %s rejected: invalid management token", r.Method, r.URL.String())
+			writeJSONError(w, http.StatusUnauthorized, "Invalid or missing management token")
+			return
+		}
+		if r.Method == http.MethodPost || r.Method == http.MethodPatch {
+			if !strings.HasPrefix(strings.ToLower(r.Header.Get("Content-Type")), "application/json") {
+				writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("ERROR: failed to write JSON response: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func serverExists(s *wmcplib.MCPService, name string) bool {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+	_, ok := s.Servers[name]
+	return ok
+}
+
+func listServersHandler(s *wmcplib.MCPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		log.Printf("HTTP %s %s", r.Method, r.URL.String())
+
+		names, servers := s.SnapshotServers()
+		sort.Strings(names)
+		infos := make([]serverInfo, 0, len(names))
+		for _, name := range names {
+			server := servers[name]
+			health := server.Health()
+			server.Mutex.RLock()
+			info := serverInfo{
+				Name:      name,
+				Command:   server.Command,
+				Tools:     len(server.Tools),
+				Prompts:   len(server.Prompts),
+				Resources: len(server.Resources),
+				State:     string(health.State),
+				LastError: health.LastError,
+			}
+			server.Mutex.RUnlock()
+			info.Filter, info.Disabled, _ = s.ServerTools(name)
+			infos = append(infos, info)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"servers": infos})
+	}
+}
+
+func addServerHandler(s *wmcplib.MCPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("HTTP %s %s", r.Method, r.URL.String())
+
+		var req addServerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid JSON in request body")
+			return
+		}
+		if req.Name == "" {
+			writeJSONError(w, http.StatusBadRequest, "Server name is required")
+			return
+		}
+		if req.Type == "" {
+			if req.URL != "" {
+				req.Type = "http"
+			} else {
+				req.Type = "stdio"
+			}
+		}
+		if err := req.Validate(req.Name); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := s.AddServer(req.Name, req.MCPServerConfig); err != nil {
+			writeJSONError(w, http.StatusBadGateway, fmt.Sprintf("Failed to start server: %v", err))
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"status": "started", "name": req.Name})
+	}
+}
+
+func deleteServerHandler(s *wmcplib.MCPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("HTTP %s %s", r.Method, r.URL.String())
+
+		name := mux.Vars(r)["name"]
+		if err := s.StopServer(name); err != nil {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("Server '%s' not found", name))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "stopped", "name": name})
+	}
+}
+
+func restartServerHandler(s *wmcplib.MCPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("HTTP %s %s", r.Method, r.URL.String())
+
+		name := mux.Vars(r)["name"]
+		if !serverExists(s, name) {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("Server '%s' not found", name))
+			return
+		}
+		if err := s.RestartServer(name); err != nil {
+			writeJSONError(w, http.StatusBadGateway, fmt.Sprintf("Failed to restart server: %v", err))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "restarted", "name": name})
+	}
+}
+
+// patchServerToolsHandler updates the tool filter of a server using JSON
+// merge patch semantics: {"tool": true} enables a tool, {"tool": false}
+// disables it and {"tool": null} removes the tool from the allow list and
+// the disabled tools. Disabling a tool never turns the filter into an
+// allow list, so the other tools stay exposed.
+func patchServerToolsHandler(s *wmcplib.MCPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("HTTP %s %s", r.Method, r.URL.String())
+
+		name := mux.Vars(r)["name"]
+		var patch map[string]*bool
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid JSON in request body")
+			return
+		}
+		tools, disabled, err := s.ServerTools(name)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("Server '%s' not found", name))
+			return
+		}
+		for tool, enabled := range patch {
+			disabled = removeString(disabled, tool)
+			switch {
+			case enabled == nil:
+				delete(tools, tool)
+			case *enabled:
+				if len(tools) > 0 {
+					tools[tool] = true
+				}
+			default:
+				delete(tools, tool)
+				disabled = append(disabled, tool)
+			}
+		}
+		sort.Strings(disabled)
+		if err := s.SetServerTools(name, tools, disabled); err != nil {
+			writeJSONError(w, http.StatusBadGateway, fmt.Sprintf("Failed to reload tools: %v", err))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"name": name, "tools": tools, "disabledTools": disabled})
+	}
+}
+
+// removeString returns list without the occurrences of value
+func removeString(list []string, value string) []string {
+	out := list[:0]
+	for _, v := range list {
+		if v != value {
+			out = append(out, v)
+		}
+	}
+	return out
+}
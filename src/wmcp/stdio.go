@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"sync"
 
 	wmcplib "wmcplib"
 )
@@ -24,7 +25,30 @@ func runStdioBridge(service *wmcplib.MCPService) {
 	scanner.Buffer(buf, 10*1024*1024)
 
 	writer := bufio.NewWriter(os.Stdout)
-	defer writer.Flush()
+	var writeLock sync.Mutex
+	defer func() {
+		writeLock.Lock()
+		writer.Flush()
+		writeLock.Unlock()
+	}()
+
+	// Forward server notifications (e.g. tools/list_changed after a config
+	// reload) interleaved with the responses.
+	notifications, unsubscribe := service.SubscribeNotifications()
+	defer unsubscribe()
+	go func() {
+		for msg := range notifications {
+			data, err := json.Marshal(msg)
+			if err != nil {
+				continue
+			}
+			writeLock.Lock()
+			writer.Write(data)
+			writer.WriteByte('\n')
+			writer.Flush()
+			writeLock.Unlock()
+		}
+	}()
 
 	for scanner.Scan() {
 		line := scanner.Bytes()
@@ -39,9 +63,11 @@ func runStdioBridge(service *wmcplib.MCPService) {
 				Error:   wmcplib.RPCError{Code: -32700, Message: "invalid json"},
 			}
 			data, _ := json.Marshal(errResp)
+			writeLock.Lock()
 			writer.Write(data)
 			writer.WriteByte('\n')
 			writer.Flush()
+			writeLock.Unlock()
 			continue
 		}
 
@@ -58,14 +84,17 @@ func runStdioBridge(service *wmcplib.MCPService) {
 			log.Printf("stdio bridge: failed to marshal response: %v", err)
 			continue
 		}
-		if _, err := writer.Write(data); err != nil {
-			log.Printf("stdio bridge: write error: %v", err)
-			return
+		writeLock.Lock()
+		_, err = writer.Write(data)
+		if err == nil {
+			err = writer.WriteByte('\n')
 		}
-		if err := writer.WriteByte('\n'); err != nil {
-			return
+		if err == nil {
+			err = writer.Flush()
 		}
-		if err := writer.Flush(); err != nil {
+		writeLock.Unlock()
+		if err != nil {
+			log.Printf("stdio bridge: write error: %v", err)
 			return
 		}
 	}